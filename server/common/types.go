@@ -3,4 +3,7 @@ package common
 type UserInf struct {
 	Name    string
 	RootDir string
+	// Quota is the amount of bytes the user is allowed to store, 0 means unlimited.
+	// It is read from the database, tokens don't carry it
+	Quota int64
 }
@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS quota BIGINT NOT NULL DEFAULT 0;
\ No newline at end of file
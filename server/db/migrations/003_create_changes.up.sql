@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS changes (
+    id BIGSERIAL PRIMARY KEY,
+    user_name VARCHAR(255) NOT NULL,
+    type VARCHAR(16) NOT NULL,
+    path TEXT NOT NULL,
+    old_path TEXT NOT NULL DEFAULT '',
+    is_dir BOOLEAN NOT NULL DEFAULT FALSE,
+    created TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS changes_user_name_id ON changes (user_name, id);
+CREATE TABLE IF NOT EXISTS changes_horizon (
+    id BIGINT NOT NULL
+);
+INSERT INTO changes_horizon (id) SELECT 0 WHERE NOT EXISTS (SELECT 1 FROM changes_horizon);
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS share_links (
+    token VARCHAR(64) PRIMARY KEY,
+    user_name VARCHAR(255) NOT NULL REFERENCES users (name) ON DELETE CASCADE,
+    path TEXT NOT NULL,
+    is_dir BOOLEAN NOT NULL DEFAULT FALSE,
+    mode VARCHAR(16) NOT NULL,
+    hashed_password TEXT NOT NULL DEFAULT '',
+    expires TIMESTAMPTZ,
+    max_downloads INTEGER NOT NULL DEFAULT 0,
+    downloads INTEGER NOT NULL DEFAULT 0,
+    created TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS share_links_user_name ON share_links (user_name);
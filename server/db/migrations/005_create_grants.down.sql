@@ -0,0 +1,2 @@
+DROP TABLE grants;
+DROP TABLE user_groups;
\ No newline at end of file
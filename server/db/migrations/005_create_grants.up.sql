@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS user_groups (
+    group_name VARCHAR(255) NOT NULL,
+    user_name VARCHAR(255) NOT NULL REFERENCES users (name) ON DELETE CASCADE,
+    PRIMARY KEY (group_name, user_name)
+);
+CREATE TABLE IF NOT EXISTS grants (
+    id BIGSERIAL PRIMARY KEY,
+    owner VARCHAR(255) NOT NULL REFERENCES users (name) ON DELETE CASCADE,
+    path TEXT NOT NULL,
+    grantee VARCHAR(255) NOT NULL,
+    grantee_type VARCHAR(16) NOT NULL,
+    permission VARCHAR(16) NOT NULL,
+    created TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (owner, path, grantee, grantee_type)
+);
+CREATE INDEX IF NOT EXISTS grants_grantee ON grants (grantee_type, grantee);
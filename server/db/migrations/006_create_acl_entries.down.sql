@@ -0,0 +1 @@
+DROP TABLE acl_entries;
\ No newline at end of file
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS acl_entries (
+    id BIGSERIAL PRIMARY KEY,
+    principal VARCHAR(255) NOT NULL,
+    principal_type VARCHAR(16) NOT NULL,
+    path_prefix TEXT NOT NULL,
+    actions TEXT NOT NULL,
+    created TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS acl_entries_principal ON acl_entries (principal_type, principal);
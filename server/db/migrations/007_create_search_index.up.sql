@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS search_index (
+    user_name VARCHAR(255) NOT NULL REFERENCES users (name) ON DELETE CASCADE,
+    path TEXT NOT NULL,
+    name TEXT NOT NULL,
+    ext TEXT NOT NULL DEFAULT '',
+    is_dir BOOLEAN NOT NULL DEFAULT FALSE,
+    size BIGINT NOT NULL DEFAULT 0,
+    modified TIMESTAMPTZ NOT NULL,
+    content TEXT NOT NULL DEFAULT '',
+    PRIMARY KEY (user_name, path)
+);
+CREATE INDEX IF NOT EXISTS search_index_ext ON search_index (user_name, ext);
@@ -0,0 +1 @@
+DROP TABLE upload_type_rules;
\ No newline at end of file
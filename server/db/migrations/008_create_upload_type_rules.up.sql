@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS upload_type_rules (
+    id BIGSERIAL PRIMARY KEY,
+    principal VARCHAR(255) NOT NULL,
+    principal_type VARCHAR(16) NOT NULL,
+    allow TEXT NOT NULL DEFAULT '',
+    deny TEXT NOT NULL DEFAULT '',
+    created TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS upload_type_rules_principal ON upload_type_rules (principal_type, principal);
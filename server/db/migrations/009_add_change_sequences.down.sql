@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS changes_horizon (
+    id BIGINT NOT NULL
+);
+INSERT INTO changes_horizon (id) SELECT COALESCE(MAX(horizon), 0) FROM change_sequences;
+CREATE INDEX IF NOT EXISTS changes_user_name_id ON changes (user_name, id);
+DROP INDEX IF EXISTS changes_user_name_seq;
+ALTER TABLE changes DROP COLUMN seq;
+DROP TABLE change_sequences;
\ No newline at end of file
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS change_sequences (
+    user_name VARCHAR(255) PRIMARY KEY,
+    seq BIGINT NOT NULL DEFAULT 0,
+    horizon BIGINT NOT NULL DEFAULT 0
+);
+ALTER TABLE changes ADD COLUMN IF NOT EXISTS seq BIGINT;
+UPDATE changes SET seq=id WHERE seq IS NULL;
+ALTER TABLE changes ALTER COLUMN seq SET NOT NULL;
+INSERT INTO change_sequences (user_name, seq, horizon)
+    SELECT user_name, MAX(seq), (SELECT COALESCE(MAX(id), 0) FROM changes_horizon) FROM changes GROUP BY user_name
+    ON CONFLICT DO NOTHING;
+CREATE UNIQUE INDEX IF NOT EXISTS changes_user_name_seq ON changes (user_name, seq);
+DROP INDEX IF EXISTS changes_user_name_id;
+DROP TABLE IF EXISTS changes_horizon;
@@ -1,6 +1,9 @@
 package db
 
-import "remote-storage/server/common"
+import (
+	"remote-storage/server/common"
+	"time"
+)
 
 type StorageDatabase interface {
 	Connect(user, password, dbname, host string) error
@@ -8,4 +11,179 @@ type StorageDatabase interface {
 	GetUser(name string) (common.UserInf, error)
 	CreateUser(name, password, rootDir string) error
 	GetHashedPassword(name string) (string, error)
+	SetQuota(name string, quota int64) error
+
+	// AddChange records the change in the journal and returns its sequence number.
+	// Changes of every user are numbered one by one in the order they become visible,
+	// so the change with the greater number is never seen before the one with the smaller number.
+	AddChange(change Change) (int64, error)
+	// GetChanges returns at most limit changes of the user recorded after the change with the number since
+	GetChanges(user string, since int64, limit int) ([]Change, error)
+	// GetChangesState returns the number of the last recorded change of the user
+	// and the number of the last removed one, changes up to the latter may be missing
+	GetChangesState(user string) (last, horizon int64, err error)
+	// DeleteChangesBefore removes changes recorded before the time
+	DeleteChangesBefore(before time.Time) error
+
+	CreateShareLink(link ShareLink) error
+	// GetShareLink returns sql.ErrNoRows if there is no link with the token
+	GetShareLink(token string) (ShareLink, error)
+	GetShareLinks(user string) ([]ShareLink, error)
+	// DeleteShareLink returns sql.ErrNoRows if the user has no link with the token
+	DeleteShareLink(user, token string) error
+	// CountShareLinkDownload increments the downloads of the link and reports
+	// whether the download is allowed by the maximal amount of downloads
+	CountShareLinkDownload(token string) (bool, error)
+
+	AddUserToGroup(group, user string) error
+	// GetGroupMembers returns the members of all groups ordered by group and user
+	GetGroupMembers() ([]GroupMember, error)
+	// RemoveUserFromGroup returns sql.ErrNoRows if the user is not in the group
+	RemoveUserFromGroup(group, user string) error
+	// CreateGrant stores the grant and returns its id,
+	// the permission of the existing grant of the same path to the same grantee is replaced
+	CreateGrant(grant Grant) (int64, error)
+	// GetGrant returns sql.ErrNoRows if there is no grant with the id
+	GetGrant(id int64) (Grant, error)
+	// GetGrantsByOwner returns the grants of the files of the owner
+	GetGrantsByOwner(owner string) ([]Grant, error)
+	// GetGrantsFor returns the grants to the user and to the groups of the user
+	GetGrantsFor(user string) ([]Grant, error)
+	DeleteGrant(id int64) error
+	// MoveGrants updates the grants of the path and of the nested paths of the owner
+	// after the path is moved to newPath
+	MoveGrants(owner, oldPath, newPath string) error
+
+	// CreateACLEntry stores the entry and returns its id
+	CreateACLEntry(entry ACLEntry) (int64, error)
+	GetACLEntries() ([]ACLEntry, error)
+	// GetACLEntriesFor returns the entries of the user and of the groups of the user
+	GetACLEntriesFor(user string) ([]ACLEntry, error)
+	// DeleteACLEntry returns sql.ErrNoRows if there is no entry with the id
+	DeleteACLEntry(id int64) error
+
+	// PutIndexEntries adds the files to the search index replacing the existing entries of the same paths
+	PutIndexEntries(entries []IndexEntry) error
+	// DeleteIndexEntries removes the file and the nested files of the user from the search index,
+	// the empty path removes all files of the user
+	DeleteIndexEntries(user, path string) error
+	// MoveIndexEntries updates the entries of the file and of the nested files after the file is moved to newPath,
+	// the name and the extension of the moved file are taken from newPath
+	MoveIndexEntries(user, oldPath, newPath string) error
+	// SearchIndex returns the entries matching the query ordered by path, Content of the entries is not returned
+	SearchIndex(query IndexQuery) ([]IndexEntry, error)
+
+	// CreateUploadTypeRule stores the rule and returns its id
+	CreateUploadTypeRule(rule UploadTypeRule) (int64, error)
+	GetUploadTypeRules() ([]UploadTypeRule, error)
+	// GetUploadTypeRulesFor returns the rules of the user and of the groups of the user
+	GetUploadTypeRulesFor(user string) ([]UploadTypeRule, error)
+	// DeleteUploadTypeRule returns sql.ErrNoRows if there is no rule with the id
+	DeleteUploadTypeRule(id int64) error
+}
+
+// Change is the change of the files of the user recorded in the journal
+type Change struct {
+	// Seq is the sequence number of the change among the changes of the user
+	Seq  int64
+	User string
+	// Type is one of created, modified, moved and deleted
+	Type string
+	Path string
+	// OldPath is the previous path of the moved file
+	OldPath string
+	IsDir   bool
+	Created time.Time
+}
+
+// ShareLink gives access to the file or the directory of the user without authentication
+type ShareLink struct {
+	Token string
+	User  string
+	// Path is relative to the root directory of the user
+	Path  string
+	IsDir bool
+	// Mode is read or upload
+	Mode           string
+	HashedPassword string
+	// Expires is zero if the link never expires
+	Expires time.Time
+	// MaxDownloads is 0 if downloads are unlimited
+	MaxDownloads int
+	Downloads    int
+	Created      time.Time
+}
+
+// Grant gives another user or the group access to the file or the directory of the owner
+type Grant struct {
+	ID    int64
+	Owner string
+	// Path is relative to the root directory of the owner
+	Path    string
+	Grantee string
+	// GranteeType is user or group
+	GranteeType string
+	// Permission is read, write or manage
+	Permission string
+	Created    time.Time
+}
+
+// GroupMember is the user belonging to the group
+type GroupMember struct {
+	Group string
+	User  string
+}
+
+// ACLEntry allows the user or the group the actions with the files at the path prefix
+type ACLEntry struct {
+	ID        int64
+	Principal string
+	// PrincipalType is user or group
+	PrincipalType string
+	// PathPrefix is relative to the root directory of the user
+	PathPrefix string
+	Actions    []string
+	Created    time.Time
+}
+
+// UploadTypeRule restricts the MIME types of the files the user or the group uploads
+type UploadTypeRule struct {
+	ID        int64
+	Principal string
+	// PrincipalType is user or group
+	PrincipalType string
+	// Allow and Deny are the patterns of MIME types such as "image/png" or "image/*"
+	Allow   []string
+	Deny    []string
+	Created time.Time
+}
+
+// IndexEntry is the file of the user in the search index
+type IndexEntry struct {
+	User string
+	// Path is relative to the root directory of the user
+	Path string
+	Name string
+	// Ext is the extension of the name in lower case including the dot
+	Ext      string
+	IsDir    bool
+	Size     int64
+	Modified time.Time
+	// Content is the beginning of the text file in lower case, empty for other files
+	Content string
+}
+
+// IndexQuery selects the entries of the search index of the user, zero fields don't restrict the search
+type IndexQuery struct {
+	User string
+	// PathPrefix is the directory the nested files of which are searched
+	PathPrefix string
+	Ext        string
+	MinSize    int64
+	MaxSize    int64
+	// ModifiedAfter and ModifiedBefore are inclusive
+	ModifiedAfter  time.Time
+	ModifiedBefore time.Time
+	// Content is the text in lower case the content must contain
+	Content string
 }
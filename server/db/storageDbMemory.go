@@ -0,0 +1,494 @@
+package db
+
+import (
+	"database/sql"
+	"path"
+	"remote-storage/server/common"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StorageDatabaseMemory keeps the data in memory, it is used when no database is configured
+// and the data doesn't have to survive the restart or to be shared between instances
+type StorageDatabaseMemory struct {
+	mu             sync.Mutex
+	users          map[string]memoryUser
+	changes        []Change
+	changeStates   map[string]changeState
+	shareLinks     map[string]ShareLink
+	groups         map[string]map[string]bool
+	grants         []Grant
+	lastGrantID    int64
+	aclEntries     []ACLEntry
+	lastACLEntryID int64
+	index          map[string]map[string]IndexEntry
+	uploadRules    []UploadTypeRule
+	lastRuleID     int64
+}
+
+// changeState keeps the sequence numbers of the last recorded and the last removed changes of the user
+type changeState struct {
+	last, horizon int64
+}
+
+type memoryUser struct {
+	inf            common.UserInf
+	hashedPassword string
+}
+
+func NewStorageDatabaseMemory() *StorageDatabaseMemory {
+	return &StorageDatabaseMemory{
+		users:        make(map[string]memoryUser),
+		shareLinks:   make(map[string]ShareLink),
+		groups:       make(map[string]map[string]bool),
+		changeStates: make(map[string]changeState),
+		index:        make(map[string]map[string]IndexEntry),
+	}
+}
+
+func (s *StorageDatabaseMemory) Connect(user, password, dbname, host string) error {
+	return nil
+}
+
+func (s *StorageDatabaseMemory) GetUsers() ([]common.UserInf, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var res []common.UserInf
+	for _, user := range s.users {
+		res = append(res, user.inf)
+	}
+	return res, nil
+}
+
+func (s *StorageDatabaseMemory) GetUser(name string) (common.UserInf, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, ok := s.users[name]
+	if !ok {
+		return common.UserInf{}, sql.ErrNoRows
+	}
+	return user.inf, nil
+}
+
+func (s *StorageDatabaseMemory) CreateUser(name, password, rootDir string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users[name] = memoryUser{
+		inf: common.UserInf{
+			Name:    name,
+			RootDir: rootDir,
+		},
+		hashedPassword: common.SHA256hashing(name + password),
+	}
+	return nil
+}
+
+func (s *StorageDatabaseMemory) GetHashedPassword(name string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, ok := s.users[name]
+	if !ok {
+		return "", sql.ErrNoRows
+	}
+	return user.hashedPassword, nil
+}
+
+func (s *StorageDatabaseMemory) SetQuota(name string, quota int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, ok := s.users[name]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	user.inf.Quota = quota
+	s.users[name] = user
+	return nil
+}
+
+func (s *StorageDatabaseMemory) AddChange(change Change) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state := s.changeStates[change.User]
+	state.last++
+	s.changeStates[change.User] = state
+	change.Seq = state.last
+	s.changes = append(s.changes, change)
+	return change.Seq, nil
+}
+
+func (s *StorageDatabaseMemory) GetChanges(user string, since int64, limit int) ([]Change, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var res []Change
+	for _, change := range s.changes {
+		if len(res) == limit {
+			break
+		}
+		if change.Seq > since && change.User == user {
+			res = append(res, change)
+		}
+	}
+	return res, nil
+}
+
+func (s *StorageDatabaseMemory) GetChangesState(user string) (int64, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state := s.changeStates[user]
+	return state.last, state.horizon, nil
+}
+
+func (s *StorageDatabaseMemory) DeleteChangesBefore(before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var kept []Change
+	for _, change := range s.changes {
+		if change.Created.Before(before) {
+			state := s.changeStates[change.User]
+			state.horizon = change.Seq
+			s.changeStates[change.User] = state
+			continue
+		}
+		kept = append(kept, change)
+	}
+	s.changes = kept
+	return nil
+}
+
+func (s *StorageDatabaseMemory) CreateShareLink(link ShareLink) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.shareLinks[link.Token] = link
+	return nil
+}
+
+func (s *StorageDatabaseMemory) GetShareLink(token string) (ShareLink, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	link, ok := s.shareLinks[token]
+	if !ok {
+		return ShareLink{}, sql.ErrNoRows
+	}
+	return link, nil
+}
+
+func (s *StorageDatabaseMemory) GetShareLinks(user string) ([]ShareLink, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var res []ShareLink
+	for _, link := range s.shareLinks {
+		if link.User == user {
+			res = append(res, link)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Created.Before(res[j].Created)
+	})
+	return res, nil
+}
+
+func (s *StorageDatabaseMemory) DeleteShareLink(user, token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	link, ok := s.shareLinks[token]
+	if !ok || link.User != user {
+		return sql.ErrNoRows
+	}
+	delete(s.shareLinks, token)
+	return nil
+}
+
+func (s *StorageDatabaseMemory) CountShareLinkDownload(token string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	link, ok := s.shareLinks[token]
+	if !ok {
+		return false, sql.ErrNoRows
+	}
+	if link.MaxDownloads > 0 && link.Downloads >= link.MaxDownloads {
+		return false, nil
+	}
+	link.Downloads++
+	s.shareLinks[token] = link
+	return true, nil
+}
+
+func (s *StorageDatabaseMemory) AddUserToGroup(group, user string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.groups[group] == nil {
+		s.groups[group] = make(map[string]bool)
+	}
+	s.groups[group][user] = true
+	return nil
+}
+
+func (s *StorageDatabaseMemory) GetGroupMembers() ([]GroupMember, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var res []GroupMember
+	for group, users := range s.groups {
+		for user := range users {
+			res = append(res, GroupMember{Group: group, User: user})
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Group != res[j].Group {
+			return res[i].Group < res[j].Group
+		}
+		return res[i].User < res[j].User
+	})
+	return res, nil
+}
+
+func (s *StorageDatabaseMemory) RemoveUserFromGroup(group, user string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.groups[group][user] {
+		return sql.ErrNoRows
+	}
+	delete(s.groups[group], user)
+	if len(s.groups[group]) == 0 {
+		delete(s.groups, group)
+	}
+	return nil
+}
+
+func (s *StorageDatabaseMemory) CreateGrant(grant Grant) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, g := range s.grants {
+		if g.Owner == grant.Owner && g.Path == grant.Path && g.Grantee == grant.Grantee && g.GranteeType == grant.GranteeType {
+			s.grants[i].Permission = grant.Permission
+			return g.ID, nil
+		}
+	}
+	s.lastGrantID++
+	grant.ID = s.lastGrantID
+	s.grants = append(s.grants, grant)
+	return grant.ID, nil
+}
+
+func (s *StorageDatabaseMemory) GetGrant(id int64) (Grant, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, grant := range s.grants {
+		if grant.ID == id {
+			return grant, nil
+		}
+	}
+	return Grant{}, sql.ErrNoRows
+}
+
+func (s *StorageDatabaseMemory) GetGrantsByOwner(owner string) ([]Grant, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var res []Grant
+	for _, grant := range s.grants {
+		if grant.Owner == owner {
+			res = append(res, grant)
+		}
+	}
+	return res, nil
+}
+
+func (s *StorageDatabaseMemory) GetGrantsFor(user string) ([]Grant, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var res []Grant
+	for _, grant := range s.grants {
+		switch {
+		case grant.GranteeType == "user" && grant.Grantee == user,
+			grant.GranteeType == "group" && s.groups[grant.Grantee][user]:
+			res = append(res, grant)
+		}
+	}
+	return res, nil
+}
+
+func (s *StorageDatabaseMemory) DeleteGrant(id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, grant := range s.grants {
+		if grant.ID == id {
+			s.grants = append(s.grants[:i], s.grants[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (s *StorageDatabaseMemory) MoveGrants(owner, oldPath, newPath string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, grant := range s.grants {
+		if grant.Owner != owner {
+			continue
+		}
+		if grant.Path == oldPath || strings.HasPrefix(grant.Path, oldPath+"/") {
+			s.grants[i].Path = newPath + strings.TrimPrefix(grant.Path, oldPath)
+		}
+	}
+	return nil
+}
+
+func (s *StorageDatabaseMemory) CreateACLEntry(entry ACLEntry) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastACLEntryID++
+	entry.ID = s.lastACLEntryID
+	entry.Actions = append([]string(nil), entry.Actions...)
+	s.aclEntries = append(s.aclEntries, entry)
+	return entry.ID, nil
+}
+
+func (s *StorageDatabaseMemory) GetACLEntries() ([]ACLEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]ACLEntry(nil), s.aclEntries...), nil
+}
+
+func (s *StorageDatabaseMemory) GetACLEntriesFor(user string) ([]ACLEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var res []ACLEntry
+	for _, entry := range s.aclEntries {
+		switch {
+		case entry.PrincipalType == "user" && entry.Principal == user,
+			entry.PrincipalType == "group" && s.groups[entry.Principal][user]:
+			res = append(res, entry)
+		}
+	}
+	return res, nil
+}
+
+func (s *StorageDatabaseMemory) DeleteACLEntry(id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, entry := range s.aclEntries {
+		if entry.ID == id {
+			s.aclEntries = append(s.aclEntries[:i], s.aclEntries[i+1:]...)
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+// isNestedPath reports whether the path is the path prefix or is nested into it,
+// every path is nested into the empty prefix
+func isNestedPath(prefix, path string) bool {
+	return prefix == "" || path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+func (s *StorageDatabaseMemory) PutIndexEntries(entries []IndexEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, entry := range entries {
+		if s.index[entry.User] == nil {
+			s.index[entry.User] = make(map[string]IndexEntry)
+		}
+		s.index[entry.User][entry.Path] = entry
+	}
+	return nil
+}
+
+func (s *StorageDatabaseMemory) DeleteIndexEntries(user, path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for p := range s.index[user] {
+		if isNestedPath(path, p) {
+			delete(s.index[user], p)
+		}
+	}
+	return nil
+}
+
+func (s *StorageDatabaseMemory) MoveIndexEntries(user, oldPath, newPath string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	moved := make(map[string]IndexEntry)
+	for p, entry := range s.index[user] {
+		if p == oldPath || strings.HasPrefix(p, oldPath+"/") {
+			delete(s.index[user], p)
+			entry.Path = newPath + strings.TrimPrefix(p, oldPath)
+			if p == oldPath {
+				entry.Name = path.Base(newPath)
+				entry.Ext = strings.ToLower(path.Ext(entry.Name))
+			}
+			moved[entry.Path] = entry
+		}
+	}
+	for p, entry := range moved {
+		s.index[user][p] = entry
+	}
+	return nil
+}
+
+func (s *StorageDatabaseMemory) SearchIndex(query IndexQuery) ([]IndexEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var res []IndexEntry
+	for _, entry := range s.index[query.User] {
+		switch {
+		case !isNestedPath(query.PathPrefix, entry.Path) || entry.Path == query.PathPrefix:
+		case query.Ext != "" && entry.Ext != query.Ext:
+		case query.MinSize > 0 && entry.Size < query.MinSize:
+		case query.MaxSize > 0 && entry.Size > query.MaxSize:
+		case !query.ModifiedAfter.IsZero() && entry.Modified.Before(query.ModifiedAfter):
+		case !query.ModifiedBefore.IsZero() && entry.Modified.After(query.ModifiedBefore):
+		case query.Content != "" && !strings.Contains(entry.Content, query.Content):
+		default:
+			entry.Content = ""
+			res = append(res, entry)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Path < res[j].Path
+	})
+	return res, nil
+}
+
+func (s *StorageDatabaseMemory) CreateUploadTypeRule(rule UploadTypeRule) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastRuleID++
+	rule.ID = s.lastRuleID
+	rule.Allow = append([]string(nil), rule.Allow...)
+	rule.Deny = append([]string(nil), rule.Deny...)
+	s.uploadRules = append(s.uploadRules, rule)
+	return rule.ID, nil
+}
+
+func (s *StorageDatabaseMemory) GetUploadTypeRules() ([]UploadTypeRule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]UploadTypeRule(nil), s.uploadRules...), nil
+}
+
+func (s *StorageDatabaseMemory) GetUploadTypeRulesFor(user string) ([]UploadTypeRule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var res []UploadTypeRule
+	for _, rule := range s.uploadRules {
+		switch {
+		case rule.PrincipalType == "user" && rule.Principal == user,
+			rule.PrincipalType == "group" && s.groups[rule.Principal][user]:
+			res = append(res, rule)
+		}
+	}
+	return res, nil
+}
+
+func (s *StorageDatabaseMemory) DeleteUploadTypeRule(id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, rule := range s.uploadRules {
+		if rule.ID == id {
+			s.uploadRules = append(s.uploadRules[:i], s.uploadRules[i+1:]...)
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
@@ -1,9 +1,14 @@
 package db
 
 import (
+	"database/sql"
 	_ "github.com/lib/pq"
+	"path"
 	"remote-storage/server/common"
 	"remote-storage/server/db/sql_db"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // StorageDatabasePG provides higher level of database abstraction
@@ -50,21 +55,24 @@ func (s *StorageDatabasePG) GetUsers() ([]common.UserInf, error) {
 	var err error
 
 	rows, err := s.db.Query(
-		"SELECT name, root_directory FROM clients",
+		"SELECT name, root_directory, quota FROM users",
 	)
 	if err != nil {
 		return res, err
 	}
+	defer rows.Close()
 	for rows.Next() {
 		var name []uint8
 		var rootDir []uint8
-		err := rows.Scan(&name, &rootDir)
+		var quota int64
+		err := rows.Scan(&name, &rootDir, &quota)
 		if err != nil {
-			continue
+			return res, err
 		}
 		inf := common.UserInf{
 			Name:    string(name),
 			RootDir: string(rootDir),
+			Quota:   quota,
 		}
 		res = append(res, inf)
 	}
@@ -78,7 +86,7 @@ func (s *StorageDatabasePG) GetUser(name string) (common.UserInf, error) {
 	var err error
 
 	row := s.db.QueryRow(
-		"SELECT name, root_directory FROM users WHERE name=$1",
+		"SELECT name, root_directory, quota FROM users WHERE name=$1",
 		name,
 	)
 	if err != nil {
@@ -86,11 +94,13 @@ func (s *StorageDatabasePG) GetUser(name string) (common.UserInf, error) {
 	}
 	var username []uint8
 	var rootDir []uint8
-	err = row.Scan(&username, &rootDir)
+	var quota int64
+	err = row.Scan(&username, &rootDir, &quota)
 
 	res = common.UserInf{
 		Name:    string(username),
 		RootDir: string(rootDir),
+		Quota:   quota,
 	}
 
 	return res, err
@@ -105,3 +115,536 @@ func (s *StorageDatabasePG) CreateUser(name, password, rootDir string) error {
 	)
 	return err
 }
+
+// SetQuota sets the amount of bytes the user is allowed to store, 0 means unlimited
+func (s *StorageDatabasePG) SetQuota(name string, quota int64) error {
+	_, err := s.db.Exec(
+		"UPDATE users SET quota=$2 WHERE name=$1",
+		name,
+		quota,
+	)
+	return err
+}
+
+// AddChange takes the next sequence number of the user in the same transaction as the change is inserted,
+// the row of the user stays locked until the commit, so the changes of the user become visible in order
+func (s *StorageDatabasePG) AddChange(change Change) (int64, error) {
+	tx, err := s.db.Conn.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	var seq int64
+	row := tx.QueryRow(
+		`INSERT INTO change_sequences (user_name, seq) VALUES($1, 1)
+		ON CONFLICT (user_name) DO UPDATE SET seq=change_sequences.seq+1 RETURNING seq`,
+		change.User,
+	)
+	if err := row.Scan(&seq); err != nil {
+		return 0, err
+	}
+	_, err = tx.Exec(
+		"INSERT INTO changes (user_name, seq, type, path, old_path, is_dir, created) VALUES($1, $2, $3, $4, $5, $6, $7)",
+		change.User,
+		seq,
+		change.Type,
+		change.Path,
+		change.OldPath,
+		change.IsDir,
+		change.Created,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return seq, tx.Commit()
+}
+
+func (s *StorageDatabasePG) GetChanges(user string, since int64, limit int) ([]Change, error) {
+	var res []Change
+	rows, err := s.db.Query(
+		"SELECT seq, user_name, type, path, old_path, is_dir, created FROM changes WHERE user_name=$1 AND seq>$2 ORDER BY seq LIMIT $3",
+		user,
+		since,
+		limit,
+	)
+	if err != nil {
+		return res, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var change Change
+		err := rows.Scan(&change.Seq, &change.User, &change.Type, &change.Path, &change.OldPath, &change.IsDir, &change.Created)
+		if err != nil {
+			return res, err
+		}
+		res = append(res, change)
+	}
+	return res, rows.Err()
+}
+
+func (s *StorageDatabasePG) GetChangesState(user string) (int64, int64, error) {
+	var last, horizon int64
+	row := s.db.QueryRow("SELECT seq, horizon FROM change_sequences WHERE user_name=$1", user)
+	err := row.Scan(&last, &horizon)
+	if err == sql.ErrNoRows {
+		return 0, 0, nil
+	}
+	return last, horizon, err
+}
+
+// DeleteChangesBefore removes old changes and moves the horizons of their users to the last removed ones
+func (s *StorageDatabasePG) DeleteChangesBefore(before time.Time) error {
+	_, err := s.db.Exec(
+		`WITH deleted AS (DELETE FROM changes WHERE created<$1 RETURNING user_name, seq)
+		UPDATE change_sequences SET horizon=GREATEST(change_sequences.horizon, d.seq)
+		FROM (SELECT user_name, MAX(seq) AS seq FROM deleted GROUP BY user_name) d
+		WHERE change_sequences.user_name=d.user_name`,
+		before,
+	)
+	return err
+}
+
+func (s *StorageDatabasePG) CreateShareLink(link ShareLink) error {
+	var expires sql.NullTime
+	if !link.Expires.IsZero() {
+		expires = sql.NullTime{Time: link.Expires, Valid: true}
+	}
+	_, err := s.db.Exec(
+		"INSERT INTO share_links (token, user_name, path, is_dir, mode, hashed_password, expires, max_downloads, created) VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9)",
+		link.Token,
+		link.User,
+		link.Path,
+		link.IsDir,
+		link.Mode,
+		link.HashedPassword,
+		expires,
+		link.MaxDownloads,
+		link.Created,
+	)
+	return err
+}
+
+const shareLinkColumns = "token, user_name, path, is_dir, mode, hashed_password, expires, max_downloads, downloads, created"
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanShareLink(row rowScanner) (ShareLink, error) {
+	var link ShareLink
+	var expires sql.NullTime
+	err := row.Scan(&link.Token, &link.User, &link.Path, &link.IsDir, &link.Mode, &link.HashedPassword, &expires, &link.MaxDownloads, &link.Downloads, &link.Created)
+	link.Expires = expires.Time
+	return link, err
+}
+
+func (s *StorageDatabasePG) GetShareLink(token string) (ShareLink, error) {
+	row := s.db.QueryRow(
+		"SELECT "+shareLinkColumns+" FROM share_links WHERE token=$1",
+		token,
+	)
+	return scanShareLink(row)
+}
+
+func (s *StorageDatabasePG) GetShareLinks(user string) ([]ShareLink, error) {
+	var res []ShareLink
+	rows, err := s.db.Query(
+		"SELECT "+shareLinkColumns+" FROM share_links WHERE user_name=$1 ORDER BY created",
+		user,
+	)
+	if err != nil {
+		return res, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		link, err := scanShareLink(rows)
+		if err != nil {
+			return res, err
+		}
+		res = append(res, link)
+	}
+	return res, rows.Err()
+}
+
+func (s *StorageDatabasePG) DeleteShareLink(user, token string) error {
+	result, err := s.db.Exec(
+		"DELETE FROM share_links WHERE user_name=$1 AND token=$2",
+		user,
+		token,
+	)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// CountShareLinkDownload checks and increments the downloads in a single statement,
+// so concurrent downloads never exceed the limit
+func (s *StorageDatabasePG) CountShareLinkDownload(token string) (bool, error) {
+	result, err := s.db.Exec(
+		"UPDATE share_links SET downloads=downloads+1 WHERE token=$1 AND (max_downloads=0 OR downloads<max_downloads)",
+		token,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+func (s *StorageDatabasePG) AddUserToGroup(group, user string) error {
+	_, err := s.db.Exec(
+		"INSERT INTO user_groups (group_name, user_name) VALUES($1, $2) ON CONFLICT DO NOTHING",
+		group,
+		user,
+	)
+	return err
+}
+
+func (s *StorageDatabasePG) GetGroupMembers() ([]GroupMember, error) {
+	rows, err := s.db.Query("SELECT group_name, user_name FROM user_groups ORDER BY group_name, user_name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res []GroupMember
+	for rows.Next() {
+		var member GroupMember
+		if err := rows.Scan(&member.Group, &member.User); err != nil {
+			return res, err
+		}
+		res = append(res, member)
+	}
+	return res, rows.Err()
+}
+
+func (s *StorageDatabasePG) RemoveUserFromGroup(group, user string) error {
+	result, err := s.db.Exec(
+		"DELETE FROM user_groups WHERE group_name=$1 AND user_name=$2",
+		group,
+		user,
+	)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (s *StorageDatabasePG) CreateGrant(grant Grant) (int64, error) {
+	var id int64
+	row := s.db.QueryRow(
+		`INSERT INTO grants (owner, path, grantee, grantee_type, permission, created) VALUES($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (owner, path, grantee, grantee_type) DO UPDATE SET permission=EXCLUDED.permission RETURNING id`,
+		grant.Owner,
+		grant.Path,
+		grant.Grantee,
+		grant.GranteeType,
+		grant.Permission,
+		grant.Created,
+	)
+	err := row.Scan(&id)
+	return id, err
+}
+
+const grantColumns = "id, owner, path, grantee, grantee_type, permission, created"
+
+func scanGrant(row rowScanner) (Grant, error) {
+	var grant Grant
+	err := row.Scan(&grant.ID, &grant.Owner, &grant.Path, &grant.Grantee, &grant.GranteeType, &grant.Permission, &grant.Created)
+	return grant, err
+}
+
+func (s *StorageDatabasePG) queryGrants(query string, args ...interface{}) ([]Grant, error) {
+	var res []Grant
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return res, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		grant, err := scanGrant(rows)
+		if err != nil {
+			return res, err
+		}
+		res = append(res, grant)
+	}
+	return res, rows.Err()
+}
+
+func (s *StorageDatabasePG) GetGrant(id int64) (Grant, error) {
+	row := s.db.QueryRow(
+		"SELECT "+grantColumns+" FROM grants WHERE id=$1",
+		id,
+	)
+	return scanGrant(row)
+}
+
+func (s *StorageDatabasePG) GetGrantsByOwner(owner string) ([]Grant, error) {
+	return s.queryGrants(
+		"SELECT "+grantColumns+" FROM grants WHERE owner=$1 ORDER BY id",
+		owner,
+	)
+}
+
+func (s *StorageDatabasePG) GetGrantsFor(user string) ([]Grant, error) {
+	return s.queryGrants(
+		`SELECT `+grantColumns+` FROM grants WHERE (grantee_type='user' AND grantee=$1)
+		OR (grantee_type='group' AND grantee IN (SELECT group_name FROM user_groups WHERE user_name=$1)) ORDER BY id`,
+		user,
+	)
+}
+
+func (s *StorageDatabasePG) DeleteGrant(id int64) error {
+	_, err := s.db.Exec(
+		"DELETE FROM grants WHERE id=$1",
+		id,
+	)
+	return err
+}
+
+func (s *StorageDatabasePG) MoveGrants(owner, oldPath, newPath string) error {
+	_, err := s.db.Exec(
+		`UPDATE grants SET path=$3 || substr(path, length($2) + 1)
+		WHERE owner=$1 AND (path=$2 OR left(path, length($2) + 1)=$2 || '/')`,
+		owner,
+		oldPath,
+		newPath,
+	)
+	return err
+}
+
+func (s *StorageDatabasePG) CreateACLEntry(entry ACLEntry) (int64, error) {
+	var id int64
+	row := s.db.QueryRow(
+		"INSERT INTO acl_entries (principal, principal_type, path_prefix, actions, created) VALUES($1, $2, $3, $4, $5) RETURNING id",
+		entry.Principal,
+		entry.PrincipalType,
+		entry.PathPrefix,
+		strings.Join(entry.Actions, ","),
+		entry.Created,
+	)
+	err := row.Scan(&id)
+	return id, err
+}
+
+const aclEntryColumns = "id, principal, principal_type, path_prefix, actions, created"
+
+func (s *StorageDatabasePG) queryACLEntries(query string, args ...interface{}) ([]ACLEntry, error) {
+	var res []ACLEntry
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return res, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var entry ACLEntry
+		var actions string
+		err := rows.Scan(&entry.ID, &entry.Principal, &entry.PrincipalType, &entry.PathPrefix, &actions, &entry.Created)
+		if err != nil {
+			return res, err
+		}
+		if actions != "" {
+			entry.Actions = strings.Split(actions, ",")
+		}
+		res = append(res, entry)
+	}
+	return res, rows.Err()
+}
+
+func (s *StorageDatabasePG) GetACLEntries() ([]ACLEntry, error) {
+	return s.queryACLEntries(
+		"SELECT " + aclEntryColumns + " FROM acl_entries ORDER BY id",
+	)
+}
+
+func (s *StorageDatabasePG) GetACLEntriesFor(user string) ([]ACLEntry, error) {
+	return s.queryACLEntries(
+		`SELECT `+aclEntryColumns+` FROM acl_entries WHERE (principal_type='user' AND principal=$1)
+		OR (principal_type='group' AND principal IN (SELECT group_name FROM user_groups WHERE user_name=$1)) ORDER BY id`,
+		user,
+	)
+}
+
+func (s *StorageDatabasePG) DeleteACLEntry(id int64) error {
+	result, err := s.db.Exec(
+		"DELETE FROM acl_entries WHERE id=$1",
+		id,
+	)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (s *StorageDatabasePG) PutIndexEntries(entries []IndexEntry) error {
+	for _, entry := range entries {
+		_, err := s.db.Exec(
+			`INSERT INTO search_index (user_name, path, name, ext, is_dir, size, modified, content) VALUES($1, $2, $3, $4, $5, $6, $7, $8)
+			ON CONFLICT (user_name, path) DO UPDATE SET name=EXCLUDED.name, ext=EXCLUDED.ext, is_dir=EXCLUDED.is_dir,
+			size=EXCLUDED.size, modified=EXCLUDED.modified, content=EXCLUDED.content`,
+			entry.User,
+			entry.Path,
+			entry.Name,
+			entry.Ext,
+			entry.IsDir,
+			entry.Size,
+			entry.Modified,
+			entry.Content,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *StorageDatabasePG) DeleteIndexEntries(user, path string) error {
+	_, err := s.db.Exec(
+		"DELETE FROM search_index WHERE user_name=$1 AND ($2='' OR path=$2 OR left(path, length($2) + 1)=$2 || '/')",
+		user,
+		path,
+	)
+	return err
+}
+
+func (s *StorageDatabasePG) MoveIndexEntries(user, oldPath, newPath string) error {
+	name := path.Base(newPath)
+	_, err := s.db.Exec(
+		`UPDATE search_index SET path=$3 || substr(path, length($2) + 1),
+		name=CASE WHEN path=$2 THEN $4 ELSE name END, ext=CASE WHEN path=$2 THEN $5 ELSE ext END
+		WHERE user_name=$1 AND (path=$2 OR left(path, length($2) + 1)=$2 || '/')`,
+		user,
+		oldPath,
+		newPath,
+		name,
+		strings.ToLower(path.Ext(name)),
+	)
+	return err
+}
+
+func (s *StorageDatabasePG) SearchIndex(query IndexQuery) ([]IndexEntry, error) {
+	var res []IndexEntry
+	conditions := []string{"user_name=$1"}
+	args := []interface{}{query.User}
+	where := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, strings.ReplaceAll(condition, "$?", "$"+strconv.Itoa(len(args))))
+	}
+	if query.PathPrefix != "" {
+		where("left(path, length($?) + 1)=$? || '/'", query.PathPrefix)
+	}
+	if query.Ext != "" {
+		where("ext=$?", query.Ext)
+	}
+	if query.MinSize > 0 {
+		where("size>=$?", query.MinSize)
+	}
+	if query.MaxSize > 0 {
+		where("size<=$?", query.MaxSize)
+	}
+	if !query.ModifiedAfter.IsZero() {
+		where("modified>=$?", query.ModifiedAfter)
+	}
+	if !query.ModifiedBefore.IsZero() {
+		where("modified<=$?", query.ModifiedBefore)
+	}
+	if query.Content != "" {
+		where("strpos(content, $?) > 0", query.Content)
+	}
+	rows, err := s.db.Query(
+		"SELECT user_name, path, name, ext, is_dir, size, modified FROM search_index WHERE "+
+			strings.Join(conditions, " AND ")+" ORDER BY path",
+		args...,
+	)
+	if err != nil {
+		return res, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var entry IndexEntry
+		err := rows.Scan(&entry.User, &entry.Path, &entry.Name, &entry.Ext, &entry.IsDir, &entry.Size, &entry.Modified)
+		if err != nil {
+			return res, err
+		}
+		res = append(res, entry)
+	}
+	return res, rows.Err()
+}
+
+func (s *StorageDatabasePG) CreateUploadTypeRule(rule UploadTypeRule) (int64, error) {
+	var id int64
+	row := s.db.QueryRow(
+		"INSERT INTO upload_type_rules (principal, principal_type, allow, deny, created) VALUES($1, $2, $3, $4, $5) RETURNING id",
+		rule.Principal,
+		rule.PrincipalType,
+		strings.Join(rule.Allow, ","),
+		strings.Join(rule.Deny, ","),
+		rule.Created,
+	)
+	err := row.Scan(&id)
+	return id, err
+}
+
+const uploadTypeRuleColumns = "id, principal, principal_type, allow, deny, created"
+
+func (s *StorageDatabasePG) queryUploadTypeRules(query string, args ...interface{}) ([]UploadTypeRule, error) {
+	var res []UploadTypeRule
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return res, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var rule UploadTypeRule
+		var allow, deny string
+		err := rows.Scan(&rule.ID, &rule.Principal, &rule.PrincipalType, &allow, &deny, &rule.Created)
+		if err != nil {
+			return res, err
+		}
+		if allow != "" {
+			rule.Allow = strings.Split(allow, ",")
+		}
+		if deny != "" {
+			rule.Deny = strings.Split(deny, ",")
+		}
+		res = append(res, rule)
+	}
+	return res, rows.Err()
+}
+
+func (s *StorageDatabasePG) GetUploadTypeRules() ([]UploadTypeRule, error) {
+	return s.queryUploadTypeRules(
+		"SELECT " + uploadTypeRuleColumns + " FROM upload_type_rules ORDER BY id",
+	)
+}
+
+func (s *StorageDatabasePG) GetUploadTypeRulesFor(user string) ([]UploadTypeRule, error) {
+	return s.queryUploadTypeRules(
+		`SELECT `+uploadTypeRuleColumns+` FROM upload_type_rules WHERE (principal_type='user' AND principal=$1)
+		OR (principal_type='group' AND principal IN (SELECT group_name FROM user_groups WHERE user_name=$1)) ORDER BY id`,
+		user,
+	)
+}
+
+func (s *StorageDatabasePG) DeleteUploadTypeRule(id int64) error {
+	result, err := s.db.Exec(
+		"DELETE FROM upload_type_rules WHERE id=$1",
+		id,
+	)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
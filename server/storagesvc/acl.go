@@ -0,0 +1,197 @@
+package storagesvc
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"remote-storage/server/db"
+)
+
+// ACLAction is the action with files controlled by the access control list
+type ACLAction string
+
+const (
+	// ACLRead allows listing, downloading and copying files
+	ACLRead ACLAction = "read"
+	// ACLWrite allows creating and changing files
+	ACLWrite ACLAction = "write"
+	// ACLDelete allows deleting files and moving them away
+	ACLDelete ACLAction = "delete"
+	// ACLShare allows creating share links and granting access to other users
+	ACLShare ACLAction = "share"
+)
+
+func parseACLAction(s string) (ACLAction, error) {
+	switch action := ACLAction(s); action {
+	case ACLRead, ACLWrite, ACLDelete, ACLShare:
+		return action, nil
+	default:
+		return "", ErrInvalidArgument
+	}
+}
+
+// ACLEntry allows the user or the group the actions with the files at PathPrefix.
+// Users without entries are allowed everything in their root directories. For users
+// with entries the entries with the longest prefix of the path decide, the actions
+// with files not covered by any entry are denied. The entry without actions denies everything.
+type ACLEntry struct {
+	ID            int64       `json:"id"`
+	Principal     string      `json:"principal"`
+	PrincipalType GranteeType `json:"principal_type,omitempty"`
+	// PathPrefix is relative to the root directory of the principal, empty for the whole directory
+	PathPrefix string      `json:"path_prefix"`
+	Actions    []ACLAction `json:"actions"`
+	Created    time.Time   `json:"created"`
+}
+
+func aclEntryFrom(entry db.ACLEntry) ACLEntry {
+	res := ACLEntry{
+		ID:            entry.ID,
+		Principal:     entry.Principal,
+		PrincipalType: GranteeType(entry.PrincipalType),
+		PathPrefix:    entry.PathPrefix,
+		Actions:       []ACLAction{},
+		Created:       entry.Created,
+	}
+	for _, action := range entry.Actions {
+		res.Actions = append(res.Actions, ACLAction(action))
+	}
+	return res
+}
+
+// checkAdmin returns ErrForbidden unless the user is allowed to manage access control lists
+func (svc *service) checkAdmin(ctx context.Context) error {
+	if !svc.admins[getUserInfFromCtx(ctx).Name] {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// ListACL returns all entries of access control lists, only admins are allowed to list them
+func (svc *service) ListACL(ctx context.Context) ([]ACLEntry, error) {
+	if err := svc.checkAdmin(ctx); err != nil {
+		return nil, err
+	}
+	entries, err := svc.database.GetACLEntries()
+	if err != nil {
+		return nil, err
+	}
+	res := make([]ACLEntry, 0, len(entries))
+	for _, entry := range entries {
+		res = append(res, aclEntryFrom(entry))
+	}
+	return res, nil
+}
+
+// AddACLEntry stores the entry of the access control list, only admins are allowed to add entries
+func (svc *service) AddACLEntry(ctx context.Context, entry ACLEntry) (ACLEntry, error) {
+	if err := svc.checkAdmin(ctx); err != nil {
+		return ACLEntry{}, err
+	}
+	if entry.PrincipalType == "" {
+		entry.PrincipalType = GranteeUser
+	}
+	if entry.PrincipalType != GranteeUser && entry.PrincipalType != GranteeGroup || entry.Principal == "" {
+		return ACLEntry{}, ErrInvalidArgument
+	}
+	prefix, err := cleanDirPath(entry.PathPrefix)
+	if err != nil {
+		return ACLEntry{}, err
+	}
+	if entry.PrincipalType == GranteeUser {
+		if _, err := svc.database.GetUser(entry.Principal); err == sql.ErrNoRows {
+			return ACLEntry{}, ErrNotFound
+		} else if err != nil {
+			return ACLEntry{}, err
+		}
+	}
+	record := db.ACLEntry{
+		Principal:     entry.Principal,
+		PrincipalType: string(entry.PrincipalType),
+		PathPrefix:    prefix,
+		Actions:       []string{},
+		Created:       time.Now(),
+	}
+	seen := map[ACLAction]bool{}
+	for _, action := range entry.Actions {
+		action, err := parseACLAction(strings.ToLower(string(action)))
+		if err != nil {
+			return ACLEntry{}, err
+		}
+		if !seen[action] {
+			seen[action] = true
+			record.Actions = append(record.Actions, string(action))
+		}
+	}
+	record.ID, err = svc.database.CreateACLEntry(record)
+	if err != nil {
+		return ACLEntry{}, err
+	}
+	return aclEntryFrom(record), nil
+}
+
+// DeleteACLEntry removes the entry of the access control list, only admins are allowed to remove entries
+func (svc *service) DeleteACLEntry(ctx context.Context, id int64) error {
+	if err := svc.checkAdmin(ctx); err != nil {
+		return err
+	}
+	err := svc.database.DeleteACLEntry(id)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	return err
+}
+
+// GroupMember is the membership of the user in the group,
+// groups are principals of grants, access control lists and upload type rules
+type GroupMember struct {
+	Group string `json:"group"`
+	User  string `json:"user"`
+}
+
+// ListGroupMembers returns the members of all groups, only admins are allowed to list them
+func (svc *service) ListGroupMembers(ctx context.Context) ([]GroupMember, error) {
+	if err := svc.checkAdmin(ctx); err != nil {
+		return nil, err
+	}
+	members, err := svc.database.GetGroupMembers()
+	if err != nil {
+		return nil, err
+	}
+	res := make([]GroupMember, 0, len(members))
+	for _, member := range members {
+		res = append(res, GroupMember{Group: member.Group, User: member.User})
+	}
+	return res, nil
+}
+
+// AddGroupMember adds the user to the group, the group is created by its first member.
+// Only admins are allowed to add members.
+func (svc *service) AddGroupMember(ctx context.Context, member GroupMember) error {
+	if err := svc.checkAdmin(ctx); err != nil {
+		return err
+	}
+	if member.Group == "" || member.User == "" {
+		return ErrInvalidArgument
+	}
+	if _, err := svc.database.GetUser(member.User); err == sql.ErrNoRows {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+	return svc.database.AddUserToGroup(member.Group, member.User)
+}
+
+// RemoveGroupMember removes the user from the group, only admins are allowed to remove members
+func (svc *service) RemoveGroupMember(ctx context.Context, member GroupMember) error {
+	if err := svc.checkAdmin(ctx); err != nil {
+		return err
+	}
+	err := svc.database.RemoveUserFromGroup(member.Group, member.User)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	return err
+}
@@ -0,0 +1,56 @@
+package storagesvc
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGroupMembers(t *testing.T) {
+	svc := newTestService(t)
+	svc.admins["alice"] = true
+	admin := userContext("alice")
+
+	if err := svc.AddGroupMember(userContext("bob"), GroupMember{Group: "team", User: "bob"}); err != ErrForbidden {
+		t.Fatalf("AddGroupMember by the user = %v, want ErrForbidden", err)
+	}
+	if _, err := svc.ListGroupMembers(userContext("bob")); err != ErrForbidden {
+		t.Fatalf("ListGroupMembers by the user = %v, want ErrForbidden", err)
+	}
+	if err := svc.AddGroupMember(admin, GroupMember{Group: "team", User: "carol"}); err != ErrNotFound {
+		t.Fatalf("AddGroupMember of the unknown user = %v, want ErrNotFound", err)
+	}
+	if err := svc.AddGroupMember(admin, GroupMember{User: "bob"}); err != ErrInvalidArgument {
+		t.Fatalf("AddGroupMember without the group = %v, want ErrInvalidArgument", err)
+	}
+
+	if _, err := svc.AddACLEntry(admin, ACLEntry{Principal: "team", PrincipalType: GranteeGroup, Actions: []ACLAction{ACLRead}}); err != nil {
+		t.Fatal(err)
+	}
+	for _, user := range []string{"bob", "alice"} {
+		if err := svc.AddGroupMember(admin, GroupMember{Group: "team", User: user}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	members, err := svc.ListGroupMembers(admin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []GroupMember{{Group: "team", User: "alice"}, {Group: "team", User: "bob"}}
+	if !reflect.DeepEqual(members, want) {
+		t.Fatalf("members = %v, want %v", members, want)
+	}
+	entries, err := svc.database.GetACLEntriesFor("bob")
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("entries of the group member = %v, %v", entries, err)
+	}
+
+	if err := svc.RemoveGroupMember(admin, GroupMember{Group: "team", User: "bob"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.RemoveGroupMember(admin, GroupMember{Group: "team", User: "bob"}); err != ErrNotFound {
+		t.Fatalf("RemoveGroupMember of the removed member = %v, want ErrNotFound", err)
+	}
+	if entries, err := svc.database.GetACLEntriesFor("bob"); err != nil || len(entries) != 0 {
+		t.Fatalf("entries of the removed member = %v, %v", entries, err)
+	}
+}
@@ -0,0 +1,216 @@
+package storagesvc
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"io"
+	"path"
+	"time"
+
+	fs "remote-storage/server/storagesvc/repository/filesystem"
+)
+
+// ArchiveFormat is the format of the downloaded archive
+type ArchiveFormat string
+
+const (
+	ArchiveZip   ArchiveFormat = "zip"
+	ArchiveTarGz ArchiveFormat = "tar.gz"
+)
+
+// archiveWriter writes the entries of the archive into the stream
+type archiveWriter interface {
+	addDir(name string, modified time.Time) error
+	addFile(name string, info fs.FileInfo, contents io.Reader) error
+	Close() error
+}
+
+func newArchiveWriter(w io.Writer, format ArchiveFormat) (archiveWriter, error) {
+	switch format {
+	case ArchiveZip:
+		return zipWriter{zip.NewWriter(w)}, nil
+	case ArchiveTarGz:
+		gz := gzip.NewWriter(w)
+		return tarGzWriter{tar.NewWriter(gz), gz}, nil
+	default:
+		return nil, ErrInvalidArgument
+	}
+}
+
+type zipWriter struct {
+	w *zip.Writer
+}
+
+func (z zipWriter) addDir(name string, modified time.Time) error {
+	_, err := z.w.CreateHeader(&zip.FileHeader{
+		Name:     name + "/",
+		Modified: modified,
+	})
+	return err
+}
+
+func (z zipWriter) addFile(name string, info fs.FileInfo, contents io.Reader) error {
+	w, err := z.w.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: info.Modified,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, contents)
+	return err
+}
+
+func (z zipWriter) Close() error {
+	return z.w.Close()
+}
+
+type tarGzWriter struct {
+	w  *tar.Writer
+	gz *gzip.Writer
+}
+
+func (t tarGzWriter) addDir(name string, modified time.Time) error {
+	return t.w.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeDir,
+		Name:     name + "/",
+		Mode:     0755,
+		ModTime:  modified,
+	})
+}
+
+func (t tarGzWriter) addFile(name string, info fs.FileInfo, contents io.Reader) error {
+	err := t.w.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     0644,
+		Size:     info.Size,
+		ModTime:  info.Modified,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(t.w, contents)
+	return err
+}
+
+func (t tarGzWriter) Close() error {
+	if err := t.w.Close(); err != nil {
+		t.gz.Close()
+		return err
+	}
+	return t.gz.Close()
+}
+
+// DownloadArchive streams the archive of the files fileNames of the directory dirPath,
+// the whole directory is archived if fileNames is empty. Paths in the archive are relative
+// to dirPath. The archive is generated while it is read, the returned FileInfo only has
+// the name of the archive.
+func (svc *service) DownloadArchive(ctx context.Context, dirPath string, fileNames []string, format ArchiveFormat) (io.ReadCloser, fs.FileInfo, error) {
+	if format == "" {
+		format = ArchiveZip
+	}
+	if format != ArchiveZip && format != ArchiveTarGz {
+		return nil, fs.FileInfo{}, ErrInvalidArgument
+	}
+	dirFullPath, dir, err := svc.resolveDir(ctx, dirPath)
+	if err != nil {
+		return nil, fs.FileInfo{}, err
+	}
+	name := "download"
+	if dir != "" {
+		name = path.Base(dir)
+	}
+	if len(fileNames) == 0 {
+		children, err := fs.ReadDir(svc.backend, dirFullPath)
+		if err != nil {
+			return nil, fs.FileInfo{}, getErrorType(err)
+		}
+		for _, child := range children {
+			fileNames = append(fileNames, child.Name)
+		}
+	} else if len(fileNames) == 1 {
+		name = fileNames[0]
+	}
+	// all files are checked before the response starts
+	for _, fileName := range fileNames {
+		filePath, err := svc.resolvePath(ctx, dir, fileName)
+		if err != nil {
+			return nil, fs.FileInfo{}, err
+		}
+		if _, err := svc.backend.Stat(filePath); err != nil {
+			return nil, fs.FileInfo{}, getErrorType(err)
+		}
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(svc.writeArchive(ctx, pw, format, dir, fileNames))
+	}()
+	info := fs.FileInfo{
+		Name:     name + "." + string(format),
+		Modified: time.Now(),
+	}
+	return pr, info, nil
+}
+
+// writeArchive writes the files fileNames of the directory dir into w,
+// the reader of w closing it stops writing
+func (svc *service) writeArchive(ctx context.Context, w io.Writer, format ArchiveFormat, dir string, fileNames []string) error {
+	archive, err := newArchiveWriter(w, format)
+	if err != nil {
+		return err
+	}
+	for _, fileName := range fileNames {
+		if err := svc.addToArchive(ctx, archive, dir, fileName, fileName); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+// addToArchive adds the file fileName of the directory dir under the name entryName,
+// nested files of directories are added recursively. Symbolic links leading outside
+// of the root directory of the user and files with invalid names are left out.
+func (svc *service) addToArchive(ctx context.Context, archive archiveWriter, dir, fileName, entryName string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	filePath, err := svc.resolvePath(ctx, dir, fileName)
+	if err == ErrPathEscape || err == ErrInvalidArgument {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	info, err := svc.backend.Stat(filePath)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir {
+		file, err := svc.backend.OpenFile(filePath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		return archive.addFile(entryName, info, file)
+	}
+
+	if err := archive.addDir(entryName, info.Modified); err != nil {
+		return err
+	}
+	children, err := fs.ReadDir(svc.backend, filePath)
+	if err != nil {
+		return err
+	}
+	for _, child := range children {
+		err := svc.addToArchive(ctx, archive, joinPath(dir, fileName), child.Name, path.Join(entryName, child.Name))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
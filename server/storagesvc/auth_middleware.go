@@ -14,6 +14,28 @@ func putUserInfInCtx(ctx context.Context, r common.UserInf) context.Context {
 	return context.WithValue(ctx, ctxUserInfKey{}, r)
 }
 
+func getUserInfFromCtx(ctx context.Context) common.UserInf {
+	inf, _ := ctx.Value(ctxUserInfKey{}).(common.UserInf)
+	return inf
+}
+
+type ctxCallerKey struct{}
+
+// putCallerInCtx keeps the name of the user making the call,
+// so calls made on behalf of the owner of shared files are still checked against the caller
+func putCallerInCtx(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, ctxCallerKey{}, name)
+}
+
+// getCallerFromCtx returns the name of the user making the call,
+// it is the user of the context unless the call is made on behalf of another user
+func getCallerFromCtx(ctx context.Context) string {
+	if name, ok := ctx.Value(ctxCallerKey{}).(string); ok {
+		return name
+	}
+	return getUserInfFromCtx(ctx).Name
+}
+
 func AuthMiddleware(authSvc authsvc.Service, next endpoint.Endpoint) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
 		// Extracting the request from the context
@@ -29,7 +51,7 @@ func AuthMiddleware(authSvc authsvc.Service, next endpoint.Endpoint) endpoint.En
 			return nil, err
 		}
 
-		putUserInfInCtx(ctx, userInf)
+		ctx = putUserInfInCtx(ctx, userInf)
 
 		// Call the next endpoint in the chain
 
@@ -0,0 +1,99 @@
+package storagesvc
+
+import (
+	"context"
+)
+
+// maxBatchOperations is the maximal number of operations in the batch
+const maxBatchOperations = 1000
+
+// BatchOp is the kind of the operation of the batch
+type BatchOp string
+
+const (
+	BatchMkDir  BatchOp = "mkdir"
+	BatchRename BatchOp = "rename"
+	BatchMove   BatchOp = "move"
+	BatchCopy   BatchOp = "copy"
+	BatchDelete BatchOp = "delete"
+)
+
+// BatchOperation is the single operation of the batch, fields are named
+// as in the requests of the corresponding endpoints, fields unused by the operation are ignored
+type BatchOperation struct {
+	Op BatchOp `json:"op"`
+	// Path and DirName are the arguments of mkdir
+	Path    string `json:"path,omitempty"`
+	DirName string `json:"dir_name,omitempty"`
+	// DirPath is the directory of the file renamed or deleted
+	DirPath string `json:"dir_path,omitempty"`
+	// OldName and NewName are the arguments of rename
+	OldName string `json:"old_name,omitempty"`
+	NewName string `json:"new_name,omitempty"`
+	// SrcDirPath and DestDirPath are the directories of the file moved or copied
+	SrcDirPath  string `json:"src_dir_path,omitempty"`
+	DestDirPath string `json:"dest_dir_path,omitempty"`
+	// FileName is the name of the file moved, copied or deleted
+	FileName string `json:"file_name,omitempty"`
+	// Conflict is applied by mkdir, rename, move and copy
+	Conflict ConflictPolicy `json:"conflict,omitempty"`
+}
+
+// BatchResult is the outcome of the operation of the batch
+type BatchResult struct {
+	Op BatchOp `json:"op"`
+	Result
+	// Error is the message if the operation failed
+	Error string `json:"error,omitempty"`
+	// Code is the HTTP status code corresponding to Error
+	Code int `json:"code,omitempty"`
+}
+
+// Batch executes the operations in order and returns the result of every executed operation.
+// If stopOnError is set, the operations following the failed one are not executed.
+func (svc *service) Batch(ctx context.Context, operations []BatchOperation, stopOnError bool) ([]BatchResult, error) {
+	return runBatch(ctx, svc, operations, stopOnError)
+}
+
+// runBatch implements Batch executing the operations through s,
+// so middlewares wrapping the service check every operation
+func runBatch(ctx context.Context, s Service, operations []BatchOperation, stopOnError bool) ([]BatchResult, error) {
+	if len(operations) > maxBatchOperations {
+		return nil, ErrInvalidArgument
+	}
+	results := make([]BatchResult, 0, len(operations))
+	for _, op := range operations {
+		if ctx.Err() != nil {
+			break
+		}
+		res, err := execute(ctx, s, op)
+		result := BatchResult{Op: op.Op, Result: res}
+		if err != nil {
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+		if err != nil && stopOnError {
+			break
+		}
+	}
+	return results, nil
+}
+
+// execute runs the single operation of the batch
+func execute(ctx context.Context, s Service, op BatchOperation) (Result, error) {
+	switch op.Op {
+	case BatchMkDir:
+		return s.MkDir(ctx, op.Path, op.DirName, op.Conflict)
+	case BatchRename:
+		return s.Rename(ctx, op.DirPath, op.OldName, op.NewName, op.Conflict)
+	case BatchMove:
+		return s.Move(ctx, op.SrcDirPath, op.FileName, op.DestDirPath, op.Conflict)
+	case BatchCopy:
+		return s.Copy(ctx, op.SrcDirPath, op.FileName, op.DestDirPath, op.Conflict)
+	case BatchDelete:
+		path, err := s.Delete(ctx, op.DirPath, op.FileName)
+		return Result{Path: path}, err
+	default:
+		return Result{}, ErrInvalidArgument
+	}
+}
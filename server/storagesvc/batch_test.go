@@ -0,0 +1,99 @@
+package storagesvc
+
+import (
+	"net/http"
+	"os"
+	"testing"
+)
+
+func TestBatchStopOnError(t *testing.T) {
+	operations := []BatchOperation{
+		{Op: BatchMkDir, DirName: "a"},
+		{Op: BatchMkDir, DirName: "a", Conflict: ConflictFail},
+		{Op: BatchMkDir, DirName: "b"},
+	}
+	for _, tc := range []struct {
+		stopOnError bool
+		results     int
+		created     bool
+	}{
+		{true, 2, false},
+		{false, 3, true},
+	} {
+		svc := newTestService(t)
+		results, err := svc.Batch(userContext("alice"), operations, tc.stopOnError)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != tc.results {
+			t.Fatalf("stopOnError %v: results = %+v, want %d", tc.stopOnError, results, tc.results)
+		}
+		if results[0].Error != "" || results[0].Path != "alice/a" || results[0].Action != ActionCreated {
+			t.Fatalf("stopOnError %v: first result = %+v", tc.stopOnError, results[0])
+		}
+		if results[1].Error != ErrAlreadyExists.Error() {
+			t.Fatalf("stopOnError %v: second result = %+v, want %v", tc.stopOnError, results[1], ErrAlreadyExists)
+		}
+		_, err = svc.backend.Stat("alice/b")
+		if created := err == nil; created != tc.created || (err != nil && !os.IsNotExist(err)) {
+			t.Fatalf("stopOnError %v: Stat of the following directory = %v", tc.stopOnError, err)
+		}
+	}
+}
+
+func TestBatchCodes(t *testing.T) {
+	svc := newTestService(t)
+	upload(t, svc, "alice", "", "a.txt", "0123456789")
+	upload(t, svc, "alice", "", "b.txt", "b")
+	setQuota(t, svc, "alice", 15)
+	batch := MakeBatchEndpoint(svc)
+
+	response, err := batch(userContext("alice"), batchRequest{Operations: []BatchOperation{
+		{Op: BatchRename, OldName: "b.txt", NewName: "c.txt"},
+		{Op: BatchDelete, FileName: "missing.txt"},
+		{Op: BatchRename, OldName: "a.txt", NewName: "c.txt", Conflict: ConflictFail},
+		{Op: "chmod", FileName: "a.txt"},
+		{Op: BatchMove, SrcDirPath: "../bob", FileName: "x.txt"},
+		{Op: BatchCopy, FileName: "a.txt", DestDirPath: "", Conflict: ConflictRename},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := response.(batchResponse)
+	if resp.error() != nil {
+		t.Fatal(resp.error())
+	}
+	want := []struct {
+		err  error
+		code int
+	}{
+		{nil, 0},
+		{ErrNotFound, http.StatusNotFound},
+		{ErrAlreadyExists, http.StatusBadRequest},
+		{ErrInvalidArgument, http.StatusBadRequest},
+		{ErrPathEscape, http.StatusForbidden},
+		{ErrQuotaExceeded, http.StatusInsufficientStorage},
+	}
+	if len(resp.Results) != len(want) {
+		t.Fatalf("results = %+v", resp.Results)
+	}
+	for i, w := range want {
+		res := resp.Results[i]
+		wantError := ""
+		if w.err != nil {
+			wantError = w.err.Error()
+		}
+		if res.Error != wantError || res.Code != w.code {
+			t.Fatalf("result %d = %+v, want %q with code %d", i, res, wantError, w.code)
+		}
+	}
+
+	// the batch itself fails if it is too large
+	response, err = batch(userContext("alice"), batchRequest{Operations: make([]BatchOperation, maxBatchOperations+1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := response.(batchResponse).error(); err == nil || err.Error() != ErrInvalidArgument.Error() {
+		t.Fatalf("too large batch = %v, want ErrInvalidArgument", err)
+	}
+}
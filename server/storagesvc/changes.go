@@ -0,0 +1,222 @@
+package storagesvc
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"remote-storage/server/db"
+)
+
+const (
+	defaultChangesRetention = 30 * 24 * time.Hour
+	changesPurgeInterval    = time.Hour
+	// maxChangesPage is the maximal amount of changes returned at once
+	maxChangesPage = 1000
+)
+
+// ChangeType is the kind of the change of the file
+type ChangeType string
+
+const (
+	ChangeCreated  ChangeType = "created"
+	ChangeModified ChangeType = "modified"
+	ChangeMoved    ChangeType = "moved"
+	ChangeDeleted  ChangeType = "deleted"
+)
+
+// Change is the change of the file made by the user
+type Change struct {
+	Type ChangeType `json:"type"`
+	// Path to the file relative to the root directory of the user
+	Path string `json:"path"`
+	// OldPath is the path the file is moved from
+	OldPath string    `json:"old_path,omitempty"`
+	IsDir   bool      `json:"is_dir"`
+	Time    time.Time `json:"time"`
+}
+
+// Changes is the page of the change journal
+type Changes struct {
+	Changes []Change `json:"changes"`
+	// Token is passed as since to get the changes made after this page
+	Token string `json:"token"`
+	// HasMore means more changes are available right away
+	HasMore bool `json:"has_more,omitempty"`
+	// ResyncRequired means the changes after the token are no longer kept,
+	// the client must list the whole tree again and continue from the new Token
+	ResyncRequired bool `json:"resync_required,omitempty"`
+}
+
+// changeJournal records the changes of files of all users in the database,
+// so clients are able to sync incrementally instead of listing the whole tree
+type changeJournal struct {
+	db        db.StorageDatabase
+	logger    log.Logger
+	retention time.Duration
+
+	mu sync.Mutex
+	// wakers are closed when the user changes files through this instance
+	wakers map[string]chan struct{}
+}
+
+func newChangeJournal(database db.StorageDatabase, logger log.Logger, retention time.Duration) *changeJournal {
+	if retention <= 0 {
+		retention = defaultChangesRetention
+	}
+	return &changeJournal{
+		db:        database,
+		logger:    logger,
+		retention: retention,
+		wakers:    make(map[string]chan struct{}),
+	}
+}
+
+// record adds the change of the user to the journal. Failing to record the change
+// doesn't fail the operation which is already done, the error is only logged.
+func (j *changeJournal) record(user string, changeType ChangeType, path, oldPath string, isDir bool) {
+	_, err := j.db.AddChange(db.Change{
+		User:    user,
+		Type:    string(changeType),
+		Path:    path,
+		OldPath: oldPath,
+		IsDir:   isDir,
+		Created: time.Now(),
+	})
+	if err != nil {
+		j.logger.Log("Error:", "cannot record change", "user", user, "path", path, "err", err)
+		return
+	}
+	j.wake(user)
+}
+
+// waiter returns the channel closed on the next change of the user recorded by this instance
+func (j *changeJournal) waiter(user string) <-chan struct{} {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	waker, ok := j.wakers[user]
+	if !ok {
+		waker = make(chan struct{})
+		j.wakers[user] = waker
+	}
+	return waker
+}
+
+func (j *changeJournal) wake(user string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if waker, ok := j.wakers[user]; ok {
+		close(waker)
+		delete(j.wakers, user)
+	}
+}
+
+// runJanitor periodically removes changes older than the retention
+func (j *changeJournal) runJanitor(ctx context.Context) {
+	ticker := time.NewTicker(changesPurgeInterval)
+	defer ticker.Stop()
+	for {
+		if err := j.db.DeleteChangesBefore(time.Now().Add(-j.retention)); err != nil {
+			j.logger.Log("Error:", "cannot remove old changes", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// relativePath returns the path of the file relative to the root directory of the user
+func relativePath(userRootDir, filePath string) string {
+	root := strings.Trim(userRootDir, "/")
+	filePath = strings.Trim(filePath, "/")
+	if root == "" {
+		return filePath
+	}
+	return strings.TrimPrefix(filePath, root+"/")
+}
+
+// recordChange adds the change of the existing file at filePath to the journal
+// and updates the search index, oldPath is only used by moved files
+func (svc *service) recordChange(ctx context.Context, changeType ChangeType, filePath, oldPath string) {
+	userInf := getUserInfFromCtx(ctx)
+	info, err := svc.backend.Stat(filePath)
+	if err != nil {
+		return
+	}
+	if oldPath != "" {
+		oldPath = relativePath(userInf.RootDir, oldPath)
+	}
+	svc.changes.record(userInf.Name, changeType, relativePath(userInf.RootDir, filePath), oldPath, info.IsDir)
+	if changeType == ChangeMoved {
+		// stale entries at the destination would collide with the moved ones
+		newPath := relativePath(userInf.RootDir, filePath)
+		if svc.database.DeleteIndexEntries(userInf.Name, newPath) == nil {
+			svc.database.MoveIndexEntries(userInf.Name, oldPath, newPath)
+		}
+	} else {
+		svc.indexFile(ctx, filePath)
+	}
+}
+
+// recordDeletion adds the deletion of the file at filePath to the journal
+// and removes the file from the search index
+func (svc *service) recordDeletion(ctx context.Context, filePath string, isDir bool) {
+	userInf := getUserInfFromCtx(ctx)
+	svc.changes.record(userInf.Name, ChangeDeleted, relativePath(userInf.RootDir, filePath), "", isDir)
+	svc.database.DeleteIndexEntries(userInf.Name, relativePath(userInf.RootDir, filePath))
+}
+
+// GetChanges returns the changes made by the user after the token since.
+// The token is the sequence number of the last change of the user seen by the client.
+// Empty since returns no changes, only the token of the current state.
+func (svc *service) GetChanges(ctx context.Context, since string) (Changes, error) {
+	userName := getUserInfFromCtx(ctx).Name
+	res := Changes{Changes: []Change{}}
+	last, horizon, err := svc.changes.db.GetChangesState(userName)
+	if err != nil {
+		return res, ErrUnknownError
+	}
+	if since == "" {
+		res.Token = strconv.FormatInt(last, 10)
+		return res, nil
+	}
+	sinceSeq, err := strconv.ParseInt(since, 10, 64)
+	if err != nil || sinceSeq < 0 {
+		return res, ErrInvalidArgument
+	}
+	// the token ahead of the journal was issued before the journal was lost
+	if sinceSeq < horizon || sinceSeq > last {
+		res.Token = strconv.FormatInt(last, 10)
+		res.ResyncRequired = true
+		return res, nil
+	}
+
+	changes, err := svc.changes.db.GetChanges(userName, sinceSeq, maxChangesPage)
+	if err != nil {
+		return res, ErrUnknownError
+	}
+	for _, change := range changes {
+		res.Changes = append(res.Changes, Change{
+			Type:    ChangeType(change.Type),
+			Path:    change.Path,
+			OldPath: change.OldPath,
+			IsDir:   change.IsDir,
+			Time:    change.Created,
+		})
+	}
+	// changes recorded after last was taken may be returned too
+	if len(changes) > 0 && changes[len(changes)-1].Seq > last {
+		last = changes[len(changes)-1].Seq
+	}
+	if len(changes) == maxChangesPage {
+		last = changes[len(changes)-1].Seq
+		res.HasMore = true
+	}
+	res.Token = strconv.FormatInt(last, 10)
+	return res, nil
+}
@@ -0,0 +1,75 @@
+package storagesvc
+
+import (
+	"testing"
+	"time"
+)
+
+func TestChangesTokensArePerUser(t *testing.T) {
+	svc := newTestService(t)
+	alice, bob := userContext("alice"), userContext("bob")
+	start, err := svc.GetChanges(alice, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bobStart, err := svc.GetChanges(bob, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	upload(t, svc, "alice", "", "a.txt", "a")
+	upload(t, svc, "bob", "", "b.txt", "b")
+	upload(t, svc, "alice", "", "c.txt", "c")
+
+	changes, err := svc.GetChanges(alice, start.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes.Changes) != 2 || changes.Changes[0].Path != "a.txt" || changes.Changes[1].Path != "c.txt" {
+		t.Fatalf("got %+v", changes.Changes)
+	}
+	if changes.Token != "2" {
+		t.Fatalf("token %q, want 2", changes.Token)
+	}
+	changes, err = svc.GetChanges(bob, bobStart.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes.Changes) != 1 || changes.Token != "1" {
+		t.Fatalf("got %+v", changes)
+	}
+}
+
+func TestChangesRequireResync(t *testing.T) {
+	svc := newTestService(t)
+	ctx := userContext("alice")
+	upload(t, svc, "alice", "", "a.txt", "a")
+
+	// the token issued before the journal was lost
+	changes, err := svc.GetChanges(ctx, "10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changes.ResyncRequired || changes.Token != "1" {
+		t.Fatalf("token ahead: got %+v", changes)
+	}
+
+	upload(t, svc, "alice", "", "b.txt", "b")
+	if err := svc.database.DeleteChangesBefore(time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	changes, err = svc.GetChanges(ctx, "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changes.ResyncRequired || changes.Token != "2" {
+		t.Fatalf("purged: got %+v", changes)
+	}
+	changes, err = svc.GetChanges(ctx, "2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changes.ResyncRequired || len(changes.Changes) != 0 {
+		t.Fatalf("up to date: got %+v", changes)
+	}
+}
@@ -0,0 +1,153 @@
+package storagesvc
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"strings"
+
+	fs "remote-storage/server/storagesvc/repository/filesystem"
+)
+
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// Checksum is the expected or the computed digest of the contents of the file,
+// empty fields are not checked
+type Checksum struct {
+	// SHA256 is the hex encoded SHA-256 digest
+	SHA256 string `json:"sha256,omitempty"`
+	// CRC32C is the hex encoded CRC-32 checksum with the Castagnoli polynomial
+	CRC32C string `json:"crc32c,omitempty"`
+}
+
+func (c Checksum) validate() error {
+	if c.SHA256 != "" {
+		if b, err := hex.DecodeString(c.SHA256); err != nil || len(b) != sha256.Size {
+			return ErrInvalidArgument
+		}
+	}
+	if c.CRC32C != "" {
+		if b, err := hex.DecodeString(c.CRC32C); err != nil || len(b) != crc32.Size {
+			return ErrInvalidArgument
+		}
+	}
+	return nil
+}
+
+// verify returns ErrChecksumMismatch if the computed checksum differs from the expected one
+func (c Checksum) verify(actual Checksum) error {
+	if c.SHA256 != "" && !strings.EqualFold(c.SHA256, actual.SHA256) {
+		return ErrChecksumMismatch
+	}
+	if c.CRC32C != "" && !strings.EqualFold(c.CRC32C, actual.CRC32C) {
+		return ErrChecksumMismatch
+	}
+	return nil
+}
+
+func checksumOf(info fs.FileInfo) Checksum {
+	return Checksum{
+		SHA256: info.SHA256,
+		CRC32C: info.CRC32C,
+	}
+}
+
+// digester computes the checksum of the data written into it
+type digester struct {
+	sha256 hash.Hash
+	crc32c hash.Hash32
+}
+
+func newDigester() *digester {
+	return &digester{
+		sha256: sha256.New(),
+		crc32c: crc32.New(crc32cTable),
+	}
+}
+
+func (d *digester) Write(p []byte) (int, error) {
+	d.sha256.Write(p)
+	d.crc32c.Write(p)
+	return len(p), nil
+}
+
+func (d *digester) sum() Checksum {
+	return Checksum{
+		SHA256: hex.EncodeToString(d.sha256.Sum(nil)),
+		CRC32C: hex.EncodeToString(d.crc32c.Sum(nil)),
+	}
+}
+
+// storeAttributes keeps the checksum and the MIME type of the file, nothing is kept
+// if the backend doesn't keep attributes of files
+func (svc *service) storeAttributes(filePath string, checksum Checksum, contentType string) error {
+	store, ok := svc.backend.(fs.AttributeStore)
+	if !ok {
+		return nil
+	}
+	attrs, err := store.GetAttributes(filePath)
+	if err != nil {
+		return err
+	}
+	attrs.SHA256 = checksum.SHA256
+	attrs.CRC32C = checksum.CRC32C
+	attrs.ContentType = contentType
+	return store.SetAttributes(filePath, attrs)
+}
+
+// digestAlgorithms maps the algorithms of Content-Digest and Repr-Digest headers (RFC 9530)
+// to the fields of Checksum
+var digestAlgorithms = map[string]func(*Checksum) *string{
+	"sha-256": func(c *Checksum) *string { return &c.SHA256 },
+	"crc32c":  func(c *Checksum) *string { return &c.CRC32C },
+}
+
+// formatDigestHeader returns the value of the Repr-Digest header describing the checksum
+func formatDigestHeader(checksum Checksum) string {
+	var fields []string
+	for _, algorithm := range []string{"sha-256", "crc32c"} {
+		value := *digestAlgorithms[algorithm](&checksum)
+		if value == "" {
+			continue
+		}
+		digest, err := hex.DecodeString(value)
+		if err != nil {
+			continue
+		}
+		fields = append(fields, fmt.Sprintf("%s=:%s:", algorithm, base64.StdEncoding.EncodeToString(digest)))
+	}
+	return strings.Join(fields, ", ")
+}
+
+// parseDigestHeader reads the checksum from the value of the Content-Digest or Repr-Digest header,
+// unknown algorithms are ignored
+func parseDigestHeader(value string) (Checksum, error) {
+	var res Checksum
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		algorithm, digest, ok := strings.Cut(field, "=")
+		if !ok {
+			return res, ErrInvalidArgument
+		}
+		target, known := digestAlgorithms[strings.ToLower(strings.TrimSpace(algorithm))]
+		if !known {
+			continue
+		}
+		digest = strings.TrimSpace(digest)
+		if len(digest) < 2 || digest[0] != ':' || digest[len(digest)-1] != ':' {
+			return res, ErrInvalidArgument
+		}
+		data, err := base64.StdEncoding.DecodeString(digest[1 : len(digest)-1])
+		if err != nil {
+			return res, ErrInvalidArgument
+		}
+		*target(&res) = hex.EncodeToString(data)
+	}
+	return res, res.validate()
+}
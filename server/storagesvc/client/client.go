@@ -4,9 +4,11 @@
 package client
 
 import (
+	"context"
 	"io"
 	"net/http"
 	"remote-storage/server/storagesvc"
+	fs "remote-storage/server/storagesvc/repository/filesystem"
 	"time"
 
 	consulapi "github.com/hashicorp/consul/api"
@@ -24,6 +26,8 @@ type Service interface {
 	// but currently i didn't find a better way to set nescessary cookies
 	// (authentication cookies firstly that are returning by Authentication Service)
 	AddCookie(cookie *http.Cookie)
+	// DownloadRange downloads length bytes of the file starting from offset
+	DownloadRange(ctx context.Context, dirPath string, fileName string, offset, length int64) (io.ReadCloser, fs.FileInfo, error)
 }
 
 // New returns a service that's load-balanced over instances of storagesvc found
@@ -57,6 +61,13 @@ func New(consulAddr string, logger log.Logger) (Service, error) {
 		retry := lb.Retry(retryMax, retryTimeout, balancer)
 		endpoints.GetStateEndpoint = retry
 	}
+	{
+		factory := factoryFor(storagesvc.MakeListEndpoint)
+		endpointer := sd.NewEndpointer(instancer, factory, logger)
+		balancer := lb.NewRoundRobin(endpointer)
+		retry := lb.Retry(retryMax, retryTimeout, balancer)
+		endpoints.ListEndpoint = retry
+	}
 	{
 		factory := factoryFor(storagesvc.MakeMkDirEndpoint)
 		endpointer := sd.NewEndpointer(instancer, factory, logger)
@@ -106,6 +117,300 @@ func New(consulAddr string, logger log.Logger) (Service, error) {
 		retry := lb.Retry(retryMax, retryTimeout, balancer)
 		endpoints.UploadEndpoint = retry
 	}
+	{
+		factory := factoryFor(storagesvc.MakeCreateUploadSessionEndpoint)
+		endpointer := sd.NewEndpointer(instancer, factory, logger)
+		balancer := lb.NewRoundRobin(endpointer)
+		retry := lb.Retry(retryMax, retryTimeout, balancer)
+		endpoints.CreateUploadSessionEndpoint = retry
+	}
+	{
+		factory := factoryFor(storagesvc.MakeGetUploadSessionEndpoint)
+		endpointer := sd.NewEndpointer(instancer, factory, logger)
+		balancer := lb.NewRoundRobin(endpointer)
+		retry := lb.Retry(retryMax, retryTimeout, balancer)
+		endpoints.GetUploadSessionEndpoint = retry
+	}
+	{
+		factory := factoryFor(storagesvc.MakeUploadChunkEndpoint)
+		endpointer := sd.NewEndpointer(instancer, factory, logger)
+		balancer := lb.NewRoundRobin(endpointer)
+		retry := lb.Retry(retryMax, retryTimeout, balancer)
+		endpoints.UploadChunkEndpoint = retry
+	}
+	{
+		factory := factoryFor(storagesvc.MakeFinalizeUploadSessionEndpoint)
+		endpointer := sd.NewEndpointer(instancer, factory, logger)
+		balancer := lb.NewRoundRobin(endpointer)
+		retry := lb.Retry(retryMax, retryTimeout, balancer)
+		endpoints.FinalizeUploadSessionEndpoint = retry
+	}
+	{
+		factory := factoryFor(storagesvc.MakeListVersionsEndpoint)
+		endpointer := sd.NewEndpointer(instancer, factory, logger)
+		balancer := lb.NewRoundRobin(endpointer)
+		retry := lb.Retry(retryMax, retryTimeout, balancer)
+		endpoints.ListVersionsEndpoint = retry
+	}
+	{
+		factory := factoryFor(storagesvc.MakeDownloadVersionEndpoint)
+		endpointer := sd.NewEndpointer(instancer, factory, logger)
+		balancer := lb.NewRoundRobin(endpointer)
+		retry := lb.Retry(retryMax, retryTimeout, balancer)
+		endpoints.DownloadVersionEndpoint = retry
+	}
+	{
+		factory := factoryFor(storagesvc.MakeRestoreVersionEndpoint)
+		endpointer := sd.NewEndpointer(instancer, factory, logger)
+		balancer := lb.NewRoundRobin(endpointer)
+		retry := lb.Retry(retryMax, retryTimeout, balancer)
+		endpoints.RestoreVersionEndpoint = retry
+	}
+	{
+		factory := factoryFor(storagesvc.MakePruneVersionsEndpoint)
+		endpointer := sd.NewEndpointer(instancer, factory, logger)
+		balancer := lb.NewRoundRobin(endpointer)
+		retry := lb.Retry(retryMax, retryTimeout, balancer)
+		endpoints.PruneVersionsEndpoint = retry
+	}
+	{
+		factory := factoryFor(storagesvc.MakeListTrashEndpoint)
+		endpointer := sd.NewEndpointer(instancer, factory, logger)
+		balancer := lb.NewRoundRobin(endpointer)
+		retry := lb.Retry(retryMax, retryTimeout, balancer)
+		endpoints.ListTrashEndpoint = retry
+	}
+	{
+		factory := factoryFor(storagesvc.MakeRestoreFromTrashEndpoint)
+		endpointer := sd.NewEndpointer(instancer, factory, logger)
+		balancer := lb.NewRoundRobin(endpointer)
+		retry := lb.Retry(retryMax, retryTimeout, balancer)
+		endpoints.RestoreFromTrashEndpoint = retry
+	}
+	{
+		factory := factoryFor(storagesvc.MakeEmptyTrashEndpoint)
+		endpointer := sd.NewEndpointer(instancer, factory, logger)
+		balancer := lb.NewRoundRobin(endpointer)
+		retry := lb.Retry(retryMax, retryTimeout, balancer)
+		endpoints.EmptyTrashEndpoint = retry
+	}
+	{
+		factory := factoryFor(storagesvc.MakeGetUsageEndpoint)
+		endpointer := sd.NewEndpointer(instancer, factory, logger)
+		balancer := lb.NewRoundRobin(endpointer)
+		retry := lb.Retry(retryMax, retryTimeout, balancer)
+		endpoints.GetUsageEndpoint = retry
+	}
+	{
+		factory := factoryFor(storagesvc.MakeSetQuotaEndpoint)
+		endpointer := sd.NewEndpointer(instancer, factory, logger)
+		balancer := lb.NewRoundRobin(endpointer)
+		retry := lb.Retry(retryMax, retryTimeout, balancer)
+		endpoints.SetQuotaEndpoint = retry
+	}
+	{
+		factory := factoryFor(storagesvc.MakeGetChangesEndpoint)
+		endpointer := sd.NewEndpointer(instancer, factory, logger)
+		balancer := lb.NewRoundRobin(endpointer)
+		retry := lb.Retry(retryMax, retryTimeout, balancer)
+		endpoints.GetChangesEndpoint = retry
+	}
+	{
+		factory := factoryFor(storagesvc.MakeWatchEndpoint)
+		endpointer := sd.NewEndpointer(instancer, factory, logger)
+		balancer := lb.NewRoundRobin(endpointer)
+		retry := lb.Retry(retryMax, retryTimeout, balancer)
+		endpoints.WatchEndpoint = retry
+	}
+	{
+		factory := factoryFor(storagesvc.MakeBatchEndpoint)
+		endpointer := sd.NewEndpointer(instancer, factory, logger)
+		balancer := lb.NewRoundRobin(endpointer)
+		retry := lb.Retry(retryMax, retryTimeout, balancer)
+		endpoints.BatchEndpoint = retry
+	}
+	{
+		factory := factoryFor(storagesvc.MakeDownloadArchiveEndpoint)
+		endpointer := sd.NewEndpointer(instancer, factory, logger)
+		balancer := lb.NewRoundRobin(endpointer)
+		retry := lb.Retry(retryMax, retryTimeout, balancer)
+		endpoints.DownloadArchiveEndpoint = retry
+	}
+	{
+		factory := factoryFor(storagesvc.MakeExtractEndpoint)
+		endpointer := sd.NewEndpointer(instancer, factory, logger)
+		balancer := lb.NewRoundRobin(endpointer)
+		retry := lb.Retry(retryMax, retryTimeout, balancer)
+		endpoints.ExtractEndpoint = retry
+	}
+	{
+		factory := factoryFor(storagesvc.MakeCreateShareLinkEndpoint)
+		endpointer := sd.NewEndpointer(instancer, factory, logger)
+		balancer := lb.NewRoundRobin(endpointer)
+		retry := lb.Retry(retryMax, retryTimeout, balancer)
+		endpoints.CreateShareLinkEndpoint = retry
+	}
+	{
+		factory := factoryFor(storagesvc.MakeListShareLinksEndpoint)
+		endpointer := sd.NewEndpointer(instancer, factory, logger)
+		balancer := lb.NewRoundRobin(endpointer)
+		retry := lb.Retry(retryMax, retryTimeout, balancer)
+		endpoints.ListShareLinksEndpoint = retry
+	}
+	{
+		factory := factoryFor(storagesvc.MakeDeleteShareLinkEndpoint)
+		endpointer := sd.NewEndpointer(instancer, factory, logger)
+		balancer := lb.NewRoundRobin(endpointer)
+		retry := lb.Retry(retryMax, retryTimeout, balancer)
+		endpoints.DeleteShareLinkEndpoint = retry
+	}
+	{
+		factory := factoryFor(storagesvc.MakeGetSharedEndpoint)
+		endpointer := sd.NewEndpointer(instancer, factory, logger)
+		balancer := lb.NewRoundRobin(endpointer)
+		retry := lb.Retry(retryMax, retryTimeout, balancer)
+		endpoints.GetSharedEndpoint = retry
+	}
+	{
+		factory := factoryFor(storagesvc.MakeDownloadSharedEndpoint)
+		endpointer := sd.NewEndpointer(instancer, factory, logger)
+		balancer := lb.NewRoundRobin(endpointer)
+		retry := lb.Retry(retryMax, retryTimeout, balancer)
+		endpoints.DownloadSharedEndpoint = retry
+	}
+	{
+		factory := factoryFor(storagesvc.MakeUploadSharedEndpoint)
+		endpointer := sd.NewEndpointer(instancer, factory, logger)
+		balancer := lb.NewRoundRobin(endpointer)
+		retry := lb.Retry(retryMax, retryTimeout, balancer)
+		endpoints.UploadSharedEndpoint = retry
+	}
+	{
+		factory := factoryFor(storagesvc.MakeGrantAccessEndpoint)
+		endpointer := sd.NewEndpointer(instancer, factory, logger)
+		balancer := lb.NewRoundRobin(endpointer)
+		retry := lb.Retry(retryMax, retryTimeout, balancer)
+		endpoints.GrantAccessEndpoint = retry
+	}
+	{
+		factory := factoryFor(storagesvc.MakeListGrantsEndpoint)
+		endpointer := sd.NewEndpointer(instancer, factory, logger)
+		balancer := lb.NewRoundRobin(endpointer)
+		retry := lb.Retry(retryMax, retryTimeout, balancer)
+		endpoints.ListGrantsEndpoint = retry
+	}
+	{
+		factory := factoryFor(storagesvc.MakeRevokeAccessEndpoint)
+		endpointer := sd.NewEndpointer(instancer, factory, logger)
+		balancer := lb.NewRoundRobin(endpointer)
+		retry := lb.Retry(retryMax, retryTimeout, balancer)
+		endpoints.RevokeAccessEndpoint = retry
+	}
+	{
+		factory := factoryFor(storagesvc.MakeListACLEndpoint)
+		endpointer := sd.NewEndpointer(instancer, factory, logger)
+		balancer := lb.NewRoundRobin(endpointer)
+		retry := lb.Retry(retryMax, retryTimeout, balancer)
+		endpoints.ListACLEndpoint = retry
+	}
+	{
+		factory := factoryFor(storagesvc.MakeAddACLEntryEndpoint)
+		endpointer := sd.NewEndpointer(instancer, factory, logger)
+		balancer := lb.NewRoundRobin(endpointer)
+		retry := lb.Retry(retryMax, retryTimeout, balancer)
+		endpoints.AddACLEntryEndpoint = retry
+	}
+	{
+		factory := factoryFor(storagesvc.MakeDeleteACLEntryEndpoint)
+		endpointer := sd.NewEndpointer(instancer, factory, logger)
+		balancer := lb.NewRoundRobin(endpointer)
+		retry := lb.Retry(retryMax, retryTimeout, balancer)
+		endpoints.DeleteACLEntryEndpoint = retry
+	}
+	{
+		factory := factoryFor(storagesvc.MakeListGroupMembersEndpoint)
+		endpointer := sd.NewEndpointer(instancer, factory, logger)
+		balancer := lb.NewRoundRobin(endpointer)
+		retry := lb.Retry(retryMax, retryTimeout, balancer)
+		endpoints.ListGroupMembersEndpoint = retry
+	}
+	{
+		factory := factoryFor(storagesvc.MakeAddGroupMemberEndpoint)
+		endpointer := sd.NewEndpointer(instancer, factory, logger)
+		balancer := lb.NewRoundRobin(endpointer)
+		retry := lb.Retry(retryMax, retryTimeout, balancer)
+		endpoints.AddGroupMemberEndpoint = retry
+	}
+	{
+		factory := factoryFor(storagesvc.MakeRemoveGroupMemberEndpoint)
+		endpointer := sd.NewEndpointer(instancer, factory, logger)
+		balancer := lb.NewRoundRobin(endpointer)
+		retry := lb.Retry(retryMax, retryTimeout, balancer)
+		endpoints.RemoveGroupMemberEndpoint = retry
+	}
+	{
+		factory := factoryFor(storagesvc.MakeSearchEndpoint)
+		endpointer := sd.NewEndpointer(instancer, factory, logger)
+		balancer := lb.NewRoundRobin(endpointer)
+		retry := lb.Retry(retryMax, retryTimeout, balancer)
+		endpoints.SearchEndpoint = retry
+	}
+	{
+		factory := factoryFor(storagesvc.MakeRebuildIndexEndpoint)
+		endpointer := sd.NewEndpointer(instancer, factory, logger)
+		balancer := lb.NewRoundRobin(endpointer)
+		retry := lb.Retry(retryMax, retryTimeout, balancer)
+		endpoints.RebuildIndexEndpoint = retry
+	}
+	{
+		factory := factoryFor(storagesvc.MakeGetMetadataEndpoint)
+		endpointer := sd.NewEndpointer(instancer, factory, logger)
+		balancer := lb.NewRoundRobin(endpointer)
+		retry := lb.Retry(retryMax, retryTimeout, balancer)
+		endpoints.GetMetadataEndpoint = retry
+	}
+	{
+		factory := factoryFor(storagesvc.MakeSetMetadataEndpoint)
+		endpointer := sd.NewEndpointer(instancer, factory, logger)
+		balancer := lb.NewRoundRobin(endpointer)
+		retry := lb.Retry(retryMax, retryTimeout, balancer)
+		endpoints.SetMetadataEndpoint = retry
+	}
+	{
+		factory := factoryFor(storagesvc.MakeDeleteMetadataEndpoint)
+		endpointer := sd.NewEndpointer(instancer, factory, logger)
+		balancer := lb.NewRoundRobin(endpointer)
+		retry := lb.Retry(retryMax, retryTimeout, balancer)
+		endpoints.DeleteMetadataEndpoint = retry
+	}
+	{
+		factory := factoryFor(storagesvc.MakePreviewEndpoint)
+		endpointer := sd.NewEndpointer(instancer, factory, logger)
+		balancer := lb.NewRoundRobin(endpointer)
+		retry := lb.Retry(retryMax, retryTimeout, balancer)
+		endpoints.PreviewEndpoint = retry
+	}
+	{
+		factory := factoryFor(storagesvc.MakeListUploadTypeRulesEndpoint)
+		endpointer := sd.NewEndpointer(instancer, factory, logger)
+		balancer := lb.NewRoundRobin(endpointer)
+		retry := lb.Retry(retryMax, retryTimeout, balancer)
+		endpoints.ListUploadTypeRulesEndpoint = retry
+	}
+	{
+		factory := factoryFor(storagesvc.MakeAddUploadTypeRuleEndpoint)
+		endpointer := sd.NewEndpointer(instancer, factory, logger)
+		balancer := lb.NewRoundRobin(endpointer)
+		retry := lb.Retry(retryMax, retryTimeout, balancer)
+		endpoints.AddUploadTypeRuleEndpoint = retry
+	}
+	{
+		factory := factoryFor(storagesvc.MakeDeleteUploadTypeRuleEndpoint)
+		endpointer := sd.NewEndpointer(instancer, factory, logger)
+		balancer := lb.NewRoundRobin(endpointer)
+		retry := lb.Retry(retryMax, retryTimeout, balancer)
+		endpoints.DeleteUploadTypeRuleEndpoint = retry
+	}
 
 	return endpoints, nil
 }
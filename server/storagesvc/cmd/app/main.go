@@ -1,13 +1,19 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"github.com/go-kit/kit/log"
 	"net/http"
 	"os"
+	"remote-storage/server/db"
 	"remote-storage/server/storagesvc"
+	fs "remote-storage/server/storagesvc/repository/filesystem"
+	"remote-storage/server/storagesvc/repository/objectstorage"
 	"strconv"
+	"time"
 )
 
 type Config struct {
@@ -21,6 +27,44 @@ type Config struct {
 	Port                int    `json:"port"`
 	ConsulServerAddress string `json:"consulServerAddress"`
 	RootDirectory       string `json:"rootDirectory"`
+	// UploadSessionDirectory is the local directory keeping resumable uploads
+	UploadSessionDirectory string `json:"uploadSessionDirectory"`
+	UploadSessionTTLSec    int    `json:"uploadSessionTTLSec"`
+	// StagingDirectory is the directory of the storage keeping uploads until they are complete
+	StagingDirectory string `json:"stagingDirectory"`
+	// ConcurrentUploads is "last-writer-wins" (default), "reject" or "rename"
+	ConcurrentUploads string `json:"concurrentUploads"`
+	// AttributesDirectory is the directory of the storage keeping attributes of files such as checksums
+	AttributesDirectory string `json:"attributesDirectory"`
+	// VersionsDirectory is the directory of the storage keeping previous versions of files
+	VersionsDirectory string `json:"versionsDirectory"`
+	// PreviewsDirectory is the directory of the storage keeping cached thumbnails and text snippets
+	PreviewsDirectory string `json:"previewsDirectory"`
+	// TrashDirectory is the directory of the storage keeping deleted files
+	TrashDirectory    string `json:"trashDirectory"`
+	TrashRetentionSec int    `json:"trashRetentionSec"`
+	// ChangesRetentionSec is the time the changes of files are kept in the change journal
+	ChangesRetentionSec int `json:"changesRetentionSec"`
+	// Admins are the users allowed to manage access control lists and upload type rules
+	Admins []string `json:"admins"`
+	// Storage selects the backend keeping users' files,
+	// "local" (default) uses RootDirectory, "s3" uses the S3 settings
+	Storage struct {
+		Type string `json:"type"`
+		// Dedup stores the contents of identical files once
+		Dedup struct {
+			Enabled bool   `json:"enabled"`
+			BlobDir string `json:"blobDir"`
+		} `json:"dedup"`
+		S3 struct {
+			Endpoint        string `json:"endpoint"`
+			AccessKeyID     string `json:"accessKeyId"`
+			SecretAccessKey string `json:"secretAccessKey"`
+			Bucket          string `json:"bucket"`
+			Region          string `json:"region"`
+			UseSSL          bool   `json:"useSSL"`
+		} `json:"s3"`
+	} `json:"storage"`
 }
 
 func LoadConfiguration(file string) Config {
@@ -35,7 +79,41 @@ func LoadConfiguration(file string) Config {
 	return config
 }
 
+func NewBackend(config Config) (fs.Backend, error) {
+	backend, err := newStorageBackend(config)
+	if err != nil || !config.Storage.Dedup.Enabled {
+		return backend, err
+	}
+	return fs.NewDedupBackend(backend, fs.ConfigDedup{
+		BlobDir: config.Storage.Dedup.BlobDir,
+	}), nil
+}
+
+func newStorageBackend(config Config) (fs.Backend, error) {
+	switch config.Storage.Type {
+	case "", "local":
+		return fs.NewLocalBackend(fs.ConfigFileSystem{
+			RootDir: config.RootDirectory,
+		}), nil
+	case "s3":
+		s3 := config.Storage.S3
+		return objectstorage.New(objectstorage.Config{
+			Endpoint:        s3.Endpoint,
+			AccessKeyID:     s3.AccessKeyID,
+			SecretAccessKey: s3.SecretAccessKey,
+			Bucket:          s3.Bucket,
+			Region:          s3.Region,
+			UseSSL:          s3.UseSSL,
+		})
+	default:
+		return nil, fmt.Errorf("unknown storage type %q", config.Storage.Type)
+	}
+}
+
 func main() {
+	rebuildIndex := flag.Bool("rebuild-index", false, "rebuild the search indexes of all users and exit")
+	flag.Parse()
+
 	config := LoadConfiguration("storagesvc\\config\\config.json")
 	logFile, err := os.OpenFile("storagesvc\\log\\log.txt", os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
 	if err != nil {
@@ -49,15 +127,75 @@ func main() {
 		logger = log.With(logger, "caller", log.DefaultCaller)
 	}
 
+	backend, err := NewBackend(config)
+	if err != nil {
+		fmt.Println("Error creating storage backend:", err)
+		os.Exit(1)
+	}
+	if dedup, ok := backend.(*fs.DedupBackend); ok {
+		// repair reference counts left by an interrupted run, files are served meanwhile
+		go func() {
+			removed, err := dedup.CollectGarbage()
+			logger.Log("method", "CollectGarbage", "removed", removed, "err", err)
+		}()
+	}
+
+	// the change journal, share links and access control lists are kept in memory if no database is configured
+	var database db.StorageDatabase = db.NewStorageDatabaseMemory()
+	if config.Database.Host == "" {
+		logger.Log("Warning:", "no database specified, the change journal, share links, grants and the search index are kept in memory")
+	} else {
+		var pg db.StorageDatabasePG
+		err = pg.Connect(config.Database.User, config.Database.Password, config.Database.Name, config.Database.Host)
+		if err != nil {
+			fmt.Println("Error connecting to database:", err)
+			os.Exit(1)
+		}
+		database = &pg
+	}
+
 	var s storagesvc.Service
 	{
 		s = storagesvc.NewFileSystemService(logger, storagesvc.Config{
-			RootDir:             config.RootDirectory,
+			Backend:             backend,
 			ConsulServerAddress: config.ConsulServerAddress,
+			UploadSessionDir:    config.UploadSessionDirectory,
+			UploadSessionTTL:    time.Duration(config.UploadSessionTTLSec) * time.Second,
+			StagingDir:          config.StagingDirectory,
+			ConcurrentUploads:   storagesvc.UploadPolicy(config.ConcurrentUploads),
+			AttributesDir:       config.AttributesDirectory,
+			VersionsDir:         config.VersionsDirectory,
+			PreviewsDir:         config.PreviewsDirectory,
+			TrashDir:            config.TrashDirectory,
+			TrashRetention:      time.Duration(config.TrashRetentionSec) * time.Second,
+			Database:            database,
+			ChangesRetention:    time.Duration(config.ChangesRetentionSec) * time.Second,
+			Admins:              config.Admins,
 		})
+		s = storagesvc.PolicyMiddleware(database)(s)
 		s = storagesvc.LoggingMiddleware(logger)(s)
 	}
 
+	if *rebuildIndex {
+		// the index kept in memory is lost on exit, so only the database index is rebuilt
+		if config.Database.Host == "" {
+			fmt.Println("Error rebuilding search index: no database specified")
+			os.Exit(1)
+		}
+		users, err := database.GetUsers()
+		if err != nil {
+			fmt.Println("Error rebuilding search index:", err)
+			os.Exit(1)
+		}
+		indexed, err := storagesvc.RebuildIndexes(context.Background(), s, users)
+		if err != nil {
+			fmt.Println("Error rebuilding search index:", err)
+			os.Exit(1)
+		}
+		fmt.Println("Indexed files:", indexed)
+		return
+	}
+
 	var h http.Handler
 	{
 		h = storagesvc.MakeHttpHandler(s)
@@ -0,0 +1,204 @@
+package storagesvc
+
+import (
+	"context"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	fs "remote-storage/server/storagesvc/repository/filesystem"
+)
+
+// ConflictPolicy defines what happens when the destination of an operation already exists
+type ConflictPolicy string
+
+const (
+	// ConflictFail makes the operation fail with ErrAlreadyExists
+	ConflictFail ConflictPolicy = "fail"
+	// ConflictOverwrite replaces the existing destination
+	ConflictOverwrite ConflictPolicy = "overwrite"
+	// ConflictRename picks a free name for the destination, "file.txt" becomes "file (1).txt"
+	ConflictRename ConflictPolicy = "rename"
+	// ConflictSkip leaves the existing destination as it is, directories are merged
+	// skipping the files which exist in both of them
+	ConflictSkip ConflictPolicy = "skip"
+)
+
+// parseConflictPolicy returns the policy named by s, empty s means ConflictFail
+func parseConflictPolicy(s string) (ConflictPolicy, error) {
+	switch p := ConflictPolicy(s); p {
+	case "":
+		return ConflictFail, nil
+	case ConflictFail, ConflictOverwrite, ConflictRename, ConflictSkip:
+		return p, nil
+	default:
+		return "", ErrInvalidArgument
+	}
+}
+
+// Action is what the operation did with its destination
+type Action string
+
+const (
+	// ActionCreated means the destination didn't exist
+	ActionCreated Action = "created"
+	// ActionOverwritten means the existing destination was replaced
+	ActionOverwritten Action = "overwritten"
+	// ActionRenamed means the operation used a free name instead of the existing destination
+	ActionRenamed Action = "renamed"
+	// ActionSkipped means nothing was done because the destination exists
+	ActionSkipped Action = "skipped"
+	// ActionMerged means the directory was merged into the existing one
+	ActionMerged Action = "merged"
+)
+
+// Result reports the outcome of the operation writing to a destination
+type Result struct {
+	// Path is the path of the destination actually written to
+	Path string `json:"path,omitempty"`
+	// Action is what was done with the destination
+	Action Action `json:"action,omitempty"`
+	// Skipped are the paths of the existing files left in place while merging directories
+	Skipped []string `json:"skipped,omitempty"`
+}
+
+// resolveConflict applies the policy if something exists at destPath, the destination of the operation
+// with the source at srcPath, srcPath is empty for new files. It returns the path the operation must
+// write to and what is going to happen with the destination. The replaced file is kept as a version,
+// the replaced directory or the file replaced by the directory is moved to the trash.
+func (svc *service) resolveConflict(ctx context.Context, srcPath, destPath string, srcIsDir bool, policy ConflictPolicy) (string, Action, error) {
+	dest, err := svc.backend.Stat(destPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return destPath, ActionCreated, nil
+		}
+		return destPath, "", getErrorType(err)
+	}
+	if srcPath == destPath && policy != ConflictRename && policy != ConflictFail {
+		// the file is never replaced by itself
+		return destPath, ActionSkipped, nil
+	}
+	switch policy {
+	case ConflictOverwrite:
+		if !srcIsDir && !dest.IsDir {
+			if err := svc.versions.keep(destPath); err != nil {
+				return destPath, "", getErrorType(err)
+			}
+			return destPath, ActionOverwritten, nil
+		}
+		userRootDir := getUserInfFromCtx(ctx).RootDir
+		dir, name := path.Split(relativePath(userRootDir, destPath))
+		item, err := svc.trash.put(userRootDir, strings.TrimSuffix(dir, "/"), name)
+		if err != nil {
+			return destPath, "", getErrorType(err)
+		}
+		svc.recordDeletion(ctx, destPath, item.IsDir)
+		return destPath, ActionOverwritten, nil
+	case ConflictRename:
+		dirPath := path.Dir(destPath)
+		name, err := freeName(svc.backend, dirPath, path.Base(destPath))
+		if err != nil {
+			return destPath, "", getErrorType(err)
+		}
+		return path.Join(dirPath, name), ActionRenamed, nil
+	case ConflictSkip:
+		if srcIsDir && dest.IsDir {
+			return destPath, ActionMerged, nil
+		}
+		return destPath, ActionSkipped, nil
+	default:
+		return destPath, "", ErrAlreadyExists
+	}
+}
+
+// merge copies or moves the contents of the directory srcPath into the existing directory destPath.
+// Files existing in both directories are left in place and returned, nested directories are merged.
+// The moved directories are removed once they are empty.
+func (svc *service) merge(ctx context.Context, srcPath, destPath string, move bool) ([]string, error) {
+	children, err := fs.ReadDir(svc.backend, srcPath)
+	if err != nil {
+		return nil, err
+	}
+	var skipped []string
+	leftovers := false
+	for _, child := range children {
+		src, dest := path.Join(srcPath, child.Name), path.Join(destPath, child.Name)
+		info, err := svc.backend.Stat(dest)
+		switch {
+		case os.IsNotExist(err):
+			if move {
+				err = svc.backend.Rename(src, dest)
+			} else {
+				err = svc.backend.Copy(src, dest)
+			}
+			if err != nil {
+				return skipped, err
+			}
+			if move {
+				svc.recordChange(ctx, ChangeMoved, dest, src)
+				svc.moveVersions(src, dest)
+			} else {
+				svc.recordChange(ctx, ChangeCreated, dest, "")
+			}
+		case err != nil:
+			return skipped, err
+		case child.IsDir && info.IsDir:
+			nested, err := svc.merge(ctx, src, dest, move)
+			skipped = append(skipped, nested...)
+			if err != nil {
+				return skipped, err
+			}
+			leftovers = leftovers || len(nested) > 0
+		default:
+			skipped = append(skipped, dest)
+			leftovers = true
+		}
+	}
+	if move && !leftovers {
+		if err := svc.backend.RemoveAll(srcPath); err != nil {
+			return skipped, err
+		}
+		svc.recordDeletion(ctx, srcPath, true)
+	}
+	return skipped, nil
+}
+
+// exists reports whether something exists at filePath of the backend
+func exists(backend fs.Backend, filePath string) (bool, error) {
+	_, err := backend.Stat(filePath)
+	if err == nil {
+		return true, nil
+	}
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return false, err
+}
+
+// freeName returns the name derived from name which is not used in the directory dirPath,
+// "file.txt" becomes "file (1).txt", "file (2).txt" and so on
+func freeName(backend fs.Backend, dirPath, name string) (string, error) {
+	return freeNameFunc(name, func(candidate string) (bool, error) {
+		return exists(backend, path.Join(dirPath, candidate))
+	})
+}
+
+// freeNameFunc returns the first name derived from name which is not taken
+func freeNameFunc(name string, taken func(candidate string) (bool, error)) (string, error) {
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	if base == "" {
+		base, ext = name, ""
+	}
+	for i := 1; ; i++ {
+		candidate := base + " (" + strconv.Itoa(i) + ")" + ext
+		isTaken, err := taken(candidate)
+		if err != nil {
+			return "", err
+		}
+		if !isTaken {
+			return candidate, nil
+		}
+	}
+}
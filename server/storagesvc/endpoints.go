@@ -3,6 +3,7 @@ package storagesvc
 import (
 	"context"
 	"errors"
+	"fmt"
 	"github.com/go-kit/kit/endpoint"
 	httptransport "github.com/go-kit/kit/transport/http"
 	"io"
@@ -11,18 +12,82 @@ import (
 	"remote-storage/server/authsvc"
 	fs "remote-storage/server/storagesvc/repository/filesystem"
 	"strings"
+	"time"
 )
 
 type Endpoints struct {
-	GetStateEndpoint endpoint.Endpoint
-	MkDirEndpoint    endpoint.Endpoint
-	RenameEndpoint   endpoint.Endpoint
-	MoveEndpoint     endpoint.Endpoint
-	CopyEndpoint     endpoint.Endpoint
-	DeleteEndpoint   endpoint.Endpoint
-	DownloadEndpoint endpoint.Endpoint
-	UploadEndpoint   endpoint.Endpoint
-	cookies          map[string]*http.Cookie
+	GetStateEndpoint        endpoint.Endpoint
+	ListEndpoint            endpoint.Endpoint
+	MkDirEndpoint           endpoint.Endpoint
+	RenameEndpoint          endpoint.Endpoint
+	MoveEndpoint            endpoint.Endpoint
+	CopyEndpoint            endpoint.Endpoint
+	DeleteEndpoint          endpoint.Endpoint
+	BatchEndpoint           endpoint.Endpoint
+	ExtractEndpoint         endpoint.Endpoint
+	DownloadEndpoint        endpoint.Endpoint
+	DownloadArchiveEndpoint endpoint.Endpoint
+	UploadEndpoint          endpoint.Endpoint
+
+	CreateUploadSessionEndpoint   endpoint.Endpoint
+	GetUploadSessionEndpoint      endpoint.Endpoint
+	UploadChunkEndpoint           endpoint.Endpoint
+	FinalizeUploadSessionEndpoint endpoint.Endpoint
+
+	ListVersionsEndpoint    endpoint.Endpoint
+	DownloadVersionEndpoint endpoint.Endpoint
+	RestoreVersionEndpoint  endpoint.Endpoint
+	PruneVersionsEndpoint   endpoint.Endpoint
+
+	ListTrashEndpoint        endpoint.Endpoint
+	RestoreFromTrashEndpoint endpoint.Endpoint
+	EmptyTrashEndpoint       endpoint.Endpoint
+
+	GetUsageEndpoint   endpoint.Endpoint
+	SetQuotaEndpoint   endpoint.Endpoint
+	GetChangesEndpoint endpoint.Endpoint
+	WatchEndpoint      endpoint.Endpoint
+
+	CreateShareLinkEndpoint endpoint.Endpoint
+	ListShareLinksEndpoint  endpoint.Endpoint
+	DeleteShareLinkEndpoint endpoint.Endpoint
+
+	GrantAccessEndpoint  endpoint.Endpoint
+	ListGrantsEndpoint   endpoint.Endpoint
+	RevokeAccessEndpoint endpoint.Endpoint
+
+	ListACLEndpoint        endpoint.Endpoint
+	AddACLEntryEndpoint    endpoint.Endpoint
+	DeleteACLEntryEndpoint endpoint.Endpoint
+
+	ListGroupMembersEndpoint  endpoint.Endpoint
+	AddGroupMemberEndpoint    endpoint.Endpoint
+	RemoveGroupMemberEndpoint endpoint.Endpoint
+
+	ListUploadTypeRulesEndpoint  endpoint.Endpoint
+	AddUploadTypeRuleEndpoint    endpoint.Endpoint
+	DeleteUploadTypeRuleEndpoint endpoint.Endpoint
+
+	SearchEndpoint       endpoint.Endpoint
+	RebuildIndexEndpoint endpoint.Endpoint
+
+	GetMetadataEndpoint    endpoint.Endpoint
+	SetMetadataEndpoint    endpoint.Endpoint
+	DeleteMetadataEndpoint endpoint.Endpoint
+
+	PreviewEndpoint endpoint.Endpoint
+
+	// PublicEndpoints are embedded, so ApplyAuthMiddleware doesn't wrap them
+	PublicEndpoints
+
+	cookies map[string]*http.Cookie
+}
+
+// PublicEndpoints serve share links to clients without authentication
+type PublicEndpoints struct {
+	GetSharedEndpoint      endpoint.Endpoint
+	DownloadSharedEndpoint endpoint.Endpoint
+	UploadSharedEndpoint   endpoint.Endpoint
 }
 
 type Cookies []*http.Cookie
@@ -30,18 +95,98 @@ type cookiesContextKey string
 
 const contextKeyRequestCookie = cookiesContextKey("request_cookies")
 
+type ctxDownloadRangeKey struct{}
+
+// downloadRange is the byte range requested by the client,
+// non-positive length means the rest of the file
+type downloadRange struct {
+	offset int64
+	length int64
+}
+
+func (r downloadRange) header() string {
+	if r.length <= 0 {
+		return fmt.Sprintf("bytes=%d-", r.offset)
+	}
+	return fmt.Sprintf("bytes=%d-%d", r.offset, r.offset+r.length-1)
+}
+
+// WithDownloadRange returns the context making the Download method of client
+// Endpoints request only length bytes of the file starting from offset.
+func WithDownloadRange(ctx context.Context, offset, length int64) context.Context {
+	return context.WithValue(ctx, ctxDownloadRangeKey{}, downloadRange{offset: offset, length: length})
+}
+
 // MakeServerEndpoints returns an Endpoints struct where each endpoint invokes
 // the corresponding method on the Service.
 func MakeServerEndpoints(s Service) Endpoints {
 	endpoints := Endpoints{
-		GetStateEndpoint: MakeGetStateEndpoint(s),
-		MkDirEndpoint:    MakeMkDirEndpoint(s),
-		RenameEndpoint:   MakeRenameEndpoint(s),
-		MoveEndpoint:     MakeMoveEndpoint(s),
-		CopyEndpoint:     MakeCopyEndpoint(s),
-		DeleteEndpoint:   MakeDeleteEndpoint(s),
-		DownloadEndpoint: MakeDownloadEndpoint(s),
-		UploadEndpoint:   MakeUploadEndpoint(s),
+		GetStateEndpoint:        MakeGetStateEndpoint(s),
+		ListEndpoint:            MakeListEndpoint(s),
+		MkDirEndpoint:           MakeMkDirEndpoint(s),
+		RenameEndpoint:          MakeRenameEndpoint(s),
+		MoveEndpoint:            MakeMoveEndpoint(s),
+		CopyEndpoint:            MakeCopyEndpoint(s),
+		DeleteEndpoint:          MakeDeleteEndpoint(s),
+		BatchEndpoint:           MakeBatchEndpoint(s),
+		ExtractEndpoint:         MakeExtractEndpoint(s),
+		DownloadEndpoint:        MakeDownloadEndpoint(s),
+		DownloadArchiveEndpoint: MakeDownloadArchiveEndpoint(s),
+		UploadEndpoint:          MakeUploadEndpoint(s),
+
+		CreateUploadSessionEndpoint:   MakeCreateUploadSessionEndpoint(s),
+		GetUploadSessionEndpoint:      MakeGetUploadSessionEndpoint(s),
+		UploadChunkEndpoint:           MakeUploadChunkEndpoint(s),
+		FinalizeUploadSessionEndpoint: MakeFinalizeUploadSessionEndpoint(s),
+
+		ListVersionsEndpoint:    MakeListVersionsEndpoint(s),
+		DownloadVersionEndpoint: MakeDownloadVersionEndpoint(s),
+		RestoreVersionEndpoint:  MakeRestoreVersionEndpoint(s),
+		PruneVersionsEndpoint:   MakePruneVersionsEndpoint(s),
+
+		ListTrashEndpoint:        MakeListTrashEndpoint(s),
+		RestoreFromTrashEndpoint: MakeRestoreFromTrashEndpoint(s),
+		EmptyTrashEndpoint:       MakeEmptyTrashEndpoint(s),
+
+		GetUsageEndpoint:   MakeGetUsageEndpoint(s),
+		SetQuotaEndpoint:   MakeSetQuotaEndpoint(s),
+		GetChangesEndpoint: MakeGetChangesEndpoint(s),
+		WatchEndpoint:      MakeWatchEndpoint(s),
+
+		CreateShareLinkEndpoint: MakeCreateShareLinkEndpoint(s),
+		ListShareLinksEndpoint:  MakeListShareLinksEndpoint(s),
+		DeleteShareLinkEndpoint: MakeDeleteShareLinkEndpoint(s),
+
+		GrantAccessEndpoint:  MakeGrantAccessEndpoint(s),
+		ListGrantsEndpoint:   MakeListGrantsEndpoint(s),
+		RevokeAccessEndpoint: MakeRevokeAccessEndpoint(s),
+
+		ListACLEndpoint:        MakeListACLEndpoint(s),
+		AddACLEntryEndpoint:    MakeAddACLEntryEndpoint(s),
+		DeleteACLEntryEndpoint: MakeDeleteACLEntryEndpoint(s),
+
+		ListGroupMembersEndpoint:  MakeListGroupMembersEndpoint(s),
+		AddGroupMemberEndpoint:    MakeAddGroupMemberEndpoint(s),
+		RemoveGroupMemberEndpoint: MakeRemoveGroupMemberEndpoint(s),
+
+		ListUploadTypeRulesEndpoint:  MakeListUploadTypeRulesEndpoint(s),
+		AddUploadTypeRuleEndpoint:    MakeAddUploadTypeRuleEndpoint(s),
+		DeleteUploadTypeRuleEndpoint: MakeDeleteUploadTypeRuleEndpoint(s),
+
+		SearchEndpoint:       MakeSearchEndpoint(s),
+		RebuildIndexEndpoint: MakeRebuildIndexEndpoint(s),
+
+		GetMetadataEndpoint:    MakeGetMetadataEndpoint(s),
+		SetMetadataEndpoint:    MakeSetMetadataEndpoint(s),
+		DeleteMetadataEndpoint: MakeDeleteMetadataEndpoint(s),
+
+		PreviewEndpoint: MakePreviewEndpoint(s),
+
+		PublicEndpoints: PublicEndpoints{
+			GetSharedEndpoint:      MakeGetSharedEndpoint(s),
+			DownloadSharedEndpoint: MakeDownloadSharedEndpoint(s),
+			UploadSharedEndpoint:   MakeUploadSharedEndpoint(s),
+		},
 	}
 
 	return endpoints
@@ -63,97 +208,169 @@ func MakeClientEndpoints(instance string) (Endpoints, error) {
 	options := []httptransport.ClientOption{}
 
 	return Endpoints{
-		GetStateEndpoint: httptransport.NewClient("POST", tgt, encodeGetStateRequest, decodeGetStateResponse, options...).Endpoint(),
-		MkDirEndpoint:    httptransport.NewClient("POST", tgt, encodeMkDirRequest, decodeMkDirResponse, options...).Endpoint(),
-		RenameEndpoint:   httptransport.NewClient("POST", tgt, encodeRenameRequest, decodeRenameResponse, options...).Endpoint(),
-		MoveEndpoint:     httptransport.NewClient("POST", tgt, encodeMoveRequest, decodeMoveResponse, options...).Endpoint(),
-		CopyEndpoint:     httptransport.NewClient("POST", tgt, encodeCopyRequest, decodeCopyResponse, options...).Endpoint(),
-		DeleteEndpoint:   httptransport.NewClient("POST", tgt, encodeDeleteRequest, decodeDeleteResponse, options...).Endpoint(),
-		DownloadEndpoint: httptransport.NewClient("POST", tgt, encodeDownloadRequest, decodeDownloadResponse, options...).Endpoint(),
-		UploadEndpoint:   httptransport.NewClient("POST", tgt, encodeUploadRequest, decodeUdploadResponse, options...).Endpoint(),
+		GetStateEndpoint:        httptransport.NewClient("POST", tgt, encodeGetStateRequest, decodeGetStateResponse, options...).Endpoint(),
+		ListEndpoint:            httptransport.NewClient("POST", tgt, encodeListRequest, decodeListResponse, options...).Endpoint(),
+		MkDirEndpoint:           httptransport.NewClient("POST", tgt, encodeMkDirRequest, decodeMkDirResponse, options...).Endpoint(),
+		RenameEndpoint:          httptransport.NewClient("POST", tgt, encodeRenameRequest, decodeRenameResponse, options...).Endpoint(),
+		MoveEndpoint:            httptransport.NewClient("POST", tgt, encodeMoveRequest, decodeMoveResponse, options...).Endpoint(),
+		CopyEndpoint:            httptransport.NewClient("POST", tgt, encodeCopyRequest, decodeCopyResponse, options...).Endpoint(),
+		DeleteEndpoint:          httptransport.NewClient("POST", tgt, encodeDeleteRequest, decodeDeleteResponse, options...).Endpoint(),
+		BatchEndpoint:           httptransport.NewClient("POST", tgt, encodeBatchRequest, decodeBatchResponse, options...).Endpoint(),
+		ExtractEndpoint:         httptransport.NewClient("POST", tgt, encodeExtractRequest, decodeExtractResponse, options...).Endpoint(),
+		DownloadEndpoint:        httptransport.NewClient("POST", tgt, encodeDownloadRequest, decodeDownloadResponse, append(options, httptransport.BufferedStream(true))...).Endpoint(),
+		DownloadArchiveEndpoint: httptransport.NewClient("POST", tgt, encodeDownloadArchiveRequest, decodeDownloadResponse, append(options, httptransport.BufferedStream(true))...).Endpoint(),
+		UploadEndpoint:          httptransport.NewClient("POST", tgt, encodeUploadRequest, decodeUdploadResponse, options...).Endpoint(),
+
+		CreateUploadSessionEndpoint:   httptransport.NewClient("POST", tgt, encodeCreateUploadSessionRequest, decodeUploadSessionResponse, options...).Endpoint(),
+		GetUploadSessionEndpoint:      httptransport.NewClient("GET", tgt, encodeGetUploadSessionRequest, decodeUploadSessionResponse, options...).Endpoint(),
+		UploadChunkEndpoint:           httptransport.NewClient("PUT", tgt, encodeUploadChunkRequest, decodeUploadSessionResponse, options...).Endpoint(),
+		FinalizeUploadSessionEndpoint: httptransport.NewClient("POST", tgt, encodeFinalizeUploadSessionRequest, decodeFinalizeUploadSessionResponse, options...).Endpoint(),
+
+		ListVersionsEndpoint:    httptransport.NewClient("POST", tgt, encodeListVersionsRequest, decodeListVersionsResponse, options...).Endpoint(),
+		DownloadVersionEndpoint: httptransport.NewClient("POST", tgt, encodeDownloadVersionRequest, decodeDownloadResponse, append(options, httptransport.BufferedStream(true))...).Endpoint(),
+		RestoreVersionEndpoint:  httptransport.NewClient("POST", tgt, encodeRestoreVersionRequest, decodeRestoreVersionResponse, options...).Endpoint(),
+		PruneVersionsEndpoint:   httptransport.NewClient("POST", tgt, encodePruneVersionsRequest, decodePruneVersionsResponse, options...).Endpoint(),
+
+		ListTrashEndpoint:        httptransport.NewClient("POST", tgt, encodeListTrashRequest, decodeListTrashResponse, options...).Endpoint(),
+		RestoreFromTrashEndpoint: httptransport.NewClient("POST", tgt, encodeRestoreFromTrashRequest, decodeRestoreFromTrashResponse, options...).Endpoint(),
+		EmptyTrashEndpoint:       httptransport.NewClient("POST", tgt, encodeEmptyTrashRequest, decodeEmptyTrashResponse, options...).Endpoint(),
+
+		GetUsageEndpoint:   httptransport.NewClient("GET", tgt, encodeGetUsageRequest, decodeGetUsageResponse, options...).Endpoint(),
+		SetQuotaEndpoint:   httptransport.NewClient("POST", tgt, encodeSetQuotaRequest, decodeSetQuotaResponse, options...).Endpoint(),
+		GetChangesEndpoint: httptransport.NewClient("GET", tgt, encodeGetChangesRequest, decodeGetChangesResponse, options...).Endpoint(),
+		WatchEndpoint:      httptransport.NewClient("GET", tgt, encodeWatchRequest, decodeWatchResponse, append(options, httptransport.BufferedStream(true))...).Endpoint(),
+
+		CreateShareLinkEndpoint: httptransport.NewClient("POST", tgt, encodeCreateShareLinkRequest, decodeCreateShareLinkResponse, options...).Endpoint(),
+		ListShareLinksEndpoint:  httptransport.NewClient("GET", tgt, encodeListShareLinksRequest, decodeListShareLinksResponse, options...).Endpoint(),
+		DeleteShareLinkEndpoint: httptransport.NewClient("POST", tgt, encodeDeleteShareLinkRequest, decodeDeleteShareLinkResponse, options...).Endpoint(),
+
+		GrantAccessEndpoint:  httptransport.NewClient("POST", tgt, encodeGrantAccessRequest, decodeGrantAccessResponse, options...).Endpoint(),
+		ListGrantsEndpoint:   httptransport.NewClient("GET", tgt, encodeListGrantsRequest, decodeListGrantsResponse, options...).Endpoint(),
+		RevokeAccessEndpoint: httptransport.NewClient("POST", tgt, encodeRevokeAccessRequest, decodeRevokeAccessResponse, options...).Endpoint(),
+
+		ListACLEndpoint:        httptransport.NewClient("GET", tgt, encodeListACLRequest, decodeListACLResponse, options...).Endpoint(),
+		AddACLEntryEndpoint:    httptransport.NewClient("POST", tgt, encodeAddACLEntryRequest, decodeAddACLEntryResponse, options...).Endpoint(),
+		DeleteACLEntryEndpoint: httptransport.NewClient("POST", tgt, encodeDeleteACLEntryRequest, decodeDeleteACLEntryResponse, options...).Endpoint(),
+
+		ListGroupMembersEndpoint:  httptransport.NewClient("GET", tgt, encodeListGroupMembersRequest, decodeListGroupMembersResponse, options...).Endpoint(),
+		AddGroupMemberEndpoint:    httptransport.NewClient("POST", tgt, encodeAddGroupMemberRequest, decodeAddGroupMemberResponse, options...).Endpoint(),
+		RemoveGroupMemberEndpoint: httptransport.NewClient("POST", tgt, encodeRemoveGroupMemberRequest, decodeRemoveGroupMemberResponse, options...).Endpoint(),
+
+		ListUploadTypeRulesEndpoint:  httptransport.NewClient("GET", tgt, encodeListUploadTypeRulesRequest, decodeListUploadTypeRulesResponse, options...).Endpoint(),
+		AddUploadTypeRuleEndpoint:    httptransport.NewClient("POST", tgt, encodeAddUploadTypeRuleRequest, decodeAddUploadTypeRuleResponse, options...).Endpoint(),
+		DeleteUploadTypeRuleEndpoint: httptransport.NewClient("POST", tgt, encodeDeleteUploadTypeRuleRequest, decodeDeleteUploadTypeRuleResponse, options...).Endpoint(),
+
+		SearchEndpoint:       httptransport.NewClient("POST", tgt, encodeSearchRequest, decodeSearchResponse, options...).Endpoint(),
+		RebuildIndexEndpoint: httptransport.NewClient("POST", tgt, encodeRebuildIndexRequest, decodeRebuildIndexResponse, options...).Endpoint(),
+
+		GetMetadataEndpoint:    httptransport.NewClient("POST", tgt, encodeGetMetadataRequest, decodeGetMetadataResponse, options...).Endpoint(),
+		SetMetadataEndpoint:    httptransport.NewClient("POST", tgt, encodeSetMetadataRequest, decodeSetMetadataResponse, options...).Endpoint(),
+		DeleteMetadataEndpoint: httptransport.NewClient("POST", tgt, encodeDeleteMetadataRequest, decodeDeleteMetadataResponse, options...).Endpoint(),
+
+		PreviewEndpoint: httptransport.NewClient("POST", tgt, encodePreviewRequest, decodePreviewResponse, append(options, httptransport.BufferedStream(true))...).Endpoint(),
+
+		PublicEndpoints: PublicEndpoints{
+			GetSharedEndpoint:      httptransport.NewClient("GET", tgt, encodeGetSharedRequest, decodeGetSharedResponse, options...).Endpoint(),
+			DownloadSharedEndpoint: httptransport.NewClient("GET", tgt, encodeDownloadSharedRequest, decodeDownloadResponse, append(options, httptransport.BufferedStream(true))...).Endpoint(),
+			UploadSharedEndpoint:   httptransport.NewClient("POST", tgt, encodeUploadSharedRequest, decodeUdploadResponse, options...).Endpoint(),
+		},
 	}, nil
 }
 
 // GetState implements Service. Primarily useful in a client.
 func (e Endpoints) GetState(ctx context.Context) (fs.FileInfo, error) {
-	e.setCookies(ctx)
-	request := getStateRequest{
-		UserRootDir: userRootDir,
-	}
+	ctx = e.setCookies(ctx)
+	request := getStateRequest{}
 	response, err := e.GetStateEndpoint(ctx, request)
 	if err != nil {
 		return fs.FileInfo{}, err
 	}
 	resp := response.(getStateResponse)
-	return resp.Info, errors.New(resp.Error)
+	return resp.Info, resp.error()
+}
+
+// List implements Service. Primarily useful in a client.
+func (e Endpoints) List(ctx context.Context, options ListOptions) (ListPage, error) {
+	ctx = e.setCookies(ctx)
+	request := listRequest{options}
+	response, err := e.ListEndpoint(ctx, request)
+	if err != nil {
+		return ListPage{}, err
+	}
+	resp := response.(listResponse)
+	return resp.ListPage, resp.error()
 }
 
 // MkDir implements Service. Primarily useful in a client.
-func (e Endpoints) MkDir(ctx context.Context, path string, dirName string) (string, error) {
-	e.setCookies(ctx)
+func (e Endpoints) MkDir(ctx context.Context, path string, dirName string, conflict ConflictPolicy) (Result, error) {
+	ctx = e.setCookies(ctx)
 	request := mkDirRequest{
-		Path:    path,
-		DirName: dirName,
+		Path:     path,
+		DirName:  dirName,
+		Conflict: conflict,
 	}
 	response, err := e.MkDirEndpoint(ctx, request)
 	if err != nil {
-		return "", err
+		return Result{}, err
 	}
 	resp := response.(mkDirResponse)
-	return resp.Path, errors.New(resp.Error)
+	return resp.Result, resp.error()
 }
 
 // Rename implements Service. Primarily useful in a client.
-func (e Endpoints) Rename(ctx context.Context, dirPath string, oldName string, newName string) (string, error) {
-	e.setCookies(ctx)
+func (e Endpoints) Rename(ctx context.Context, dirPath string, oldName string, newName string, conflict ConflictPolicy) (Result, error) {
+	ctx = e.setCookies(ctx)
 	request := renameRequest{
-		DirPath: dirPath,
-		OldName: oldName,
-		NewName: newName,
+		DirPath:  dirPath,
+		OldName:  oldName,
+		NewName:  newName,
+		Conflict: conflict,
 	}
 	response, err := e.RenameEndpoint(ctx, request)
 	if err != nil {
-		return "", err
+		return Result{}, err
 	}
 	resp := response.(renameResponse)
-	return resp.Path, errors.New(resp.Error)
+	return resp.Result, resp.error()
 }
 
 // Move implements Service. Primarily useful in a client.
-func (e Endpoints) Move(ctx context.Context, srcDirPath string, fileName string, destDirPath string) (string, error) {
-	e.setCookies(ctx)
+func (e Endpoints) Move(ctx context.Context, srcDirPath string, fileName string, destDirPath string, conflict ConflictPolicy) (Result, error) {
+	ctx = e.setCookies(ctx)
 	request := moveRequest{
 		SrcDirPath:  srcDirPath,
 		FileName:    fileName,
 		DestDirPath: destDirPath,
+		Conflict:    conflict,
 	}
 	response, err := e.MoveEndpoint(ctx, request)
 	if err != nil {
-		return "", err
+		return Result{}, err
 	}
 	resp := response.(moveResponse)
-	return resp.Path, errors.New(resp.Error)
+	return resp.Result, resp.error()
 }
 
 // Copy implements Service. Primarily useful in a client.
-func (e Endpoints) Copy(ctx context.Context, srcDirPath string, fileName string, destDirPath string) (string, error) {
-	e.setCookies(ctx)
+func (e Endpoints) Copy(ctx context.Context, srcDirPath string, fileName string, destDirPath string, conflict ConflictPolicy) (Result, error) {
+	ctx = e.setCookies(ctx)
 	request := copyRequest{
 		SrcDirPath:  srcDirPath,
 		FileName:    fileName,
 		DestDirPath: destDirPath,
+		Conflict:    conflict,
 	}
 	response, err := e.CopyEndpoint(ctx, request)
 	if err != nil {
-		return "", err
+		return Result{}, err
 	}
 	resp := response.(copyResponse)
-	return resp.Path, errors.New(resp.Error)
+	return resp.Result, resp.error()
 }
 
 // Delete implements Service. Primarily useful in a client.
 func (e Endpoints) Delete(ctx context.Context, dirPath string, fileName string) (string, error) {
-	e.setCookies(ctx)
+	ctx = e.setCookies(ctx)
 	request := deleteRequest{
 		DirPath:  dirPath,
 		FileName: fileName,
@@ -163,224 +380,1294 @@ func (e Endpoints) Delete(ctx context.Context, dirPath string, fileName string)
 		return "", err
 	}
 	resp := response.(deleteResponse)
-	return resp.Path, errors.New(resp.Error)
+	return resp.Path, resp.error()
+}
+
+// Batch implements Service. Primarily useful in a client.
+func (e Endpoints) Batch(ctx context.Context, operations []BatchOperation, stopOnError bool) ([]BatchResult, error) {
+	ctx = e.setCookies(ctx)
+	request := batchRequest{
+		Operations:  operations,
+		StopOnError: stopOnError,
+	}
+	response, err := e.BatchEndpoint(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	resp := response.(batchResponse)
+	return resp.Results, resp.error()
+}
+
+// Extract implements Service. Primarily useful in a client.
+func (e Endpoints) Extract(ctx context.Context, dirPath, fileName, destDirPath string, conflict ConflictPolicy) ([]Result, error) {
+	ctx = e.setCookies(ctx)
+	request := extractRequest{
+		DirPath:     dirPath,
+		FileName:    fileName,
+		DestDirPath: destDirPath,
+		Conflict:    conflict,
+	}
+	response, err := e.ExtractEndpoint(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	resp := response.(extractResponse)
+	return resp.Results, resp.error()
 }
 
 // Download implements Service. Primarily useful in a client.
-func (e Endpoints) Download(ctx context.Context, dirPath string, fileName string) (io.ReadCloser, error) {
-	e.setCookies(ctx)
+// Size of the returned info is the amount of bytes in the response body.
+func (e Endpoints) Download(ctx context.Context, dirPath string, fileName string) (io.ReadCloser, fs.FileInfo, error) {
+	ctx = e.setCookies(ctx)
 	request := downloadRequest{
 		DirPath:  dirPath,
 		FileName: fileName,
 	}
 	response, err := e.DownloadEndpoint(ctx, request)
 	if err != nil {
-		return nil, err
+		return nil, fs.FileInfo{}, err
+	}
+	resp := response.(downloadResponse)
+	return resp.Buffer, resp.Info, resp.error()
+}
+
+// DownloadRange downloads length bytes of the file starting from offset,
+// non-positive length means the rest of the file.
+func (e Endpoints) DownloadRange(ctx context.Context, dirPath string, fileName string, offset, length int64) (io.ReadCloser, fs.FileInfo, error) {
+	return e.Download(WithDownloadRange(ctx, offset, length), dirPath, fileName)
+}
+
+// DownloadArchive implements Service. Primarily useful in a client.
+func (e Endpoints) DownloadArchive(ctx context.Context, dirPath string, fileNames []string, format ArchiveFormat) (io.ReadCloser, fs.FileInfo, error) {
+	ctx = e.setCookies(ctx)
+	request := downloadArchiveRequest{
+		DirPath:   dirPath,
+		FileNames: fileNames,
+		Format:    format,
+	}
+	response, err := e.DownloadArchiveEndpoint(ctx, request)
+	if err != nil {
+		return nil, fs.FileInfo{}, err
 	}
 	resp := response.(downloadResponse)
-	return resp.Buffer, errors.New(resp.Error)
+	return resp.Buffer, resp.Info, resp.error()
 }
 
 // Upload implements Service. Primarily useful in a client.
-func (e Endpoints) Upload(ctx context.Context, dirPath string, fileName string, contents io.ReadCloser) error {
-	e.setCookies(ctx)
+func (e Endpoints) Upload(ctx context.Context, dirPath string, fileName string, contents io.ReadCloser, checksum Checksum, conflict ConflictPolicy) (Result, error) {
+	ctx = e.setCookies(ctx)
 	request := uploadRequest{
 		DirPath:  dirPath,
 		FileName: fileName,
 		Contents: contents,
+		Checksum: checksum,
+		Conflict: conflict,
 	}
 	response, err := e.UploadEndpoint(ctx, request)
 	if err != nil {
-		return err
+		return Result{}, err
 	}
 	resp := response.(uploadResponse)
-	return errors.New(resp.Error)
+	return resp.Result, resp.error()
 }
 
-func (e Endpoints) getAuthSvc() authsvc.Service {
-	return nil
+// CreateUploadSession implements Service. Primarily useful in a client.
+func (e Endpoints) CreateUploadSession(ctx context.Context, dirPath string, fileName string, size int64, checksum Checksum, conflict ConflictPolicy) (UploadSession, error) {
+	ctx = e.setCookies(ctx)
+	request := createUploadSessionRequest{
+		DirPath:  dirPath,
+		FileName: fileName,
+		Size:     size,
+		Checksum: checksum,
+		Conflict: conflict,
+	}
+	response, err := e.CreateUploadSessionEndpoint(ctx, request)
+	if err != nil {
+		return UploadSession{}, err
+	}
+	resp := response.(uploadSessionResponse)
+	return resp.Session, resp.error()
 }
 
-func (e Endpoints) AddCookie(cookie *http.Cookie) {
-	if e.cookies == nil {
-		e.cookies = make(map[string]*http.Cookie)
+// GetUploadSession implements Service. Primarily useful in a client.
+func (e Endpoints) GetUploadSession(ctx context.Context, id string) (UploadSession, error) {
+	ctx = e.setCookies(ctx)
+	request := getUploadSessionRequest{
+		ID: id,
 	}
-	e.cookies[cookie.Name] = cookie
+	response, err := e.GetUploadSessionEndpoint(ctx, request)
+	if err != nil {
+		return UploadSession{}, err
+	}
+	resp := response.(uploadSessionResponse)
+	return resp.Session, resp.error()
 }
 
-func (e Endpoints) DeleteCookie(cookie *http.Cookie) {
-	if e.cookies == nil {
-		e.cookies = make(map[string]*http.Cookie)
+// UploadChunk implements Service. Primarily useful in a client.
+func (e Endpoints) UploadChunk(ctx context.Context, id string, offset int64, contents io.ReadCloser) (UploadSession, error) {
+	ctx = e.setCookies(ctx)
+	request := uploadChunkRequest{
+		ID:       id,
+		Offset:   offset,
+		Contents: contents,
 	}
-	delete(e.cookies, cookie.Value)
+	response, err := e.UploadChunkEndpoint(ctx, request)
+	if err != nil {
+		return UploadSession{}, err
+	}
+	resp := response.(uploadSessionResponse)
+	return resp.Session, resp.error()
 }
 
-func (e Endpoints) setCookies(ctx context.Context) context.Context {
+// FinalizeUploadSession implements Service. Primarily useful in a client.
+func (e Endpoints) FinalizeUploadSession(ctx context.Context, id string) (Result, error) {
+	ctx = e.setCookies(ctx)
+	request := finalizeUploadSessionRequest{
+		ID: id,
+	}
+	response, err := e.FinalizeUploadSessionEndpoint(ctx, request)
+	if err != nil {
+		return Result{}, err
+	}
+	resp := response.(finalizeUploadSessionResponse)
+	return resp.Result, resp.error()
+}
 
-	var cookieArr Cookies
-	for _, v := range e.cookies {
-		cookieArr = append(cookieArr, v)
+// ListVersions implements Service. Primarily useful in a client.
+func (e Endpoints) ListVersions(ctx context.Context, dirPath string, fileName string) ([]FileVersion, error) {
+	ctx = e.setCookies(ctx)
+	request := listVersionsRequest{
+		DirPath:  dirPath,
+		FileName: fileName,
 	}
-	return context.WithValue(ctx, contextKeyRequestCookie, cookieArr)
+	response, err := e.ListVersionsEndpoint(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	resp := response.(listVersionsResponse)
+	return resp.Versions, resp.error()
 }
 
-func MakeGetStateEndpoint(svc Service) endpoint.Endpoint {
-	return func(_ context.Context, request interface{}) (interface{}, error) {
-		req := request.(getStateRequest)
-		resp, err := svc.GetState(nil)
-		if err != nil {
-			return getStateResponse{resp, err.Error()}, nil
-		}
-		return getStateResponse{resp, ""}, nil
+// DownloadVersion implements Service. Primarily useful in a client.
+func (e Endpoints) DownloadVersion(ctx context.Context, dirPath string, fileName string, versionID string) (io.ReadCloser, fs.FileInfo, error) {
+	ctx = e.setCookies(ctx)
+	request := versionRequest{
+		DirPath:   dirPath,
+		FileName:  fileName,
+		VersionID: versionID,
+	}
+	response, err := e.DownloadVersionEndpoint(ctx, request)
+	if err != nil {
+		return nil, fs.FileInfo{}, err
 	}
+	resp := response.(downloadResponse)
+	return resp.Buffer, resp.Info, resp.error()
 }
 
-func MakeMkDirEndpoint(svc Service) endpoint.Endpoint {
-	return func(_ context.Context, request interface{}) (interface{}, error) {
-		req := request.(mkDirRequest)
-		resp, err := svc.MkDir(nil, req.Path, req.DirName)
-		if err != nil {
-			return mkDirResponse{resp, err.Error()}, nil
-		}
-		return mkDirResponse{resp, ""}, nil
+// RestoreVersion implements Service. Primarily useful in a client.
+func (e Endpoints) RestoreVersion(ctx context.Context, dirPath string, fileName string, versionID string) (string, error) {
+	ctx = e.setCookies(ctx)
+	request := versionRequest{
+		DirPath:   dirPath,
+		FileName:  fileName,
+		VersionID: versionID,
 	}
+	response, err := e.RestoreVersionEndpoint(ctx, request)
+	if err != nil {
+		return "", err
+	}
+	resp := response.(restoreVersionResponse)
+	return resp.Path, resp.error()
 }
 
-func MakeRenameEndpoint(svc Service) endpoint.Endpoint {
-	return func(ctx context.Context, request interface{}) (interface{}, error) {
-		req := request.(renameRequest)
-		resp, err := svc.Rename(ctx, req.DirPath, req.OldName, req.NewName)
-		if err != nil {
-			return renameResponse{resp, err.Error()}, nil
-		}
-		return renameResponse{resp, ""}, nil
+// PruneVersions implements Service. Primarily useful in a client.
+func (e Endpoints) PruneVersions(ctx context.Context, keep int, maxAge time.Duration) (int, error) {
+	ctx = e.setCookies(ctx)
+	request := pruneVersionsRequest{
+		Keep:      keep,
+		MaxAgeSec: int64(maxAge / time.Second),
+	}
+	response, err := e.PruneVersionsEndpoint(ctx, request)
+	if err != nil {
+		return 0, err
 	}
+	resp := response.(pruneVersionsResponse)
+	return resp.Pruned, resp.error()
 }
 
-func MakeMoveEndpoint(svc Service) endpoint.Endpoint {
-	return func(ctx context.Context, request interface{}) (interface{}, error) {
-		req := request.(moveRequest)
-		resp, err := svc.Move(ctx, req.SrcDirPath, req.FileName, req.DestDirPath)
-		if err != nil {
-			return moveResponse{resp, err.Error()}, nil
-		}
-		return moveResponse{resp, ""}, nil
+// ListTrash implements Service. Primarily useful in a client.
+func (e Endpoints) ListTrash(ctx context.Context) ([]TrashItem, error) {
+	ctx = e.setCookies(ctx)
+	request := listTrashRequest{}
+	response, err := e.ListTrashEndpoint(ctx, request)
+	if err != nil {
+		return nil, err
 	}
+	resp := response.(listTrashResponse)
+	return resp.Items, resp.error()
 }
 
-func MakeCopyEndpoint(svc Service) endpoint.Endpoint {
-	return func(ctx context.Context, request interface{}) (interface{}, error) {
-		req := request.(copyRequest)
-		resp, err := svc.Copy(ctx, req.SrcDirPath, req.FileName, req.DestDirPath)
-		if err != nil {
-			return copyResponse{resp, err.Error()}, nil
-		}
-		return copyResponse{resp, ""}, nil
+// RestoreFromTrash implements Service. Primarily useful in a client.
+func (e Endpoints) RestoreFromTrash(ctx context.Context, id string, conflict ConflictPolicy) (Result, error) {
+	ctx = e.setCookies(ctx)
+	request := restoreFromTrashRequest{
+		ID:       id,
+		Conflict: conflict,
 	}
+	response, err := e.RestoreFromTrashEndpoint(ctx, request)
+	if err != nil {
+		return Result{}, err
+	}
+	resp := response.(restoreFromTrashResponse)
+	return resp.Result, resp.error()
 }
 
-func MakeDeleteEndpoint(svc Service) endpoint.Endpoint {
-	return func(ctx context.Context, request interface{}) (interface{}, error) {
-		req := request.(deleteRequest)
-		resp, err := svc.Delete(ctx, req.DirPath, req.FileName)
-		if err != nil {
-			return deleteResponse{resp, err.Error()}, nil
-		}
-		return deleteResponse{resp, ""}, nil
+// EmptyTrash implements Service. Primarily useful in a client.
+func (e Endpoints) EmptyTrash(ctx context.Context) (int, error) {
+	ctx = e.setCookies(ctx)
+	request := emptyTrashRequest{}
+	response, err := e.EmptyTrashEndpoint(ctx, request)
+	if err != nil {
+		return 0, err
 	}
+	resp := response.(emptyTrashResponse)
+	return resp.Removed, resp.error()
 }
 
-func MakeDownloadEndpoint(svc Service) endpoint.Endpoint {
-	return func(ctx context.Context, request interface{}) (interface{}, error) {
-		req := request.(downloadRequest)
-		resp, err := svc.Download(ctx, req.DirPath, req.FileName)
-		if err != nil {
-			return downloadResponse{resp, err.Error()}, nil
-		}
-		return downloadResponse{resp, ""}, nil
+// GetUsage implements Service. Primarily useful in a client.
+func (e Endpoints) GetUsage(ctx context.Context) (Usage, error) {
+	ctx = e.setCookies(ctx)
+	request := getUsageRequest{}
+	response, err := e.GetUsageEndpoint(ctx, request)
+	if err != nil {
+		return Usage{}, err
 	}
+	resp := response.(getUsageResponse)
+	return resp.Usage, resp.error()
 }
 
-func MakeUploadEndpoint(svc Service) endpoint.Endpoint {
-	return func(ctx context.Context, request interface{}) (interface{}, error) {
-		req := request.(uploadRequest)
-		err := svc.Upload(ctx, req.DirPath, req.FileName, req.Contents)
-		if err != nil {
-			return uploadResponse{err.Error()}, nil
-		}
-		return uploadResponse{""}, nil
+// SetQuota implements Service. Primarily useful in a client.
+func (e Endpoints) SetQuota(ctx context.Context, user string, quota int64) error {
+	ctx = e.setCookies(ctx)
+	request := setQuotaRequest{User: user, Quota: quota}
+	response, err := e.SetQuotaEndpoint(ctx, request)
+	if err != nil {
+		return err
 	}
+	resp := response.(setQuotaResponse)
+	return resp.error()
 }
 
-type getStateRequest struct {
-	UserRootDir string `json:"user_root_dir,omitempty"`
+// GetChanges implements Service. Primarily useful in a client.
+func (e Endpoints) GetChanges(ctx context.Context, since string) (Changes, error) {
+	ctx = e.setCookies(ctx)
+	request := getChangesRequest{Since: since}
+	response, err := e.GetChangesEndpoint(ctx, request)
+	if err != nil {
+		return Changes{}, err
+	}
+	resp := response.(getChangesResponse)
+	return resp.Changes, resp.error()
 }
 
-type getStateResponse struct {
-	Info  fs.FileInfo `json:"info"`
-	Error string      `json:"error,omitempty"`
+// Watch implements Service. Primarily useful in a client.
+// The stream of changes is closed when ctx is done or the connection is lost.
+func (e Endpoints) Watch(ctx context.Context, since string) (<-chan Changes, error) {
+	ctx = e.setCookies(ctx)
+	request := watchRequest{Since: since}
+	response, err := e.WatchEndpoint(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	resp := response.(watchResponse)
+	return resp.Changes, resp.error()
 }
 
-func (r getStateResponse) error() error {
-	return errors.New(r.Error)
+// CreateShareLink implements Service. Primarily useful in a client.
+func (e Endpoints) CreateShareLink(ctx context.Context, options ShareLinkOptions) (ShareLink, error) {
+	ctx = e.setCookies(ctx)
+	request := createShareLinkRequest{options}
+	response, err := e.CreateShareLinkEndpoint(ctx, request)
+	if err != nil {
+		return ShareLink{}, err
+	}
+	resp := response.(createShareLinkResponse)
+	return resp.ShareLink, resp.error()
 }
 
-type mkDirRequest struct {
-	// path to directory where new directory must be created
-	Path string `json:"path"`
-	// name of the directory to be created
-	DirName string `json:"dir_name,omitempty"`
+// ListShareLinks implements Service. Primarily useful in a client.
+func (e Endpoints) ListShareLinks(ctx context.Context) ([]ShareLink, error) {
+	ctx = e.setCookies(ctx)
+	request := listShareLinksRequest{}
+	response, err := e.ListShareLinksEndpoint(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	resp := response.(listShareLinksResponse)
+	return resp.Links, resp.error()
 }
 
-type mkDirResponse struct {
-	// path to created directory
-	Path string `json:"path,omitempty"`
-	// message if something went wrong
-	Error string `json:"error,omitempty"`
+// DeleteShareLink implements Service. Primarily useful in a client.
+func (e Endpoints) DeleteShareLink(ctx context.Context, token string) error {
+	ctx = e.setCookies(ctx)
+	request := deleteShareLinkRequest{Token: token}
+	response, err := e.DeleteShareLinkEndpoint(ctx, request)
+	if err != nil {
+		return err
+	}
+	resp := response.(deleteShareLinkResponse)
+	return resp.error()
 }
 
-func (r mkDirResponse) error() error {
-	return errors.New(r.Error)
+// GrantAccess implements Service. Primarily useful in a client.
+func (e Endpoints) GrantAccess(ctx context.Context, options GrantOptions) (Grant, error) {
+	ctx = e.setCookies(ctx)
+	request := grantAccessRequest{options}
+	response, err := e.GrantAccessEndpoint(ctx, request)
+	if err != nil {
+		return Grant{}, err
+	}
+	resp := response.(grantAccessResponse)
+	return resp.Grant, resp.error()
 }
 
-type renameRequest struct {
-	// path to directory
-	DirPath string `json:"dir_path"`
-	// old name of file
-	OldName string `json:"old_name,omitempty"`
-	// new name of file
-	NewName string `json:"new_name,omitempty"`
+// ListGrants implements Service. Primarily useful in a client.
+func (e Endpoints) ListGrants(ctx context.Context) ([]Grant, error) {
+	ctx = e.setCookies(ctx)
+	request := listGrantsRequest{}
+	response, err := e.ListGrantsEndpoint(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	resp := response.(listGrantsResponse)
+	return resp.Grants, resp.error()
 }
 
-type renameResponse struct {
-	// path to the renamed file
-	Path string `json:"path,omitempty"`
-	// message if something went wrong
-	Error string `json:"error,omitempty"`
+// RevokeAccess implements Service. Primarily useful in a client.
+func (e Endpoints) RevokeAccess(ctx context.Context, id int64) error {
+	ctx = e.setCookies(ctx)
+	request := revokeAccessRequest{ID: id}
+	response, err := e.RevokeAccessEndpoint(ctx, request)
+	if err != nil {
+		return err
+	}
+	resp := response.(revokeAccessResponse)
+	return resp.error()
 }
 
-func (r renameResponse) error() error {
-	return errors.New(r.Error)
+// ListACL implements Service. Primarily useful in a client.
+func (e Endpoints) ListACL(ctx context.Context) ([]ACLEntry, error) {
+	ctx = e.setCookies(ctx)
+	request := listACLRequest{}
+	response, err := e.ListACLEndpoint(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	resp := response.(listACLResponse)
+	return resp.Entries, resp.error()
 }
 
-type moveRequest struct {
-	// path to source directory
-	SrcDirPath string `json:"src_dir_path"`
-	// name of file to be moved
-	FileName string `json:"file_name,omitempty"`
-	// path to destination directory
-	DestDirPath string `json:"dest_dir_path"`
+// AddACLEntry implements Service. Primarily useful in a client.
+func (e Endpoints) AddACLEntry(ctx context.Context, entry ACLEntry) (ACLEntry, error) {
+	ctx = e.setCookies(ctx)
+	request := addACLEntryRequest{entry}
+	response, err := e.AddACLEntryEndpoint(ctx, request)
+	if err != nil {
+		return ACLEntry{}, err
+	}
+	resp := response.(addACLEntryResponse)
+	return resp.ACLEntry, resp.error()
 }
 
-type moveResponse struct {
-	// path to the moved file
-	Path string `json:"path,omitempty"`
-	// message if something went wrong
-	Error string `json:"error,omitempty"`
+// DeleteACLEntry implements Service. Primarily useful in a client.
+func (e Endpoints) DeleteACLEntry(ctx context.Context, id int64) error {
+	ctx = e.setCookies(ctx)
+	request := deleteACLEntryRequest{ID: id}
+	response, err := e.DeleteACLEntryEndpoint(ctx, request)
+	if err != nil {
+		return err
+	}
+	resp := response.(deleteACLEntryResponse)
+	return resp.error()
 }
 
-func (r moveResponse) error() error {
-	return errors.New(r.Error)
+// ListGroupMembers implements Service. Primarily useful in a client.
+func (e Endpoints) ListGroupMembers(ctx context.Context) ([]GroupMember, error) {
+	ctx = e.setCookies(ctx)
+	request := listGroupMembersRequest{}
+	response, err := e.ListGroupMembersEndpoint(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	resp := response.(listGroupMembersResponse)
+	return resp.Members, resp.error()
+}
+
+// AddGroupMember implements Service. Primarily useful in a client.
+func (e Endpoints) AddGroupMember(ctx context.Context, member GroupMember) error {
+	ctx = e.setCookies(ctx)
+	request := addGroupMemberRequest{member}
+	response, err := e.AddGroupMemberEndpoint(ctx, request)
+	if err != nil {
+		return err
+	}
+	resp := response.(addGroupMemberResponse)
+	return resp.error()
+}
+
+// RemoveGroupMember implements Service. Primarily useful in a client.
+func (e Endpoints) RemoveGroupMember(ctx context.Context, member GroupMember) error {
+	ctx = e.setCookies(ctx)
+	request := removeGroupMemberRequest{member}
+	response, err := e.RemoveGroupMemberEndpoint(ctx, request)
+	if err != nil {
+		return err
+	}
+	resp := response.(removeGroupMemberResponse)
+	return resp.error()
+}
+
+// ListUploadTypeRules implements Service. Primarily useful in a client.
+func (e Endpoints) ListUploadTypeRules(ctx context.Context) ([]UploadTypeRule, error) {
+	ctx = e.setCookies(ctx)
+	request := listUploadTypeRulesRequest{}
+	response, err := e.ListUploadTypeRulesEndpoint(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	resp := response.(listUploadTypeRulesResponse)
+	return resp.Rules, resp.error()
+}
+
+// AddUploadTypeRule implements Service. Primarily useful in a client.
+func (e Endpoints) AddUploadTypeRule(ctx context.Context, rule UploadTypeRule) (UploadTypeRule, error) {
+	ctx = e.setCookies(ctx)
+	request := addUploadTypeRuleRequest{rule}
+	response, err := e.AddUploadTypeRuleEndpoint(ctx, request)
+	if err != nil {
+		return UploadTypeRule{}, err
+	}
+	resp := response.(addUploadTypeRuleResponse)
+	return resp.UploadTypeRule, resp.error()
+}
+
+// DeleteUploadTypeRule implements Service. Primarily useful in a client.
+func (e Endpoints) DeleteUploadTypeRule(ctx context.Context, id int64) error {
+	ctx = e.setCookies(ctx)
+	request := deleteUploadTypeRuleRequest{ID: id}
+	response, err := e.DeleteUploadTypeRuleEndpoint(ctx, request)
+	if err != nil {
+		return err
+	}
+	resp := response.(deleteUploadTypeRuleResponse)
+	return resp.error()
+}
+
+// Search implements Service. Primarily useful in a client.
+func (e Endpoints) Search(ctx context.Context, options SearchOptions) (SearchResult, error) {
+	ctx = e.setCookies(ctx)
+	request := searchRequest{options}
+	response, err := e.SearchEndpoint(ctx, request)
+	if err != nil {
+		return SearchResult{}, err
+	}
+	resp := response.(searchResponse)
+	return resp.SearchResult, resp.error()
+}
+
+// RebuildIndex implements Service. Primarily useful in a client.
+func (e Endpoints) RebuildIndex(ctx context.Context) (int, error) {
+	ctx = e.setCookies(ctx)
+	request := rebuildIndexRequest{}
+	response, err := e.RebuildIndexEndpoint(ctx, request)
+	if err != nil {
+		return 0, err
+	}
+	resp := response.(rebuildIndexResponse)
+	return resp.Indexed, resp.error()
+}
+
+// GetMetadata implements Service. Primarily useful in a client.
+func (e Endpoints) GetMetadata(ctx context.Context, dirPath, fileName string) (Metadata, error) {
+	ctx = e.setCookies(ctx)
+	request := getMetadataRequest{DirPath: dirPath, FileName: fileName}
+	response, err := e.GetMetadataEndpoint(ctx, request)
+	if err != nil {
+		return Metadata{}, err
+	}
+	resp := response.(metadataResponse)
+	return resp.Metadata, resp.error()
+}
+
+// SetMetadata implements Service. Primarily useful in a client.
+func (e Endpoints) SetMetadata(ctx context.Context, dirPath, fileName string, metadata Metadata, replace bool) (Metadata, error) {
+	ctx = e.setCookies(ctx)
+	request := setMetadataRequest{DirPath: dirPath, FileName: fileName, Metadata: metadata, Replace: replace}
+	response, err := e.SetMetadataEndpoint(ctx, request)
+	if err != nil {
+		return Metadata{}, err
+	}
+	resp := response.(metadataResponse)
+	return resp.Metadata, resp.error()
+}
+
+// DeleteMetadata implements Service. Primarily useful in a client.
+func (e Endpoints) DeleteMetadata(ctx context.Context, dirPath, fileName string, keys, tags []string) (Metadata, error) {
+	ctx = e.setCookies(ctx)
+	request := deleteMetadataRequest{DirPath: dirPath, FileName: fileName, Keys: keys, Tags: tags}
+	response, err := e.DeleteMetadataEndpoint(ctx, request)
+	if err != nil {
+		return Metadata{}, err
+	}
+	resp := response.(metadataResponse)
+	return resp.Metadata, resp.error()
+}
+
+// Preview implements Service. Primarily useful in a client.
+func (e Endpoints) Preview(ctx context.Context, dirPath, fileName string, size int) (io.ReadCloser, fs.FileInfo, error) {
+	ctx = e.setCookies(ctx)
+	request := previewRequest{
+		DirPath:  dirPath,
+		FileName: fileName,
+		Size:     size,
+	}
+	response, err := e.PreviewEndpoint(ctx, request)
+	if err != nil {
+		return nil, fs.FileInfo{}, err
+	}
+	resp := response.(previewResponse)
+	return resp.Buffer, resp.Info, resp.error()
+}
+
+// GetShared implements Service. Primarily useful in a client.
+func (e Endpoints) GetShared(ctx context.Context, token, password string, options ListOptions) (SharedItem, error) {
+	request := getSharedRequest{
+		Token:       token,
+		Password:    password,
+		ListOptions: options,
+	}
+	response, err := e.GetSharedEndpoint(ctx, request)
+	if err != nil {
+		return SharedItem{}, err
+	}
+	resp := response.(getSharedResponse)
+	return resp.SharedItem, resp.error()
+}
+
+// DownloadShared implements Service. Primarily useful in a client.
+func (e Endpoints) DownloadShared(ctx context.Context, token, password, filePath string, format ArchiveFormat) (io.ReadCloser, fs.FileInfo, error) {
+	request := downloadSharedRequest{
+		Token:    token,
+		Password: password,
+		Path:     filePath,
+		Format:   format,
+	}
+	response, err := e.DownloadSharedEndpoint(ctx, request)
+	if err != nil {
+		return nil, fs.FileInfo{}, err
+	}
+	resp := response.(downloadResponse)
+	return resp.Buffer, resp.Info, resp.error()
+}
+
+// UploadShared implements Service. Primarily useful in a client.
+func (e Endpoints) UploadShared(ctx context.Context, token, password, dirPath, fileName string, contents io.ReadCloser) (Result, error) {
+	request := uploadSharedRequest{
+		Token:    token,
+		Password: password,
+		DirPath:  dirPath,
+		FileName: fileName,
+		Contents: contents,
+	}
+	response, err := e.UploadSharedEndpoint(ctx, request)
+	if err != nil {
+		return Result{}, err
+	}
+	resp := response.(uploadResponse)
+	return resp.Result, resp.error()
+}
+
+func (e Endpoints) getAuthSvc() authsvc.Service {
+	return nil
+}
+
+func (e Endpoints) AddCookie(cookie *http.Cookie) {
+	if e.cookies == nil {
+		e.cookies = make(map[string]*http.Cookie)
+	}
+	e.cookies[cookie.Name] = cookie
+}
+
+func (e Endpoints) DeleteCookie(cookie *http.Cookie) {
+	if e.cookies == nil {
+		e.cookies = make(map[string]*http.Cookie)
+	}
+	delete(e.cookies, cookie.Value)
+}
+
+func (e Endpoints) setCookies(ctx context.Context) context.Context {
+
+	var cookieArr Cookies
+	for _, v := range e.cookies {
+		cookieArr = append(cookieArr, v)
+	}
+	return context.WithValue(ctx, contextKeyRequestCookie, cookieArr)
+}
+
+func MakeGetStateEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		resp, err := svc.GetState(ctx)
+		if err != nil {
+			return getStateResponse{resp, err.Error()}, nil
+		}
+		return getStateResponse{resp, ""}, nil
+	}
+}
+
+func MakeListEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(listRequest)
+		resp, err := svc.List(ctx, req.ListOptions)
+		if err != nil {
+			return listResponse{resp, err.Error()}, nil
+		}
+		return listResponse{resp, ""}, nil
+	}
+}
+
+func MakeMkDirEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(mkDirRequest)
+		resp, err := svc.MkDir(ctx, req.Path, req.DirName, req.Conflict)
+		if err != nil {
+			return mkDirResponse{resp, err.Error()}, nil
+		}
+		return mkDirResponse{resp, ""}, nil
+	}
+}
+
+func MakeRenameEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(renameRequest)
+		resp, err := svc.Rename(ctx, req.DirPath, req.OldName, req.NewName, req.Conflict)
+		if err != nil {
+			return renameResponse{resp, err.Error()}, nil
+		}
+		return renameResponse{resp, ""}, nil
+	}
+}
+
+func MakeMoveEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(moveRequest)
+		resp, err := svc.Move(ctx, req.SrcDirPath, req.FileName, req.DestDirPath, req.Conflict)
+		if err != nil {
+			return moveResponse{resp, err.Error()}, nil
+		}
+		return moveResponse{resp, ""}, nil
+	}
+}
+
+func MakeCopyEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(copyRequest)
+		resp, err := svc.Copy(ctx, req.SrcDirPath, req.FileName, req.DestDirPath, req.Conflict)
+		if err != nil {
+			return copyResponse{resp, err.Error()}, nil
+		}
+		return copyResponse{resp, ""}, nil
+	}
+}
+
+func MakeBatchEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(batchRequest)
+		resp, err := svc.Batch(ctx, req.Operations, req.StopOnError)
+		for i := range resp {
+			if resp[i].Error != "" {
+				resp[i].Code = codeFrom(responseError(resp[i].Error))
+			}
+		}
+		if err != nil {
+			return batchResponse{resp, err.Error()}, nil
+		}
+		return batchResponse{resp, ""}, nil
+	}
+}
+
+func MakeExtractEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(extractRequest)
+		resp, err := svc.Extract(ctx, req.DirPath, req.FileName, req.DestDirPath, req.Conflict)
+		if err != nil {
+			return extractResponse{resp, err.Error()}, nil
+		}
+		return extractResponse{resp, ""}, nil
+	}
+}
+
+func MakeDeleteEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(deleteRequest)
+		resp, err := svc.Delete(ctx, req.DirPath, req.FileName)
+		if err != nil {
+			return deleteResponse{resp, err.Error()}, nil
+		}
+		return deleteResponse{resp, ""}, nil
+	}
+}
+
+func MakeDownloadEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(downloadRequest)
+		resp, info, err := svc.Download(ctx, req.DirPath, req.FileName)
+		if err != nil {
+			return downloadResponse{resp, info, err.Error()}, nil
+		}
+		return downloadResponse{resp, info, ""}, nil
+	}
+}
+
+func MakeDownloadArchiveEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(downloadArchiveRequest)
+		resp, info, err := svc.DownloadArchive(ctx, req.DirPath, req.FileNames, req.Format)
+		if err != nil {
+			return downloadResponse{resp, info, err.Error()}, nil
+		}
+		return downloadResponse{resp, info, ""}, nil
+	}
+}
+
+func MakeUploadEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(uploadRequest)
+		resp, err := svc.Upload(ctx, req.DirPath, req.FileName, req.Contents, req.Checksum, req.Conflict)
+		if err != nil {
+			return uploadResponse{resp, err.Error()}, nil
+		}
+		return uploadResponse{resp, ""}, nil
+	}
+}
+
+func MakeCreateUploadSessionEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(createUploadSessionRequest)
+		resp, err := svc.CreateUploadSession(ctx, req.DirPath, req.FileName, req.Size, req.Checksum, req.Conflict)
+		if err != nil {
+			return uploadSessionResponse{resp, err.Error()}, nil
+		}
+		return uploadSessionResponse{resp, ""}, nil
+	}
+}
+
+func MakeGetUploadSessionEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(getUploadSessionRequest)
+		resp, err := svc.GetUploadSession(ctx, req.ID)
+		if err != nil {
+			return uploadSessionResponse{resp, err.Error()}, nil
+		}
+		return uploadSessionResponse{resp, ""}, nil
+	}
+}
+
+func MakeUploadChunkEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(uploadChunkRequest)
+		resp, err := svc.UploadChunk(ctx, req.ID, req.Offset, req.Contents)
+		if err != nil {
+			return uploadSessionResponse{resp, err.Error()}, nil
+		}
+		return uploadSessionResponse{resp, ""}, nil
+	}
+}
+
+func MakeFinalizeUploadSessionEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(finalizeUploadSessionRequest)
+		resp, err := svc.FinalizeUploadSession(ctx, req.ID)
+		if err != nil {
+			return finalizeUploadSessionResponse{resp, err.Error()}, nil
+		}
+		return finalizeUploadSessionResponse{resp, ""}, nil
+	}
+}
+
+func MakeListVersionsEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(listVersionsRequest)
+		resp, err := svc.ListVersions(ctx, req.DirPath, req.FileName)
+		if err != nil {
+			return listVersionsResponse{resp, err.Error()}, nil
+		}
+		return listVersionsResponse{resp, ""}, nil
+	}
+}
+
+func MakeDownloadVersionEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(versionRequest)
+		resp, info, err := svc.DownloadVersion(ctx, req.DirPath, req.FileName, req.VersionID)
+		if err != nil {
+			return downloadResponse{resp, info, err.Error()}, nil
+		}
+		return downloadResponse{resp, info, ""}, nil
+	}
+}
+
+func MakeRestoreVersionEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(versionRequest)
+		resp, err := svc.RestoreVersion(ctx, req.DirPath, req.FileName, req.VersionID)
+		if err != nil {
+			return restoreVersionResponse{resp, err.Error()}, nil
+		}
+		return restoreVersionResponse{resp, ""}, nil
+	}
+}
+
+func MakePruneVersionsEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(pruneVersionsRequest)
+		resp, err := svc.PruneVersions(ctx, req.Keep, time.Duration(req.MaxAgeSec)*time.Second)
+		if err != nil {
+			return pruneVersionsResponse{resp, err.Error()}, nil
+		}
+		return pruneVersionsResponse{resp, ""}, nil
+	}
+}
+
+func MakeListTrashEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		resp, err := svc.ListTrash(ctx)
+		if err != nil {
+			return listTrashResponse{resp, err.Error()}, nil
+		}
+		return listTrashResponse{resp, ""}, nil
+	}
+}
+
+func MakeRestoreFromTrashEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(restoreFromTrashRequest)
+		resp, err := svc.RestoreFromTrash(ctx, req.ID, req.Conflict)
+		if err != nil {
+			return restoreFromTrashResponse{resp, err.Error()}, nil
+		}
+		return restoreFromTrashResponse{resp, ""}, nil
+	}
+}
+
+func MakeEmptyTrashEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		resp, err := svc.EmptyTrash(ctx)
+		if err != nil {
+			return emptyTrashResponse{resp, err.Error()}, nil
+		}
+		return emptyTrashResponse{resp, ""}, nil
+	}
+}
+
+func MakeGetUsageEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		resp, err := svc.GetUsage(ctx)
+		if err != nil {
+			return getUsageResponse{resp, err.Error()}, nil
+		}
+		return getUsageResponse{resp, ""}, nil
+	}
+}
+
+func MakeSetQuotaEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(setQuotaRequest)
+		err := svc.SetQuota(ctx, req.User, req.Quota)
+		if err != nil {
+			return setQuotaResponse{err.Error()}, nil
+		}
+		return setQuotaResponse{""}, nil
+	}
+}
+
+func MakeGetChangesEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(getChangesRequest)
+		resp, err := svc.GetChanges(ctx, req.Since)
+		if err != nil {
+			return getChangesResponse{resp, err.Error()}, nil
+		}
+		return getChangesResponse{resp, ""}, nil
+	}
+}
+
+func MakeWatchEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(watchRequest)
+		resp, err := svc.Watch(ctx, req.Since)
+		if err != nil {
+			return watchResponse{resp, err.Error()}, nil
+		}
+		return watchResponse{resp, ""}, nil
+	}
+}
+
+func MakeCreateShareLinkEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(createShareLinkRequest)
+		resp, err := svc.CreateShareLink(ctx, req.ShareLinkOptions)
+		if err != nil {
+			return createShareLinkResponse{resp, err.Error()}, nil
+		}
+		return createShareLinkResponse{resp, ""}, nil
+	}
+}
+
+func MakeListShareLinksEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		resp, err := svc.ListShareLinks(ctx)
+		if err != nil {
+			return listShareLinksResponse{resp, err.Error()}, nil
+		}
+		return listShareLinksResponse{resp, ""}, nil
+	}
+}
+
+func MakeDeleteShareLinkEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(deleteShareLinkRequest)
+		err := svc.DeleteShareLink(ctx, req.Token)
+		if err != nil {
+			return deleteShareLinkResponse{err.Error()}, nil
+		}
+		return deleteShareLinkResponse{""}, nil
+	}
+}
+
+func MakeGrantAccessEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(grantAccessRequest)
+		resp, err := svc.GrantAccess(ctx, req.GrantOptions)
+		if err != nil {
+			return grantAccessResponse{resp, err.Error()}, nil
+		}
+		return grantAccessResponse{resp, ""}, nil
+	}
+}
+
+func MakeListGrantsEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		resp, err := svc.ListGrants(ctx)
+		if err != nil {
+			return listGrantsResponse{resp, err.Error()}, nil
+		}
+		return listGrantsResponse{resp, ""}, nil
+	}
+}
+
+func MakeRevokeAccessEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(revokeAccessRequest)
+		err := svc.RevokeAccess(ctx, req.ID)
+		if err != nil {
+			return revokeAccessResponse{err.Error()}, nil
+		}
+		return revokeAccessResponse{""}, nil
+	}
+}
+
+func MakeListACLEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		resp, err := svc.ListACL(ctx)
+		if err != nil {
+			return listACLResponse{resp, err.Error()}, nil
+		}
+		return listACLResponse{resp, ""}, nil
+	}
+}
+
+func MakeAddACLEntryEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(addACLEntryRequest)
+		resp, err := svc.AddACLEntry(ctx, req.ACLEntry)
+		if err != nil {
+			return addACLEntryResponse{resp, err.Error()}, nil
+		}
+		return addACLEntryResponse{resp, ""}, nil
+	}
+}
+
+func MakeDeleteACLEntryEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(deleteACLEntryRequest)
+		err := svc.DeleteACLEntry(ctx, req.ID)
+		if err != nil {
+			return deleteACLEntryResponse{err.Error()}, nil
+		}
+		return deleteACLEntryResponse{""}, nil
+	}
+}
+
+func MakeListGroupMembersEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		resp, err := svc.ListGroupMembers(ctx)
+		if err != nil {
+			return listGroupMembersResponse{resp, err.Error()}, nil
+		}
+		return listGroupMembersResponse{resp, ""}, nil
+	}
+}
+
+func MakeAddGroupMemberEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(addGroupMemberRequest)
+		err := svc.AddGroupMember(ctx, req.GroupMember)
+		if err != nil {
+			return addGroupMemberResponse{err.Error()}, nil
+		}
+		return addGroupMemberResponse{""}, nil
+	}
+}
+
+func MakeRemoveGroupMemberEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(removeGroupMemberRequest)
+		err := svc.RemoveGroupMember(ctx, req.GroupMember)
+		if err != nil {
+			return removeGroupMemberResponse{err.Error()}, nil
+		}
+		return removeGroupMemberResponse{""}, nil
+	}
+}
+
+func MakeListUploadTypeRulesEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		resp, err := svc.ListUploadTypeRules(ctx)
+		if err != nil {
+			return listUploadTypeRulesResponse{resp, err.Error()}, nil
+		}
+		return listUploadTypeRulesResponse{resp, ""}, nil
+	}
+}
+
+func MakeAddUploadTypeRuleEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(addUploadTypeRuleRequest)
+		resp, err := svc.AddUploadTypeRule(ctx, req.UploadTypeRule)
+		if err != nil {
+			return addUploadTypeRuleResponse{resp, err.Error()}, nil
+		}
+		return addUploadTypeRuleResponse{resp, ""}, nil
+	}
+}
+
+func MakeDeleteUploadTypeRuleEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(deleteUploadTypeRuleRequest)
+		err := svc.DeleteUploadTypeRule(ctx, req.ID)
+		if err != nil {
+			return deleteUploadTypeRuleResponse{err.Error()}, nil
+		}
+		return deleteUploadTypeRuleResponse{""}, nil
+	}
+}
+
+func MakeSearchEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(searchRequest)
+		resp, err := svc.Search(ctx, req.SearchOptions)
+		if err != nil {
+			return searchResponse{resp, err.Error()}, nil
+		}
+		return searchResponse{resp, ""}, nil
+	}
+}
+
+func MakeRebuildIndexEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		resp, err := svc.RebuildIndex(ctx)
+		if err != nil {
+			return rebuildIndexResponse{resp, err.Error()}, nil
+		}
+		return rebuildIndexResponse{resp, ""}, nil
+	}
+}
+
+func MakeGetMetadataEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(getMetadataRequest)
+		resp, err := svc.GetMetadata(ctx, req.DirPath, req.FileName)
+		if err != nil {
+			return metadataResponse{resp, err.Error()}, nil
+		}
+		return metadataResponse{resp, ""}, nil
+	}
+}
+
+func MakeSetMetadataEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(setMetadataRequest)
+		resp, err := svc.SetMetadata(ctx, req.DirPath, req.FileName, req.Metadata, req.Replace)
+		if err != nil {
+			return metadataResponse{resp, err.Error()}, nil
+		}
+		return metadataResponse{resp, ""}, nil
+	}
+}
+
+func MakeDeleteMetadataEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(deleteMetadataRequest)
+		resp, err := svc.DeleteMetadata(ctx, req.DirPath, req.FileName, req.Keys, req.Tags)
+		if err != nil {
+			return metadataResponse{resp, err.Error()}, nil
+		}
+		return metadataResponse{resp, ""}, nil
+	}
+}
+
+func MakePreviewEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(previewRequest)
+		resp, info, err := svc.Preview(ctx, req.DirPath, req.FileName, req.Size)
+		if err != nil {
+			return previewResponse{resp, info, err.Error()}, nil
+		}
+		return previewResponse{resp, info, ""}, nil
+	}
+}
+
+func MakeGetSharedEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(getSharedRequest)
+		resp, err := svc.GetShared(ctx, req.Token, req.Password, req.ListOptions)
+		if err != nil {
+			return getSharedResponse{resp, err.Error()}, nil
+		}
+		return getSharedResponse{resp, ""}, nil
+	}
+}
+
+func MakeDownloadSharedEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(downloadSharedRequest)
+		resp, info, err := svc.DownloadShared(ctx, req.Token, req.Password, req.Path, req.Format)
+		if err != nil {
+			return downloadResponse{resp, info, err.Error()}, nil
+		}
+		return downloadResponse{resp, info, ""}, nil
+	}
+}
+
+func MakeUploadSharedEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(uploadSharedRequest)
+		resp, err := svc.UploadShared(ctx, req.Token, req.Password, req.DirPath, req.FileName, req.Contents)
+		if err != nil {
+			return uploadResponse{resp, err.Error()}, nil
+		}
+		return uploadResponse{resp, ""}, nil
+	}
+}
+
+// responseError restores the error of the response,
+// an empty message means the request succeeded
+func responseError(message string) error {
+	if message == "" {
+		return nil
+	}
+	return errors.New(message)
+}
+
+type getStateRequest struct {
+	UserRootDir string `json:"user_root_dir,omitempty"`
+}
+
+type getStateResponse struct {
+	Info  fs.FileInfo `json:"info"`
+	Error string      `json:"error,omitempty"`
+}
+
+func (r getStateResponse) error() error {
+	return responseError(r.Error)
+}
+
+type listRequest struct {
+	ListOptions
+}
+
+type listResponse struct {
+	ListPage
+	// message if something went wrong
+	Error string `json:"error,omitempty"`
+}
+
+func (r listResponse) error() error {
+	return responseError(r.Error)
+}
+
+type mkDirRequest struct {
+	// path to directory where new directory must be created
+	Path string `json:"path"`
+	// name of the directory to be created
+	DirName string `json:"dir_name,omitempty"`
+	// what to do if the destination exists: fail, overwrite, rename or skip
+	Conflict ConflictPolicy `json:"conflict,omitempty"`
+}
+
+type mkDirResponse struct {
+	// path to the created directory and what was done with the destination
+	Result
+	// message if something went wrong
+	Error string `json:"error,omitempty"`
+}
+
+func (r mkDirResponse) error() error {
+	return responseError(r.Error)
+}
+
+type renameRequest struct {
+	// path to directory
+	DirPath string `json:"dir_path"`
+	// old name of file
+	OldName string `json:"old_name,omitempty"`
+	// new name of file
+	NewName string `json:"new_name,omitempty"`
+	// what to do if the destination exists: fail, overwrite, rename or skip
+	Conflict ConflictPolicy `json:"conflict,omitempty"`
+}
+
+type renameResponse struct {
+	// path to the renamed file and what was done with the destination
+	Result
+	// message if something went wrong
+	Error string `json:"error,omitempty"`
+}
+
+func (r renameResponse) error() error {
+	return responseError(r.Error)
+}
+
+type moveRequest struct {
+	// path to source directory
+	SrcDirPath string `json:"src_dir_path"`
+	// name of file to be moved
+	FileName string `json:"file_name,omitempty"`
+	// path to destination directory
+	DestDirPath string `json:"dest_dir_path"`
+	// what to do if the destination exists: fail, overwrite, rename or skip
+	Conflict ConflictPolicy `json:"conflict,omitempty"`
+}
+
+type moveResponse struct {
+	// path to the moved file and what was done with the destination
+	Result
+	// message if something went wrong
+	Error string `json:"error,omitempty"`
+}
+
+func (r moveResponse) error() error {
+	return responseError(r.Error)
 }
 
 type copyRequest struct {
@@ -388,80 +1675,710 @@ type copyRequest struct {
 	SrcDirPath string `json:"src_dir_path"`
 	// name of file to be copied
 	FileName string `json:"file_name,omitempty"`
-	// path to destination directory
-	DestDirPath string `json:"dest_dir_path"`
+	// path to destination directory
+	DestDirPath string `json:"dest_dir_path"`
+	// what to do if the destination exists: fail, overwrite, rename or skip
+	Conflict ConflictPolicy `json:"conflict,omitempty"`
+}
+
+type copyResponse struct {
+	// path to the copied file and what was done with the destination
+	Result
+	// message if something went wrong
+	Error string `json:"error,omitempty"`
+}
+
+func (r copyResponse) error() error {
+	return responseError(r.Error)
+}
+
+type deleteRequest struct {
+	// path to the directory
+	DirPath string `json:"dir_path"`
+	// name of file to be deleted
+	FileName string `json:"file_name,omitempty"`
+}
+
+type deleteResponse struct {
+	// path to the deleted file
+	Path string `json:"path,omitempty"`
+	// message if something went wrong
+	Error string `json:"error,omitempty"`
+}
+
+func (r deleteResponse) error() error {
+	return responseError(r.Error)
+}
+
+type batchRequest struct {
+	// operations executed in order
+	Operations []BatchOperation `json:"operations"`
+	// whether the operations following the failed one are skipped
+	StopOnError bool `json:"stop_on_error,omitempty"`
+}
+
+type batchResponse struct {
+	// results of the executed operations in the order of operations
+	Results []BatchResult `json:"results"`
+	// message if something went wrong
+	Error string `json:"error,omitempty"`
+}
+
+func (r batchResponse) error() error {
+	return responseError(r.Error)
+}
+
+type extractRequest struct {
+	// path to the directory of the archive
+	DirPath string `json:"dir_path"`
+	// name of the archive: .zip, .tar, .tar.gz or .tgz
+	FileName string `json:"file_name"`
+	// path to the existing directory the archive is extracted into
+	DestDirPath string `json:"dest_dir_path"`
+	// what happens to existing files: fail (default), overwrite, rename or skip
+	Conflict ConflictPolicy `json:"conflict,omitempty"`
+}
+
+type extractResponse struct {
+	// results of the extracted entries in the order of the archive
+	Results []Result `json:"results"`
+	// message if something went wrong
+	Error string `json:"error,omitempty"`
+}
+
+func (r extractResponse) error() error {
+	return responseError(r.Error)
+}
+
+type downloadRequest struct {
+	// path to the directory
+	DirPath string `json:"dir_path"`
+	// name of file to be downloaded
+	FileName string `json:"file_name,omitempty"`
+}
+
+type downloadResponse struct {
+	// contents of the file
+	Buffer io.ReadCloser `json:"buffer,omitempty"`
+	// information about the file, sent in the response headers
+	Info fs.FileInfo `json:"-"`
+	// message if something went wrong
+	Error string `json:"error,omitempty"`
+}
+
+func (r downloadResponse) error() error {
+	return responseError(r.Error)
+}
+
+func (r downloadResponse) ReadCloser() io.ReadCloser {
+	return r.Buffer
+}
+
+func (r downloadResponse) FileInfo() fs.FileInfo {
+	return r.Info
+}
+
+type downloadArchiveRequest struct {
+	// path to the directory
+	DirPath string `json:"dir_path"`
+	// names of files in the directory to be archived, the whole directory if empty
+	FileNames []string `json:"file_names,omitempty"`
+	// format of the archive: zip (default) or tar.gz
+	Format ArchiveFormat `json:"format,omitempty"`
+}
+
+type uploadRequest struct {
+	// path to the directory
+	DirPath string `json:"dir_path"`
+	// name of file to be uploaded
+	FileName string `json:"file_name,omitempty"`
+	// contents of the file, sent as the body of the request
+	Contents io.ReadCloser `json:"-"`
+	// expected checksum of the contents, sent in the Content-Digest header
+	Checksum Checksum `json:"-"`
+	// what to do if the file exists: overwrite (default), fail, rename or skip
+	Conflict ConflictPolicy `json:"-"`
+}
+
+type uploadResponse struct {
+	// path to the stored file and what was done with the destination
+	Result
+	// message if something went wrong
+	Error string `json:"error,omitempty"`
+}
+
+func (r uploadResponse) error() error {
+	return responseError(r.Error)
+}
+
+func (r uploadRequest) ReadCloser() io.ReadCloser {
+	return r.Contents
+}
+
+type createUploadSessionRequest struct {
+	// path to the directory
+	DirPath string `json:"dir_path"`
+	// name of the file to be uploaded
+	FileName string `json:"file_name,omitempty"`
+	// total size of the file in bytes
+	Size int64 `json:"size"`
+	// expected checksum of the whole file verified when the session is finalized
+	Checksum Checksum `json:"checksum"`
+	// what to do if the file exists when the session is finalized: overwrite (default), fail, rename or skip
+	Conflict ConflictPolicy `json:"conflict,omitempty"`
+}
+
+type getUploadSessionRequest struct {
+	// id of the upload session
+	ID string `json:"id"`
+}
+
+type uploadChunkRequest struct {
+	// id of the upload session
+	ID string `json:"id"`
+	// offset of the chunk, must be equal to the committed offset of the session
+	Offset int64 `json:"offset"`
+	// contents of the chunk, sent as the raw request body
+	Contents io.ReadCloser `json:"-"`
+}
+
+type uploadSessionResponse struct {
+	// state of the upload session
+	Session UploadSession `json:"session"`
+	// message if something went wrong
+	Error string `json:"error,omitempty"`
+}
+
+func (r uploadSessionResponse) error() error {
+	return responseError(r.Error)
+}
+
+type finalizeUploadSessionRequest struct {
+	// id of the upload session
+	ID string `json:"id"`
+}
+
+type finalizeUploadSessionResponse struct {
+	// path to the uploaded file and what was done with the destination
+	Result
+	// message if something went wrong
+	Error string `json:"error,omitempty"`
+}
+
+func (r finalizeUploadSessionResponse) error() error {
+	return responseError(r.Error)
+}
+
+type listVersionsRequest struct {
+	// path to the directory
+	DirPath string `json:"dir_path"`
+	// name of the file
+	FileName string `json:"file_name,omitempty"`
 }
 
-type copyResponse struct {
-	// path to the copied file
-	Path string `json:"path,omitempty"`
+type listVersionsResponse struct {
+	// versions of the file, the newest first
+	Versions []FileVersion `json:"versions"`
 	// message if something went wrong
 	Error string `json:"error,omitempty"`
 }
 
-func (r copyResponse) error() error {
-	return errors.New(r.Error)
+func (r listVersionsResponse) error() error {
+	return responseError(r.Error)
 }
 
-type deleteRequest struct {
+type versionRequest struct {
 	// path to the directory
 	DirPath string `json:"dir_path"`
-	// name of file to be deleted
+	// name of the file
 	FileName string `json:"file_name,omitempty"`
+	// id of the version of the file
+	VersionID string `json:"version_id"`
 }
 
-type deleteResponse struct {
-	// path to the deleted file
+type restoreVersionResponse struct {
+	// path to the restored file
 	Path string `json:"path,omitempty"`
 	// message if something went wrong
 	Error string `json:"error,omitempty"`
 }
 
-func (r deleteResponse) error() error {
-	return errors.New(r.Error)
+func (r restoreVersionResponse) error() error {
+	return responseError(r.Error)
 }
 
-type downloadRequest struct {
+type pruneVersionsRequest struct {
+	// amount of the newest versions of every file to be kept, 0 means no limit
+	Keep int `json:"keep,omitempty"`
+	// versions older than this are removed, 0 means no limit
+	MaxAgeSec int64 `json:"max_age_sec,omitempty"`
+}
+
+type pruneVersionsResponse struct {
+	// amount of removed versions
+	Pruned int `json:"pruned"`
+	// message if something went wrong
+	Error string `json:"error,omitempty"`
+}
+
+func (r pruneVersionsResponse) error() error {
+	return responseError(r.Error)
+}
+
+type listTrashRequest struct {
+}
+
+type listTrashResponse struct {
+	// deleted files, the most recently deleted first
+	Items []TrashItem `json:"items"`
+	// message if something went wrong
+	Error string `json:"error,omitempty"`
+}
+
+func (r listTrashResponse) error() error {
+	return responseError(r.Error)
+}
+
+type restoreFromTrashRequest struct {
+	// id of the deleted file
+	ID string `json:"id"`
+	// what to do if the original location is taken: fail, overwrite, rename or skip
+	Conflict ConflictPolicy `json:"conflict,omitempty"`
+}
+
+type restoreFromTrashResponse struct {
+	// path to the restored file and what was done with the destination
+	Result
+	// message if something went wrong
+	Error string `json:"error,omitempty"`
+}
+
+func (r restoreFromTrashResponse) error() error {
+	return responseError(r.Error)
+}
+
+type emptyTrashRequest struct {
+}
+
+type emptyTrashResponse struct {
+	// amount of permanently removed files
+	Removed int `json:"removed"`
+	// message if something went wrong
+	Error string `json:"error,omitempty"`
+}
+
+func (r emptyTrashResponse) error() error {
+	return responseError(r.Error)
+}
+
+type getUsageRequest struct {
+}
+
+type getUsageResponse struct {
+	Usage
+	// message if something went wrong
+	Error string `json:"error,omitempty"`
+}
+
+func (r getUsageResponse) error() error {
+	return responseError(r.Error)
+}
+
+type setQuotaRequest struct {
+	User string `json:"user"`
+	// amount of bytes the user is allowed to store, 0 means unlimited
+	Quota int64 `json:"quota"`
+}
+
+type setQuotaResponse struct {
+	// message if something went wrong
+	Error string `json:"error,omitempty"`
+}
+
+func (r setQuotaResponse) error() error {
+	return responseError(r.Error)
+}
+
+type getChangesRequest struct {
+	// token of the last synced state, empty to get the token of the current state
+	Since string `json:"since"`
+}
+
+type getChangesResponse struct {
+	Changes
+	// message if something went wrong
+	Error string `json:"error,omitempty"`
+}
+
+func (r getChangesResponse) error() error {
+	return responseError(r.Error)
+}
+
+type watchRequest struct {
+	// token of the last synced state, empty to start from the current state
+	Since string `json:"since"`
+}
+
+type watchResponse struct {
+	// stream of changes, sent as server-sent events
+	Changes <-chan Changes `json:"-"`
+	// message if something went wrong
+	Error string `json:"error,omitempty"`
+}
+
+func (r watchResponse) error() error {
+	return responseError(r.Error)
+}
+
+type createShareLinkRequest struct {
+	ShareLinkOptions
+}
+
+type createShareLinkResponse struct {
+	ShareLink
+	// message if something went wrong
+	Error string `json:"error,omitempty"`
+}
+
+func (r createShareLinkResponse) error() error {
+	return responseError(r.Error)
+}
+
+type listShareLinksRequest struct {
+}
+
+type listShareLinksResponse struct {
+	// share links of the user
+	Links []ShareLink `json:"links"`
+	// message if something went wrong
+	Error string `json:"error,omitempty"`
+}
+
+func (r listShareLinksResponse) error() error {
+	return responseError(r.Error)
+}
+
+type deleteShareLinkRequest struct {
+	// token of the revoked link
+	Token string `json:"token"`
+}
+
+type deleteShareLinkResponse struct {
+	// message if something went wrong
+	Error string `json:"error,omitempty"`
+}
+
+func (r deleteShareLinkResponse) error() error {
+	return responseError(r.Error)
+}
+
+type grantAccessRequest struct {
+	GrantOptions
+}
+
+type grantAccessResponse struct {
+	Grant
+	// message if something went wrong
+	Error string `json:"error,omitempty"`
+}
+
+func (r grantAccessResponse) error() error {
+	return responseError(r.Error)
+}
+
+type listGrantsRequest struct {
+}
+
+type listGrantsResponse struct {
+	// grants of the directories of the user
+	Grants []Grant `json:"grants"`
+	// message if something went wrong
+	Error string `json:"error,omitempty"`
+}
+
+func (r listGrantsResponse) error() error {
+	return responseError(r.Error)
+}
+
+type revokeAccessRequest struct {
+	// id of the revoked grant
+	ID int64 `json:"id"`
+}
+
+type revokeAccessResponse struct {
+	// message if something went wrong
+	Error string `json:"error,omitempty"`
+}
+
+func (r revokeAccessResponse) error() error {
+	return responseError(r.Error)
+}
+
+type listACLRequest struct {
+}
+
+type listACLResponse struct {
+	// entries of access control lists of all users
+	Entries []ACLEntry `json:"entries"`
+	// message if something went wrong
+	Error string `json:"error,omitempty"`
+}
+
+func (r listACLResponse) error() error {
+	return responseError(r.Error)
+}
+
+type addACLEntryRequest struct {
+	ACLEntry
+}
+
+type addACLEntryResponse struct {
+	ACLEntry
+	// message if something went wrong
+	Error string `json:"error,omitempty"`
+}
+
+func (r addACLEntryResponse) error() error {
+	return responseError(r.Error)
+}
+
+type deleteACLEntryRequest struct {
+	// id of the removed entry
+	ID int64 `json:"id"`
+}
+
+type deleteACLEntryResponse struct {
+	// message if something went wrong
+	Error string `json:"error,omitempty"`
+}
+
+func (r deleteACLEntryResponse) error() error {
+	return responseError(r.Error)
+}
+
+type listGroupMembersRequest struct {
+}
+
+type listGroupMembersResponse struct {
+	// members of all groups
+	Members []GroupMember `json:"members"`
+	// message if something went wrong
+	Error string `json:"error,omitempty"`
+}
+
+func (r listGroupMembersResponse) error() error {
+	return responseError(r.Error)
+}
+
+type addGroupMemberRequest struct {
+	GroupMember
+}
+
+type addGroupMemberResponse struct {
+	// message if something went wrong
+	Error string `json:"error,omitempty"`
+}
+
+func (r addGroupMemberResponse) error() error {
+	return responseError(r.Error)
+}
+
+type removeGroupMemberRequest struct {
+	GroupMember
+}
+
+type removeGroupMemberResponse struct {
+	// message if something went wrong
+	Error string `json:"error,omitempty"`
+}
+
+func (r removeGroupMemberResponse) error() error {
+	return responseError(r.Error)
+}
+
+type listUploadTypeRulesRequest struct {
+}
+
+type listUploadTypeRulesResponse struct {
+	// upload type rules of all users and groups
+	Rules []UploadTypeRule `json:"rules"`
+	// message if something went wrong
+	Error string `json:"error,omitempty"`
+}
+
+func (r listUploadTypeRulesResponse) error() error {
+	return responseError(r.Error)
+}
+
+type addUploadTypeRuleRequest struct {
+	UploadTypeRule
+}
+
+type addUploadTypeRuleResponse struct {
+	UploadTypeRule
+	// message if something went wrong
+	Error string `json:"error,omitempty"`
+}
+
+func (r addUploadTypeRuleResponse) error() error {
+	return responseError(r.Error)
+}
+
+type deleteUploadTypeRuleRequest struct {
+	// id of the removed rule
+	ID int64 `json:"id"`
+}
+
+type deleteUploadTypeRuleResponse struct {
+	// message if something went wrong
+	Error string `json:"error,omitempty"`
+}
+
+func (r deleteUploadTypeRuleResponse) error() error {
+	return responseError(r.Error)
+}
+
+type searchRequest struct {
+	SearchOptions
+}
+
+type searchResponse struct {
+	SearchResult
+	// message if something went wrong
+	Error string `json:"error,omitempty"`
+}
+
+func (r searchResponse) error() error {
+	return responseError(r.Error)
+}
+
+type rebuildIndexRequest struct {
+}
+
+type rebuildIndexResponse struct {
+	// amount of indexed files
+	Indexed int `json:"indexed"`
+	// message if something went wrong
+	Error string `json:"error,omitempty"`
+}
+
+func (r rebuildIndexResponse) error() error {
+	return responseError(r.Error)
+}
+
+type getMetadataRequest struct {
 	// path to the directory
 	DirPath string `json:"dir_path"`
-	// name of file to be deleted
-	FileName string `json:"file_name,omitempty"`
+	// name of the file
+	FileName string `json:"file_name"`
 }
 
-type downloadResponse struct {
-	// path to the deleted file
+type setMetadataRequest struct {
+	// path to the directory
+	DirPath string `json:"dir_path"`
+	// name of the file
+	FileName string `json:"file_name"`
+	// values and tags added to the metadata of the file
+	Metadata
+	// drop the existing values and tags first
+	Replace bool `json:"replace,omitempty"`
+}
+
+type deleteMetadataRequest struct {
+	// path to the directory
+	DirPath string `json:"dir_path"`
+	// name of the file
+	FileName string `json:"file_name"`
+	// removed keys and tags, everything is removed if both are empty
+	Keys []string `json:"keys,omitempty"`
+	Tags []string `json:"tags,omitempty"`
+}
+
+type metadataResponse struct {
+	// metadata of the file after the call
+	Metadata
+	// message if something went wrong
+	Error string `json:"error,omitempty"`
+}
+
+func (r metadataResponse) error() error {
+	return responseError(r.Error)
+}
+
+type previewRequest struct {
+	// path to the directory
+	DirPath string `json:"dir_path"`
+	// name of the file
+	FileName string `json:"file_name"`
+	// size of the square the thumbnail fits into in pixels, 256 by default
+	Size int `json:"size,omitempty"`
+}
+
+type previewResponse struct {
+	// contents of the preview
 	Buffer io.ReadCloser `json:"buffer,omitempty"`
+	// information about the preview, sent in the response headers
+	Info fs.FileInfo `json:"-"`
 	// message if something went wrong
 	Error string `json:"error,omitempty"`
 }
 
-func (r downloadResponse) error() error {
-	return errors.New(r.Error)
+func (r previewResponse) error() error {
+	return responseError(r.Error)
 }
 
-func (r downloadResponse) ReadCloser() io.ReadCloser {
+func (r previewResponse) ReadCloser() io.ReadCloser {
 	return r.Buffer
 }
 
-type uploadRequest struct {
-	// path to the directory
-	DirPath string `json:"dir_path"`
-	// name of file to be deleted
-	FileName string `json:"file_name,omitempty"`
-	//
-	Contents io.ReadCloser `json:"contents"`
+func (r previewResponse) FileInfo() fs.FileInfo {
+	return r.Info
 }
 
-type uploadResponse struct {
+// Inline lets browsers show previews instead of saving them
+func (r previewResponse) Inline() bool {
+	return true
+}
+
+type getSharedRequest struct {
+	// token of the link
+	Token string `json:"-"`
+	// password of the link, empty if the link has no password
+	Password string `json:"-"`
+	// DirPath of the options is relative to the shared directory
+	ListOptions
+}
 
+type getSharedResponse struct {
+	SharedItem
 	// message if something went wrong
 	Error string `json:"error,omitempty"`
 }
 
-func (r uploadResponse) error() error {
-	return errors.New(r.Error)
+func (r getSharedResponse) error() error {
+	return responseError(r.Error)
 }
 
-func (r uploadRequest) ReadCloser() io.ReadCloser {
-	return r.Contents
+type downloadSharedRequest struct {
+	// token of the link
+	Token string
+	// password of the link, empty if the link has no password
+	Password string
+	// path to the file relative to the shared directory, empty for the shared item itself
+	Path string
+	// format of the archive the directory is downloaded as
+	Format ArchiveFormat
+}
+
+type uploadSharedRequest struct {
+	// token of the link
+	Token string
+	// password of the link, empty if the link has no password
+	Password string
+	// path to the directory relative to the shared directory
+	DirPath string
+	// name of the uploaded file
+	FileName string
+	// contents of the file
+	Contents io.ReadCloser
 }
@@ -0,0 +1,320 @@
+package storagesvc
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	fs "remote-storage/server/storagesvc/repository/filesystem"
+)
+
+// ArchiveTar is the uncompressed tar archive, it is only extracted
+const ArchiveTar ArchiveFormat = "tar"
+
+// archiveFormatOf returns the format of the archive by its name
+func archiveFormatOf(name string) (ArchiveFormat, error) {
+	name = strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		return ArchiveZip, nil
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return ArchiveTarGz, nil
+	case strings.HasSuffix(name, ".tar"):
+		return ArchiveTar, nil
+	default:
+		return "", ErrInvalidArgument
+	}
+}
+
+// archiveEntry is the entry read from the archive
+type archiveEntry struct {
+	name  string
+	isDir bool
+	// isFile is false for symbolic links and other special entries, which are never extracted
+	isFile bool
+	open   func() (io.ReadCloser, error)
+}
+
+// archiveReader reads the entries of the archive in order, io.EOF is returned after the last one
+type archiveReader interface {
+	next() (archiveEntry, error)
+}
+
+// newArchiveReader reads the archive from the beginning of the file
+func newArchiveReader(file fs.File, size int64, format ArchiveFormat) (archiveReader, error) {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	switch format {
+	case ArchiveZip:
+		r, err := zip.NewReader(newReaderAt(file), size)
+		if err != nil {
+			return nil, ErrInvalidArgument
+		}
+		return &zipReader{files: r.File}, nil
+	case ArchiveTarGz:
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return nil, ErrInvalidArgument
+		}
+		return tarReader{tar.NewReader(gz)}, nil
+	case ArchiveTar:
+		return tarReader{tar.NewReader(file)}, nil
+	default:
+		return nil, ErrInvalidArgument
+	}
+}
+
+type zipReader struct {
+	files []*zip.File
+}
+
+func (z *zipReader) next() (archiveEntry, error) {
+	if len(z.files) == 0 {
+		return archiveEntry{}, io.EOF
+	}
+	f := z.files[0]
+	z.files = z.files[1:]
+	mode := f.Mode()
+	return archiveEntry{
+		name:   f.Name,
+		isDir:  mode.IsDir(),
+		isFile: mode.IsRegular(),
+		open:   f.Open,
+	}, nil
+}
+
+type tarReader struct {
+	r *tar.Reader
+}
+
+func (t tarReader) next() (archiveEntry, error) {
+	h, err := t.r.Next()
+	if err == io.EOF {
+		return archiveEntry{}, err
+	}
+	if err != nil {
+		return archiveEntry{}, ErrInvalidArgument
+	}
+	return archiveEntry{
+		name:   h.Name,
+		isDir:  h.Typeflag == tar.TypeDir,
+		isFile: h.Typeflag == tar.TypeReg,
+		open: func() (io.ReadCloser, error) {
+			return io.NopCloser(t.r), nil
+		},
+	}, nil
+}
+
+// newReaderAt returns io.ReaderAt of the file, files without ReadAt are read after seeking
+func newReaderAt(file fs.File) io.ReaderAt {
+	if r, ok := file.(io.ReaderAt); ok {
+		return r
+	}
+	return &seekReaderAt{file: file}
+}
+
+type seekReaderAt struct {
+	mu   sync.Mutex
+	file fs.File
+}
+
+func (r *seekReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, err := r.file.Seek(off, io.SeekStart); err != nil {
+		return 0, err
+	}
+	n, err := io.ReadFull(r.file, p)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// Extract expands the archive fileName of the directory dirPath into the existing directory destDirPath.
+// Nothing is extracted if any entry of the archive leads outside of the destination directory.
+// Existing directories are merged, conflict defines what happens to other existing files.
+// Symbolic links and other special entries are skipped. The results of the entries extracted
+// before the failure are returned together with the error.
+func (svc *service) Extract(ctx context.Context, dirPath, fileName, destDirPath string, conflict ConflictPolicy) ([]Result, error) {
+	conflict, err := parseConflictPolicy(string(conflict))
+	if err != nil {
+		return nil, err
+	}
+	archivePath, err := svc.resolvePath(ctx, dirPath, fileName)
+	if err != nil {
+		return nil, err
+	}
+	format, err := archiveFormatOf(fileName)
+	if err != nil {
+		return nil, err
+	}
+	destFullPath, destDir, err := svc.resolveDir(ctx, destDirPath)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := svc.backend.Stat(destFullPath); err != nil {
+		return nil, getErrorType(err)
+	} else if !info.IsDir {
+		return nil, ErrInvalidArgument
+	}
+	info, err := svc.backend.Stat(archivePath)
+	if err != nil {
+		return nil, getErrorType(err)
+	}
+	if info.IsDir {
+		return nil, ErrInvalidArgument
+	}
+	file, err := svc.backend.OpenFile(archivePath)
+	if err != nil {
+		return nil, getErrorType(err)
+	}
+	defer file.Close()
+
+	// the names of all entries are checked before anything is written,
+	// absolute names and names containing ".." are rejected
+	archive, err := newArchiveReader(file, info.Size, format)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		entry, err := archive.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(entry.name, "/") {
+			return nil, ErrPathEscape
+		}
+		if _, err := cleanDirPath(entry.name); err != nil {
+			return nil, err
+		}
+	}
+
+	archive, err = newArchiveReader(file, info.Size, format)
+	if err != nil {
+		return nil, err
+	}
+	x := extraction{
+		svc:      svc,
+		conflict: conflict,
+		dirs:     map[string]string{"": destDir},
+	}
+	for {
+		if err := ctx.Err(); err != nil {
+			return x.results, err
+		}
+		entry, err := archive.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return x.results, err
+		}
+		if err := x.extract(ctx, entry); err != nil {
+			return x.results, err
+		}
+	}
+	return x.results, nil
+}
+
+// extraction keeps the state of the archive being extracted
+type extraction struct {
+	svc      *service
+	conflict ConflictPolicy
+	// dirs maps directories of the archive to the directories they are extracted to
+	// relative to the root directory of the user, skipped directories map to skippedDir
+	dirs    map[string]string
+	results []Result
+}
+
+// extract writes the entry of the archive
+func (x *extraction) extract(ctx context.Context, entry archiveEntry) error {
+	name, _ := cleanDirPath(entry.name)
+	if name == "" {
+		return nil
+	}
+	if entry.isDir {
+		_, err := x.dir(ctx, name)
+		return err
+	}
+	parent, base := path.Split(name)
+	dir, err := x.dir(ctx, strings.TrimSuffix(parent, "/"))
+	if err != nil || dir == skippedDir {
+		return err
+	}
+	filePath, err := x.svc.resolvePath(ctx, dir, base)
+	if err != nil {
+		return err
+	}
+	if !entry.isFile {
+		x.results = append(x.results, Result{Path: filePath, Action: ActionSkipped})
+		return nil
+	}
+	contents, err := entry.open()
+	if err != nil {
+		return ErrInvalidArgument
+	}
+	defer contents.Close()
+	res, err := x.svc.store(ctx, filePath, contents, Checksum{}, x.conflict)
+	if err != nil {
+		return err
+	}
+	x.results = append(x.results, res)
+	return nil
+}
+
+// skippedDir marks directories of the archive whose entries are not extracted
+const skippedDir = "\x00"
+
+// dir returns the directory the directory name of the archive is extracted to,
+// creating it and its parents if needed
+func (x *extraction) dir(ctx context.Context, name string) (string, error) {
+	if dir, ok := x.dirs[name]; ok {
+		return dir, nil
+	}
+	parent, base := path.Split(name)
+	parentDir, err := x.dir(ctx, strings.TrimSuffix(parent, "/"))
+	if err != nil || parentDir == skippedDir {
+		return parentDir, err
+	}
+	dirPath, err := x.svc.resolvePath(ctx, parentDir, base)
+	if err != nil {
+		return "", err
+	}
+	info, err := x.svc.backend.Stat(dirPath)
+	if err != nil && !os.IsNotExist(err) {
+		return "", getErrorType(err)
+	}
+	res := Result{Path: dirPath, Action: ActionMerged}
+	if err != nil || !info.IsDir {
+		res.Path, res.Action, err = x.svc.resolveConflict(ctx, "", dirPath, true, x.conflict)
+		if err != nil {
+			return "", err
+		}
+	}
+	switch res.Action {
+	case ActionSkipped:
+		x.dirs[name] = skippedDir
+		x.results = append(x.results, res)
+		return skippedDir, nil
+	case ActionCreated, ActionOverwritten, ActionRenamed:
+		if err := x.svc.backend.Mkdir(res.Path, 0644); err != nil {
+			return "", getErrorType(err)
+		}
+		x.svc.recordChange(ctx, ChangeCreated, res.Path, "")
+	}
+	x.results = append(x.results, res)
+	userRootDir := getUserInfFromCtx(ctx).RootDir
+	x.dirs[name] = relativePath(userRootDir, res.Path)
+	return x.dirs[name], nil
+}
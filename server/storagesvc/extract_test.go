@@ -0,0 +1,248 @@
+package storagesvc
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+
+	fs "remote-storage/server/storagesvc/repository/filesystem"
+)
+
+// archiveFile is the entry of the archive built by the test
+type archiveFile struct {
+	name     string
+	contents string
+	// link is the target of the symbolic link entry
+	link string
+}
+
+func zipArchive(t *testing.T, files []archiveFile) string {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range files {
+		header := &zip.FileHeader{Name: f.name, Method: zip.Deflate}
+		contents := f.contents
+		if f.link != "" {
+			header.SetMode(os.ModeSymlink | 0777)
+			contents = f.link
+		}
+		w, err := zw.CreateHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(contents))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func tarArchive(t *testing.T, files []archiveFile) string {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, f := range files {
+		header := &tar.Header{Name: f.name, Mode: 0644, Size: int64(len(f.contents)), Typeflag: tar.TypeReg}
+		if f.link != "" {
+			header.Typeflag, header.Linkname, header.Size = tar.TypeSymlink, f.link, 0
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte(f.contents))
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+var archiveBuilders = []struct {
+	name  string
+	build func(t *testing.T, files []archiveFile) string
+}{
+	{"archive.zip", zipArchive},
+	{"archive.tar", tarArchive},
+}
+
+// treeOf returns the sorted paths of all files and directories in the directory of the backend
+func treeOf(t *testing.T, svc *service, dirPath string) []string {
+	t.Helper()
+	tree, err := svc.backend.TraverseDirectory(dirPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var res []string
+	var walk func(prefix string, children []fs.FileInfo)
+	walk = func(prefix string, children []fs.FileInfo) {
+		for _, child := range children {
+			res = append(res, prefix+child.Name)
+			walk(prefix+child.Name+"/", child.Children)
+		}
+	}
+	walk("", tree.Children)
+	sort.Strings(res)
+	return res
+}
+
+// newExtractService returns the service where alice has the empty directory dest
+func newExtractService(t *testing.T) *service {
+	t.Helper()
+	svc := newTestService(t)
+	if _, err := svc.MkDir(userContext("alice"), "", "dest", ConflictFail); err != nil {
+		t.Fatal(err)
+	}
+	return svc
+}
+
+func TestExtractRejectsEscapingEntries(t *testing.T) {
+	for _, builder := range archiveBuilders {
+		for _, name := range []string{"../x", "a/../../x", "/abs", "/../x"} {
+			t.Run(builder.name+" "+name, func(t *testing.T) {
+				svc := newExtractService(t)
+				archive := builder.build(t, []archiveFile{
+					{name: "first.txt", contents: "first"},
+					{name: name, contents: "escaped"},
+				})
+				upload(t, svc, "alice", "", builder.name, archive)
+
+				if _, err := svc.Extract(userContext("alice"), "", builder.name, "dest", ConflictOverwrite); err != ErrPathEscape {
+					t.Fatalf("Extract = %v, want ErrPathEscape", err)
+				}
+				if got := treeOf(t, svc, "alice/dest"); len(got) != 0 {
+					t.Fatalf("dest = %v, want nothing extracted", got)
+				}
+				want := []string{"alice", "alice/" + builder.name, "alice/dest", "bob"}
+				var got []string
+				for _, p := range treeOf(t, svc, "") {
+					if !strings.HasPrefix(p, ".") {
+						got = append(got, p)
+					}
+				}
+				if strings.Join(got, ",") != strings.Join(want, ",") {
+					t.Fatalf("tree = %v, want %v", got, want)
+				}
+			})
+		}
+	}
+}
+
+func TestExtractSkipsSymlinks(t *testing.T) {
+	for _, builder := range archiveBuilders {
+		t.Run(builder.name, func(t *testing.T) {
+			svc := newExtractService(t)
+			archive := builder.build(t, []archiveFile{
+				{name: "link", link: "/etc/passwd"},
+				{name: "a.txt", contents: "a"},
+			})
+			upload(t, svc, "alice", "", builder.name, archive)
+
+			results, err := svc.Extract(userContext("alice"), "", builder.name, "dest", ConflictFail)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(results) != 2 || results[0].Path != "alice/dest/link" || results[0].Action != ActionSkipped {
+				t.Fatalf("results = %+v, want the link skipped", results)
+			}
+			if got := treeOf(t, svc, "alice/dest"); len(got) != 1 || got[0] != "a.txt" {
+				t.Fatalf("dest = %v, want a.txt", got)
+			}
+		})
+	}
+}
+
+func TestExtractQuota(t *testing.T) {
+	svc := newExtractService(t)
+	archive := tarArchive(t, []archiveFile{
+		{name: "small.txt", contents: "small"},
+		{name: "large.txt", contents: strings.Repeat("x", 1000)},
+	})
+	upload(t, svc, "alice", "", "archive.tar", archive)
+	setQuota(t, svc, "alice", int64(len(archive))+100)
+
+	results, err := svc.Extract(userContext("alice"), "", "archive.tar", "dest", ConflictFail)
+	if err != ErrQuotaExceeded {
+		t.Fatalf("Extract = %v, want ErrQuotaExceeded", err)
+	}
+	if len(results) != 1 || results[0].Path != "alice/dest/small.txt" {
+		t.Fatalf("results = %+v, want small.txt extracted before the failure", results)
+	}
+	if _, err := svc.backend.Stat("alice/dest/large.txt"); !os.IsNotExist(err) {
+		t.Fatalf("Stat of the file over the quota = %v, want not exist", err)
+	}
+	if staged := stagedFiles(t, svc); len(staged) != 0 {
+		t.Fatalf("staged files are left: %v", staged)
+	}
+}
+
+func TestExtractConflict(t *testing.T) {
+	tests := []struct {
+		conflict ConflictPolicy
+		err      error
+		// files maps the files of dest to their contents
+		files map[string]string
+	}{
+		{ConflictFail, ErrAlreadyExists, map[string]string{
+			"a.txt": "old", "d/old.txt": "old", "f": "old",
+		}},
+		{ConflictSkip, nil, map[string]string{
+			"a.txt": "old", "d/old.txt": "old", "d/b.txt": "new", "f": "old",
+		}},
+		{ConflictRename, nil, map[string]string{
+			"a.txt": "old", "a (1).txt": "new", "d/old.txt": "old", "d/b.txt": "new",
+			"f": "old", "f (1)/c.txt": "new",
+		}},
+		{ConflictOverwrite, nil, map[string]string{
+			"a.txt": "new", "d/old.txt": "old", "d/b.txt": "new", "f/c.txt": "new",
+		}},
+	}
+	for _, tc := range tests {
+		t.Run(string(tc.conflict), func(t *testing.T) {
+			svc := newExtractService(t)
+			ctx := userContext("alice")
+			if _, err := svc.MkDir(ctx, "dest", "d", ConflictFail); err != nil {
+				t.Fatal(err)
+			}
+			upload(t, svc, "alice", "dest", "a.txt", "old")
+			upload(t, svc, "alice", "dest/d", "old.txt", "old")
+			upload(t, svc, "alice", "dest", "f", "old")
+			archive := tarArchive(t, []archiveFile{
+				{name: "a.txt", contents: "new"},
+				{name: "d/b.txt", contents: "new"},
+				{name: "f/c.txt", contents: "new"},
+			})
+			upload(t, svc, "alice", "", "archive.tar", archive)
+
+			if _, err := svc.Extract(ctx, "", "archive.tar", "dest", tc.conflict); err != tc.err {
+				t.Fatalf("Extract = %v, want %v", err, tc.err)
+			}
+			var files []string
+			for _, p := range treeOf(t, svc, "alice/dest") {
+				info, err := svc.backend.Stat("alice/dest/" + p)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if info.IsDir {
+					continue
+				}
+				files = append(files, p)
+				dir, name := "dest", p
+				if i := strings.LastIndex(p, "/"); i >= 0 {
+					dir, name = "dest/"+p[:i], p[i+1:]
+				}
+				if got := download(t, svc, "alice", dir, name); got != tc.files[p] {
+					t.Fatalf("%s = %q, want %q", p, got, tc.files[p])
+				}
+			}
+			if len(files) != len(tc.files) {
+				t.Fatalf("dest has %v, want %v", files, tc.files)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package storagesvc
+
+import (
+	"context"
+	"path"
+	"strings"
+	"unicode/utf8"
+
+	fs "remote-storage/server/storagesvc/repository/filesystem"
+)
+
+// maxNameLength is the maximal length of the name of a file in bytes
+const maxNameLength = 255
+
+// cleanDirPath normalizes the path to the directory taken from the client.
+// The result is relative to the root directory of the user and has no leading or trailing slashes,
+// empty elements and "." are dropped, ".." is rejected with ErrPathEscape.
+func cleanDirPath(dirPath string) (string, error) {
+	var names []string
+	for _, name := range strings.Split(dirPath, "/") {
+		if name == "" || name == "." {
+			continue
+		}
+		if err := validateName(name); err != nil {
+			return "", err
+		}
+		names = append(names, name)
+	}
+	return strings.Join(names, "/"), nil
+}
+
+// validateName checks the name of the file taken from the client,
+// it must be a single element of the path without control characters
+func validateName(name string) error {
+	switch {
+	case name == "..":
+		return ErrPathEscape
+	case name == "" || name == ".":
+		return ErrInvalidArgument
+	case len(name) > maxNameLength || !utf8.ValidString(name):
+		return ErrInvalidArgument
+	}
+	for _, r := range name {
+		if r == '/' || r == '\\' || r < 0x20 || r == 0x7f {
+			return ErrInvalidArgument
+		}
+	}
+	return nil
+}
+
+// joinPath joins the root directory of the user and the cleaned elements of the path
+func joinPath(userRootDir string, elem ...string) string {
+	res := strings.TrimRight(userRootDir, "/")
+	for _, e := range elem {
+		if e == "" {
+			continue
+		}
+		if res != "" {
+			res += "/"
+		}
+		res += e
+	}
+	return res
+}
+
+// checkSymlinks returns ErrPathEscape if the path leads outside of the root directory
+// of the user through symbolic links, nothing is checked if the backend has no symbolic links
+func (svc *service) checkSymlinks(userRootDir, filePath string) error {
+	resolver, ok := svc.backend.(fs.SymlinkResolver)
+	if !ok {
+		return nil
+	}
+	root, err := resolver.ResolveSymlinks(userRootDir)
+	if err != nil {
+		return getErrorType(err)
+	}
+	resolved, err := resolver.ResolveSymlinks(filePath)
+	if err != nil {
+		return getErrorType(err)
+	}
+	root = strings.Trim(path.Clean("/"+root), "/")
+	if root != "" && resolved != root && !strings.HasPrefix(resolved, root+"/") {
+		return ErrPathEscape
+	}
+	return nil
+}
+
+// resolveDir returns the path in the backend of the directory taken from the client
+// together with the cleaned dirPath, which is relative to the root directory of the user
+func (svc *service) resolveDir(ctx context.Context, dirPath string) (string, string, error) {
+	userRootDir := getUserInfFromCtx(ctx).RootDir
+	dir, err := cleanDirPath(dirPath)
+	if err != nil {
+		return "", "", err
+	}
+	res := joinPath(userRootDir, dir)
+	if err := svc.checkSymlinks(userRootDir, res); err != nil {
+		return "", "", err
+	}
+	return res, dir, nil
+}
+
+// resolvePath returns the path in the backend of the file taken from the client.
+// Every path built from the arguments of the client must be resolved here,
+// so it can't lead outside of the root directory of the user.
+func (svc *service) resolvePath(ctx context.Context, dirPath, fileName string) (string, error) {
+	userRootDir := getUserInfFromCtx(ctx).RootDir
+	dir, err := cleanDirPath(dirPath)
+	if err != nil {
+		return "", err
+	}
+	if err := validateName(fileName); err != nil {
+		return "", err
+	}
+	res := joinPath(userRootDir, dir, fileName)
+	if err := svc.checkSymlinks(userRootDir, res); err != nil {
+		return "", err
+	}
+	return res, nil
+}
@@ -0,0 +1,207 @@
+package storagesvc
+
+import (
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	fs "remote-storage/server/storagesvc/repository/filesystem"
+)
+
+var jailSeeds = []string{
+	"", ".", "..", "a", "a/b", "/a", "/", "//", "a//b", "./a", "a/.", "a/..", "../a", "a/../..",
+	"/etc/passwd", `..\..`, `a\b`, "a\x00b", "\x00", "a/\x7f", "...", ".../a", "a/.../b",
+	strings.Repeat("x", maxNameLength+1), "\xff",
+}
+
+// assertUnderRoot fails the test if the path accepted from the client leads outside of the root of alice
+func assertUnderRoot(t *testing.T, res string) {
+	t.Helper()
+	if !isNested("alice", res) && res != "alice" {
+		t.Fatalf("%q is outside of the root", res)
+	}
+	if path.Clean(res) != res {
+		t.Fatalf("%q is not clean", res)
+	}
+	for _, name := range strings.Split(res, "/") {
+		if name == ".." || strings.ContainsAny(name, "\\\x00") {
+			t.Fatalf("%q has the element %q", res, name)
+		}
+	}
+}
+
+func FuzzCleanDirPath(f *testing.F) {
+	for _, seed := range jailSeeds {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, dirPath string) {
+		dir, err := cleanDirPath(dirPath)
+		if err != nil {
+			return
+		}
+		if strings.HasPrefix(dir, "/") || strings.HasSuffix(dir, "/") {
+			t.Fatalf("%q has leading or trailing slashes", dir)
+		}
+		assertUnderRoot(t, joinPath("alice/", dir))
+	})
+}
+
+func FuzzResolvePath(f *testing.F) {
+	for _, seed := range jailSeeds {
+		f.Add(seed, "a.txt")
+		f.Add("", seed)
+	}
+	root := f.TempDir()
+	if err := os.Mkdir(filepath.Join(root, "alice"), 0755); err != nil {
+		f.Fatal(err)
+	}
+	services := []*service{
+		{backend: fs.NewMemoryBackend()},
+		{backend: fs.NewLocalBackend(fs.ConfigFileSystem{RootDir: root})},
+	}
+	ctx := userContext("alice")
+	f.Fuzz(func(t *testing.T, dirPath, fileName string) {
+		for _, svc := range services {
+			res, err := svc.resolvePath(ctx, dirPath, fileName)
+			if err != nil {
+				continue
+			}
+			assertUnderRoot(t, res)
+			if res == "alice" {
+				t.Fatalf("%q, %q resolves to the root", dirPath, fileName)
+			}
+		}
+	})
+}
+
+// jailBackends are the backends the paths taken from the client are checked against
+var jailBackends = map[string]func(t *testing.T) fs.Backend{
+	"local": func(t *testing.T) fs.Backend {
+		return fs.NewLocalBackend(fs.ConfigFileSystem{RootDir: t.TempDir()})
+	},
+	"memory": func(t *testing.T) fs.Backend {
+		return fs.NewMemoryBackend()
+	},
+}
+
+func TestResolvePathRejects(t *testing.T) {
+	tests := []struct {
+		dirPath, fileName string
+		want              error
+	}{
+		{"..", "a.txt", ErrPathEscape},
+		{"a/../..", "a.txt", ErrPathEscape},
+		{"", "..", ErrPathEscape},
+		{"", ".", ErrInvalidArgument},
+		{"", "", ErrInvalidArgument},
+		{`..\..`, "a.txt", ErrInvalidArgument},
+		{"", `..\a.txt`, ErrInvalidArgument},
+		{"a\x00b", "a.txt", ErrInvalidArgument},
+		{"", "a.txt\x00.jpg", ErrInvalidArgument},
+		{"", "a/b", ErrInvalidArgument},
+	}
+	for name, newBackend := range jailBackends {
+		t.Run(name, func(t *testing.T) {
+			svc := newTestServiceOn(t, newBackend(t))
+			ctx := userContext("alice")
+			for _, tt := range tests {
+				if _, err := svc.resolvePath(ctx, tt.dirPath, tt.fileName); err != tt.want {
+					t.Errorf("resolvePath(%q, %q): got %v, want %v", tt.dirPath, tt.fileName, err, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestResolvePathKeepsAbsolutePathsInRoot(t *testing.T) {
+	for name, newBackend := range jailBackends {
+		t.Run(name, func(t *testing.T) {
+			svc := newTestServiceOn(t, newBackend(t))
+			ctx := userContext("alice")
+			for _, dirPath := range []string{"/etc", "//etc/", "/../etc", "/./etc"} {
+				res, err := svc.resolvePath(ctx, dirPath, "passwd")
+				if dirPath == "/../etc" {
+					if err != ErrPathEscape {
+						t.Errorf("resolvePath(%q): got %v, want %v", dirPath, err, ErrPathEscape)
+					}
+					continue
+				}
+				if err != nil || res != "alice/etc/passwd" {
+					t.Errorf("resolvePath(%q): got %q, %v, want alice/etc/passwd", dirPath, res, err)
+				}
+			}
+		})
+	}
+}
+
+// newSymlinkService returns the service on the local backend together with its root directory
+func newSymlinkService(t *testing.T) (*service, string) {
+	root := t.TempDir()
+	svc := newTestServiceOn(t, fs.NewLocalBackend(fs.ConfigFileSystem{RootDir: root}))
+	if err := os.WriteFile(filepath.Join(root, "bob", "secret.txt"), []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return svc, root
+}
+
+func TestSymlinksLeadingOutsideAreRejected(t *testing.T) {
+	svc, root := newSymlinkService(t)
+	if err := os.Symlink(filepath.Join(root, "bob"), filepath.Join(root, "alice", "bob")); err != nil {
+		t.Skip("symbolic links are not supported:", err)
+	}
+	if err := os.Symlink("/", filepath.Join(root, "alice", "system")); err != nil {
+		t.Fatal(err)
+	}
+	ctx := userContext("alice")
+
+	for _, dirPath := range []string{"bob", "system", "system/tmp"} {
+		if _, err := svc.resolvePath(ctx, dirPath, "secret.txt"); err != ErrPathEscape {
+			t.Errorf("resolvePath(%q): got %v, want %v", dirPath, err, ErrPathEscape)
+		}
+	}
+	if _, _, err := svc.Download(ctx, "bob", "secret.txt"); err != ErrPathEscape {
+		t.Fatalf("download: got %v, want %v", err, ErrPathEscape)
+	}
+	if _, err := svc.List(ctx, ListOptions{DirPath: "bob"}); err != ErrPathEscape {
+		t.Fatalf("list: got %v, want %v", err, ErrPathEscape)
+	}
+}
+
+func TestDanglingSymlinksAreNotFollowedOnCreate(t *testing.T) {
+	svc, root := newSymlinkService(t)
+	target := filepath.Join(root, "bob", "planted.txt")
+	if err := os.Symlink(target, filepath.Join(root, "alice", "a.txt")); err != nil {
+		t.Skip("symbolic links are not supported:", err)
+	}
+	ctx := userContext("alice")
+
+	if _, err := svc.resolvePath(ctx, "", "a.txt"); err != ErrPathEscape {
+		t.Fatalf("got %v, want %v", err, ErrPathEscape)
+	}
+	contents := io.NopCloser(strings.NewReader("planted"))
+	if _, err := svc.Upload(ctx, "", "a.txt", contents, Checksum{}, ConflictOverwrite); err != ErrPathEscape {
+		t.Fatalf("upload: got %v, want %v", err, ErrPathEscape)
+	}
+	if _, err := os.Lstat(target); !os.IsNotExist(err) {
+		t.Fatalf("the target of the link was created: %v", err)
+	}
+}
+
+func TestSymlinksInsideRootAreFollowed(t *testing.T) {
+	svc, root := newSymlinkService(t)
+	if err := os.Mkdir(filepath.Join(root, "alice", "docs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("docs", filepath.Join(root, "alice", "link")); err != nil {
+		t.Skip("symbolic links are not supported:", err)
+	}
+	ctx := userContext("alice")
+
+	res, err := svc.resolvePath(ctx, "link", "a.txt")
+	if err != nil || res != "alice/link/a.txt" {
+		t.Fatalf("got %q, %v, want alice/link/a.txt", res, err)
+	}
+}
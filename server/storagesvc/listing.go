@@ -0,0 +1,344 @@
+package storagesvc
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	fs "remote-storage/server/storagesvc/repository/filesystem"
+)
+
+const (
+	defaultListLimit = 100
+	maxListLimit     = 1000
+)
+
+// maxListScan is the maximal amount of entries read to list the directory sorted by size
+// or modification time or with nested directories, such listings fail with ErrTooManyEntries
+var maxListScan = 100000
+
+// ListSort is the field the entries of the listing are sorted by
+type ListSort string
+
+const (
+	ListSortName     ListSort = "name"
+	ListSortSize     ListSort = "size"
+	ListSortModified ListSort = "mtime"
+)
+
+// ListType filters the entries of the listing by their type
+type ListType string
+
+const (
+	ListTypeAll   ListType = ""
+	ListTypeFiles ListType = "files"
+	ListTypeDirs  ListType = "dirs"
+)
+
+// ListOptions describes the page of the directory listing
+type ListOptions struct {
+	// DirPath is the path to the listed directory
+	DirPath string `json:"dir_path"`
+	// Depth is the amount of listed levels of nested directories,
+	// 0 and 1 list only the directory itself, negative depth means unlimited
+	Depth int `json:"depth,omitempty"`
+	// Sort is the field entries are sorted by, name by default
+	Sort ListSort `json:"sort,omitempty"`
+	// Desc reverses the order of entries
+	Desc bool `json:"desc,omitempty"`
+	// Type filters entries by their type
+	Type ListType `json:"type,omitempty"`
+	// Glob filters entries by their names, see path.Match for the syntax
+	Glob string `json:"glob,omitempty"`
+	// Tags filters entries having all the tags
+	Tags []string `json:"tags,omitempty"`
+	// Metadata filters entries having all the metadata values,
+	// the empty value only requires the key to be set
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// Cursor is the NextCursor of the previous page, empty for the first page
+	Cursor string `json:"cursor,omitempty"`
+	// Limit is the maximal amount of entries in the page
+	Limit int `json:"limit,omitempty"`
+}
+
+// ListEntry is the file found in the listed directory
+type ListEntry struct {
+	// Path to the file relative to the listed directory
+	Path string `json:"path"`
+	fs.FileInfo
+}
+
+// ListPage is the page of the directory listing
+type ListPage struct {
+	Entries []ListEntry `json:"entries"`
+	// NextCursor requests the next page, it is empty on the last page
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// listCursor is the position after the last entry of the page,
+// it is passed to the client encoded as an opaque string
+type listCursor struct {
+	Sort     ListSort `json:"s"`
+	Desc     bool     `json:"d,omitempty"`
+	Path     string   `json:"p"`
+	Name     string   `json:"n"`
+	Size     int64    `json:"z,omitempty"`
+	Modified int64    `json:"m,omitempty"`
+}
+
+func encodeListCursor(options ListOptions, entry ListEntry) string {
+	data, _ := json.Marshal(listCursor{
+		Sort:     options.Sort,
+		Desc:     options.Desc,
+		Path:     entry.Path,
+		Name:     entry.Name,
+		Size:     entry.Size,
+		Modified: entry.Modified.UnixNano(),
+	})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeListCursor returns the last entry of the previous page,
+// the cursor must be created for the same order of entries
+func decodeListCursor(options ListOptions) (ListEntry, error) {
+	var c listCursor
+	data, err := base64.RawURLEncoding.DecodeString(options.Cursor)
+	if err != nil {
+		return ListEntry{}, ErrInvalidArgument
+	}
+	if err := json.Unmarshal(data, &c); err != nil {
+		return ListEntry{}, ErrInvalidArgument
+	}
+	if c.Sort != options.Sort || c.Desc != options.Desc {
+		return ListEntry{}, ErrInvalidArgument
+	}
+	return ListEntry{
+		Path: c.Path,
+		FileInfo: fs.FileInfo{
+			Name:     c.Name,
+			Size:     c.Size,
+			Modified: time.Unix(0, c.Modified),
+		},
+	}, nil
+}
+
+// compareEntries orders entries by the sort field, entries with equal fields are ordered by path
+func compareEntries(sortBy ListSort, a, b ListEntry) int {
+	var res int
+	switch sortBy {
+	case ListSortSize:
+		res = compareInt64(a.Size, b.Size)
+	case ListSortModified:
+		res = compareInt64(a.Modified.UnixNano(), b.Modified.UnixNano())
+	default:
+		res = strings.Compare(a.Name, b.Name)
+	}
+	if res == 0 {
+		res = strings.Compare(a.Path, b.Path)
+	}
+	return res
+}
+
+func compareInt64(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// validateListOptions checks the options and fills in the defaults
+func validateListOptions(options ListOptions) (ListOptions, error) {
+	switch options.Sort {
+	case "":
+		options.Sort = ListSortName
+	case ListSortName, ListSortSize, ListSortModified:
+	default:
+		return options, ErrInvalidArgument
+	}
+	switch options.Type {
+	case ListTypeAll, ListTypeFiles, ListTypeDirs:
+	default:
+		return options, ErrInvalidArgument
+	}
+	if options.Glob != "" {
+		if _, err := path.Match(options.Glob, ""); err != nil {
+			return options, ErrInvalidArgument
+		}
+	}
+	if options.Depth == 0 {
+		options.Depth = 1
+	}
+	switch {
+	case options.Limit < 0:
+		return options, ErrInvalidArgument
+	case options.Limit == 0:
+		options.Limit = defaultListLimit
+	case options.Limit > maxListLimit:
+		options.Limit = maxListLimit
+	}
+	return options, nil
+}
+
+// matches reports whether the entry passes the filters of the options
+func (options ListOptions) matches(entry ListEntry) bool {
+	if options.Type == ListTypeFiles && entry.IsDir || options.Type == ListTypeDirs && !entry.IsDir {
+		return false
+	}
+	if options.Glob != "" {
+		if ok, _ := path.Match(options.Glob, entry.Name); !ok {
+			return false
+		}
+	}
+	for _, tag := range options.Tags {
+		if !hasTag(entry.Tags, tag) {
+			return false
+		}
+	}
+	for k, v := range options.Metadata {
+		if value, ok := entry.Metadata[k]; !ok || v != "" && value != v {
+			return false
+		}
+	}
+	return true
+}
+
+type ctxVirtualEntriesKey struct{}
+
+// withVirtualEntries adds entries which don't exist in the backend
+// to the listing of the root directory of the user
+func withVirtualEntries(ctx context.Context, entries ...ListEntry) context.Context {
+	return context.WithValue(ctx, ctxVirtualEntriesKey{}, entries)
+}
+
+func virtualEntriesFromCtx(ctx context.Context) []ListEntry {
+	entries, _ := ctx.Value(ctxVirtualEntriesKey{}).([]ListEntry)
+	return entries
+}
+
+// collectEntries appends the files of the directory and of the nested directories
+// up to depth levels, paths of the entries are prefixed by prefix.
+// scanned counts the read entries, ErrTooManyEntries is returned when it exceeds maxListScan.
+func (svc *service) collectEntries(dirPath, prefix string, depth int, options ListOptions, scanned *int, res *[]ListEntry) error {
+	children, err := fs.ReadDir(svc.backend, dirPath)
+	if err != nil {
+		return err
+	}
+	*scanned += len(children)
+	if *scanned > maxListScan {
+		return ErrTooManyEntries
+	}
+	for _, child := range children {
+		entry := ListEntry{
+			Path:     joinPath(prefix, child.Name),
+			FileInfo: child,
+		}
+		if options.matches(entry) {
+			*res = append(*res, entry)
+		}
+		if child.IsDir && depth != 1 {
+			err := svc.collectEntries(joinPath(dirPath, child.Name), entry.Path, depth-1, options, scanned, res)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// List returns the page of the files in the directory. Only the directory itself
+// is listed instead of the whole tree, unless the deeper listing is requested.
+// The directory sorted by name is read without the nested directories and its entries
+// are checked from the cursor until the page is filled, other listings read all entries
+// up to maxListScan.
+func (svc *service) List(ctx context.Context, options ListOptions) (ListPage, error) {
+	res := ListPage{Entries: []ListEntry{}}
+	options, err := validateListOptions(options)
+	if err != nil {
+		return res, err
+	}
+	var after *ListEntry
+	if options.Cursor != "" {
+		entry, err := decodeListCursor(options)
+		if err != nil {
+			return res, err
+		}
+		after = &entry
+	}
+	dirPath, dir, err := svc.resolveDir(ctx, options.DirPath)
+	if err != nil {
+		return res, err
+	}
+	info, err := svc.backend.Stat(dirPath)
+	if err != nil {
+		return res, getErrorType(err)
+	}
+	if !info.IsDir {
+		return res, ErrInvalidArgument
+	}
+
+	var virtual []ListEntry
+	if dir == "" {
+		virtual = virtualEntriesFromCtx(ctx)
+	}
+	less := func(a, b ListEntry) bool {
+		if options.Desc {
+			return compareEntries(options.Sort, a, b) > 0
+		}
+		return compareEntries(options.Sort, a, b) < 0
+	}
+	var entries []ListEntry
+	if options.Sort == ListSortName && options.Depth == 1 {
+		entries, err = svc.readDirInOrder(dirPath, virtual, less)
+	} else {
+		var scanned int
+		err = svc.collectEntries(dirPath, "", options.Depth, options, &scanned, &entries)
+		entries = append(entries, virtual...)
+		sort.Slice(entries, func(i, j int) bool {
+			return less(entries[i], entries[j])
+		})
+	}
+	if err != nil {
+		return res, getErrorType(err)
+	}
+	start := 0
+	if after != nil {
+		start = sort.Search(len(entries), func(i int) bool {
+			return less(*after, entries[i])
+		})
+	}
+	for _, entry := range entries[start:] {
+		if !options.matches(entry) {
+			continue
+		}
+		if len(res.Entries) == options.Limit {
+			res.NextCursor = encodeListCursor(options, res.Entries[len(res.Entries)-1])
+			break
+		}
+		res.Entries = append(res.Entries, entry)
+	}
+	return res, nil
+}
+
+// readDirInOrder returns the entries of the directory together with the virtual entries in the order of less
+func (svc *service) readDirInOrder(dirPath string, virtual []ListEntry, less func(a, b ListEntry) bool) ([]ListEntry, error) {
+	children, err := fs.ReadDir(svc.backend, dirPath)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]ListEntry, 0, len(children)+len(virtual))
+	for _, child := range children {
+		entries = append(entries, ListEntry{Path: child.Name, FileInfo: child})
+	}
+	entries = append(entries, virtual...)
+	sort.Slice(entries, func(i, j int) bool {
+		return less(entries[i], entries[j])
+	})
+	return entries, nil
+}
@@ -0,0 +1,77 @@
+package storagesvc
+
+import (
+	"fmt"
+	"testing"
+)
+
+func listAll(t *testing.T, svc *service, options ListOptions) []string {
+	t.Helper()
+	ctx := userContext("alice")
+	var res []string
+	for {
+		page, err := svc.List(ctx, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, entry := range page.Entries {
+			res = append(res, entry.Path)
+		}
+		if page.NextCursor == "" {
+			return res
+		}
+		options.Cursor = page.NextCursor
+	}
+}
+
+func TestListPagesInNameOrder(t *testing.T) {
+	svc := newTestService(t)
+	for _, name := range []string{"c.txt", "a.txt", "e.jpg", "b.txt", "d.jpg"} {
+		upload(t, svc, "alice", "", name, "x")
+	}
+	if _, err := svc.MkDir(userContext("alice"), "", "f", ConflictFail); err != nil {
+		t.Fatal(err)
+	}
+	upload(t, svc, "alice", "f", "nested.txt", "x")
+
+	tests := []struct {
+		options ListOptions
+		want    string
+	}{
+		{ListOptions{Limit: 2}, "[a.txt b.txt c.txt d.jpg e.jpg f]"},
+		{ListOptions{Limit: 2, Desc: true}, "[f e.jpg d.jpg c.txt b.txt a.txt]"},
+		{ListOptions{Limit: 1, Glob: "*.txt"}, "[a.txt b.txt c.txt]"},
+		{ListOptions{Limit: 1, Type: ListTypeDirs}, "[f]"},
+		{ListOptions{Limit: 3, Depth: -1}, "[a.txt b.txt c.txt d.jpg e.jpg f f/nested.txt]"},
+	}
+	for _, tt := range tests {
+		if got := fmt.Sprint(listAll(t, svc, tt.options)); got != tt.want {
+			t.Errorf("%+v: got %s, want %s", tt.options, got, tt.want)
+		}
+	}
+}
+
+func TestListScanIsLimited(t *testing.T) {
+	defer func(n int) { maxListScan = n }(maxListScan)
+	maxListScan = 10
+	svc := newTestService(t)
+	ctx := userContext("alice")
+	for i := 0; i <= maxListScan; i++ {
+		w, err := svc.backend.Create(fmt.Sprintf("alice/%02d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Close()
+	}
+
+	if _, err := svc.List(ctx, ListOptions{Sort: ListSortSize}); err != ErrTooManyEntries {
+		t.Fatalf("sorted by size: got %v, want %v", err, ErrTooManyEntries)
+	}
+	page, err := svc.List(ctx, ListOptions{Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Entries) != 1 || page.Entries[0].Name != "00" {
+		t.Fatalf("got %+v", page.Entries)
+	}
+}
@@ -29,30 +29,30 @@ func (mw loggingMiddleware) getAuthSvc() authsvc.Service {
 
 func (mw loggingMiddleware) GetState(ctx context.Context) (info fs.FileInfo, err error) {
 	defer func(begin time.Time) {
-		mw.logger.Log("method", "GetState", "user root dir", userRootDir, "took", time.Since(begin), "err", err)
+		mw.logger.Log("method", "GetState", "took", time.Since(begin), "err", err)
 	}(time.Now())
-	return mw.next.GetState(nil)
+	return mw.next.GetState(ctx)
 }
 
-func (mw loggingMiddleware) MkDir(ctx context.Context, dir, path string) (s string, err error) {
+func (mw loggingMiddleware) MkDir(ctx context.Context, dir, path string, conflict ConflictPolicy) (res Result, err error) {
 	defer func(begin time.Time) {
-		mw.logger.Log("method", "MkDir", "path", path, "dir", dir, "took", time.Since(begin), "err", err)
+		mw.logger.Log("method", "MkDir", "path", path, "dir", dir, "conflict", conflict, "action", res.Action, "took", time.Since(begin), "err", err)
 	}(time.Now())
-	return mw.next.MkDir(nil, dir, path)
+	return mw.next.MkDir(ctx, dir, path, conflict)
 }
 
-func (mw loggingMiddleware) Rename(ctx context.Context, dirPath, oldName, newName string) (s string, err error) {
+func (mw loggingMiddleware) Rename(ctx context.Context, dirPath, oldName, newName string, conflict ConflictPolicy) (res Result, err error) {
 	defer func(begin time.Time) {
-		mw.logger.Log("method", "Rename", "dirPath", dirPath, "oldName", oldName, "newName", newName, "took", time.Since(begin), "err", err)
+		mw.logger.Log("method", "Rename", "dirPath", dirPath, "oldName", oldName, "newName", newName, "conflict", conflict, "action", res.Action, "took", time.Since(begin), "err", err)
 	}(time.Now())
-	return mw.next.Rename(ctx, dirPath, oldName, newName)
+	return mw.next.Rename(ctx, dirPath, oldName, newName, conflict)
 }
 
-func (mw loggingMiddleware) Move(ctx context.Context, srcDirPath, fileName, destDirPath string) (s string, err error) {
+func (mw loggingMiddleware) Move(ctx context.Context, srcDirPath, fileName, destDirPath string, conflict ConflictPolicy) (res Result, err error) {
 	defer func(begin time.Time) {
-		mw.logger.Log("method", "Move", "dirPath", srcDirPath, "fileName", fileName, "destDirPath", destDirPath, "took", time.Since(begin), "err", err)
+		mw.logger.Log("method", "Move", "dirPath", srcDirPath, "fileName", fileName, "destDirPath", destDirPath, "conflict", conflict, "action", res.Action, "took", time.Since(begin), "err", err)
 	}(time.Now())
-	return mw.next.Move(ctx, srcDirPath, fileName, destDirPath)
+	return mw.next.Move(ctx, srcDirPath, fileName, destDirPath, conflict)
 }
 
 func (mw loggingMiddleware) Delete(ctx context.Context, dirPath, fileName string) (s string, err error) {
@@ -62,23 +62,324 @@ func (mw loggingMiddleware) Delete(ctx context.Context, dirPath, fileName string
 	return mw.next.Delete(ctx, dirPath, fileName)
 }
 
-func (mw loggingMiddleware) Copy(ctx context.Context, srcDirPath, fileName, destDirPath string) (s string, err error) {
+func (mw loggingMiddleware) Copy(ctx context.Context, srcDirPath, fileName, destDirPath string, conflict ConflictPolicy) (res Result, err error) {
 	defer func(begin time.Time) {
-		mw.logger.Log("method", "Copy", "srcDirPath", srcDirPath, "fileName", fileName, "destDirPath", destDirPath, "took", time.Since(begin), "err", err)
+		mw.logger.Log("method", "Copy", "srcDirPath", srcDirPath, "fileName", fileName, "destDirPath", destDirPath, "conflict", conflict, "action", res.Action, "took", time.Since(begin), "err", err)
 	}(time.Now())
-	return mw.next.Copy(ctx, srcDirPath, fileName, destDirPath)
+	return mw.next.Copy(ctx, srcDirPath, fileName, destDirPath, conflict)
 }
 
-func (mw loggingMiddleware) Download(ctx context.Context, dirPath, fileName string) (buffer io.ReadCloser, err error) {
+func (mw loggingMiddleware) Extract(ctx context.Context, dirPath, fileName, destDirPath string, conflict ConflictPolicy) (results []Result, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "Extract", "dirPath", dirPath, "fileName", fileName, "destDirPath", destDirPath, "conflict", conflict, "extracted", len(results), "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.Extract(ctx, dirPath, fileName, destDirPath, conflict)
+}
+
+func (mw loggingMiddleware) Batch(ctx context.Context, operations []BatchOperation, stopOnError bool) (results []BatchResult, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "Batch", "operations", len(operations), "stopOnError", stopOnError, "executed", len(results), "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.Batch(ctx, operations, stopOnError)
+}
+
+func (mw loggingMiddleware) Download(ctx context.Context, dirPath, fileName string) (buffer io.ReadCloser, info fs.FileInfo, err error) {
 	defer func(begin time.Time) {
 		mw.logger.Log("method", "Download", "dirPath", dirPath, "fileName", fileName, "took", time.Since(begin), "err", err)
 	}(time.Now())
 	return mw.next.Download(ctx, dirPath, fileName)
 }
 
-func (mw loggingMiddleware) Upload(ctx context.Context, dirPath, fileName string, contents io.ReadCloser) (err error) {
+func (mw loggingMiddleware) DownloadArchive(ctx context.Context, dirPath string, fileNames []string, format ArchiveFormat) (buffer io.ReadCloser, info fs.FileInfo, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "DownloadArchive", "dirPath", dirPath, "files", len(fileNames), "format", format, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.DownloadArchive(ctx, dirPath, fileNames, format)
+}
+
+func (mw loggingMiddleware) Upload(ctx context.Context, dirPath, fileName string, contents io.ReadCloser, checksum Checksum, conflict ConflictPolicy) (res Result, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "Upload", "dirPath", dirPath, "fileName", fileName, "conflict", conflict, "action", res.Action, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.Upload(ctx, dirPath, fileName, contents, checksum, conflict)
+}
+
+func (mw loggingMiddleware) CreateUploadSession(ctx context.Context, dirPath, fileName string, size int64, checksum Checksum, conflict ConflictPolicy) (session UploadSession, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "CreateUploadSession", "dirPath", dirPath, "fileName", fileName, "size", size, "conflict", conflict, "id", session.ID, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.CreateUploadSession(ctx, dirPath, fileName, size, checksum, conflict)
+}
+
+func (mw loggingMiddleware) GetUploadSession(ctx context.Context, id string) (session UploadSession, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "GetUploadSession", "id", id, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.GetUploadSession(ctx, id)
+}
+
+func (mw loggingMiddleware) UploadChunk(ctx context.Context, id string, offset int64, contents io.ReadCloser) (session UploadSession, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "UploadChunk", "id", id, "offset", offset, "committed", session.Offset, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.UploadChunk(ctx, id, offset, contents)
+}
+
+func (mw loggingMiddleware) FinalizeUploadSession(ctx context.Context, id string) (res Result, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "FinalizeUploadSession", "id", id, "action", res.Action, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.FinalizeUploadSession(ctx, id)
+}
+
+func (mw loggingMiddleware) ListVersions(ctx context.Context, dirPath, fileName string) (versions []FileVersion, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "ListVersions", "dirPath", dirPath, "fileName", fileName, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.ListVersions(ctx, dirPath, fileName)
+}
+
+func (mw loggingMiddleware) DownloadVersion(ctx context.Context, dirPath, fileName, versionID string) (buffer io.ReadCloser, info fs.FileInfo, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "DownloadVersion", "dirPath", dirPath, "fileName", fileName, "versionID", versionID, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.DownloadVersion(ctx, dirPath, fileName, versionID)
+}
+
+func (mw loggingMiddleware) RestoreVersion(ctx context.Context, dirPath, fileName, versionID string) (s string, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "RestoreVersion", "dirPath", dirPath, "fileName", fileName, "versionID", versionID, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.RestoreVersion(ctx, dirPath, fileName, versionID)
+}
+
+func (mw loggingMiddleware) PruneVersions(ctx context.Context, keep int, maxAge time.Duration) (pruned int, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "PruneVersions", "keep", keep, "maxAge", maxAge, "pruned", pruned, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.PruneVersions(ctx, keep, maxAge)
+}
+
+func (mw loggingMiddleware) ListTrash(ctx context.Context) (items []TrashItem, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "ListTrash", "items", len(items), "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.ListTrash(ctx)
+}
+
+func (mw loggingMiddleware) RestoreFromTrash(ctx context.Context, id string, conflict ConflictPolicy) (res Result, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "RestoreFromTrash", "id", id, "conflict", conflict, "action", res.Action, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.RestoreFromTrash(ctx, id, conflict)
+}
+
+func (mw loggingMiddleware) EmptyTrash(ctx context.Context) (removed int, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "EmptyTrash", "removed", removed, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.EmptyTrash(ctx)
+}
+
+func (mw loggingMiddleware) List(ctx context.Context, options ListOptions) (page ListPage, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "List", "dirPath", options.DirPath, "depth", options.Depth, "sort", options.Sort, "entries", len(page.Entries), "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.List(ctx, options)
+}
+
+func (mw loggingMiddleware) GetUsage(ctx context.Context) (usage Usage, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "GetUsage", "used", usage.Used, "available", usage.Available, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.GetUsage(ctx)
+}
+
+func (mw loggingMiddleware) SetQuota(ctx context.Context, user string, quota int64) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "SetQuota", "user", user, "quota", quota, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.SetQuota(ctx, user, quota)
+}
+
+func (mw loggingMiddleware) GetChanges(ctx context.Context, since string) (changes Changes, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "GetChanges", "since", since, "changes", len(changes.Changes), "token", changes.Token, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.GetChanges(ctx, since)
+}
+
+func (mw loggingMiddleware) CreateShareLink(ctx context.Context, options ShareLinkOptions) (link ShareLink, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "CreateShareLink", "dirPath", options.DirPath, "fileName", options.FileName, "mode", options.Mode, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.CreateShareLink(ctx, options)
+}
+
+func (mw loggingMiddleware) ListShareLinks(ctx context.Context) (links []ShareLink, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "ListShareLinks", "links", len(links), "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.ListShareLinks(ctx)
+}
+
+func (mw loggingMiddleware) DeleteShareLink(ctx context.Context, token string) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "DeleteShareLink", "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.DeleteShareLink(ctx, token)
+}
+
+func (mw loggingMiddleware) GetShared(ctx context.Context, token, password string, options ListOptions) (item SharedItem, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "GetShared", "dirPath", options.DirPath, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.GetShared(ctx, token, password, options)
+}
+
+func (mw loggingMiddleware) DownloadShared(ctx context.Context, token, password, filePath string, format ArchiveFormat) (buffer io.ReadCloser, info fs.FileInfo, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "DownloadShared", "filePath", filePath, "format", format, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.DownloadShared(ctx, token, password, filePath, format)
+}
+
+func (mw loggingMiddleware) UploadShared(ctx context.Context, token, password, dirPath, fileName string, contents io.ReadCloser) (res Result, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "UploadShared", "dirPath", dirPath, "fileName", fileName, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.UploadShared(ctx, token, password, dirPath, fileName, contents)
+}
+
+func (mw loggingMiddleware) GrantAccess(ctx context.Context, options GrantOptions) (grant Grant, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "GrantAccess", "dirPath", options.DirPath, "fileName", options.FileName, "grantee", options.Grantee, "granteeType", options.GranteeType, "permission", options.Permission, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.GrantAccess(ctx, options)
+}
+
+func (mw loggingMiddleware) ListGrants(ctx context.Context) (grants []Grant, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "ListGrants", "grants", len(grants), "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.ListGrants(ctx)
+}
+
+func (mw loggingMiddleware) RevokeAccess(ctx context.Context, id int64) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "RevokeAccess", "id", id, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.RevokeAccess(ctx, id)
+}
+
+func (mw loggingMiddleware) ListACL(ctx context.Context) (entries []ACLEntry, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "ListACL", "entries", len(entries), "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.ListACL(ctx)
+}
+
+func (mw loggingMiddleware) AddACLEntry(ctx context.Context, entry ACLEntry) (res ACLEntry, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "AddACLEntry", "principal", entry.Principal, "principalType", entry.PrincipalType, "pathPrefix", entry.PathPrefix, "actions", len(entry.Actions), "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.AddACLEntry(ctx, entry)
+}
+
+func (mw loggingMiddleware) DeleteACLEntry(ctx context.Context, id int64) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "DeleteACLEntry", "id", id, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.DeleteACLEntry(ctx, id)
+}
+
+func (mw loggingMiddleware) ListGroupMembers(ctx context.Context) (members []GroupMember, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "ListGroupMembers", "members", len(members), "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.ListGroupMembers(ctx)
+}
+
+func (mw loggingMiddleware) AddGroupMember(ctx context.Context, member GroupMember) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "AddGroupMember", "group", member.Group, "user", member.User, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.AddGroupMember(ctx, member)
+}
+
+func (mw loggingMiddleware) RemoveGroupMember(ctx context.Context, member GroupMember) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "RemoveGroupMember", "group", member.Group, "user", member.User, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.RemoveGroupMember(ctx, member)
+}
+
+func (mw loggingMiddleware) ListUploadTypeRules(ctx context.Context) (rules []UploadTypeRule, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "ListUploadTypeRules", "rules", len(rules), "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.ListUploadTypeRules(ctx)
+}
+
+func (mw loggingMiddleware) AddUploadTypeRule(ctx context.Context, rule UploadTypeRule) (res UploadTypeRule, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "AddUploadTypeRule", "principal", rule.Principal, "principalType", rule.PrincipalType, "allow", len(rule.Allow), "deny", len(rule.Deny), "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.AddUploadTypeRule(ctx, rule)
+}
+
+func (mw loggingMiddleware) DeleteUploadTypeRule(ctx context.Context, id int64) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "DeleteUploadTypeRule", "id", id, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.DeleteUploadTypeRule(ctx, id)
+}
+
+func (mw loggingMiddleware) Search(ctx context.Context, options SearchOptions) (res SearchResult, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "Search", "dirPath", options.DirPath, "glob", options.Glob, "ext", options.Ext, "entries", len(res.Entries), "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.Search(ctx, options)
+}
+
+func (mw loggingMiddleware) RebuildIndex(ctx context.Context) (indexed int, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "RebuildIndex", "indexed", indexed, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.RebuildIndex(ctx)
+}
+
+func (mw loggingMiddleware) GetMetadata(ctx context.Context, dirPath, fileName string) (metadata Metadata, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "GetMetadata", "dirPath", dirPath, "fileName", fileName, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.GetMetadata(ctx, dirPath, fileName)
+}
+
+func (mw loggingMiddleware) SetMetadata(ctx context.Context, dirPath, fileName string, metadata Metadata, replace bool) (res Metadata, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "SetMetadata", "dirPath", dirPath, "fileName", fileName, "keys", len(metadata.Values), "tags", len(metadata.Tags), "replace", replace, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.SetMetadata(ctx, dirPath, fileName, metadata, replace)
+}
+
+func (mw loggingMiddleware) DeleteMetadata(ctx context.Context, dirPath, fileName string, keys, tags []string) (res Metadata, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "DeleteMetadata", "dirPath", dirPath, "fileName", fileName, "keys", len(keys), "tags", len(tags), "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.DeleteMetadata(ctx, dirPath, fileName, keys, tags)
+}
+
+func (mw loggingMiddleware) Preview(ctx context.Context, dirPath, fileName string, size int) (buffer io.ReadCloser, info fs.FileInfo, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "Preview", "dirPath", dirPath, "fileName", fileName, "size", size, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.Preview(ctx, dirPath, fileName, size)
+}
+
+func (mw loggingMiddleware) Watch(ctx context.Context, since string) (changes <-chan Changes, err error) {
 	defer func(begin time.Time) {
-		mw.logger.Log("method", "Upload", "dirPath", dirPath, "fileName", fileName, "took", time.Since(begin), "err", err)
+		mw.logger.Log("method", "Watch", "since", since, "took", time.Since(begin), "err", err)
 	}(time.Now())
-	return mw.next.Upload(ctx, dirPath, fileName, contents)
+	return mw.next.Watch(ctx, since)
 }
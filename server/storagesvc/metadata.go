@@ -0,0 +1,189 @@
+package storagesvc
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"unicode"
+
+	fs "remote-storage/server/storagesvc/repository/filesystem"
+)
+
+const (
+	maxMetadataKeys   = 64
+	maxMetadataKeyLen = 128
+	maxMetadataValue  = 1024
+	maxTags           = 64
+	maxTagLen         = 128
+)
+
+// Metadata are the custom key/value pairs and tags of the file
+type Metadata struct {
+	Values map[string]string `json:"metadata"`
+	Tags   []string          `json:"tags"`
+}
+
+func metadataFrom(attrs fs.Attributes) Metadata {
+	res := Metadata{Values: attrs.Metadata, Tags: attrs.Tags}
+	if res.Values == nil {
+		res.Values = map[string]string{}
+	}
+	if res.Tags == nil {
+		res.Tags = []string{}
+	}
+	return res
+}
+
+// validLabel reports whether the key or the tag is not empty,
+// is not too long and has no control characters
+func validLabel(s string, maxLen int) bool {
+	if s == "" || len(s) > maxLen {
+		return false
+	}
+	return strings.IndexFunc(s, unicode.IsControl) < 0
+}
+
+// mergeMetadata returns the attributes with the values and the tags added,
+// the values replace the existing values of the same keys
+func mergeMetadata(attrs fs.Attributes, metadata Metadata) (fs.Attributes, error) {
+	values := make(map[string]string, len(attrs.Metadata)+len(metadata.Values))
+	for k, v := range attrs.Metadata {
+		values[k] = v
+	}
+	for k, v := range metadata.Values {
+		if !validLabel(k, maxMetadataKeyLen) || len(v) > maxMetadataValue {
+			return attrs, ErrInvalidArgument
+		}
+		values[k] = v
+	}
+	tags := append([]string{}, attrs.Tags...)
+	for _, tag := range metadata.Tags {
+		if !validLabel(tag, maxTagLen) {
+			return attrs, ErrInvalidArgument
+		}
+		if !hasTag(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	if len(values) > maxMetadataKeys || len(tags) > maxTags {
+		return attrs, ErrInvalidArgument
+	}
+	sort.Strings(tags)
+	attrs.Metadata, attrs.Tags = values, tags
+	return attrs, nil
+}
+
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// attributeStore returns the backend keeping the metadata of files
+func (svc *service) attributeStore() (fs.AttributeStore, error) {
+	store, ok := svc.backend.(fs.AttributeStore)
+	if !ok {
+		// the backend is always wrapped by fs.AttributeBackend by NewFileSystemService
+		return nil, ErrUnknownError
+	}
+	return store, nil
+}
+
+// GetMetadata returns the metadata and the tags of the file
+func (svc *service) GetMetadata(ctx context.Context, dirPath, fileName string) (Metadata, error) {
+	filePath, err := svc.resolvePath(ctx, dirPath, fileName)
+	if err != nil {
+		return Metadata{}, err
+	}
+	info, err := svc.backend.Stat(filePath)
+	if err != nil {
+		return Metadata{}, getErrorType(err)
+	}
+	return metadataFrom(info.Attributes), nil
+}
+
+// SetMetadata adds the values and the tags to the metadata of the file,
+// replace drops the existing values and tags first
+func (svc *service) SetMetadata(ctx context.Context, dirPath, fileName string, metadata Metadata, replace bool) (Metadata, error) {
+	store, err := svc.attributeStore()
+	if err != nil {
+		return Metadata{}, err
+	}
+	filePath, err := svc.resolvePath(ctx, dirPath, fileName)
+	if err != nil {
+		return Metadata{}, err
+	}
+	info, err := svc.backend.Stat(filePath)
+	if err != nil {
+		return Metadata{}, getErrorType(err)
+	}
+	attrs := info.Attributes
+	if replace {
+		attrs.Metadata, attrs.Tags = nil, nil
+	}
+	attrs, err = mergeMetadata(attrs, metadata)
+	if err != nil {
+		return Metadata{}, err
+	}
+	if err := store.SetAttributes(filePath, attrs); err != nil {
+		return Metadata{}, getErrorType(err)
+	}
+	return metadataFrom(attrs), nil
+}
+
+// DeleteMetadata removes the keys and the tags from the metadata of the file,
+// all metadata and tags are removed if neither keys nor tags are given
+func (svc *service) DeleteMetadata(ctx context.Context, dirPath, fileName string, keys, tags []string) (Metadata, error) {
+	store, err := svc.attributeStore()
+	if err != nil {
+		return Metadata{}, err
+	}
+	filePath, err := svc.resolvePath(ctx, dirPath, fileName)
+	if err != nil {
+		return Metadata{}, err
+	}
+	info, err := svc.backend.Stat(filePath)
+	if err != nil {
+		return Metadata{}, getErrorType(err)
+	}
+	attrs := info.Attributes
+	if len(keys) == 0 && len(tags) == 0 {
+		attrs.Metadata, attrs.Tags = nil, nil
+	} else {
+		for _, k := range keys {
+			delete(attrs.Metadata, k)
+		}
+		kept := attrs.Tags[:0]
+		for _, tag := range attrs.Tags {
+			if !hasTag(tags, tag) {
+				kept = append(kept, tag)
+			}
+		}
+		attrs.Tags = kept
+	}
+	if err := store.SetAttributes(filePath, attrs); err != nil {
+		return Metadata{}, getErrorType(err)
+	}
+	return metadataFrom(attrs), nil
+}
+
+// keepMetadata copies the metadata and the tags of the replaced file to the file
+// overwriting it, so the metadata describe the file rather than its contents
+func (svc *service) keepMetadata(filePath string, replaced fs.Attributes) {
+	if len(replaced.Metadata) == 0 && len(replaced.Tags) == 0 {
+		return
+	}
+	store, err := svc.attributeStore()
+	if err != nil {
+		return
+	}
+	attrs, err := store.GetAttributes(filePath)
+	if err != nil {
+		return
+	}
+	attrs.Metadata, attrs.Tags = replaced.Metadata, replaced.Tags
+	store.SetAttributes(filePath, attrs)
+}
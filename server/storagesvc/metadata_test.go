@@ -0,0 +1,94 @@
+package storagesvc
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func setMetadata(t *testing.T, svc *service, dirPath, fileName string, metadata Metadata) {
+	t.Helper()
+	if _, err := svc.SetMetadata(userContext("alice"), dirPath, fileName, metadata, false); err != nil {
+		t.Fatalf("SetMetadata(%q, %q): %v", dirPath, fileName, err)
+	}
+}
+
+func assertMetadata(t *testing.T, svc *service, dirPath, fileName string, want Metadata) {
+	t.Helper()
+	got, err := svc.GetMetadata(userContext("alice"), dirPath, fileName)
+	if err != nil {
+		t.Fatalf("GetMetadata(%q, %q): %v", dirPath, fileName, err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("metadata of %s/%s = %+v, want %+v", dirPath, fileName, got, want)
+	}
+}
+
+func TestMetadataFollowsFiles(t *testing.T) {
+	svc := newTestService(t)
+	ctx := userContext("alice")
+	for _, dir := range []string{"docs", "archive"} {
+		if _, err := svc.MkDir(ctx, "", dir, ConflictFail); err != nil {
+			t.Fatal(err)
+		}
+	}
+	upload(t, svc, "alice", "docs", "a.txt", "a")
+	metadata := Metadata{Values: map[string]string{"project": "x"}, Tags: []string{"red"}}
+	setMetadata(t, svc, "docs", "a.txt", metadata)
+
+	if _, err := svc.Rename(ctx, "docs", "a.txt", "b.txt", ConflictFail); err != nil {
+		t.Fatal(err)
+	}
+	assertMetadata(t, svc, "docs", "b.txt", metadata)
+	if _, err := svc.Move(ctx, "", "docs", "archive", ConflictFail); err != nil {
+		t.Fatal(err)
+	}
+	assertMetadata(t, svc, "archive/docs", "b.txt", metadata)
+	if _, err := svc.Copy(ctx, "archive/docs", "b.txt", "", ConflictFail); err != nil {
+		t.Fatal(err)
+	}
+	assertMetadata(t, svc, "", "b.txt", metadata)
+	assertMetadata(t, svc, "archive/docs", "b.txt", metadata)
+
+	// the copy has its own metadata
+	setMetadata(t, svc, "", "b.txt", Metadata{Tags: []string{"blue"}})
+	assertMetadata(t, svc, "archive/docs", "b.txt", metadata)
+
+	// the new file at the path of the deleted one has no metadata
+	if _, err := svc.Delete(ctx, "", "b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.GetMetadata(ctx, "", "b.txt"); err != ErrNotFound {
+		t.Fatalf("GetMetadata of the deleted file = %v, want ErrNotFound", err)
+	}
+	upload(t, svc, "alice", "", "b.txt", "new")
+	assertMetadata(t, svc, "", "b.txt", Metadata{Values: map[string]string{}, Tags: []string{}})
+}
+
+func TestListFiltersMetadata(t *testing.T) {
+	svc := newTestService(t)
+	for _, name := range []string{"a.txt", "b.txt", "c.txt", "d.txt"} {
+		upload(t, svc, "alice", "", name, "x")
+	}
+	setMetadata(t, svc, "", "a.txt", Metadata{Values: map[string]string{"project": "x"}, Tags: []string{"red", "draft"}})
+	setMetadata(t, svc, "", "b.txt", Metadata{Values: map[string]string{"project": "y"}, Tags: []string{"red"}})
+	setMetadata(t, svc, "", "c.txt", Metadata{Tags: []string{"draft"}})
+
+	tests := []struct {
+		options ListOptions
+		want    string
+	}{
+		{ListOptions{Tags: []string{"red"}}, "a.txt,b.txt"},
+		{ListOptions{Tags: []string{"red", "draft"}}, "a.txt"},
+		{ListOptions{Metadata: map[string]string{"project": "y"}}, "b.txt"},
+		{ListOptions{Metadata: map[string]string{"project": ""}}, "a.txt,b.txt"},
+		{ListOptions{Metadata: map[string]string{"project": ""}, Tags: []string{"draft"}}, "a.txt"},
+		{ListOptions{Metadata: map[string]string{"owner": ""}}, ""},
+		{ListOptions{}, "a.txt,b.txt,c.txt,d.txt"},
+	}
+	for _, tc := range tests {
+		if got := strings.Join(listAll(t, svc, tc.options), ","); got != tc.want {
+			t.Errorf("List(%+v) = %q, want %q", tc.options, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,609 @@
+package storagesvc
+
+import (
+	"context"
+	"io"
+	"strings"
+	"time"
+
+	"remote-storage/server/authsvc"
+	"remote-storage/server/db"
+	fs "remote-storage/server/storagesvc/repository/filesystem"
+)
+
+// PolicyMiddleware checks every call against the access control list of the user,
+// denied calls fail with ErrForbidden before reaching the service. Paths are checked
+// as the user sees them, so the directories shared with the user are checked
+// in sharedWithMeDir. GetState, List, Search, ListTrash, GetChanges and Watch
+// hide the files the user can't read.
+func PolicyMiddleware(database db.StorageDatabase) Middleware {
+	return func(next Service) Service {
+		return &policyMiddleware{
+			next:     next,
+			database: database,
+		}
+	}
+}
+
+type policyMiddleware struct {
+	next     Service
+	database db.StorageDatabase
+}
+
+// policy is the access control list of the user
+type policy struct {
+	// entries are nil if the user is not restricted
+	entries []db.ACLEntry
+}
+
+func (mw *policyMiddleware) policy(ctx context.Context) (policy, error) {
+	entries, err := mw.database.GetACLEntriesFor(getUserInfFromCtx(ctx).Name)
+	return policy{entries}, err
+}
+
+// covers reports whether the prefix of the entry covers the path
+func covers(prefix, rel string) bool {
+	return prefix == "" || rel == prefix || strings.HasPrefix(rel, prefix+"/")
+}
+
+func hasAction(entry db.ACLEntry, action ACLAction) bool {
+	for _, a := range entry.Actions {
+		if ACLAction(a) == action {
+			return true
+		}
+	}
+	return false
+}
+
+// allows reports whether the action with the file at the path is allowed
+// by the entries with the longest prefix of the path
+func (p policy) allows(rel string, action ACLAction) bool {
+	if p.entries == nil {
+		return true
+	}
+	longest := -1
+	allowed := false
+	for _, entry := range p.entries {
+		if !covers(entry.PathPrefix, rel) {
+			continue
+		}
+		switch {
+		case len(entry.PathPrefix) > longest:
+			longest = len(entry.PathPrefix)
+			allowed = hasAction(entry, action)
+		case len(entry.PathPrefix) == longest:
+			allowed = allowed || hasAction(entry, action)
+		}
+	}
+	return allowed
+}
+
+// allowsTree reports whether the action is allowed with the file at the path
+// and with every file nested into it
+func (p policy) allowsTree(rel string, action ACLAction) bool {
+	if !p.allows(rel, action) {
+		return false
+	}
+	for _, entry := range p.entries {
+		if covers(rel, entry.PathPrefix) && !p.allows(entry.PathPrefix, action) {
+			return false
+		}
+	}
+	return true
+}
+
+// visible reports whether the file at the path is readable or is the directory
+// leading to the readable file
+func (p policy) visible(rel string) bool {
+	if p.allows(rel, ACLRead) {
+		return true
+	}
+	for _, entry := range p.entries {
+		if covers(rel, entry.PathPrefix) && p.allows(entry.PathPrefix, ACLRead) {
+			return true
+		}
+	}
+	return false
+}
+
+// aclPath returns the path of the file relative to the root directory of the user,
+// invalid paths are rejected by the service
+func aclPath(dirPath string, elem ...string) string {
+	dir, _ := cleanDirPath(dirPath)
+	return joinPath(dir, elem...)
+}
+
+// check returns ErrForbidden unless the action is allowed with the files at the paths
+// and with the files nested into them
+func (mw *policyMiddleware) check(ctx context.Context, action ACLAction, paths ...string) error {
+	p, err := mw.policy(ctx)
+	if err != nil {
+		return err
+	}
+	for _, rel := range paths {
+		if !p.allowsTree(rel, action) {
+			return ErrForbidden
+		}
+	}
+	return nil
+}
+
+// checkFile returns ErrForbidden unless the action is allowed with the file at the path,
+// the files nested into it are not checked
+func (mw *policyMiddleware) checkFile(ctx context.Context, action ACLAction, rel string) error {
+	p, err := mw.policy(ctx)
+	if err != nil {
+		return err
+	}
+	if !p.allows(rel, action) {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// prune removes the files the user can't see from the tree of the directory at the path
+func (p policy) prune(info fs.FileInfo, rel string) fs.FileInfo {
+	children := info.Children
+	info.Children = nil
+	for _, child := range children {
+		childPath := joinPath(rel, child.Name)
+		if p.visible(childPath) {
+			info.Children = append(info.Children, p.prune(child, childPath))
+		}
+	}
+	return info
+}
+
+func (mw *policyMiddleware) getAuthSvc() authsvc.Service {
+	return mw.next.getAuthSvc()
+}
+
+func (mw *policyMiddleware) GetState(ctx context.Context) (fs.FileInfo, error) {
+	p, err := mw.policy(ctx)
+	if err != nil {
+		return fs.FileInfo{}, err
+	}
+	if !p.visible("") {
+		return fs.FileInfo{}, ErrForbidden
+	}
+	res, err := mw.next.GetState(ctx)
+	if err != nil || p.entries == nil {
+		return res, err
+	}
+	return p.prune(res, ""), nil
+}
+
+func (mw *policyMiddleware) List(ctx context.Context, options ListOptions) (ListPage, error) {
+	p, err := mw.policy(ctx)
+	if err != nil {
+		return ListPage{}, err
+	}
+	dir := aclPath(options.DirPath)
+	if !p.visible(dir) {
+		return ListPage{}, ErrForbidden
+	}
+	res, err := mw.next.List(ctx, options)
+	if err != nil || p.entries == nil {
+		return res, err
+	}
+	entries := res.Entries[:0]
+	for _, entry := range res.Entries {
+		if p.visible(joinPath(dir, entry.Path)) {
+			entries = append(entries, entry)
+		}
+	}
+	res.Entries = entries
+	return res, nil
+}
+
+func (mw *policyMiddleware) MkDir(ctx context.Context, dirPath, dirName string, conflict ConflictPolicy) (Result, error) {
+	if err := mw.check(ctx, ACLWrite, aclPath(dirPath, dirName)); err != nil {
+		return Result{}, err
+	}
+	return mw.next.MkDir(ctx, dirPath, dirName, conflict)
+}
+
+func (mw *policyMiddleware) Rename(ctx context.Context, dirPath, oldName, newName string, conflict ConflictPolicy) (Result, error) {
+	if err := mw.check(ctx, ACLDelete, aclPath(dirPath, oldName)); err != nil {
+		return Result{}, err
+	}
+	if err := mw.check(ctx, ACLWrite, aclPath(dirPath, newName)); err != nil {
+		return Result{}, err
+	}
+	return mw.next.Rename(ctx, dirPath, oldName, newName, conflict)
+}
+
+func (mw *policyMiddleware) Move(ctx context.Context, srcDirPath, fileName, destDirPath string, conflict ConflictPolicy) (Result, error) {
+	if err := mw.check(ctx, ACLDelete, aclPath(srcDirPath, fileName)); err != nil {
+		return Result{}, err
+	}
+	if err := mw.check(ctx, ACLWrite, aclPath(destDirPath, fileName)); err != nil {
+		return Result{}, err
+	}
+	return mw.next.Move(ctx, srcDirPath, fileName, destDirPath, conflict)
+}
+
+func (mw *policyMiddleware) Delete(ctx context.Context, dirPath, fileName string) (string, error) {
+	if err := mw.check(ctx, ACLDelete, aclPath(dirPath, fileName)); err != nil {
+		return "", err
+	}
+	return mw.next.Delete(ctx, dirPath, fileName)
+}
+
+func (mw *policyMiddleware) Copy(ctx context.Context, srcDirPath, fileName, destDirPath string, conflict ConflictPolicy) (Result, error) {
+	if err := mw.check(ctx, ACLRead, aclPath(srcDirPath, fileName)); err != nil {
+		return Result{}, err
+	}
+	if err := mw.check(ctx, ACLWrite, aclPath(destDirPath, fileName)); err != nil {
+		return Result{}, err
+	}
+	return mw.next.Copy(ctx, srcDirPath, fileName, destDirPath, conflict)
+}
+
+func (mw *policyMiddleware) Batch(ctx context.Context, operations []BatchOperation, stopOnError bool) ([]BatchResult, error) {
+	return runBatch(ctx, mw, operations, stopOnError)
+}
+
+func (mw *policyMiddleware) Extract(ctx context.Context, dirPath, fileName, destDirPath string, conflict ConflictPolicy) ([]Result, error) {
+	if err := mw.check(ctx, ACLRead, aclPath(dirPath, fileName)); err != nil {
+		return nil, err
+	}
+	if err := mw.check(ctx, ACLWrite, aclPath(destDirPath)); err != nil {
+		return nil, err
+	}
+	return mw.next.Extract(ctx, dirPath, fileName, destDirPath, conflict)
+}
+
+func (mw *policyMiddleware) Download(ctx context.Context, dirPath, fileName string) (io.ReadCloser, fs.FileInfo, error) {
+	if err := mw.check(ctx, ACLRead, aclPath(dirPath, fileName)); err != nil {
+		return nil, fs.FileInfo{}, err
+	}
+	return mw.next.Download(ctx, dirPath, fileName)
+}
+
+func (mw *policyMiddleware) DownloadArchive(ctx context.Context, dirPath string, fileNames []string, format ArchiveFormat) (io.ReadCloser, fs.FileInfo, error) {
+	paths := []string{aclPath(dirPath)}
+	if len(fileNames) > 0 {
+		paths = paths[:0]
+		for _, name := range fileNames {
+			paths = append(paths, aclPath(dirPath, name))
+		}
+	}
+	if err := mw.check(ctx, ACLRead, paths...); err != nil {
+		return nil, fs.FileInfo{}, err
+	}
+	return mw.next.DownloadArchive(ctx, dirPath, fileNames, format)
+}
+
+func (mw *policyMiddleware) Upload(ctx context.Context, dirPath, fileName string, contents io.ReadCloser, checksum Checksum, conflict ConflictPolicy) (Result, error) {
+	if err := mw.check(ctx, ACLWrite, aclPath(dirPath, fileName)); err != nil {
+		contents.Close()
+		return Result{}, err
+	}
+	return mw.next.Upload(ctx, dirPath, fileName, contents, checksum, conflict)
+}
+
+func (mw *policyMiddleware) CreateUploadSession(ctx context.Context, dirPath, fileName string, size int64, checksum Checksum, conflict ConflictPolicy) (UploadSession, error) {
+	if err := mw.check(ctx, ACLWrite, aclPath(dirPath, fileName)); err != nil {
+		return UploadSession{}, err
+	}
+	return mw.next.CreateUploadSession(ctx, dirPath, fileName, size, checksum, conflict)
+}
+
+func (mw *policyMiddleware) GetUploadSession(ctx context.Context, id string) (UploadSession, error) {
+	return mw.next.GetUploadSession(ctx, id)
+}
+
+func (mw *policyMiddleware) UploadChunk(ctx context.Context, id string, offset int64, contents io.ReadCloser) (UploadSession, error) {
+	return mw.next.UploadChunk(ctx, id, offset, contents)
+}
+
+// FinalizeUploadSession checks the path of the session again, as the entries
+// could change since the session was created
+func (mw *policyMiddleware) FinalizeUploadSession(ctx context.Context, id string) (Result, error) {
+	session, err := mw.next.GetUploadSession(ctx, id)
+	if err != nil {
+		return Result{}, err
+	}
+	if err := mw.check(ctx, ACLWrite, aclPath(session.DirPath, session.FileName)); err != nil {
+		return Result{}, err
+	}
+	return mw.next.FinalizeUploadSession(ctx, id)
+}
+
+func (mw *policyMiddleware) ListVersions(ctx context.Context, dirPath, fileName string) ([]FileVersion, error) {
+	if err := mw.check(ctx, ACLRead, aclPath(dirPath, fileName)); err != nil {
+		return nil, err
+	}
+	return mw.next.ListVersions(ctx, dirPath, fileName)
+}
+
+func (mw *policyMiddleware) DownloadVersion(ctx context.Context, dirPath, fileName, versionID string) (io.ReadCloser, fs.FileInfo, error) {
+	if err := mw.check(ctx, ACLRead, aclPath(dirPath, fileName)); err != nil {
+		return nil, fs.FileInfo{}, err
+	}
+	return mw.next.DownloadVersion(ctx, dirPath, fileName, versionID)
+}
+
+func (mw *policyMiddleware) RestoreVersion(ctx context.Context, dirPath, fileName, versionID string) (string, error) {
+	if err := mw.check(ctx, ACLWrite, aclPath(dirPath, fileName)); err != nil {
+		return "", err
+	}
+	return mw.next.RestoreVersion(ctx, dirPath, fileName, versionID)
+}
+
+// PruneVersions requires ACLDelete for the whole root directory
+func (mw *policyMiddleware) PruneVersions(ctx context.Context, keep int, maxAge time.Duration) (int, error) {
+	if err := mw.check(ctx, ACLDelete, ""); err != nil {
+		return 0, err
+	}
+	return mw.next.PruneVersions(ctx, keep, maxAge)
+}
+
+// ListTrash hides the items deleted from the paths the user can't read
+func (mw *policyMiddleware) ListTrash(ctx context.Context) ([]TrashItem, error) {
+	p, err := mw.policy(ctx)
+	if err != nil {
+		return nil, err
+	}
+	items, err := mw.next.ListTrash(ctx)
+	if err != nil || p.entries == nil {
+		return items, err
+	}
+	res := make([]TrashItem, 0, len(items))
+	for _, item := range items {
+		if p.visible(aclPath(item.DirPath, item.FileName)) {
+			res = append(res, item)
+		}
+	}
+	return res, nil
+}
+
+// RestoreFromTrash requires ACLWrite for the original path of the item
+func (mw *policyMiddleware) RestoreFromTrash(ctx context.Context, id string, conflict ConflictPolicy) (Result, error) {
+	items, err := mw.next.ListTrash(ctx)
+	if err != nil {
+		return Result{}, err
+	}
+	for _, item := range items {
+		if item.ID != id {
+			continue
+		}
+		if err := mw.check(ctx, ACLWrite, aclPath(item.DirPath, item.FileName)); err != nil {
+			return Result{}, err
+		}
+	}
+	return mw.next.RestoreFromTrash(ctx, id, conflict)
+}
+
+// EmptyTrash requires ACLDelete for the whole root directory
+func (mw *policyMiddleware) EmptyTrash(ctx context.Context) (int, error) {
+	if err := mw.check(ctx, ACLDelete, ""); err != nil {
+		return 0, err
+	}
+	return mw.next.EmptyTrash(ctx)
+}
+
+// GetUsage requires ACLRead for the whole root directory,
+// the usage counts the files the user may be unable to read otherwise
+func (mw *policyMiddleware) GetUsage(ctx context.Context) (Usage, error) {
+	if err := mw.check(ctx, ACLRead, ""); err != nil {
+		return Usage{}, err
+	}
+	return mw.next.GetUsage(ctx)
+}
+
+func (mw *policyMiddleware) SetQuota(ctx context.Context, user string, quota int64) error {
+	return mw.next.SetQuota(ctx, user, quota)
+}
+
+// filterChanges hides the changes of the files the user can't read. Files moved
+// between readable and hidden paths are reported as created or deleted.
+func (p policy) filterChanges(changes []Change) []Change {
+	if p.entries == nil {
+		return changes
+	}
+	res := make([]Change, 0, len(changes))
+	for _, change := range changes {
+		visible := p.visible(aclPath(change.Path))
+		if change.Type == ChangeMoved {
+			oldVisible := p.visible(aclPath(change.OldPath))
+			switch {
+			case visible && !oldVisible:
+				change.Type = ChangeCreated
+				change.OldPath = ""
+			case !visible && oldVisible:
+				change.Type = ChangeDeleted
+				change.Path, change.OldPath = change.OldPath, ""
+				visible = true
+			}
+		}
+		if visible {
+			res = append(res, change)
+		}
+	}
+	return res
+}
+
+// GetChanges hides the changes of the files the user can't read
+func (mw *policyMiddleware) GetChanges(ctx context.Context, since string) (Changes, error) {
+	p, err := mw.policy(ctx)
+	if err != nil {
+		return Changes{}, err
+	}
+	res, err := mw.next.GetChanges(ctx, since)
+	if err != nil {
+		return res, err
+	}
+	res.Changes = p.filterChanges(res.Changes)
+	return res, nil
+}
+
+// Watch hides the changes of the files the user can't read, the policy is read again
+// for every page, so the stream follows the changes of the access control list.
+// Pages left without changes are dropped, except the first one.
+func (mw *policyMiddleware) Watch(ctx context.Context, since string) (<-chan Changes, error) {
+	if _, err := mw.policy(ctx); err != nil {
+		return nil, err
+	}
+	changes, err := mw.next.Watch(ctx, since)
+	if err != nil {
+		return nil, err
+	}
+	res := make(chan Changes)
+	go func() {
+		defer close(res)
+		first := true
+		for page := range changes {
+			p, err := mw.policy(ctx)
+			if err != nil {
+				// nothing is sent unchecked, the client reconnects from the last token
+				return
+			}
+			page.Changes = p.filterChanges(page.Changes)
+			if !first && len(page.Changes) == 0 && !page.ResyncRequired {
+				continue
+			}
+			first = false
+			select {
+			case res <- page:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return res, nil
+}
+
+func (mw *policyMiddleware) CreateShareLink(ctx context.Context, options ShareLinkOptions) (ShareLink, error) {
+	if err := mw.check(ctx, ACLShare, aclPath(options.DirPath, options.FileName)); err != nil {
+		return ShareLink{}, err
+	}
+	return mw.next.CreateShareLink(ctx, options)
+}
+
+func (mw *policyMiddleware) ListShareLinks(ctx context.Context) ([]ShareLink, error) {
+	return mw.next.ListShareLinks(ctx)
+}
+
+func (mw *policyMiddleware) DeleteShareLink(ctx context.Context, token string) error {
+	return mw.next.DeleteShareLink(ctx, token)
+}
+
+func (mw *policyMiddleware) GetShared(ctx context.Context, token, password string, options ListOptions) (SharedItem, error) {
+	return mw.next.GetShared(ctx, token, password, options)
+}
+
+func (mw *policyMiddleware) DownloadShared(ctx context.Context, token, password, filePath string, format ArchiveFormat) (io.ReadCloser, fs.FileInfo, error) {
+	return mw.next.DownloadShared(ctx, token, password, filePath, format)
+}
+
+func (mw *policyMiddleware) UploadShared(ctx context.Context, token, password, dirPath, fileName string, contents io.ReadCloser) (Result, error) {
+	return mw.next.UploadShared(ctx, token, password, dirPath, fileName, contents)
+}
+
+func (mw *policyMiddleware) GrantAccess(ctx context.Context, options GrantOptions) (Grant, error) {
+	if err := mw.check(ctx, ACLShare, aclPath(options.DirPath, options.FileName)); err != nil {
+		return Grant{}, err
+	}
+	return mw.next.GrantAccess(ctx, options)
+}
+
+func (mw *policyMiddleware) ListGrants(ctx context.Context) ([]Grant, error) {
+	return mw.next.ListGrants(ctx)
+}
+
+func (mw *policyMiddleware) RevokeAccess(ctx context.Context, id int64) error {
+	return mw.next.RevokeAccess(ctx, id)
+}
+
+func (mw *policyMiddleware) ListACL(ctx context.Context) ([]ACLEntry, error) {
+	return mw.next.ListACL(ctx)
+}
+
+func (mw *policyMiddleware) AddACLEntry(ctx context.Context, entry ACLEntry) (ACLEntry, error) {
+	return mw.next.AddACLEntry(ctx, entry)
+}
+
+func (mw *policyMiddleware) DeleteACLEntry(ctx context.Context, id int64) error {
+	return mw.next.DeleteACLEntry(ctx, id)
+}
+
+func (mw *policyMiddleware) ListGroupMembers(ctx context.Context) ([]GroupMember, error) {
+	return mw.next.ListGroupMembers(ctx)
+}
+
+func (mw *policyMiddleware) AddGroupMember(ctx context.Context, member GroupMember) error {
+	return mw.next.AddGroupMember(ctx, member)
+}
+
+func (mw *policyMiddleware) RemoveGroupMember(ctx context.Context, member GroupMember) error {
+	return mw.next.RemoveGroupMember(ctx, member)
+}
+
+func (mw *policyMiddleware) ListUploadTypeRules(ctx context.Context) ([]UploadTypeRule, error) {
+	return mw.next.ListUploadTypeRules(ctx)
+}
+
+func (mw *policyMiddleware) AddUploadTypeRule(ctx context.Context, rule UploadTypeRule) (UploadTypeRule, error) {
+	return mw.next.AddUploadTypeRule(ctx, rule)
+}
+
+func (mw *policyMiddleware) DeleteUploadTypeRule(ctx context.Context, id int64) error {
+	return mw.next.DeleteUploadTypeRule(ctx, id)
+}
+
+func (mw *policyMiddleware) Search(ctx context.Context, options SearchOptions) (SearchResult, error) {
+	p, err := mw.policy(ctx)
+	if err != nil {
+		return SearchResult{}, err
+	}
+	dir := aclPath(options.DirPath)
+	if !p.visible(dir) {
+		return SearchResult{}, ErrForbidden
+	}
+	res, err := mw.next.Search(ctx, options)
+	if err != nil || p.entries == nil {
+		return res, err
+	}
+	entries := res.Entries[:0]
+	for _, entry := range res.Entries {
+		if p.visible(joinPath(dir, entry.Path)) {
+			entries = append(entries, entry)
+		}
+	}
+	res.Entries = entries
+	return res, nil
+}
+
+func (mw *policyMiddleware) RebuildIndex(ctx context.Context) (int, error) {
+	return mw.next.RebuildIndex(ctx)
+}
+
+func (mw *policyMiddleware) GetMetadata(ctx context.Context, dirPath, fileName string) (Metadata, error) {
+	if err := mw.checkFile(ctx, ACLRead, aclPath(dirPath, fileName)); err != nil {
+		return Metadata{}, err
+	}
+	return mw.next.GetMetadata(ctx, dirPath, fileName)
+}
+
+func (mw *policyMiddleware) SetMetadata(ctx context.Context, dirPath, fileName string, metadata Metadata, replace bool) (Metadata, error) {
+	if err := mw.checkFile(ctx, ACLWrite, aclPath(dirPath, fileName)); err != nil {
+		return Metadata{}, err
+	}
+	return mw.next.SetMetadata(ctx, dirPath, fileName, metadata, replace)
+}
+
+func (mw *policyMiddleware) DeleteMetadata(ctx context.Context, dirPath, fileName string, keys, tags []string) (Metadata, error) {
+	if err := mw.checkFile(ctx, ACLWrite, aclPath(dirPath, fileName)); err != nil {
+		return Metadata{}, err
+	}
+	return mw.next.DeleteMetadata(ctx, dirPath, fileName, keys, tags)
+}
+
+func (mw *policyMiddleware) Preview(ctx context.Context, dirPath, fileName string, size int) (io.ReadCloser, fs.FileInfo, error) {
+	if err := mw.check(ctx, ACLRead, aclPath(dirPath, fileName)); err != nil {
+		return nil, fs.FileInfo{}, err
+	}
+	return mw.next.Preview(ctx, dirPath, fileName, size)
+}
@@ -0,0 +1,102 @@
+package storagesvc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"remote-storage/server/db"
+)
+
+// newRestrictedService returns the service checked by the policy where bob is only allowed
+// to read the docs directory, bob's files are created in docs and secret
+func newRestrictedService(t *testing.T) (*service, Service) {
+	t.Helper()
+	svc := newTestService(t)
+	bob := userContext("bob")
+	for _, dir := range []string{"docs", "secret"} {
+		if _, err := svc.MkDir(bob, "", dir, ConflictFail); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err := svc.database.CreateACLEntry(db.ACLEntry{
+		Principal:     "bob",
+		PrincipalType: string(GranteeUser),
+		PathPrefix:    "docs",
+		Actions:       []string{string(ACLRead)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return svc, PolicyMiddleware(svc.database)(svc)
+}
+
+func TestPolicyHidesChanges(t *testing.T) {
+	svc, restricted := newRestrictedService(t)
+	bob := userContext("bob")
+	start, err := restricted.GetChanges(bob, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	upload(t, svc, "bob", "docs", "a.txt", "a")
+	upload(t, svc, "bob", "secret", "b.txt", "b")
+	upload(t, svc, "bob", "secret", "c.txt", "c")
+	if _, err := svc.Move(bob, "secret", "b.txt", "docs", ConflictFail); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Move(bob, "docs", "a.txt", "secret", ConflictFail); err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := restricted.GetChanges(bob, start.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Change{
+		{Type: ChangeCreated, Path: "docs/a.txt"},
+		{Type: ChangeCreated, Path: "docs/b.txt"},
+		{Type: ChangeDeleted, Path: "docs/a.txt"},
+	}
+	if len(changes.Changes) != len(want) {
+		t.Fatalf("changes = %+v, want %+v", changes.Changes, want)
+	}
+	for i, change := range changes.Changes {
+		if change.Type != want[i].Type || change.Path != want[i].Path || change.OldPath != "" {
+			t.Fatalf("changes = %+v, want %+v", changes.Changes, want)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(bob, 5*time.Second)
+	defer cancel()
+	watch, err := restricted.Watch(ctx, start.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := <-watch
+	if len(page.Changes) != len(want) {
+		t.Fatalf("watched changes = %+v, want %+v", page.Changes, want)
+	}
+}
+
+func TestPolicyHidesTrash(t *testing.T) {
+	svc, restricted := newRestrictedService(t)
+	bob := userContext("bob")
+	upload(t, svc, "bob", "docs", "a.txt", "a")
+	upload(t, svc, "bob", "secret", "b.txt", "b")
+	if _, err := svc.Delete(bob, "docs", "a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Delete(bob, "secret", "b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	items, err := restricted.ListTrash(bob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items[0].DirPath != "docs" {
+		t.Fatalf("trash = %+v", items)
+	}
+	if _, err := restricted.GetUsage(bob); err != ErrForbidden {
+		t.Fatalf("GetUsage = %v, want ErrForbidden", err)
+	}
+}
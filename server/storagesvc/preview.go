@@ -0,0 +1,282 @@
+package storagesvc
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"image"
+	"image/color"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	fs "remote-storage/server/storagesvc/repository/filesystem"
+)
+
+const (
+	defaultPreviewsDir = ".previews"
+	defaultPreviewSize = 256
+	minPreviewSize     = 16
+	maxPreviewSize     = 1024
+	// maxPreviewPixels limits the images decoded for previews, so huge images don't exhaust memory
+	maxPreviewPixels = 25 << 20
+	// maxPreviewText is the size of the snippet of text files
+	maxPreviewText = 4 << 10
+)
+
+// previewStore caches the previews of files by the SHA-256 digest of their contents,
+// so identical files share previews and changed files never get stale ones
+type previewStore struct {
+	backend fs.Backend
+	rootDir string
+}
+
+func newPreviewStore(backend fs.Backend, rootDir string) *previewStore {
+	if rootDir == "" {
+		rootDir = defaultPreviewsDir
+	}
+	return &previewStore{
+		backend: backend,
+		rootDir: rootDir,
+	}
+}
+
+// dirOf returns the directory keeping the previews of the contents with the digest
+func (p *previewStore) dirOf(digest string) string {
+	return path.Join(p.rootDir, digest[:2])
+}
+
+func (p *previewStore) thumbnailPath(digest string, size int) string {
+	return path.Join(p.dirOf(digest), digest+"-"+strconv.Itoa(size)+".png")
+}
+
+func (p *previewStore) snippetPath(digest string) string {
+	return path.Join(p.dirOf(digest), digest+".txt")
+}
+
+// open returns the cached preview, nil if nothing is cached
+func (p *previewStore) open(previewPath string) (fs.File, int64) {
+	info, err := p.backend.Stat(previewPath)
+	if err != nil || info.IsDir {
+		return nil, 0
+	}
+	f, err := p.backend.OpenFile(previewPath)
+	if err != nil {
+		return nil, 0
+	}
+	return f, info.Size
+}
+
+// store caches the preview, failing to cache doesn't fail the preview
+func (p *previewStore) store(previewPath string, data []byte) {
+	if err := fs.MkdirAll(p.backend, path.Dir(previewPath), 0755); err != nil {
+		return
+	}
+	w, err := p.backend.Create(previewPath)
+	if err != nil {
+		return
+	}
+	if _, err = w.Write(data); err != nil {
+		fs.Abort(w)
+	} else {
+		err = w.Close()
+	}
+	if err != nil {
+		p.backend.RemoveAll(previewPath)
+	}
+}
+
+// invalidate removes the cached previews of the contents with the digest
+func (p *previewStore) invalidate(digest string) {
+	if len(digest) < 2 {
+		return
+	}
+	children, err := fs.ReadDir(p.backend, p.dirOf(digest))
+	if err != nil {
+		return
+	}
+	for _, child := range children {
+		if strings.HasPrefix(child.Name, digest) {
+			p.backend.RemoveAll(path.Join(p.dirOf(digest), child.Name))
+		}
+	}
+}
+
+// previewContents is the generated preview served like the contents of the file
+type previewContents struct {
+	*bytes.Reader
+}
+
+func (previewContents) Close() error {
+	return nil
+}
+
+// isText reports whether the beginning of the contents looks like text
+func isText(data []byte) bool {
+	return len(data) > 0 && strings.HasPrefix(http.DetectContentType(data), "text/")
+}
+
+// thumbnail scales the image down to fit into the square of the size keeping its proportions,
+// every pixel of the thumbnail is the average of the pixels of the image it covers
+func thumbnail(src image.Image, size int) image.Image {
+	bounds := src.Bounds()
+	sw, sh := bounds.Dx(), bounds.Dy()
+	if sw <= size && sh <= size {
+		return src
+	}
+	w, h := size, size
+	if sw > sh {
+		h = sh * size / sw
+	} else {
+		w = sw * size / sh
+	}
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+	dst := image.NewRGBA64(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		y0, y1 := bounds.Min.Y+y*sh/h, bounds.Min.Y+(y+1)*sh/h
+		for x := 0; x < w; x++ {
+			x0, x1 := bounds.Min.X+x*sw/w, bounds.Min.X+(x+1)*sw/w
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := src.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(pr), g+uint64(pg), b+uint64(pb), a+uint64(pa)
+					n++
+				}
+			}
+			dst.SetRGBA64(x, y, color.RGBA64{
+				R: uint16(r / n),
+				G: uint16(g / n),
+				B: uint16(b / n),
+				A: uint16(a / n),
+			})
+		}
+	}
+	return dst
+}
+
+// snippet returns the beginning of the text cut at the last complete line
+func snippet(data []byte) []byte {
+	if len(data) == maxPreviewText {
+		if i := bytes.LastIndexByte(data, '\n'); i > 0 {
+			data = data[:i+1]
+		}
+	}
+	if !utf8.Valid(data) {
+		data = bytes.ToValidUTF8(data, nil)
+	}
+	return data
+}
+
+// contentDigest returns the SHA-256 digest of the file, the stored checksum is used if it is known
+func (svc *service) contentDigest(filePath string, info fs.FileInfo) (string, error) {
+	if info.SHA256 != "" {
+		return info.SHA256, nil
+	}
+	f, err := svc.backend.OpenFile(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Preview returns the PNG thumbnail of the PNG, JPEG or GIF image fitting into the square
+// of the size, or the snippet of the text file. Other files have no previews.
+func (svc *service) Preview(ctx context.Context, dirPath, fileName string, size int) (io.ReadCloser, fs.FileInfo, error) {
+	if size == 0 {
+		size = defaultPreviewSize
+	}
+	if size < minPreviewSize || size > maxPreviewSize {
+		return nil, fs.FileInfo{}, ErrInvalidArgument
+	}
+	filePath, err := svc.resolvePath(ctx, dirPath, fileName)
+	if err != nil {
+		return nil, fs.FileInfo{}, err
+	}
+	info, err := svc.backend.Stat(filePath)
+	if err != nil {
+		return nil, fs.FileInfo{}, getErrorType(err)
+	}
+	if info.IsDir {
+		return nil, fs.FileInfo{}, ErrInvalidArgument
+	}
+	digest, err := svc.contentDigest(filePath, info)
+	if err != nil {
+		return nil, fs.FileInfo{}, getErrorType(err)
+	}
+	base := strings.TrimSuffix(info.Name, path.Ext(info.Name))
+	previewInfo := func(ext string, size int64) fs.FileInfo {
+		return fs.FileInfo{Name: base + ext, Size: size, Modified: info.Modified}
+	}
+	thumbnailPath, snippetPath := svc.previews.thumbnailPath(digest, size), svc.previews.snippetPath(digest)
+	if f, n := svc.previews.open(thumbnailPath); f != nil {
+		return f, previewInfo(".png", n), nil
+	}
+	if f, n := svc.previews.open(snippetPath); f != nil {
+		return f, previewInfo(".txt", n), nil
+	}
+
+	f, err := svc.backend.OpenFile(filePath)
+	if err != nil {
+		return nil, fs.FileInfo{}, getErrorType(err)
+	}
+	defer f.Close()
+	var data []byte
+	if config, _, err := image.DecodeConfig(f); err == nil {
+		if config.Width*config.Height > maxPreviewPixels {
+			return nil, fs.FileInfo{}, ErrInvalidArgument
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return nil, fs.FileInfo{}, getErrorType(err)
+		}
+		img, _, err := image.Decode(f)
+		if err != nil {
+			return nil, fs.FileInfo{}, ErrInvalidArgument
+		}
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, thumbnail(img, size)); err != nil {
+			return nil, fs.FileInfo{}, ErrUnknownError
+		}
+		data = buf.Bytes()
+		svc.previews.store(thumbnailPath, data)
+		return previewContents{bytes.NewReader(data)}, previewInfo(".png", int64(len(data))), nil
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, fs.FileInfo{}, getErrorType(err)
+	}
+	data, err = io.ReadAll(io.LimitReader(f, maxPreviewText))
+	if err != nil {
+		return nil, fs.FileInfo{}, getErrorType(err)
+	}
+	if !isText(data) {
+		return nil, fs.FileInfo{}, ErrInvalidArgument
+	}
+	data = snippet(data)
+	svc.previews.store(snippetPath, data)
+	return previewContents{bytes.NewReader(data)}, previewInfo(".txt", int64(len(data))), nil
+}
+
+// invalidatePreviews removes the cached previews of the replaced contents of the file
+func (svc *service) invalidatePreviews(replaced fs.FileInfo) {
+	if replaced.SHA256 != "" {
+		svc.previews.invalidate(replaced.SHA256)
+	}
+}
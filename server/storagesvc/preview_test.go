@@ -0,0 +1,90 @@
+package storagesvc
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"testing"
+)
+
+func pngOf(t *testing.T, c color.Color) string {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func preview(t *testing.T, svc *service, fileName string, size int) []byte {
+	t.Helper()
+	f, _, err := svc.Preview(userContext("alice"), "", fileName, size)
+	if err != nil {
+		t.Fatalf("Preview(%q): %v", fileName, err)
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func isCached(svc *service, previewPath string) bool {
+	_, err := svc.previews.backend.Stat(previewPath)
+	return err == nil
+}
+
+func TestOverwriteInvalidatesThumbnail(t *testing.T) {
+	svc := newTestService(t)
+	red, blue := pngOf(t, color.RGBA{R: 255, A: 255}), pngOf(t, color.RGBA{B: 255, A: 255})
+	upload(t, svc, "alice", "", "a.png", red)
+	preview(t, svc, "a.png", 16)
+	redThumbnail := svc.previews.thumbnailPath(sha256Of(red), 16)
+	if !isCached(svc, redThumbnail) {
+		t.Fatal("thumbnail is not cached")
+	}
+
+	upload(t, svc, "alice", "", "a.png", blue)
+	if isCached(svc, redThumbnail) {
+		t.Fatal("thumbnail of the replaced contents is kept")
+	}
+	img, err := png.Decode(bytes.NewReader(preview(t, svc, "a.png", 16)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, _, b, _ := img.At(0, 0).RGBA(); r != 0 || b != 0xffff {
+		t.Fatalf("thumbnail of the new contents is %v", img.At(0, 0))
+	}
+	if !isCached(svc, svc.previews.thumbnailPath(sha256Of(blue), 16)) {
+		t.Fatal("thumbnail of the new contents is not cached")
+	}
+}
+
+func TestOverwriteInvalidatesSnippet(t *testing.T) {
+	svc := newTestService(t)
+	upload(t, svc, "alice", "", "a.txt", "old text\n")
+	if got := string(preview(t, svc, "a.txt", 0)); got != "old text\n" {
+		t.Fatalf("snippet = %q", got)
+	}
+	oldSnippet := svc.previews.snippetPath(sha256Of("old text\n"))
+	if !isCached(svc, oldSnippet) {
+		t.Fatal("snippet is not cached")
+	}
+
+	upload(t, svc, "alice", "", "a.txt", "new text\n")
+	if isCached(svc, oldSnippet) {
+		t.Fatal("snippet of the replaced contents is kept")
+	}
+	if got := string(preview(t, svc, "a.txt", 0)); got != "new text\n" {
+		t.Fatalf("snippet = %q, want the new contents", got)
+	}
+}
@@ -0,0 +1,316 @@
+package filesystem
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+const (
+	defaultAttributesDir = ".attrs"
+	// attributesFileName is the name of the file keeping the attributes in the mirrored directory,
+	// mirrored directories of nested files are prefixed, so they never collide with it
+	attributesFileName = "attrs.json"
+	mirrorPrefix       = "d-"
+)
+
+// Attributes are the properties of the file kept beside its contents
+type Attributes struct {
+	// SHA256 is the hex encoded SHA-256 digest of the contents
+	SHA256 string `json:"sha256,omitempty"`
+	// CRC32C is the hex encoded CRC-32 checksum of the contents with the Castagnoli polynomial
+	CRC32C string `json:"crc32c,omitempty"`
+	// Metadata are the custom key/value pairs of the file set by its owner
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// Tags are the custom labels of the file set by its owner
+	Tags []string `json:"tags,omitempty"`
+	// ContentType is the MIME type of the contents detected when the file is uploaded
+	ContentType string `json:"content_type,omitempty"`
+	// Blob is the reference to the contents kept by DedupBackend, it is never returned by DedupBackend
+	Blob string `json:"blob,omitempty"`
+}
+
+func (a Attributes) isEmpty() bool {
+	return a.SHA256 == "" && a.CRC32C == "" && len(a.Metadata) == 0 && len(a.Tags) == 0 && a.ContentType == "" && a.Blob == ""
+}
+
+// AttributeStore is implemented by backends keeping the attributes of files.
+// Attributes follow the files on Rename and Copy, they are dropped when
+// the file is removed or created again, and returned in FileInfo.
+type AttributeStore interface {
+	GetAttributes(path string) (Attributes, error)
+	SetAttributes(path string, attrs Attributes) error
+}
+
+type ConfigAttributes struct {
+	// Dir is the directory of the backend keeping the attributes, ".attrs" by default
+	Dir string
+}
+
+// AttributeBackend is a Backend keeping the attributes of files of the wrapped backend.
+// The attributes of every file are kept in the mirror of the tree in the attributes directory,
+// so moving or copying the directory moves or copies the attributes of all nested files at once.
+type AttributeBackend struct {
+	backend Backend
+	dir     string
+}
+
+// NewAttributeBackend returns the Backend keeping files in backend together with their attributes
+func NewAttributeBackend(backend Backend, config ConfigAttributes) *AttributeBackend {
+	dir := strings.Trim(config.Dir, "/")
+	if dir == "" {
+		dir = defaultAttributesDir
+	}
+	return &AttributeBackend{
+		backend: backend,
+		dir:     dir,
+	}
+}
+
+// mirrorPath returns the directory of the mirror keeping the attributes of the file at p
+func (a *AttributeBackend) mirrorPath(p string) string {
+	res := a.dir
+	for _, name := range strings.Split(p, "/") {
+		if name == "" || name == "." {
+			continue
+		}
+		res += "/" + mirrorPrefix + name
+	}
+	return res
+}
+
+func (a *AttributeBackend) attributesPath(p string) string {
+	return a.mirrorPath(p) + "/" + attributesFileName
+}
+
+// GetAttributes implements AttributeStore, empty attributes are returned if nothing is kept
+func (a *AttributeBackend) GetAttributes(p string) (Attributes, error) {
+	var attrs Attributes
+	file, err := a.backend.OpenFile(a.attributesPath(p))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return attrs, nil
+		}
+		return attrs, err
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return attrs, err
+	}
+	if err := json.Unmarshal(data, &attrs); err != nil {
+		// broken attributes are treated as missing
+		return Attributes{}, nil
+	}
+	return attrs, nil
+}
+
+// SetAttributes implements AttributeStore, the file must exist
+func (a *AttributeBackend) SetAttributes(p string, attrs Attributes) error {
+	if _, err := a.backend.Stat(p); err != nil {
+		return err
+	}
+	if attrs.isEmpty() {
+		return a.removeAttributes(a.attributesPath(p))
+	}
+	if err := MkdirAll(a.backend, a.mirrorPath(p), 0755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(attrs)
+	if err != nil {
+		return err
+	}
+	file, err := a.backend.Create(a.attributesPath(p))
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		Abort(file)
+		return err
+	}
+	return file.Close()
+}
+
+func (a *AttributeBackend) removeAttributes(p string) error {
+	err := a.backend.RemoveAll(p)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Create implements Backend, the attributes of the replaced file are dropped
+func (a *AttributeBackend) Create(p string) (io.WriteCloser, error) {
+	w, err := a.backend.Create(p)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.removeAttributes(a.attributesPath(p)); err != nil {
+		w.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+func (a *AttributeBackend) OpenFile(p string) (File, error) {
+	return a.backend.OpenFile(p)
+}
+
+// Rename implements Backend, the attributes are moved together with the files
+func (a *AttributeBackend) Rename(oldPath, newPath string) error {
+	if err := a.backend.Rename(oldPath, newPath); err != nil {
+		return err
+	}
+	src, dest := a.mirrorPath(oldPath), a.mirrorPath(newPath)
+	if src == dest {
+		return nil
+	}
+	if err := a.removeAttributes(dest); err != nil {
+		return err
+	}
+	if _, err := a.backend.Stat(src); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if err := MkdirAll(a.backend, path.Dir(dest), 0755); err != nil {
+		return err
+	}
+	return a.backend.Rename(src, dest)
+}
+
+// Copy implements Backend, the attributes are copied together with the files
+func (a *AttributeBackend) Copy(srcPath, destPath string) error {
+	if err := a.backend.Copy(srcPath, destPath); err != nil {
+		return err
+	}
+	src, dest := a.mirrorPath(srcPath), a.mirrorPath(destPath)
+	// the copied file replaces the attributes of the file at destPath
+	if err := a.removeAttributes(a.attributesPath(destPath)); err != nil {
+		return err
+	}
+	if _, err := a.backend.Stat(src); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if err := MkdirAll(a.backend, path.Dir(dest), 0755); err != nil {
+		return err
+	}
+	return a.backend.Copy(src, dest)
+}
+
+// RemoveAll implements Backend, the attributes are removed together with the files
+func (a *AttributeBackend) RemoveAll(p string) error {
+	if err := a.backend.RemoveAll(p); err != nil {
+		return err
+	}
+	if a.mirrorPath(p) == a.dir {
+		return nil
+	}
+	return a.removeAttributes(a.mirrorPath(p))
+}
+
+func (a *AttributeBackend) Mkdir(p string, permission os.FileMode) error {
+	return a.backend.Mkdir(p, permission)
+}
+
+func (a *AttributeBackend) Stat(p string) (FileInfo, error) {
+	info, err := a.backend.Stat(p)
+	if err != nil {
+		return info, err
+	}
+	info.Attributes, err = a.GetAttributes(p)
+	return info, err
+}
+
+func (a *AttributeBackend) TraverseDirectory(dirPath string) (FileInfo, error) {
+	tree, err := a.backend.TraverseDirectory(dirPath)
+	if err != nil {
+		return tree, err
+	}
+	mirror, err := a.backend.TraverseDirectory(a.mirrorPath(dirPath))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return tree, nil
+		}
+		return tree, err
+	}
+	return tree, a.fillAttributes(dirPath, tree.Children, mirror.Children)
+}
+
+// fillAttributes sets the attributes of the files which have them in the mirror
+func (a *AttributeBackend) fillAttributes(dirPath string, children, mirror []FileInfo) error {
+	mirrored := make(map[string]FileInfo, len(mirror))
+	for _, m := range mirror {
+		if m.IsDir && strings.HasPrefix(m.Name, mirrorPrefix) {
+			mirrored[strings.TrimPrefix(m.Name, mirrorPrefix)] = m
+		}
+	}
+	for i := range children {
+		m, ok := mirrored[children[i].Name]
+		if !ok {
+			continue
+		}
+		childPath := path.Join(dirPath, children[i].Name)
+		for _, f := range m.Children {
+			if f.Name == attributesFileName && !f.IsDir {
+				attrs, err := a.GetAttributes(childPath)
+				if err != nil {
+					return err
+				}
+				children[i].Attributes = attrs
+			}
+		}
+		if children[i].IsDir {
+			if err := a.fillAttributes(childPath, children[i].Children, m.Children); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ReadDir implements DirReader
+func (a *AttributeBackend) ReadDir(dirPath string) ([]FileInfo, error) {
+	children, err := ReadDir(a.backend, dirPath)
+	if err != nil {
+		return nil, err
+	}
+	mirror, err := ReadDir(a.backend, a.mirrorPath(dirPath))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return children, nil
+		}
+		return nil, err
+	}
+	mirrored := make(map[string]bool, len(mirror))
+	for _, m := range mirror {
+		if m.IsDir && strings.HasPrefix(m.Name, mirrorPrefix) {
+			mirrored[strings.TrimPrefix(m.Name, mirrorPrefix)] = true
+		}
+	}
+	for i := range children {
+		if !mirrored[children[i].Name] {
+			continue
+		}
+		attrs, err := a.GetAttributes(path.Join(dirPath, children[i].Name))
+		if err != nil {
+			return nil, err
+		}
+		children[i].Attributes = attrs
+	}
+	return children, nil
+}
+
+// ResolveSymlinks implements SymlinkResolver
+func (a *AttributeBackend) ResolveSymlinks(p string) (string, error) {
+	if r, ok := a.backend.(SymlinkResolver); ok {
+		return r.ResolveSymlinks(p)
+	}
+	return strings.Trim(path.Clean("/"+p), "/"), nil
+}
@@ -0,0 +1,106 @@
+package filesystem
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// Backend is a storage keeping the files of the storage service.
+// All paths taken by Backend methods are relative to the root of the backend.
+// Errors must be compatible with os.IsNotExist and os.IsExist,
+// so the service is able to recognise them regardless of the implementation.
+type Backend interface {
+	Create(path string) (io.WriteCloser, error)
+	OpenFile(path string) (File, error)
+	Rename(oldPath, newPath string) error
+	Copy(srcPath, destPath string) error
+	RemoveAll(path string) error
+	Mkdir(path string, permission os.FileMode) error
+	TraverseDirectory(dirPath string) (FileInfo, error)
+	Stat(path string) (FileInfo, error)
+}
+
+// ErrOutsideRoot is returned if the path leads outside of the root of the backend
+var ErrOutsideRoot = errors.New("path is outside of the root directory")
+
+// SymlinkResolver is implemented by backends supporting symbolic links.
+// ResolveSymlinks returns the path with all symbolic links resolved, relative to the root of the backend.
+// Missing trailing elements of the path are kept as they are,
+// ErrOutsideRoot is returned if the resolved path leads outside of the root.
+type SymlinkResolver interface {
+	ResolveSymlinks(path string) (string, error)
+}
+
+// DirReader is implemented by backends able to list the directory
+// without traversing the nested directories
+type DirReader interface {
+	ReadDir(dirPath string) ([]FileInfo, error)
+}
+
+// ReadDir returns the files of the directory without their children,
+// the whole directory is traversed if the backend is not a DirReader
+func ReadDir(b Backend, dirPath string) ([]FileInfo, error) {
+	if r, ok := b.(DirReader); ok {
+		return r.ReadDir(dirPath)
+	}
+	tree, err := b.TraverseDirectory(dirPath)
+	if err != nil {
+		return nil, err
+	}
+	for i := range tree.Children {
+		tree.Children[i].Children = nil
+	}
+	return tree.Children, nil
+}
+
+// Aborter is implemented by writers returned by Backend.Create able to discard the file,
+// the file being written doesn't appear in the backend if the writer is aborted instead of closed
+type Aborter interface {
+	Abort() error
+}
+
+// Abort discards the file being written by w if writing it failed,
+// w is closed if it is not an Aborter
+func Abort(w io.WriteCloser) error {
+	if a, ok := w.(Aborter); ok {
+		return a.Abort()
+	}
+	return w.Close()
+}
+
+// File is a file opened for reading by Backend.OpenFile
+type File interface {
+	io.Reader
+	io.Seeker
+	io.Closer
+}
+
+type FileInfo struct {
+	Name     string     `json:"name"`
+	IsDir    bool       `json:"is_dir"`
+	Size     int64      `json:"size"`
+	Modified time.Time  `json:"modified"`
+	Children []FileInfo `json:"children,omitempty"` // Nested files and directories
+	// Attributes are only filled by backends implementing AttributeStore
+	Attributes
+}
+
+// MkdirAll creates the directory with all missing parents in the backend,
+// existing directories are left untouched
+func MkdirAll(b Backend, dirPath string, permission os.FileMode) error {
+	var current string
+	for _, name := range strings.Split(strings.Trim(dirPath, "/"), "/") {
+		if name == "" {
+			continue
+		}
+		current += name + "/"
+		err := b.Mkdir(current, permission)
+		if err != nil && !os.IsExist(err) {
+			return err
+		}
+	}
+	return nil
+}
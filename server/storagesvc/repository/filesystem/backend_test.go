@@ -0,0 +1,20 @@
+package filesystem_test
+
+import (
+	"testing"
+
+	fs "remote-storage/server/storagesvc/repository/filesystem"
+	"remote-storage/server/storagesvc/repository/filesystem/backendtest"
+)
+
+func TestLocalBackend(t *testing.T) {
+	backendtest.Run(t, func(t *testing.T) fs.Backend {
+		return fs.NewLocalBackend(fs.ConfigFileSystem{RootDir: t.TempDir()})
+	})
+}
+
+func TestMemoryBackend(t *testing.T) {
+	backendtest.Run(t, func(t *testing.T) fs.Backend {
+		return fs.NewMemoryBackend()
+	})
+}
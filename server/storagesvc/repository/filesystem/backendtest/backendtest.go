@@ -0,0 +1,318 @@
+// Package backendtest implements the tests shared by all implementations of filesystem.Backend
+package backendtest
+
+import (
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+
+	fs "remote-storage/server/storagesvc/repository/filesystem"
+)
+
+// Run checks the behaviour every Backend implementation must share,
+// so the service works the same way regardless of where files are kept.
+// newBackend must return the empty backend for every test.
+func Run(t *testing.T, newBackend func(t *testing.T) fs.Backend) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, b fs.Backend)
+	}{
+		{"CreateAndOpen", testCreateAndOpen},
+		{"CreateReplaces", testCreateReplaces},
+		{"NotExist", testNotExist},
+		{"Mkdir", testMkdir},
+		{"Rename", testRename},
+		{"Copy", testCopy},
+		{"RemoveAll", testRemoveAll},
+		{"TraverseDirectory", testTraverseDirectory},
+		{"ReadDir", testReadDir},
+		{"StaysInRoot", testStaysInRoot},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newBackend(t))
+		})
+	}
+}
+
+func writeFile(t *testing.T, b fs.Backend, p, contents string) {
+	t.Helper()
+	w, err := b.Create(p)
+	if err != nil {
+		t.Fatalf("Create(%q): %v", p, err)
+	}
+	if _, err := io.WriteString(w, contents); err != nil {
+		t.Fatalf("Write(%q): %v", p, err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close(%q): %v", p, err)
+	}
+}
+
+func readFile(t *testing.T, b fs.Backend, p string) string {
+	t.Helper()
+	f, err := b.OpenFile(p)
+	if err != nil {
+		t.Fatalf("OpenFile(%q): %v", p, err)
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatalf("ReadAll(%q): %v", p, err)
+	}
+	return string(data)
+}
+
+func mkdirAll(t *testing.T, b fs.Backend, p string) {
+	t.Helper()
+	if err := fs.MkdirAll(b, p, 0755); err != nil {
+		t.Fatalf("MkdirAll(%q): %v", p, err)
+	}
+}
+
+func assertMissing(t *testing.T, b fs.Backend, p string) {
+	t.Helper()
+	if _, err := b.Stat(p); !os.IsNotExist(err) {
+		t.Fatalf("Stat(%q) = %v, want not exist", p, err)
+	}
+}
+
+// names returns the sorted names of the files
+func names(files []fs.FileInfo) string {
+	res := make([]string, 0, len(files))
+	for _, f := range files {
+		res = append(res, f.Name)
+	}
+	sort.Strings(res)
+	return strings.Join(res, ",")
+}
+
+func testCreateAndOpen(t *testing.T, b fs.Backend) {
+	writeFile(t, b, "a.txt", "hello")
+	if got := readFile(t, b, "a.txt"); got != "hello" {
+		t.Fatalf("contents = %q, want %q", got, "hello")
+	}
+	info, err := b.Stat("a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Name != "a.txt" || info.IsDir || info.Size != 5 || info.Modified.IsZero() {
+		t.Fatalf("Stat = %+v", info)
+	}
+	f, err := b.OpenFile("a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.Seek(2, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if rest, _ := io.ReadAll(f); string(rest) != "llo" {
+		t.Fatalf("contents after Seek = %q", rest)
+	}
+}
+
+func testCreateReplaces(t *testing.T, b fs.Backend) {
+	writeFile(t, b, "a.txt", "long contents")
+	writeFile(t, b, "a.txt", "short")
+	if got := readFile(t, b, "a.txt"); got != "short" {
+		t.Fatalf("contents = %q, want %q", got, "short")
+	}
+	mkdirAll(t, b, "dir")
+	if _, err := b.Create("dir"); err == nil {
+		t.Fatal("Create over the directory succeeded")
+	}
+}
+
+func testNotExist(t *testing.T, b fs.Backend) {
+	assertMissing(t, b, "missing")
+	if _, err := b.OpenFile("missing"); !os.IsNotExist(err) {
+		t.Fatalf("OpenFile = %v, want not exist", err)
+	}
+	if _, err := b.Create("missing/a.txt"); !os.IsNotExist(err) {
+		t.Fatalf("Create in missing directory = %v, want not exist", err)
+	}
+	if err := b.Mkdir("missing/dir", 0755); !os.IsNotExist(err) {
+		t.Fatalf("Mkdir in missing directory = %v, want not exist", err)
+	}
+	if err := b.Rename("missing", "other"); !os.IsNotExist(err) {
+		t.Fatalf("Rename = %v, want not exist", err)
+	}
+	if err := b.Copy("missing", "other"); !os.IsNotExist(err) {
+		t.Fatalf("Copy = %v, want not exist", err)
+	}
+	if _, err := b.TraverseDirectory("missing"); !os.IsNotExist(err) {
+		t.Fatalf("TraverseDirectory = %v, want not exist", err)
+	}
+}
+
+func testMkdir(t *testing.T, b fs.Backend) {
+	if err := b.Mkdir("dir", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Mkdir("dir", 0755); !os.IsExist(err) {
+		t.Fatalf("Mkdir of existing directory = %v, want exist", err)
+	}
+	info, err := b.Stat("dir")
+	if err != nil || !info.IsDir {
+		t.Fatalf("Stat = %+v, %v", info, err)
+	}
+	mkdirAll(t, b, "dir/a/b/c")
+	mkdirAll(t, b, "dir/a/b/c")
+	if info, err := b.Stat("dir/a/b/c"); err != nil || !info.IsDir {
+		t.Fatalf("Stat = %+v, %v", info, err)
+	}
+}
+
+func testRename(t *testing.T, b fs.Backend) {
+	mkdirAll(t, b, "src/nested")
+	writeFile(t, b, "src/nested/a.txt", "a")
+	writeFile(t, b, "b.txt", "b")
+
+	if err := b.Rename("b.txt", "c.txt"); err != nil {
+		t.Fatal(err)
+	}
+	assertMissing(t, b, "b.txt")
+	if got := readFile(t, b, "c.txt"); got != "b" {
+		t.Fatalf("renamed contents = %q", got)
+	}
+
+	if err := b.Rename("src", "dest"); err != nil {
+		t.Fatal(err)
+	}
+	assertMissing(t, b, "src")
+	assertMissing(t, b, "src/nested/a.txt")
+	if got := readFile(t, b, "dest/nested/a.txt"); got != "a" {
+		t.Fatalf("contents of renamed directory = %q", got)
+	}
+
+	writeFile(t, b, "d.txt", "d")
+	if err := b.Rename("d.txt", "c.txt"); err != nil {
+		t.Fatalf("Rename over the file: %v", err)
+	}
+	if got := readFile(t, b, "c.txt"); got != "d" {
+		t.Fatalf("replaced contents = %q", got)
+	}
+}
+
+func testCopy(t *testing.T, b fs.Backend) {
+	mkdirAll(t, b, "src/nested")
+	writeFile(t, b, "src/a.txt", "a")
+	writeFile(t, b, "src/nested/b.txt", "b")
+
+	if err := b.Copy("src/a.txt", "a-copy.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, b, "a-copy.txt"); got != "a" {
+		t.Fatalf("copied contents = %q", got)
+	}
+
+	if err := b.Copy("src", "dest"); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, b, "dest/nested/b.txt"); got != "b" {
+		t.Fatalf("contents of copied directory = %q", got)
+	}
+	// the copy is independent of the original
+	writeFile(t, b, "dest/a.txt", "changed")
+	if got := readFile(t, b, "src/a.txt"); got != "a" {
+		t.Fatalf("original changed with the copy: %q", got)
+	}
+}
+
+func testRemoveAll(t *testing.T, b fs.Backend) {
+	mkdirAll(t, b, "dir/nested")
+	writeFile(t, b, "dir/nested/a.txt", "a")
+	writeFile(t, b, "b.txt", "b")
+
+	if err := b.RemoveAll("dir"); err != nil {
+		t.Fatal(err)
+	}
+	assertMissing(t, b, "dir")
+	assertMissing(t, b, "dir/nested/a.txt")
+	if err := b.RemoveAll("b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	assertMissing(t, b, "b.txt")
+	if err := b.RemoveAll("missing"); err != nil {
+		t.Fatalf("RemoveAll of missing file = %v", err)
+	}
+}
+
+func testTraverseDirectory(t *testing.T, b fs.Backend) {
+	mkdirAll(t, b, "root/dir/nested")
+	writeFile(t, b, "root/a.txt", "a")
+	writeFile(t, b, "root/dir/b.txt", "bb")
+	writeFile(t, b, "root/dir/nested/c.txt", "ccc")
+
+	tree, err := b.TraverseDirectory("root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tree.Name != "root" || !tree.IsDir {
+		t.Fatalf("root = %+v", tree)
+	}
+	if got := names(tree.Children); got != "a.txt,dir" {
+		t.Fatalf("children = %s", got)
+	}
+	for _, child := range tree.Children {
+		switch child.Name {
+		case "a.txt":
+			if child.IsDir || child.Size != 1 {
+				t.Fatalf("a.txt = %+v", child)
+			}
+		case "dir":
+			if got := names(child.Children); got != "b.txt,nested" {
+				t.Fatalf("children of dir = %s", got)
+			}
+			for _, nested := range child.Children {
+				if nested.Name == "nested" && names(nested.Children) != "c.txt" {
+					t.Fatalf("children of nested = %s", names(nested.Children))
+				}
+			}
+		}
+	}
+
+	if _, err := b.TraverseDirectory("root/a.txt"); err == nil {
+		t.Fatal("TraverseDirectory of the file succeeded")
+	}
+}
+
+func testReadDir(t *testing.T, b fs.Backend) {
+	mkdirAll(t, b, "root/dir")
+	writeFile(t, b, "root/a.txt", "a")
+	writeFile(t, b, "root/dir/b.txt", "b")
+
+	children, err := fs.ReadDir(b, "root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := names(children); got != "a.txt,dir" {
+		t.Fatalf("children = %s", got)
+	}
+	for _, child := range children {
+		if len(child.Children) != 0 {
+			t.Fatalf("ReadDir returned nested files of %s", child.Name)
+		}
+	}
+}
+
+// testStaysInRoot checks that paths climbing out of the root are cleaned into it
+func testStaysInRoot(t *testing.T, b fs.Backend) {
+	mkdirAll(t, b, "dir")
+	for _, p := range []string{"../a.txt", "/../a.txt", "dir/../../a.txt"} {
+		writeFile(t, b, p, p)
+		if got := readFile(t, b, "a.txt"); got != p {
+			t.Fatalf("%q is written outside of the root, a.txt = %q", p, got)
+		}
+	}
+	tree, err := b.TraverseDirectory("..")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := names(tree.Children); got != "a.txt,dir" {
+		t.Fatalf("children of the parent of the root = %s", got)
+	}
+}
@@ -4,111 +4,71 @@ import (
 	"io"
 	"os"
 	"path/filepath"
-	"time"
 )
 
 type ConfigFileSystem struct {
 	RootDir string
 }
 
-var rootDir string
-var isInitialized = false
-
-type FileInfo struct {
-	Name     string     `json:"name"`
-	IsDir    bool       `json:"is_dir"`
-	Size     int64      `json:"size"`
-	Modified time.Time  `json:"modified"`
-	Children []FileInfo `json:"children,omitempty"` // Nested files and directories
-}
-
-func init() {
-
+// localBackend is a Backend keeping files in the directory of the local file system
+type localBackend struct {
+	rootDir string
 }
 
-func checkForInitializing() {
-	if !isInitialized {
-		panic("package not initialized, root directory must be set")
+// NewLocalBackend returns a Backend working with the root directory specified in config
+func NewLocalBackend(config ConfigFileSystem) Backend {
+	return &localBackend{
+		rootDir: config.RootDir,
 	}
 }
 
-func InitializeFileSystem(config ConfigFileSystem) {
-	rootDir = config.RootDir
-	isInitialized = true
-}
-
-func Create(filepath string) (*os.File, error) {
-	checkForInitializing()
-	file, err := os.Create(getPath(filepath))
-	return file, err
-}
-
-func OpenFile(filepath string) (*os.File, error) {
-	checkForInitializing()
-	file, err := os.OpenFile(getPath(filepath), os.O_RDWR, 0644)
-	return file, err
-}
-
-func Write(filepath string, data []byte) (int, error) {
-	checkForInitializing()
-	file, err := os.OpenFile(getPath(filepath), os.O_RDWR, 0644)
-	defer file.Close()
+func (b *localBackend) Create(filepath string) (io.WriteCloser, error) {
+	file, err := os.Create(b.getPath(filepath))
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
-	writtenBytesNum, err := file.Write(data)
-	return writtenBytesNum, err
+	return file, nil
 }
 
-func ReadAll(filepath string) ([]byte, error) {
-	checkForInitializing()
-	var contents []byte
-	sourceFile, err := os.Open(getPath(filepath))
+func (b *localBackend) OpenFile(filepath string) (File, error) {
+	file, err := os.OpenFile(b.getPath(filepath), os.O_RDONLY, 0644)
 	if err != nil {
-		return contents, err
+		return nil, err
 	}
-	defer sourceFile.Close()
-	contents, err = io.ReadAll(sourceFile)
-	if err != nil {
-		return contents, err
-	}
-	return contents, nil
-}
-
-func RemoveAll(filePath string) error {
-	checkForInitializing()
-	err := os.RemoveAll(getPath(filePath))
-	return err
+	return file, nil
 }
 
-func Remove(filePath string) error {
-	checkForInitializing()
-	err := os.Remove(getPath(filePath))
+func (b *localBackend) RemoveAll(filePath string) error {
+	err := os.RemoveAll(b.getPath(filePath))
 	return err
 }
 
-func Rename(oldPath, newPath string) error {
-	checkForInitializing()
-	err := os.Rename(getPath(oldPath), getPath(newPath))
+func (b *localBackend) Rename(oldPath, newPath string) error {
+	err := os.Rename(b.getPath(oldPath), b.getPath(newPath))
 	return err
 }
 
-func Move(srcPath, destPath string) error {
-	checkForInitializing()
-	err := os.Rename(getPath(srcPath), getPath(destPath))
+func (b *localBackend) Mkdir(path string, permission os.FileMode) error {
+	err := os.Mkdir(b.getPath(path), permission)
 	return err
 }
 
-func Mkdir(path string, permission os.FileMode) error {
-	checkForInitializing()
-	err := os.Mkdir(getPath(path), permission)
-	return err
+func (b *localBackend) Stat(path string) (FileInfo, error) {
+	info, err := os.Stat(b.getPath(path))
+	if err != nil {
+		return FileInfo{}, err
+	}
+	return FileInfo{
+		Name:     info.Name(),
+		IsDir:    info.IsDir(),
+		Size:     info.Size(),
+		Modified: info.ModTime(),
+	}, nil
 }
 
-func Copy(srcPath, destPath string) error {
-	checkForInitializing()
-	srcPath = getPath(srcPath)
-	destPath = getPath(destPath)
+func (b *localBackend) Copy(srcPath, destPath string) error {
+	srcPath = b.getPath(srcPath)
+	destPath = b.getPath(destPath)
 	srcInfo, err := os.Stat(srcPath)
 	if err != nil {
 		return err
@@ -172,8 +132,34 @@ func copyFile(src, dest string) error {
 	return nil
 }
 
-func TraverseDirectory(dirPath string) (FileInfo, error) {
-	checkForInitializing()
+func (b *localBackend) TraverseDirectory(dirPath string) (FileInfo, error) {
+	return traverseDirectory(b.getPath(dirPath))
+}
+
+// ReadDir implements DirReader
+func (b *localBackend) ReadDir(dirPath string) ([]FileInfo, error) {
+	entries, err := os.ReadDir(b.getPath(dirPath))
+	if err != nil {
+		return nil, err
+	}
+	res := make([]FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			// the file was removed after reading the directory
+			continue
+		}
+		res = append(res, FileInfo{
+			Name:     info.Name(),
+			IsDir:    info.IsDir(),
+			Size:     info.Size(),
+			Modified: info.ModTime(),
+		})
+	}
+	return res, nil
+}
+
+func traverseDirectory(dirPath string) (FileInfo, error) {
 	file := FileInfo{
 		Name:     filepath.Base(dirPath),
 		IsDir:    true,
@@ -204,7 +190,7 @@ func TraverseDirectory(dirPath string) (FileInfo, error) {
 
 		if child.IsDir {
 			// Recursively traverse nested directories
-			nestedFileInfo, err := TraverseDirectory(filepath.Join(dirPath, child.Name))
+			nestedFileInfo, err := traverseDirectory(filepath.Join(dirPath, child.Name))
 			if err != nil {
 				return file, err
 			}
@@ -0,0 +1,716 @@
+package filesystem
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBlobDir = ".blobs"
+	// blobRefsDir is the directory in the blob directory keeping the attributes which mark the references
+	blobRefsDir = "refs"
+	blobTmpDir  = "tmp"
+	// blobTmpTTL is the time after which abandoned temporary blobs are removed by the garbage collector
+	blobTmpTTL = 24 * time.Hour
+)
+
+type ConfigDedup struct {
+	// BlobDir is the directory of the backend keeping the blobs, ".blobs" by default
+	BlobDir string
+}
+
+// DedupBackend is a Backend storing the contents of files once per SHA-256 digest.
+// Contents are kept as blobs in the blob directory of the wrapped backend,
+// files of the tree only reference them, so copying files doesn't copy the contents.
+// References are marked in the attributes of the files kept in the blob directory,
+// files without the mark, such as the files written by other backends, are read as they are.
+// Every blob counts its references and is removed together with the last of them.
+// The blob directory is not a part of the tree, it is hidden from listings
+// and the paths leading into it are rejected with ErrOutsideRoot.
+type DedupBackend struct {
+	backend Backend
+	// tree keeps the files of the tree together with the marks of the references
+	tree    *AttributeBackend
+	blobDir string
+
+	// mu serializes the changes of references
+	mu sync.Mutex
+	// pending counts the writers replacing the references to every blob
+	pending map[string]int
+	// touched are the blobs which references changed while the garbage is collected,
+	// it is nil if the garbage is not collected
+	touched map[string]bool
+	// gcMu is held while the garbage is collected
+	gcMu sync.Mutex
+}
+
+// NewDedupBackend returns the deduplicating Backend keeping files in backend
+func NewDedupBackend(backend Backend, config ConfigDedup) *DedupBackend {
+	blobDir := cleanPath(config.BlobDir)
+	if blobDir == "" {
+		blobDir = defaultBlobDir
+	}
+	return &DedupBackend{
+		backend: backend,
+		tree:    NewAttributeBackend(backend, ConfigAttributes{Dir: path.Join(blobDir, blobRefsDir)}),
+		blobDir: blobDir,
+		pending: make(map[string]int),
+	}
+}
+
+// cleanPath returns the path relative to the root of the backend without leading and trailing slashes
+func cleanPath(p string) string {
+	return strings.Trim(path.Clean("/"+p), "/")
+}
+
+// inBlobDir reports whether the path leads to the blob directory or into it
+func (d *DedupBackend) inBlobDir(p string) bool {
+	p = cleanPath(p)
+	return p == d.blobDir || strings.HasPrefix(p, d.blobDir+"/")
+}
+
+// readPath returns the cleaned path, ErrOutsideRoot is returned if it leads into the blob directory
+func (d *DedupBackend) readPath(p string) (string, error) {
+	p = cleanPath(p)
+	if d.inBlobDir(p) {
+		return "", ErrOutsideRoot
+	}
+	return p, nil
+}
+
+// writePath returns the cleaned path, ErrOutsideRoot is returned if changing it changes
+// the blob directory, that is the path leads into the blob directory or to the directory containing it
+func (d *DedupBackend) writePath(p string) (string, error) {
+	p = cleanPath(p)
+	if d.inBlobDir(p) || p == "" || strings.HasPrefix(d.blobDir, p+"/") {
+		return "", ErrOutsideRoot
+	}
+	return p, nil
+}
+
+// blobRef is the reference to the blob kept in the attributes of the file
+type blobRef struct {
+	Digest string
+	Size   int64
+}
+
+func (r blobRef) encode() string {
+	return "sha256:" + r.Digest + " " + strconv.FormatInt(r.Size, 10)
+}
+
+// parseBlobRef returns false if the attributes don't reference the blob
+func parseBlobRef(attrs Attributes) (blobRef, bool) {
+	ref, ok := strings.CutPrefix(attrs.Blob, "sha256:")
+	if !ok {
+		return blobRef{}, false
+	}
+	digest, size, ok := strings.Cut(ref, " ")
+	if !ok || len(digest) != sha256.Size*2 {
+		return blobRef{}, false
+	}
+	if _, err := hex.DecodeString(digest); err != nil {
+		return blobRef{}, false
+	}
+	n, err := strconv.ParseInt(size, 10, 64)
+	if err != nil || n < 0 {
+		return blobRef{}, false
+	}
+	return blobRef{Digest: digest, Size: n}, true
+}
+
+func (d *DedupBackend) blobPath(digest string) string {
+	return path.Join(d.blobDir, digest[:2], digest)
+}
+
+func (d *DedupBackend) refCountPath(digest string) string {
+	return d.blobPath(digest) + ".refs"
+}
+
+func (d *DedupBackend) tmpDir() string {
+	return path.Join(d.blobDir, blobTmpDir)
+}
+
+// isBlobShard reports whether the directory of the blob directory keeps blobs
+func isBlobShard(name string) bool {
+	_, err := hex.DecodeString(name)
+	return len(name) == 2 && err == nil
+}
+
+// collectRefs counts the blobs referenced by the file or the tree at p
+func (d *DedupBackend) collectRefs(p string, refs map[string]int) error {
+	info, err := d.tree.Stat(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if info.IsDir {
+		if info, err = d.tree.TraverseDirectory(p); err != nil {
+			return err
+		}
+	}
+	d.collectTreeRefs(cleanPath(p), info, refs)
+	return nil
+}
+
+// collectTreeRefs counts the blobs referenced by the tree taken from d.tree, the blob directory is skipped
+func (d *DedupBackend) collectTreeRefs(p string, info FileInfo, refs map[string]int) {
+	if d.inBlobDir(p) {
+		return
+	}
+	if !info.IsDir {
+		if ref, ok := parseBlobRef(info.Attributes); ok {
+			refs[ref.Digest]++
+		}
+		return
+	}
+	for _, child := range info.Children {
+		d.collectTreeRefs(path.Join(p, child.Name), child, refs)
+	}
+}
+
+// touch marks the blobs which references are changed while the garbage is collected, d.mu must be held
+func (d *DedupBackend) touch(refs map[string]int) {
+	if d.touched == nil {
+		return
+	}
+	for digest := range refs {
+		d.touched[digest] = true
+	}
+}
+
+// updateRefs changes the reference counts of the blobs by the difference
+// between the references before and after the change, d.mu must be held
+func (d *DedupBackend) updateRefs(before, after map[string]int) error {
+	for digest, n := range after {
+		if delta := n - before[digest]; delta != 0 {
+			if err := d.addRefs(digest, delta); err != nil {
+				return err
+			}
+		}
+	}
+	for digest, n := range before {
+		if _, ok := after[digest]; !ok {
+			if err := d.addRefs(digest, -n); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// addRefs changes the reference count of the blob by delta,
+// the blob is removed when it is no longer referenced, d.mu must be held
+func (d *DedupBackend) addRefs(digest string, delta int) error {
+	if d.touched != nil {
+		d.touched[digest] = true
+	}
+	count, err := d.refCount(digest)
+	if err != nil {
+		return err
+	}
+	count += delta
+	if count <= 0 {
+		return d.removeBlob(digest)
+	}
+	return d.writeFile(d.refCountPath(digest), []byte(strconv.Itoa(count)))
+}
+
+func (d *DedupBackend) removeBlob(digest string) error {
+	if err := d.backend.RemoveAll(d.blobPath(digest)); err != nil {
+		return err
+	}
+	return d.backend.RemoveAll(d.refCountPath(digest))
+}
+
+func (d *DedupBackend) refCount(digest string) (int, error) {
+	file, err := d.backend.OpenFile(d.refCountPath(digest))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return 0, err
+	}
+	count, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		// the broken count is fixed by the garbage collector
+		return 0, nil
+	}
+	return count, nil
+}
+
+func (d *DedupBackend) writeFile(filePath string, data []byte) error {
+	file, err := d.backend.Create(filePath)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		Abort(file)
+		return err
+	}
+	return file.Close()
+}
+
+// Create implements Backend. The contents are written into the temporary blob,
+// which becomes the blob of its digest, and the file references it on Close.
+func (d *DedupBackend) Create(filePath string) (io.WriteCloser, error) {
+	filePath, err := d.writePath(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if err := MkdirAll(d.backend, d.tmpDir(), 0755); err != nil {
+		return nil, err
+	}
+	var id [8]byte
+	rand.Read(id[:])
+	tmpPath := path.Join(d.tmpDir(), strconv.FormatInt(time.Now().UnixNano(), 10)+"-"+hex.EncodeToString(id[:]))
+	tmpFile, err := d.backend.Create(tmpPath)
+	if err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	before := make(map[string]int)
+	err = d.collectRefs(filePath, before)
+	var refFile io.WriteCloser
+	if err == nil {
+		refFile, err = d.tree.Create(filePath)
+	}
+	if err != nil {
+		tmpFile.Close()
+		d.backend.RemoveAll(tmpPath)
+		return nil, err
+	}
+	for digest := range before {
+		d.pending[digest]++
+	}
+	d.touch(before)
+	return &blobWriter{
+		d:        d,
+		filePath: filePath,
+		refFile:  refFile,
+		tmpFile:  tmpFile,
+		tmpPath:  tmpPath,
+		hash:     sha256.New(),
+		replaced: before,
+	}, nil
+}
+
+// blobWriter writes the contents of the file created by DedupBackend
+type blobWriter struct {
+	d        *DedupBackend
+	filePath string
+	refFile  io.WriteCloser
+	tmpFile  io.WriteCloser
+	tmpPath  string
+	hash     hash.Hash
+	size     int64
+	replaced map[string]int
+	closed   bool
+}
+
+func (w *blobWriter) Write(p []byte) (int, error) {
+	n, err := w.tmpFile.Write(p)
+	w.hash.Write(p[:n])
+	w.size += int64(n)
+	return n, err
+}
+
+// Sync flushes the written contents to the storage if the wrapped backend supports it
+func (w *blobWriter) Sync() error {
+	if s, ok := w.tmpFile.(interface{ Sync() error }); ok {
+		return s.Sync()
+	}
+	return nil
+}
+
+// done drops the writer from the pending ones, d.mu must be held
+func (w *blobWriter) done() {
+	for digest := range w.replaced {
+		if w.d.pending[digest]--; w.d.pending[digest] <= 0 {
+			delete(w.d.pending, digest)
+		}
+	}
+}
+
+// Abort implements Aborter, the written contents are dropped.
+// The replaced file is kept by backends able to discard the written file,
+// otherwise it is replaced by the empty one and its references are dropped.
+func (w *blobWriter) Abort() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	Abort(w.tmpFile)
+	d := w.d
+	d.backend.RemoveAll(w.tmpPath)
+	err := Abort(w.refFile)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	defer w.done()
+	after := make(map[string]int)
+	if err := d.collectRefs(w.filePath, after); err != nil {
+		return err
+	}
+	if updateErr := d.updateRefs(w.replaced, after); err == nil {
+		err = updateErr
+	}
+	return err
+}
+
+func (w *blobWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	d := w.d
+	err := w.tmpFile.Close()
+	if err != nil {
+		d.backend.RemoveAll(w.tmpPath)
+	}
+	ref := blobRef{
+		Digest: hex.EncodeToString(w.hash.Sum(nil)),
+		Size:   w.size,
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	defer w.done()
+	if err == nil {
+		err = d.storeBlob(w.tmpPath, ref.Digest)
+	}
+	if closeErr := w.refFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = d.tree.SetAttributes(w.filePath, Attributes{Blob: ref.encode()})
+	}
+	// the replaced file is gone, the new one references the blob unless it failed
+	after := map[string]int{ref.Digest: 1}
+	if err != nil {
+		after = map[string]int{}
+	}
+	if updateErr := d.updateRefs(w.replaced, after); err == nil {
+		err = updateErr
+	}
+	return err
+}
+
+// storeBlob makes the temporary blob the blob of the digest, d.mu must be held
+func (d *DedupBackend) storeBlob(tmpPath, digest string) error {
+	blobPath := d.blobPath(digest)
+	if _, err := d.backend.Stat(blobPath); err == nil {
+		// the same contents are already stored
+		return d.backend.RemoveAll(tmpPath)
+	}
+	err := MkdirAll(d.backend, path.Dir(blobPath), 0755)
+	if err == nil {
+		err = d.backend.Rename(tmpPath, blobPath)
+	}
+	if err != nil {
+		d.backend.RemoveAll(tmpPath)
+	}
+	return err
+}
+
+// OpenFile implements Backend, the blob referenced by the file is opened
+func (d *DedupBackend) OpenFile(filePath string) (File, error) {
+	filePath, err := d.readPath(filePath)
+	if err != nil {
+		return nil, err
+	}
+	info, err := d.tree.Stat(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if ref, ok := parseBlobRef(info.Attributes); ok && !info.IsDir {
+		return d.backend.OpenFile(d.blobPath(ref.Digest))
+	}
+	return d.tree.OpenFile(filePath)
+}
+
+// Rename implements Backend, references of the replaced files are dropped
+func (d *DedupBackend) Rename(oldPath, newPath string) error {
+	oldPath, err := d.writePath(oldPath)
+	if err != nil {
+		return err
+	}
+	newPath, err = d.writePath(newPath)
+	if err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	before := make(map[string]int)
+	if err := d.collectRefs(newPath, before); err != nil {
+		return err
+	}
+	if d.touched != nil {
+		// the garbage collector may miss the moved references
+		moved := make(map[string]int)
+		if err := d.collectRefs(oldPath, moved); err != nil {
+			return err
+		}
+		d.touch(moved)
+	}
+	if err := d.tree.Rename(oldPath, newPath); err != nil {
+		return err
+	}
+	// references of the moved files are not changed
+	return d.updateRefs(before, map[string]int{})
+}
+
+// Copy implements Backend, only the references are copied
+func (d *DedupBackend) Copy(srcPath, destPath string) error {
+	srcPath, err := d.writePath(srcPath)
+	if err != nil {
+		return err
+	}
+	destPath, err = d.writePath(destPath)
+	if err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	before := make(map[string]int)
+	if err := d.collectRefs(destPath, before); err != nil {
+		return err
+	}
+	copyErr := d.tree.Copy(srcPath, destPath)
+	// the partial copy references the blobs too
+	after := make(map[string]int)
+	if err := d.collectRefs(destPath, after); err != nil {
+		return err
+	}
+	if err := d.updateRefs(before, after); err != nil {
+		return err
+	}
+	return copyErr
+}
+
+// RemoveAll implements Backend, blobs are removed with their last references
+func (d *DedupBackend) RemoveAll(p string) error {
+	p, err := d.writePath(p)
+	if err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	before := make(map[string]int)
+	if err := d.collectRefs(p, before); err != nil {
+		return err
+	}
+	removeErr := d.tree.RemoveAll(p)
+	after := make(map[string]int)
+	if removeErr != nil {
+		if err := d.collectRefs(p, after); err != nil {
+			return err
+		}
+	}
+	if err := d.updateRefs(before, after); err != nil {
+		return err
+	}
+	return removeErr
+}
+
+func (d *DedupBackend) Mkdir(p string, permission os.FileMode) error {
+	p, err := d.readPath(p)
+	if err != nil {
+		return err
+	}
+	return d.tree.Mkdir(p, permission)
+}
+
+// fromTree replaces the size of the reference by the size of the referenced blob,
+// the attributes only marking the reference are dropped
+func fromTree(info *FileInfo) {
+	if ref, ok := parseBlobRef(info.Attributes); ok && !info.IsDir {
+		info.Size = ref.Size
+	}
+	info.Attributes = Attributes{}
+}
+
+// fromTreeChildren applies fromTree to the files of the directory and of the nested directories,
+// the blob directory is dropped
+func (d *DedupBackend) fromTreeChildren(dirPath string, children []FileInfo) []FileInfo {
+	res := children[:0]
+	for _, child := range children {
+		childPath := path.Join(cleanPath(dirPath), child.Name)
+		if d.inBlobDir(childPath) {
+			continue
+		}
+		fromTree(&child)
+		if child.IsDir {
+			child.Children = d.fromTreeChildren(childPath, child.Children)
+		}
+		res = append(res, child)
+	}
+	return res
+}
+
+func (d *DedupBackend) Stat(p string) (FileInfo, error) {
+	p, err := d.readPath(p)
+	if err != nil {
+		return FileInfo{}, err
+	}
+	info, err := d.tree.Stat(p)
+	if err != nil {
+		return info, err
+	}
+	fromTree(&info)
+	return info, nil
+}
+
+func (d *DedupBackend) TraverseDirectory(dirPath string) (FileInfo, error) {
+	dirPath, err := d.readPath(dirPath)
+	if err != nil {
+		return FileInfo{}, err
+	}
+	tree, err := d.tree.TraverseDirectory(dirPath)
+	if err != nil {
+		return tree, err
+	}
+	fromTree(&tree)
+	tree.Children = d.fromTreeChildren(dirPath, tree.Children)
+	return tree, nil
+}
+
+// ReadDir implements DirReader
+func (d *DedupBackend) ReadDir(dirPath string) ([]FileInfo, error) {
+	dirPath, err := d.readPath(dirPath)
+	if err != nil {
+		return nil, err
+	}
+	children, err := d.tree.ReadDir(dirPath)
+	if err != nil {
+		return nil, err
+	}
+	return d.fromTreeChildren(dirPath, children), nil
+}
+
+// ResolveSymlinks implements SymlinkResolver
+func (d *DedupBackend) ResolveSymlinks(p string) (string, error) {
+	return d.tree.ResolveSymlinks(p)
+}
+
+// CollectGarbage recounts the references of all blobs and removes the blobs
+// which are not referenced, together with the abandoned temporary blobs.
+// It repairs the counts left wrong by interrupted writes and returns the amount of removed blobs.
+// The tree is traversed while the files are changed, the blobs which references are changed
+// meanwhile keep the counts maintained by the changes.
+func (d *DedupBackend) CollectGarbage() (int, error) {
+	d.gcMu.Lock()
+	defer d.gcMu.Unlock()
+	d.mu.Lock()
+	d.touched = make(map[string]bool)
+	d.mu.Unlock()
+	defer func() {
+		d.mu.Lock()
+		d.touched = nil
+		d.mu.Unlock()
+	}()
+
+	root, err := d.tree.TraverseDirectory("")
+	if err != nil {
+		return 0, err
+	}
+	refs := make(map[string]int)
+	d.collectTreeRefs("", root, refs)
+
+	blobs, err := d.backend.TraverseDirectory(d.blobDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	var removed int
+	for _, dir := range blobs.Children {
+		dirPath := path.Join(d.blobDir, dir.Name)
+		if dir.IsDir && dirPath == d.tmpDir() {
+			if err := d.removeAbandoned(dir); err != nil {
+				return removed, err
+			}
+			continue
+		}
+		if !dir.IsDir || !isBlobShard(dir.Name) {
+			continue
+		}
+		for _, blob := range dir.Children {
+			if blob.IsDir || strings.HasSuffix(blob.Name, ".refs") {
+				continue
+			}
+			ok, err := d.sweep(blob.Name, refs[blob.Name])
+			if err != nil {
+				return removed, err
+			}
+			if ok {
+				removed++
+			}
+		}
+		if err := d.removeEmptyShard(dirPath); err != nil {
+			return removed, err
+		}
+	}
+	return removed, nil
+}
+
+// removeAbandoned removes the temporary blobs older than blobTmpTTL
+func (d *DedupBackend) removeAbandoned(tmp FileInfo) error {
+	for _, blob := range tmp.Children {
+		if time.Since(blob.Modified) <= blobTmpTTL {
+			continue
+		}
+		if err := d.backend.RemoveAll(path.Join(d.tmpDir(), blob.Name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sweep sets the reference count of the blob to count found by the garbage collector,
+// the blob is removed if it is not referenced. It returns true if the blob is removed.
+// Blobs which references were changed since the collection started are left as they are.
+func (d *DedupBackend) sweep(digest string, count int) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.touched[digest] || d.pending[digest] > 0 {
+		return false, nil
+	}
+	if count == 0 {
+		return true, d.removeBlob(digest)
+	}
+	current, err := d.refCount(digest)
+	if err != nil || current == count {
+		return false, err
+	}
+	return false, d.writeFile(d.refCountPath(digest), []byte(strconv.Itoa(count)))
+}
+
+// removeEmptyShard removes the directory of blobs if nothing is left in it
+func (d *DedupBackend) removeEmptyShard(dirPath string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	children, err := ReadDir(d.backend, dirPath)
+	if err != nil || len(children) > 0 {
+		return err
+	}
+	return d.backend.RemoveAll(dirPath)
+}
@@ -0,0 +1,293 @@
+package filesystem_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	fs "remote-storage/server/storagesvc/repository/filesystem"
+	"remote-storage/server/storagesvc/repository/filesystem/backendtest"
+)
+
+func TestDedupBackend(t *testing.T) {
+	backendtest.Run(t, func(t *testing.T) fs.Backend {
+		return fs.NewDedupBackend(fs.NewMemoryBackend(), fs.ConfigDedup{})
+	})
+}
+
+func digestOf(contents string) string {
+	sum := sha256.Sum256([]byte(contents))
+	return hex.EncodeToString(sum[:])
+}
+
+func blobPath(blobDir, contents string) string {
+	digest := digestOf(contents)
+	return path.Join(blobDir, digest[:2], digest)
+}
+
+// writeFile writes the file creating its parent directories
+func writeFile(t *testing.T, b fs.Backend, p, contents string) {
+	t.Helper()
+	if err := fs.MkdirAll(b, path.Dir(p), 0755); err != nil {
+		t.Fatalf("MkdirAll(%q): %v", path.Dir(p), err)
+	}
+	w, err := b.Create(p)
+	if err != nil {
+		t.Fatalf("Create(%q): %v", p, err)
+	}
+	if _, err := io.WriteString(w, contents); err != nil {
+		t.Fatalf("Write(%q): %v", p, err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close(%q): %v", p, err)
+	}
+}
+
+func readFile(t *testing.T, b fs.Backend, p string) string {
+	t.Helper()
+	f, err := b.OpenFile(p)
+	if err != nil {
+		t.Fatalf("OpenFile(%q): %v", p, err)
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatalf("ReadAll(%q): %v", p, err)
+	}
+	return string(data)
+}
+
+// refCount returns the stored reference count of the blob, 0 if the blob is removed
+func refCount(t *testing.T, raw fs.Backend, blobDir, contents string) int {
+	t.Helper()
+	p := blobPath(blobDir, contents)
+	if _, err := raw.Stat(p); os.IsNotExist(err) {
+		return 0
+	}
+	count, err := strconv.Atoi(readFile(t, raw, p+".refs"))
+	if err != nil {
+		t.Fatalf("reference count of %q: %v", contents, err)
+	}
+	return count
+}
+
+func TestDedupStoresContentsOnce(t *testing.T) {
+	raw := fs.NewMemoryBackend()
+	d := fs.NewDedupBackend(raw, fs.ConfigDedup{})
+	writeFile(t, d, "a.txt", "same")
+	writeFile(t, d, "b.txt", "same")
+	if err := d.Copy("a.txt", "c.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if got := refCount(t, raw, ".blobs", "same"); got != 3 {
+		t.Fatalf("references = %d, want 3", got)
+	}
+	if got := readFile(t, raw, blobPath(".blobs", "same")); got != "same" {
+		t.Fatalf("blob = %q", got)
+	}
+	if got := readFile(t, raw, "c.txt"); got != "" {
+		t.Fatalf("reference keeps the contents %q", got)
+	}
+	info, err := d.Stat("c.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size != 4 || info.Attributes.Blob != "" {
+		t.Fatalf("Stat = %+v", info)
+	}
+
+	writeFile(t, d, "b.txt", "other")
+	if err := d.RemoveAll("a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if got := refCount(t, raw, ".blobs", "same"); got != 1 {
+		t.Fatalf("references = %d, want 1", got)
+	}
+	if err := d.Rename("b.txt", "c.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if got := refCount(t, raw, ".blobs", "same"); got != 0 {
+		t.Fatalf("blob of the replaced file is kept with %d references", got)
+	}
+	if got := readFile(t, d, "c.txt"); got != "other" {
+		t.Fatalf("c.txt = %q", got)
+	}
+}
+
+func TestDedupReadsUnmarkedFilesAsTheyAre(t *testing.T) {
+	raw := fs.NewMemoryBackend()
+	d := fs.NewDedupBackend(raw, fs.ConfigDedup{})
+	writeFile(t, d, "a.txt", "target")
+	// the contents look like the reference, but the file is not marked as one
+	fake := "sha256:" + digestOf("target") + " 6\n"
+	writeFile(t, raw, "b.txt", fake)
+	if got := readFile(t, d, "b.txt"); got != fake {
+		t.Fatalf("b.txt = %q, want %q", got, fake)
+	}
+	info, err := d.Stat("b.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size != int64(len(fake)) {
+		t.Fatalf("size = %d, want %d", info.Size, len(fake))
+	}
+}
+
+func TestDedupHidesBlobDir(t *testing.T) {
+	for _, blobDir := range []string{".blobs", "data/.blobs", "/data//.blobs/"} {
+		t.Run(blobDir, func(t *testing.T) {
+			d := fs.NewDedupBackend(fs.NewMemoryBackend(), fs.ConfigDedup{BlobDir: blobDir})
+			writeFile(t, d, "data/a.txt", "a")
+			tree, err := d.TraverseDirectory("")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, dir := range tree.Children {
+				for _, child := range append([]fs.FileInfo{dir}, dir.Children...) {
+					if child.Name == ".blobs" {
+						t.Fatalf("blob directory is listed in %+v", tree)
+					}
+				}
+			}
+			for _, p := range []string{"data/.blobs", "data/.blobs/tmp", "/data/./.blobs", ".blobs"} {
+				if _, err := d.Stat(p); err == nil {
+					t.Fatalf("Stat(%q) succeeded", p)
+				}
+			}
+			cleaned := path.Clean("/" + blobDir)[1:]
+			for _, p := range []string{cleaned, cleaned + "/x", path.Dir(cleaned), ""} {
+				if err := d.RemoveAll(p); err != fs.ErrOutsideRoot {
+					t.Fatalf("RemoveAll(%q) = %v, want ErrOutsideRoot", p, err)
+				}
+				if err := d.Rename(p, "moved"); err != fs.ErrOutsideRoot {
+					t.Fatalf("Rename(%q) = %v, want ErrOutsideRoot", p, err)
+				}
+			}
+			if got := readFile(t, d, "data/a.txt"); got != "a" {
+				t.Fatalf("data/a.txt = %q", got)
+			}
+		})
+	}
+}
+
+func TestDedupCollectGarbage(t *testing.T) {
+	raw := fs.NewMemoryBackend()
+	d := fs.NewDedupBackend(raw, fs.ConfigDedup{BlobDir: "data/.blobs"})
+	writeFile(t, d, "a.txt", "kept")
+	writeFile(t, d, "dir/b.txt", "kept")
+	writeFile(t, d, "c.txt", "broken")
+
+	// the count broken by the interrupted write
+	writeFile(t, raw, blobPath("data/.blobs", "broken")+".refs", "7")
+	// the blob stored before the crash without the file referencing it
+	writeFile(t, raw, blobPath("data/.blobs", "orphan"), "orphan")
+
+	removed, err := d.CollectGarbage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 1 {
+		t.Fatalf("removed = %d, want 1", removed)
+	}
+	if got := refCount(t, raw, "data/.blobs", "orphan"); got != 0 {
+		t.Fatal("unreferenced blob is kept")
+	}
+	if got := refCount(t, raw, "data/.blobs", "broken"); got != 1 {
+		t.Fatalf("references = %d, want 1", got)
+	}
+	if got := refCount(t, raw, "data/.blobs", "kept"); got != 2 {
+		t.Fatalf("references = %d, want 2", got)
+	}
+	if got := readFile(t, d, "dir/b.txt"); got != "kept" {
+		t.Fatalf("dir/b.txt = %q", got)
+	}
+}
+
+func TestDedupCollectGarbageRemovesAbandonedTmp(t *testing.T) {
+	root := t.TempDir()
+	raw := fs.NewLocalBackend(fs.ConfigFileSystem{RootDir: root})
+	d := fs.NewDedupBackend(raw, fs.ConfigDedup{})
+	writeFile(t, raw, ".blobs/tmp/old", "old")
+	writeFile(t, raw, ".blobs/tmp/new", "new")
+	old := time.Now().Add(-48 * time.Hour)
+	if err := os.Chtimes(filepath.Join(root, ".blobs", "tmp", "old"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.CollectGarbage(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := raw.Stat(".blobs/tmp/old"); !os.IsNotExist(err) {
+		t.Fatalf("abandoned blob is kept: %v", err)
+	}
+	if _, err := raw.Stat(".blobs/tmp/new"); err != nil {
+		t.Fatalf("blob being written is removed: %v", err)
+	}
+}
+
+// TestDedupCollectGarbageWhileWriting checks that the files changed while the garbage
+// is collected keep their blobs and the counts stay right
+func TestDedupCollectGarbageWhileWriting(t *testing.T) {
+	raw := fs.NewMemoryBackend()
+	d := fs.NewDedupBackend(raw, fs.ConfigDedup{})
+	for i := 0; i < 20; i++ {
+		writeFile(t, d, "dir/"+strconv.Itoa(i), "same")
+	}
+	for _, dir := range []string{"new", "moved"} {
+		if err := d.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			if _, err := d.CollectGarbage(); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			name := strconv.Itoa(i)
+			w, err := d.Create("new/" + name)
+			if err == nil {
+				io.WriteString(w, "new")
+				err = w.Close()
+			}
+			if err == nil {
+				err = d.Rename("dir/"+name, "moved/"+name)
+			}
+			if err == nil {
+				err = d.RemoveAll("new/" + name)
+			}
+			if err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	wg.Wait()
+
+	if got := refCount(t, raw, ".blobs", "same"); got != 20 {
+		t.Fatalf("references = %d, want 20", got)
+	}
+	if got := refCount(t, raw, ".blobs", "new"); got != 0 {
+		t.Fatalf("blob of the removed files is kept with %d references", got)
+	}
+	for i := 0; i < 20; i++ {
+		if got := readFile(t, d, "moved/"+strconv.Itoa(i)); got != "same" {
+			t.Fatalf("moved/%d = %q", i, got)
+		}
+	}
+}
@@ -1,99 +1,68 @@
 package filesystem
 
 import (
-	"fmt"
 	"os"
+	"path"
+	"path/filepath"
 	"strings"
 )
 
 const pathSeparator = string(os.PathSeparator)
 
-func getPath(path string) string {
-	var res string
-	res += rootDir
-	//res += fs.currentDir
-	res += path
-	return res
+// getPath returns the path in the local file system,
+// the path is cleaned so it can't lead outside of the root directory
+func (b *localBackend) getPath(p string) string {
+	return filepath.Join(b.root(), filepath.FromSlash(path.Clean("/"+p)))
 }
 
-func DivideFileIntoChunks(path string, chunkSize int) ([][]byte, error) {
-	var chunks [][]byte
-	file, err := os.Open(getPath(path))
-	if err != nil {
-		fmt.Println("Error opening file:", err)
-		return chunks, err
+func (b *localBackend) root() string {
+	if b.rootDir == "" {
+		return "."
 	}
-	defer file.Close()
-
-	fileInfo, _ := file.Stat()
-	fileSize := fileInfo.Size()
+	return b.rootDir
+}
 
-	fullChunksAmount := int(fileSize) / chunkSize
-	lastChunkSize := int(fileSize) % chunkSize
-	chunkAmount := fullChunksAmount
-	if lastChunkSize > 0 {
-		chunkAmount++
+// ResolveSymlinks implements SymlinkResolver
+func (b *localBackend) ResolveSymlinks(p string) (string, error) {
+	root, err := filepath.EvalSymlinks(b.root())
+	if err != nil {
+		return "", err
 	}
-	chunks = make([][]byte, chunkAmount)
-
-	for i := 0; i < fullChunksAmount; i++ {
-		chunk := make([]byte, chunkSize)
-		_, err := file.Read(chunk)
-		if err != nil {
-			return chunks, err
-		}
-		chunks[i] = chunk
+	if root, err = filepath.Abs(root); err != nil {
+		return "", err
 	}
-
-	if lastChunkSize > 0 {
-		lastChunk := make([]byte, lastChunkSize)
-		_, err := file.Read(lastChunk)
-		if err != nil {
-			return chunks, err
+	current := b.getPath(p)
+	var missing []string
+	for {
+		resolved, err := filepath.EvalSymlinks(current)
+		if err == nil {
+			current = resolved
+			break
 		}
-		chunks[chunkAmount-1] = lastChunk
-	}
-
-	return chunks, err
-}
-
-func joinPath(path []string) string {
-	var res string
-	for _, s := range path {
-		res += s + string(os.PathSeparator)
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+		// a dangling symbolic link would be followed on creating the file
+		if _, err := os.Lstat(current); err == nil {
+			return "", ErrOutsideRoot
+		}
+		parent := filepath.Dir(current)
+		if parent == current {
+			return "", err
+		}
+		missing = append([]string{filepath.Base(current)}, missing...)
+		current = parent
 	}
-	return res
-}
-
-func splitPath(path string) []string {
-	res := strings.Split(path, string(os.PathSeparator))
-	if res[len(res)-1] == "" {
-		res = res[:len(res)-1]
+	current, err = filepath.Abs(filepath.Join(append([]string{current}, missing...)...))
+	if err != nil {
+		return "", err
 	}
-
-	return res
-}
-
-func isExists(path string) bool {
-	path = getPath(path)
-	_, err := os.Stat(path)
-	return !os.IsNotExist(err)
-}
-
-func isDirectoryExists(path string) bool {
-	path = getPath(path)
-	info, err := os.Stat(path)
-	if os.IsNotExist(err) {
-		return false // Directory does not exist
+	rel, err := filepath.Rel(root, current)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+pathSeparator) {
+		return "", ErrOutsideRoot
 	}
-	return info.IsDir()
-}
-
-func isFileExists(path string) bool {
-	path = getPath(path)
-	info, err := os.Stat(path)
-	if os.IsNotExist(err) {
-		return false // File does not exist
+	if rel == "." {
+		return "", nil
 	}
-	return !info.IsDir()
+	return filepath.ToSlash(rel), nil
 }
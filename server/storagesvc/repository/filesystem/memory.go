@@ -0,0 +1,298 @@
+package filesystem
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// memoryBackend is a Backend keeping files in memory.
+// Useful in tests, contents are lost when the process exits.
+type memoryBackend struct {
+	mu    sync.RWMutex
+	nodes map[string]*memoryNode
+}
+
+type memoryNode struct {
+	isDir    bool
+	data     []byte
+	modified time.Time
+}
+
+// NewMemoryBackend returns an empty in-memory Backend
+func NewMemoryBackend() Backend {
+	return &memoryBackend{
+		nodes: map[string]*memoryNode{
+			"/": {isDir: true, modified: time.Now()},
+		},
+	}
+}
+
+func cleanMemoryPath(p string) string {
+	return path.Clean("/" + p)
+}
+
+// children returns the paths of all nodes nested into the directory dirPath
+func (b *memoryBackend) children(dirPath string) []string {
+	prefix := dirPath + "/"
+	if dirPath == "/" {
+		prefix = "/"
+	}
+	var res []string
+	for p := range b.nodes {
+		if p != dirPath && strings.HasPrefix(p, prefix) {
+			res = append(res, p)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+func (b *memoryBackend) parentIsDir(op, p string) error {
+	parent, ok := b.nodes[path.Dir(p)]
+	if !ok || !parent.isDir {
+		return &os.PathError{Op: op, Path: p, Err: os.ErrNotExist}
+	}
+	return nil
+}
+
+func (b *memoryBackend) Create(filePath string) (io.WriteCloser, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	p := cleanMemoryPath(filePath)
+	if err := b.parentIsDir("create", p); err != nil {
+		return nil, err
+	}
+	if node, ok := b.nodes[p]; ok && node.isDir {
+		return nil, &os.PathError{Op: "create", Path: p, Err: os.ErrExist}
+	}
+	node := &memoryNode{modified: time.Now()}
+	b.nodes[p] = node
+	return &memoryWriter{backend: b, node: node}, nil
+}
+
+func (b *memoryBackend) OpenFile(filePath string) (File, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	p := cleanMemoryPath(filePath)
+	node, ok := b.nodes[p]
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: p, Err: os.ErrNotExist}
+	}
+	if node.isDir {
+		return nil, &os.PathError{Op: "open", Path: p, Err: os.ErrInvalid}
+	}
+	return memoryFile{bytes.NewReader(append([]byte(nil), node.data...))}, nil
+}
+
+func (b *memoryBackend) Rename(oldPath, newPath string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	src := cleanMemoryPath(oldPath)
+	dest := cleanMemoryPath(newPath)
+	node, ok := b.nodes[src]
+	if !ok || src == "/" {
+		return &os.LinkError{Op: "rename", Old: src, New: dest, Err: os.ErrNotExist}
+	}
+	if err := b.parentIsDir("rename", dest); err != nil {
+		return err
+	}
+	if src == dest {
+		return nil
+	}
+	if strings.HasPrefix(dest, src+"/") {
+		return &os.LinkError{Op: "rename", Old: src, New: dest, Err: os.ErrInvalid}
+	}
+	if existing, ok := b.nodes[dest]; ok {
+		if existing.isDir != node.isDir || len(b.children(dest)) > 0 {
+			return &os.LinkError{Op: "rename", Old: src, New: dest, Err: os.ErrExist}
+		}
+	}
+	for _, p := range b.children(src) {
+		b.nodes[dest+strings.TrimPrefix(p, src)] = b.nodes[p]
+		delete(b.nodes, p)
+	}
+	delete(b.nodes, src)
+	b.nodes[dest] = node
+	return nil
+}
+
+func (b *memoryBackend) Copy(srcPath, destPath string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	src := cleanMemoryPath(srcPath)
+	dest := cleanMemoryPath(destPath)
+	node, ok := b.nodes[src]
+	if !ok {
+		return &os.PathError{Op: "stat", Path: src, Err: os.ErrNotExist}
+	}
+	if err := b.parentIsDir("copy", dest); err != nil {
+		return err
+	}
+	if !node.isDir {
+		if existing, ok := b.nodes[dest]; ok && existing.isDir {
+			return &os.PathError{Op: "copy", Path: dest, Err: os.ErrExist}
+		}
+		b.nodes[dest] = node.copy()
+		return nil
+	}
+	if strings.HasPrefix(dest, src+"/") {
+		return &os.PathError{Op: "copy", Path: dest, Err: os.ErrInvalid}
+	}
+	// directories are merged like the local backend does it
+	paths := append([]string{src}, b.children(src)...)
+	for _, p := range paths {
+		target := dest + strings.TrimPrefix(p, src)
+		if existing, ok := b.nodes[target]; ok && existing.isDir != b.nodes[p].isDir {
+			return &os.PathError{Op: "copy", Path: target, Err: os.ErrExist}
+		}
+		if existing, ok := b.nodes[target]; ok && existing.isDir {
+			continue
+		}
+		b.nodes[target] = b.nodes[p].copy()
+	}
+	return nil
+}
+
+func (b *memoryBackend) RemoveAll(filePath string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	p := cleanMemoryPath(filePath)
+	for _, child := range b.children(p) {
+		delete(b.nodes, child)
+	}
+	if p != "/" {
+		delete(b.nodes, p)
+	}
+	return nil
+}
+
+func (b *memoryBackend) Mkdir(dirPath string, permission os.FileMode) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	p := cleanMemoryPath(dirPath)
+	if _, ok := b.nodes[p]; ok {
+		return &os.PathError{Op: "mkdir", Path: p, Err: os.ErrExist}
+	}
+	if err := b.parentIsDir("mkdir", p); err != nil {
+		return err
+	}
+	b.nodes[p] = &memoryNode{isDir: true, modified: time.Now()}
+	return nil
+}
+
+func (b *memoryBackend) TraverseDirectory(dirPath string) (FileInfo, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	p := cleanMemoryPath(dirPath)
+	node, ok := b.nodes[p]
+	if !ok {
+		return FileInfo{Name: path.Base(p), IsDir: true, Children: []FileInfo{}},
+			&os.PathError{Op: "open", Path: p, Err: os.ErrNotExist}
+	}
+	if !node.isDir {
+		return FileInfo{Name: path.Base(p), IsDir: true, Children: []FileInfo{}},
+			&os.PathError{Op: "readdirent", Path: p, Err: os.ErrInvalid}
+	}
+	return b.traverse(p), nil
+}
+
+// ReadDir implements DirReader
+func (b *memoryBackend) ReadDir(dirPath string) ([]FileInfo, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	p := cleanMemoryPath(dirPath)
+	node, ok := b.nodes[p]
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: p, Err: os.ErrNotExist}
+	}
+	if !node.isDir {
+		return nil, &os.PathError{Op: "readdirent", Path: p, Err: os.ErrInvalid}
+	}
+	res := []FileInfo{}
+	for _, child := range b.children(p) {
+		if path.Dir(child) == p {
+			res = append(res, b.nodes[child].info(child))
+		}
+	}
+	return res, nil
+}
+
+func (b *memoryBackend) traverse(dirPath string) FileInfo {
+	file := FileInfo{
+		Name:     path.Base(dirPath),
+		IsDir:    true,
+		Children: []FileInfo{},
+	}
+	for _, p := range b.children(dirPath) {
+		if path.Dir(p) != dirPath {
+			continue
+		}
+		node := b.nodes[p]
+		child := node.info(p)
+		if child.IsDir {
+			child.Children = b.traverse(p).Children
+		}
+		file.Children = append(file.Children, child)
+	}
+	return file
+}
+
+func (b *memoryBackend) Stat(filePath string) (FileInfo, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	p := cleanMemoryPath(filePath)
+	node, ok := b.nodes[p]
+	if !ok {
+		return FileInfo{}, &os.PathError{Op: "stat", Path: p, Err: os.ErrNotExist}
+	}
+	return node.info(p), nil
+}
+
+func (n *memoryNode) info(p string) FileInfo {
+	return FileInfo{
+		Name:     path.Base(p),
+		IsDir:    n.isDir,
+		Size:     int64(len(n.data)),
+		Modified: n.modified,
+	}
+}
+
+func (n *memoryNode) copy() *memoryNode {
+	return &memoryNode{
+		isDir:    n.isDir,
+		data:     append([]byte(nil), n.data...),
+		modified: time.Now(),
+	}
+}
+
+// memoryWriter appends written data to the node created by memoryBackend.Create
+type memoryWriter struct {
+	backend *memoryBackend
+	node    *memoryNode
+}
+
+func (w *memoryWriter) Write(p []byte) (int, error) {
+	w.backend.mu.Lock()
+	defer w.backend.mu.Unlock()
+	w.node.data = append(w.node.data, p...)
+	w.node.modified = time.Now()
+	return len(p), nil
+}
+
+func (w *memoryWriter) Close() error {
+	return nil
+}
+
+type memoryFile struct {
+	*bytes.Reader
+}
+
+func (f memoryFile) Close() error {
+	return nil
+}
@@ -0,0 +1,575 @@
+// Package objectstorage provides a storagesvc backend keeping files
+// in an S3-compatible object storage. Directories are emulated with key
+// prefixes, an empty directory is kept as a zero-sized "dir/" marker object.
+package objectstorage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	fs "remote-storage/server/storagesvc/repository/filesystem"
+)
+
+const dirMarker = "/"
+
+// uploadPartSize is the size of the parts of objects of unknown size, it bounds the memory
+// buffered by every upload and makes the largest object 10000 parts, about 156 GiB
+const uploadPartSize = 16 << 20
+
+// copyPartSize is the largest object S3 copies with a single CopyObject request, it is
+// also the size of the parts of the larger objects copied with the multipart upload
+var copyPartSize int64 = 5 << 30
+
+// errAborted interrupts the upload of the object whose writer is aborted
+var errAborted = errors.New("upload aborted")
+
+type Config struct {
+	Endpoint        string
+	AccessKeyID     string
+	SecretAccessKey string
+	Bucket          string
+	Region          string
+	UseSSL          bool
+}
+
+// backend is a filesystem.Backend keeping files as objects of the bucket
+type backend struct {
+	client *minio.Client
+	bucket string
+}
+
+// New returns a filesystem.Backend working with the bucket specified in config.
+// The bucket is created if it does not exist.
+func New(config Config) (fs.Backend, error) {
+	client, err := minio.New(config.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(config.AccessKeyID, config.SecretAccessKey, ""),
+		Secure: config.UseSSL,
+		Region: config.Region,
+	})
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+	exists, err := client.BucketExists(ctx, config.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		err = client.MakeBucket(ctx, config.Bucket, minio.MakeBucketOptions{Region: config.Region})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &backend{
+		client: client,
+		bucket: config.Bucket,
+	}, nil
+}
+
+// objectKey converts the backend path into the object key, the root of the bucket is ""
+func objectKey(p string) string {
+	return strings.TrimPrefix(path.Clean("/"+p), "/")
+}
+
+// prefixOf returns the key prefix of the objects nested into the directory key
+func prefixOf(key string) string {
+	if key == "" {
+		return ""
+	}
+	return key + dirMarker
+}
+
+func isNotFound(err error) bool {
+	code := minio.ToErrorResponse(err).Code
+	return code == "NoSuchKey" || code == "NotFound"
+}
+
+func pathError(op, key string, err error) error {
+	if isNotFound(err) {
+		err = os.ErrNotExist
+	}
+	return &os.PathError{Op: op, Path: key, Err: err}
+}
+
+// listObjects returns all objects with the taken prefix, including directory markers
+func (b *backend) listObjects(prefix string) ([]minio.ObjectInfo, error) {
+	var res []minio.ObjectInfo
+	for obj := range b.client.ListObjects(context.Background(), b.bucket, minio.ListObjectsOptions{
+		Prefix:    prefix,
+		Recursive: true,
+	}) {
+		if obj.Err != nil {
+			return nil, obj.Err
+		}
+		res = append(res, obj)
+	}
+	return res, nil
+}
+
+// isDir reports whether the key is an existing directory,
+// i.e. it has a marker object or any nested objects
+func (b *backend) isDir(key string) (bool, error) {
+	if key == "" {
+		return true, nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for obj := range b.client.ListObjects(ctx, b.bucket, minio.ListObjectsOptions{
+		Prefix:  prefixOf(key),
+		MaxKeys: 1,
+	}) {
+		if obj.Err != nil {
+			return false, obj.Err
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+func (b *backend) isFile(key string) (bool, error) {
+	if key == "" {
+		return false, nil
+	}
+	_, err := b.client.StatObject(context.Background(), b.bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		if isNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (b *backend) checkParent(op, key string) error {
+	parent := objectKey(path.Dir("/" + key))
+	ok, err := b.isDir(parent)
+	if err != nil {
+		return pathError(op, key, err)
+	}
+	if !ok {
+		return &os.PathError{Op: op, Path: key, Err: os.ErrNotExist}
+	}
+	return nil
+}
+
+func (b *backend) Create(filePath string) (io.WriteCloser, error) {
+	key := objectKey(filePath)
+	if err := b.checkParent("create", key); err != nil {
+		return nil, err
+	}
+	dir, err := b.isDir(key)
+	if err != nil {
+		return nil, pathError("create", key, err)
+	}
+	if key == "" || dir {
+		return nil, &os.PathError{Op: "create", Path: key, Err: os.ErrExist}
+	}
+
+	pr, pw := io.Pipe()
+	w := &objectWriter{
+		pw:   pw,
+		done: make(chan error, 1),
+	}
+	go func() {
+		_, err := b.client.PutObject(context.Background(), b.bucket, key, pr, -1, minio.PutObjectOptions{
+			DisableContentSha256: true,
+			PartSize:             uploadPartSize,
+		})
+		pr.CloseWithError(err)
+		w.done <- err
+	}()
+	return w, nil
+}
+
+func (b *backend) OpenFile(filePath string) (fs.File, error) {
+	key := objectKey(filePath)
+	ctx := context.Background()
+	if _, err := b.client.StatObject(ctx, b.bucket, key, minio.StatObjectOptions{}); err != nil {
+		return nil, pathError("open", key, err)
+	}
+	obj, err := b.client.GetObject(ctx, b.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, pathError("open", key, err)
+	}
+	return obj, nil
+}
+
+func (b *backend) Rename(oldPath, newPath string) error {
+	src := objectKey(oldPath)
+	dest := objectKey(newPath)
+	if src == dest {
+		return nil
+	}
+	if err := b.checkParent("rename", dest); err != nil {
+		return err
+	}
+	isFile, err := b.isFile(src)
+	if err != nil {
+		return pathError("rename", src, err)
+	}
+	if isFile {
+		if destDir, err := b.isDir(dest); err != nil || destDir {
+			return &os.LinkError{Op: "rename", Old: src, New: dest, Err: os.ErrExist}
+		}
+		if err := b.copyObject(src, dest); err != nil {
+			return pathError("rename", src, err)
+		}
+		return b.removeObject(src)
+	}
+
+	isDir, err := b.isDir(src)
+	if err != nil {
+		return pathError("rename", src, err)
+	}
+	if !isDir || src == "" {
+		return &os.LinkError{Op: "rename", Old: src, New: dest, Err: os.ErrNotExist}
+	}
+	if strings.HasPrefix(dest, prefixOf(src)) {
+		return &os.LinkError{Op: "rename", Old: src, New: dest, Err: os.ErrInvalid}
+	}
+	// like os.Rename, a directory may replace only an empty directory
+	existing, err := b.listObjects(prefixOf(dest))
+	if err != nil {
+		return pathError("rename", dest, err)
+	}
+	destFile, err := b.isFile(dest)
+	if err != nil {
+		return pathError("rename", dest, err)
+	}
+	if destFile || len(existing) > 1 || (len(existing) == 1 && existing[0].Key != prefixOf(dest)) {
+		return &os.LinkError{Op: "rename", Old: src, New: dest, Err: os.ErrExist}
+	}
+	objects, err := b.copyPrefix(src, dest)
+	if err != nil {
+		return pathError("rename", src, err)
+	}
+	for _, obj := range objects {
+		if err := b.removeObject(obj.Key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *backend) Copy(srcPath, destPath string) error {
+	src := objectKey(srcPath)
+	dest := objectKey(destPath)
+	if err := b.checkParent("copy", dest); err != nil {
+		return err
+	}
+	isFile, err := b.isFile(src)
+	if err != nil {
+		return pathError("copy", src, err)
+	}
+	if isFile {
+		if destDir, err := b.isDir(dest); err != nil || destDir {
+			return &os.PathError{Op: "copy", Path: dest, Err: os.ErrExist}
+		}
+		if err := b.copyObject(src, dest); err != nil {
+			return pathError("copy", src, err)
+		}
+		return nil
+	}
+	isDir, err := b.isDir(src)
+	if err != nil {
+		return pathError("copy", src, err)
+	}
+	if !isDir {
+		return &os.PathError{Op: "stat", Path: src, Err: os.ErrNotExist}
+	}
+	if src == dest || strings.HasPrefix(dest, prefixOf(src)) {
+		return &os.PathError{Op: "copy", Path: dest, Err: os.ErrInvalid}
+	}
+	// directories are merged like the local backend does it
+	if _, err := b.copyPrefix(src, dest); err != nil {
+		return pathError("copy", src, err)
+	}
+	return b.putDirMarker(dest)
+}
+
+// copyPrefix copies all objects nested into the src directory into the dest directory
+// and returns the list of copied source objects
+func (b *backend) copyPrefix(src, dest string) ([]minio.ObjectInfo, error) {
+	objects, err := b.listObjects(prefixOf(src))
+	if err != nil {
+		return nil, err
+	}
+	for _, obj := range objects {
+		target := prefixOf(dest) + strings.TrimPrefix(obj.Key, prefixOf(src))
+		if err := b.copyObject(obj.Key, target); err != nil {
+			return nil, err
+		}
+	}
+	return objects, b.putDirMarker(dest)
+}
+
+// copyObject copies the object on the server side, objects larger than copyPartSize
+// cannot be copied with a single request and are composed of their ranges
+func (b *backend) copyObject(src, dest string) error {
+	ctx := context.Background()
+	destOpts := minio.CopyDestOptions{Bucket: b.bucket, Object: dest}
+	info, err := b.client.StatObject(ctx, b.bucket, src, minio.StatObjectOptions{})
+	if err != nil {
+		return err
+	}
+	if info.Size <= copyPartSize {
+		_, err = b.client.CopyObject(ctx, destOpts, minio.CopySrcOptions{Bucket: b.bucket, Object: src})
+		return err
+	}
+	var parts []minio.CopySrcOptions
+	for start := int64(0); start < info.Size; start += copyPartSize {
+		end := start + copyPartSize
+		if end > info.Size {
+			end = info.Size
+		}
+		parts = append(parts, minio.CopySrcOptions{
+			Bucket:     b.bucket,
+			Object:     src,
+			MatchETag:  info.ETag,
+			MatchRange: true,
+			Start:      start,
+			End:        end - 1,
+		})
+	}
+	_, err = b.client.ComposeObject(ctx, destOpts, parts...)
+	return err
+}
+
+func (b *backend) removeObject(key string) error {
+	err := b.client.RemoveObject(context.Background(), b.bucket, key, minio.RemoveObjectOptions{})
+	if err != nil && !isNotFound(err) {
+		return pathError("remove", key, err)
+	}
+	return nil
+}
+
+func (b *backend) putDirMarker(key string) error {
+	if key == "" {
+		return nil
+	}
+	_, err := b.client.PutObject(context.Background(), b.bucket, prefixOf(key), strings.NewReader(""), 0, minio.PutObjectOptions{DisableContentSha256: true})
+	return err
+}
+
+func (b *backend) RemoveAll(filePath string) error {
+	key := objectKey(filePath)
+	objects, err := b.listObjects(prefixOf(key))
+	if err != nil {
+		return pathError("removeall", key, err)
+	}
+	for _, obj := range objects {
+		if err := b.removeObject(obj.Key); err != nil {
+			return err
+		}
+	}
+	if key == "" {
+		return nil
+	}
+	return b.removeObject(key)
+}
+
+func (b *backend) Mkdir(dirPath string, permission os.FileMode) error {
+	key := objectKey(dirPath)
+	if err := b.checkParent("mkdir", key); err != nil {
+		return err
+	}
+	isFile, err := b.isFile(key)
+	if err != nil {
+		return pathError("mkdir", key, err)
+	}
+	isDir, err := b.isDir(key)
+	if err != nil {
+		return pathError("mkdir", key, err)
+	}
+	if isFile || isDir {
+		return &os.PathError{Op: "mkdir", Path: key, Err: os.ErrExist}
+	}
+	if err := b.putDirMarker(key); err != nil {
+		return pathError("mkdir", key, err)
+	}
+	return nil
+}
+
+func (b *backend) Stat(filePath string) (fs.FileInfo, error) {
+	key := objectKey(filePath)
+	if key != "" {
+		info, err := b.client.StatObject(context.Background(), b.bucket, key, minio.StatObjectOptions{})
+		if err == nil {
+			return fs.FileInfo{
+				Name:     path.Base(key),
+				Size:     info.Size,
+				Modified: info.LastModified,
+			}, nil
+		}
+		if !isNotFound(err) {
+			return fs.FileInfo{}, pathError("stat", key, err)
+		}
+	}
+	isDir, err := b.isDir(key)
+	if err != nil {
+		return fs.FileInfo{}, pathError("stat", key, err)
+	}
+	if !isDir {
+		return fs.FileInfo{}, &os.PathError{Op: "stat", Path: key, Err: os.ErrNotExist}
+	}
+	return fs.FileInfo{
+		Name:  path.Base("/" + key),
+		IsDir: true,
+	}, nil
+}
+
+func (b *backend) TraverseDirectory(dirPath string) (fs.FileInfo, error) {
+	key := objectKey(dirPath)
+	root := &treeNode{
+		info: fs.FileInfo{
+			Name:  path.Base("/" + key),
+			IsDir: true,
+		},
+	}
+	isDir, err := b.isDir(key)
+	if err != nil {
+		return root.fileInfo(), pathError("open", key, err)
+	}
+	if !isDir {
+		return root.fileInfo(), &os.PathError{Op: "open", Path: key, Err: os.ErrNotExist}
+	}
+	objects, err := b.listObjects(prefixOf(key))
+	if err != nil {
+		return root.fileInfo(), pathError("open", key, err)
+	}
+	for _, obj := range objects {
+		rel := strings.TrimPrefix(obj.Key, prefixOf(key))
+		isMarker := strings.HasSuffix(rel, dirMarker)
+		parts := strings.Split(strings.TrimSuffix(rel, dirMarker), dirMarker)
+		node := root
+		for i, name := range parts {
+			if name == "" {
+				break
+			}
+			last := i == len(parts)-1
+			node = node.child(name, !last || isMarker)
+			if last && !isMarker {
+				node.info.Size = obj.Size
+				node.info.Modified = obj.LastModified
+			}
+		}
+	}
+	return root.fileInfo(), nil
+}
+
+// ReadDir implements fs.DirReader, the objects are listed non-recursively,
+// so nested directories are reported by their common prefixes
+func (b *backend) ReadDir(dirPath string) ([]fs.FileInfo, error) {
+	key := objectKey(dirPath)
+	isDir, err := b.isDir(key)
+	if err != nil {
+		return nil, pathError("open", key, err)
+	}
+	if !isDir {
+		return nil, &os.PathError{Op: "open", Path: key, Err: os.ErrNotExist}
+	}
+	res := []fs.FileInfo{}
+	dirs := make(map[string]bool)
+	for obj := range b.client.ListObjects(context.Background(), b.bucket, minio.ListObjectsOptions{
+		Prefix: prefixOf(key),
+	}) {
+		if obj.Err != nil {
+			return nil, pathError("open", key, obj.Err)
+		}
+		name := strings.TrimPrefix(obj.Key, prefixOf(key))
+		if name == "" {
+			// the marker of the directory itself
+			continue
+		}
+		if strings.HasSuffix(name, dirMarker) {
+			// the directory may be reported both by its marker and by the common prefix
+			name = strings.TrimSuffix(name, dirMarker)
+			if !dirs[name] {
+				dirs[name] = true
+				res = append(res, fs.FileInfo{Name: name, IsDir: true})
+			}
+			continue
+		}
+		res = append(res, fs.FileInfo{
+			Name:     name,
+			Size:     obj.Size,
+			Modified: obj.LastModified,
+		})
+	}
+	return res, nil
+}
+
+// treeNode is used for building the directory tree from the flat list of keys
+type treeNode struct {
+	info     fs.FileInfo
+	children map[string]*treeNode
+}
+
+func (n *treeNode) child(name string, isDir bool) *treeNode {
+	if n.children == nil {
+		n.children = make(map[string]*treeNode)
+	}
+	c, ok := n.children[name]
+	if !ok {
+		c = &treeNode{info: fs.FileInfo{Name: name, IsDir: isDir}}
+		n.children[name] = c
+	}
+	return c
+}
+
+func (n *treeNode) fileInfo() fs.FileInfo {
+	res := n.info
+	if !res.IsDir {
+		return res
+	}
+	res.Children = []fs.FileInfo{}
+	names := make([]string, 0, len(n.children))
+	for name := range n.children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		res.Children = append(res.Children, n.children[name].fileInfo())
+	}
+	return res
+}
+
+// objectWriter streams written data into the object being uploaded,
+// the object appears in the bucket when the writer is closed and never appears if it is aborted
+type objectWriter struct {
+	pw        *io.PipeWriter
+	done      chan error
+	closeOnce sync.Once
+	closeErr  error
+}
+
+func (w *objectWriter) Write(p []byte) (int, error) {
+	return w.pw.Write(p)
+}
+
+func (w *objectWriter) Close() error {
+	w.closeOnce.Do(func() {
+		w.pw.Close()
+		w.closeErr = <-w.done
+	})
+	return w.closeErr
+}
+
+// Abort implements fs.Aborter, the upload fails instead of storing the truncated object
+func (w *objectWriter) Abort() error {
+	w.closeOnce.Do(func() {
+		w.pw.CloseWithError(errAborted)
+		if err := <-w.done; err != nil && !errors.Is(err, errAborted) {
+			w.closeErr = err
+		}
+	})
+	return w.closeErr
+}
@@ -0,0 +1,271 @@
+package objectstorage
+
+import (
+	"bytes"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	fs "remote-storage/server/storagesvc/repository/filesystem"
+	"remote-storage/server/storagesvc/repository/filesystem/backendtest"
+)
+
+const testBucket = "files"
+
+// newTestBackend returns the backend working with the new bucket of the fake S3
+func newTestBackend(t *testing.T) (fs.Backend, *fakeS3) {
+	fake := newFakeS3()
+	ts := fake.start(t)
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := New(Config{
+		Endpoint:        u.Host,
+		AccessKeyID:     "access",
+		SecretAccessKey: "secret",
+		Bucket:          testBucket,
+		Region:          "us-east-1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b, fake
+}
+
+func TestBackend(t *testing.T) {
+	backendtest.Run(t, func(t *testing.T) fs.Backend {
+		b, _ := newTestBackend(t)
+		return b
+	})
+}
+
+func put(t *testing.T, b fs.Backend, p, contents string) {
+	t.Helper()
+	w, err := b.Create(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.WriteString(w, contents); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPrefixDirectories(t *testing.T) {
+	b, fake := newTestBackend(t)
+	if err := fs.MkdirAll(b, "a/b", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(fake.objects(testBucket), ","); got != "a/,a/b/" {
+		t.Fatalf("objects = %s, want directory markers", got)
+	}
+	put(t, b, "a/b/c.txt", "c")
+
+	// the directory exists as long as anything is nested into it, even without its marker
+	if err := b.RemoveAll("a/b/"); err != nil {
+		t.Fatal(err)
+	}
+	put(t, b, "a/c.txt", "c")
+	w, err := b.Create("a/d.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	fake.mu.Lock()
+	delete(fake.buckets[testBucket], "a/")
+	fake.mu.Unlock()
+	info, err := b.Stat("a")
+	if err != nil || !info.IsDir {
+		t.Fatalf("Stat of the prefix directory = %+v, %v", info, err)
+	}
+	children, err := fs.ReadDir(b, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(children) != 2 {
+		t.Fatalf("children = %+v", children)
+	}
+	if err := b.Mkdir("a", 0755); !os.IsExist(err) {
+		t.Fatalf("Mkdir of the prefix directory = %v, want exist", err)
+	}
+
+	// the marker of the empty directory is listed as the directory
+	if err := b.Mkdir("a/empty", 0755); err != nil {
+		t.Fatal(err)
+	}
+	tree, err := b.TraverseDirectory("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tree.Children) != 1 || tree.Children[0].Name != "a" || len(tree.Children[0].Children) != 3 {
+		t.Fatalf("tree = %+v", tree)
+	}
+	for _, child := range tree.Children[0].Children {
+		if child.Name == "empty" && (!child.IsDir || len(child.Children) != 0) {
+			t.Fatalf("empty directory = %+v", child)
+		}
+	}
+}
+
+func TestRenameDirectoryMovesObjects(t *testing.T) {
+	b, fake := newTestBackend(t)
+	if err := fs.MkdirAll(b, "src/nested", 0755); err != nil {
+		t.Fatal(err)
+	}
+	put(t, b, "src/nested/a.txt", "a")
+	if err := b.Mkdir("dest", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Rename("src", "dest"); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(fake.objects(testBucket), ","); got != "dest/,dest/nested/,dest/nested/a.txt" {
+		t.Fatalf("objects = %s", got)
+	}
+	put(t, b, "other.txt", "o")
+	if err := b.Rename("other.txt", "dest"); !os.IsExist(err) {
+		t.Fatalf("Rename of the file over the directory = %v, want exist", err)
+	}
+	if err := b.Rename("dest", "dest/nested/x"); err == nil {
+		t.Fatal("Rename of the directory into itself succeeded")
+	}
+	if err := b.Mkdir("full", 0755); err != nil {
+		t.Fatal(err)
+	}
+	put(t, b, "full/f.txt", "f")
+	if err := b.Rename("dest", "full"); !os.IsExist(err) {
+		t.Fatalf("Rename over the directory which is not empty = %v, want exist", err)
+	}
+}
+
+func TestCopyDirectoryMerges(t *testing.T) {
+	b, _ := newTestBackend(t)
+	if err := fs.MkdirAll(b, "src", 0755); err != nil {
+		t.Fatal(err)
+	}
+	put(t, b, "src/a.txt", "a")
+	if err := fs.MkdirAll(b, "dest", 0755); err != nil {
+		t.Fatal(err)
+	}
+	put(t, b, "dest/b.txt", "b")
+	if err := b.Copy("src", "dest"); err != nil {
+		t.Fatal(err)
+	}
+	children, err := fs.ReadDir(b, "dest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(children) != 2 {
+		t.Fatalf("children of the merged directory = %+v", children)
+	}
+	if err := b.Copy("src", "src/inner"); err == nil {
+		t.Fatal("Copy of the directory into itself succeeded")
+	}
+}
+
+func TestRemoveAllKeepsSiblings(t *testing.T) {
+	b, fake := newTestBackend(t)
+	if err := fs.MkdirAll(b, "dir", 0755); err != nil {
+		t.Fatal(err)
+	}
+	put(t, b, "dir/a.txt", "a")
+	// "dir2" shares the prefix of "dir" without being nested into it
+	put(t, b, "dir2", "d")
+	put(t, b, "dir.txt", "d")
+	if err := b.RemoveAll("dir"); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(fake.objects(testBucket), ","); got != "dir.txt,dir2" {
+		t.Fatalf("objects = %s", got)
+	}
+	if err := b.RemoveAll(""); err != nil {
+		t.Fatal(err)
+	}
+	if got := fake.objects(testBucket); len(got) != 0 {
+		t.Fatalf("objects after removing the root = %v", got)
+	}
+}
+
+func TestAbortedWriterStoresNothing(t *testing.T) {
+	b, fake := newTestBackend(t)
+	put(t, b, "a.txt", "complete")
+
+	w, err := b.Create("a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.WriteString(w, "trunc"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Abort(w); err != nil {
+		t.Fatalf("Abort = %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close after Abort = %v", err)
+	}
+	f, err := b.OpenFile("a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if data, _ := io.ReadAll(f); string(data) != "complete" {
+		t.Fatalf("contents after aborted upload = %q", data)
+	}
+
+	w, err = b.Create("b.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(w, "partial")
+	fs.Abort(w)
+	if _, err := b.Stat("b.txt"); !os.IsNotExist(err) {
+		t.Fatalf("Stat of the aborted file = %v, want not exist", err)
+	}
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if len(fake.uploads) != 0 {
+		t.Fatalf("multipart uploads left after abort: %d", len(fake.uploads))
+	}
+}
+
+func TestCopyLargeObjectInParts(t *testing.T) {
+	defer func(size int64) { copyPartSize = size }(copyPartSize)
+	copyPartSize = 5 << 20
+	b, fake := newTestBackend(t)
+	data := make([]byte, 2*copyPartSize+3)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	put(t, b, "a.bin", string(data))
+	if err := b.Copy("a.bin", "b.bin"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Rename("b.bin", "c.bin"); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{"a.bin", "c.bin"} {
+		f, err := b.OpenFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(f)
+		f.Close()
+		if err != nil || !bytes.Equal(got, data) {
+			t.Fatalf("%s: %d bytes, %v", p, len(got), err)
+		}
+	}
+	if _, err := b.Stat("b.bin"); !os.IsNotExist(err) {
+		t.Fatalf("Stat of the renamed file = %v, want not exist", err)
+	}
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	// the put of a.bin is the first upload, both copies are composed of parts
+	if fake.lastID < 3 || len(fake.uploads) != 0 {
+		t.Fatalf("multipart uploads started %d, left %d", fake.lastID, len(fake.uploads))
+	}
+}
@@ -0,0 +1,326 @@
+package objectstorage
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fakeS3 is the in-process stand-in of the S3 service speaking the subset of the API
+// used by the backend: buckets, objects, copying, multipart uploads and ListObjectsV2.
+// Requests are expected in the path style and signatures are not checked.
+type fakeS3 struct {
+	mu      sync.Mutex
+	buckets map[string]map[string]fakeObject
+	uploads map[string]map[int][]byte
+	lastID  int
+}
+
+type fakeObject struct {
+	data     []byte
+	modified time.Time
+}
+
+func (o fakeObject) etag() string {
+	sum := md5.Sum(o.data)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{
+		buckets: make(map[string]map[string]fakeObject),
+		uploads: make(map[string]map[int][]byte),
+	}
+}
+
+// start serves the fake, the server is closed when the test ends
+func (f *fakeS3) start(t interface{ Cleanup(func()) }) *httptest.Server {
+	ts := httptest.NewServer(f)
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	bucketName, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	query := r.URL.Query()
+	bucket, ok := f.buckets[bucketName]
+	if key == "" {
+		switch {
+		case r.Method == http.MethodPut:
+			if !ok {
+				f.buckets[bucketName] = make(map[string]fakeObject)
+			}
+		case !ok:
+			writeS3Error(w, r, http.StatusNotFound, "NoSuchBucket")
+		case r.Method == http.MethodGet && query.Get("list-type") == "2":
+			f.list(w, bucket, query)
+		case r.Method == http.MethodHead:
+		default:
+			writeS3Error(w, r, http.StatusNotImplemented, "NotImplemented")
+		}
+		return
+	}
+	if !ok {
+		writeS3Error(w, r, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+	switch {
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		f.lastID++
+		id := strconv.Itoa(f.lastID)
+		f.uploads[id] = make(map[int][]byte)
+		writeXML(w, struct {
+			XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+			Bucket   string
+			Key      string
+			UploadId string
+		}{Bucket: bucketName, Key: key, UploadId: id})
+	case r.Method == http.MethodPut && query.Has("uploadId") && r.Header.Get("X-Amz-Copy-Source") != "":
+		parts, ok := f.uploads[query.Get("uploadId")]
+		if !ok {
+			writeS3Error(w, r, http.StatusNotFound, "NoSuchUpload")
+			return
+		}
+		src, ok := f.copySource(w, r)
+		if !ok {
+			return
+		}
+		data := src.data
+		if rng := r.Header.Get("X-Amz-Copy-Source-Range"); rng != "" {
+			var start, end int
+			if _, err := fmt.Sscanf(rng, "bytes=%d-%d", &start, &end); err != nil ||
+				start > end || end >= len(data) {
+				writeS3Error(w, r, http.StatusBadRequest, "InvalidRange")
+				return
+			}
+			data = data[start : end+1]
+		}
+		n, _ := strconv.Atoi(query.Get("partNumber"))
+		parts[n] = append([]byte(nil), data...)
+		part := fakeObject{data: data, modified: time.Now()}
+		writeXML(w, struct {
+			XMLName      xml.Name `xml:"CopyPartResult"`
+			ETag         string
+			LastModified string
+		}{ETag: part.etag(), LastModified: part.modified.UTC().Format(time.RFC3339)})
+	case r.Method == http.MethodPut && query.Has("uploadId"):
+		parts, ok := f.uploads[query.Get("uploadId")]
+		if !ok {
+			writeS3Error(w, r, http.StatusNotFound, "NoSuchUpload")
+			return
+		}
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeS3Error(w, r, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+		n, _ := strconv.Atoi(query.Get("partNumber"))
+		parts[n] = data
+		w.Header().Set("ETag", fakeObject{data: data}.etag())
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		id := query.Get("uploadId")
+		parts, ok := f.uploads[id]
+		if !ok {
+			writeS3Error(w, r, http.StatusNotFound, "NoSuchUpload")
+			return
+		}
+		numbers := make([]int, 0, len(parts))
+		for n := range parts {
+			numbers = append(numbers, n)
+		}
+		sort.Ints(numbers)
+		var data []byte
+		for _, n := range numbers {
+			data = append(data, parts[n]...)
+		}
+		delete(f.uploads, id)
+		obj := fakeObject{data: data, modified: time.Now()}
+		bucket[key] = obj
+		writeXML(w, struct {
+			XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+			Bucket  string
+			Key     string
+			ETag    string
+		}{Bucket: bucketName, Key: key, ETag: obj.etag()})
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+		delete(f.uploads, query.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut && r.Header.Get("X-Amz-Copy-Source") != "":
+		src, ok := f.copySource(w, r)
+		if !ok {
+			return
+		}
+		obj := fakeObject{data: append([]byte(nil), src.data...), modified: time.Now()}
+		bucket[key] = obj
+		writeXML(w, struct {
+			XMLName      xml.Name `xml:"CopyObjectResult"`
+			ETag         string
+			LastModified string
+		}{ETag: obj.etag(), LastModified: obj.modified.UTC().Format(time.RFC3339)})
+	case r.Method == http.MethodPut:
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeS3Error(w, r, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+		obj := fakeObject{data: data, modified: time.Now()}
+		bucket[key] = obj
+		w.Header().Set("ETag", obj.etag())
+	case r.Method == http.MethodGet, r.Method == http.MethodHead:
+		obj, ok := bucket[key]
+		if !ok {
+			writeS3Error(w, r, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		w.Header().Set("ETag", obj.etag())
+		w.Header().Set("Content-Type", "application/octet-stream")
+		http.ServeContent(w, r, "", obj.modified, bytes.NewReader(obj.data))
+	case r.Method == http.MethodDelete:
+		delete(bucket, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeS3Error(w, r, http.StatusNotImplemented, "NotImplemented")
+	}
+}
+
+// copySource returns the object named by the X-Amz-Copy-Source header of the copy
+// request, the error is written when it is missing or its ETag does not match
+func (f *fakeS3) copySource(w http.ResponseWriter, r *http.Request) (fakeObject, bool) {
+	source, err := url.PathUnescape(r.Header.Get("X-Amz-Copy-Source"))
+	if err != nil {
+		writeS3Error(w, r, http.StatusBadRequest, "InvalidArgument")
+		return fakeObject{}, false
+	}
+	srcBucket, srcKey, _ := strings.Cut(strings.TrimPrefix(source, "/"), "/")
+	src, ok := f.buckets[srcBucket][srcKey]
+	if !ok {
+		writeS3Error(w, r, http.StatusNotFound, "NoSuchKey")
+		return fakeObject{}, false
+	}
+	if etag := r.Header.Get("X-Amz-Copy-Source-If-Match"); etag != "" && strings.Trim(etag, `"`) != strings.Trim(src.etag(), `"`) {
+		writeS3Error(w, r, http.StatusPreconditionFailed, "PreconditionFailed")
+		return fakeObject{}, false
+	}
+	return src, true
+}
+
+// list implements ListObjectsV2, the continuation token is the last returned key or prefix
+func (f *fakeS3) list(w http.ResponseWriter, bucket map[string]fakeObject, query url.Values) {
+	prefix, delimiter := query.Get("prefix"), query.Get("delimiter")
+	maxKeys := 1000
+	if n, err := strconv.Atoi(query.Get("max-keys")); err == nil && n > 0 {
+		maxKeys = n
+	}
+	after := query.Get("continuation-token")
+	if after == "" {
+		after = query.Get("start-after")
+	}
+	keys := make([]string, 0, len(bucket))
+	for key := range bucket {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	type content struct {
+		Key          string
+		LastModified string
+		ETag         string
+		Size         int64
+		StorageClass string
+	}
+	type commonPrefix struct {
+		Prefix string
+	}
+	var res struct {
+		XMLName               xml.Name `xml:"ListBucketResult"`
+		Prefix                string
+		Delimiter             string
+		MaxKeys               int
+		KeyCount              int
+		IsTruncated           bool
+		NextContinuationToken string         `xml:",omitempty"`
+		Contents              []content      `xml:"Contents"`
+		CommonPrefixes        []commonPrefix `xml:"CommonPrefixes"`
+	}
+	res.Prefix, res.Delimiter, res.MaxKeys = prefix, delimiter, maxKeys
+	last := ""
+	for _, key := range keys {
+		entry := key
+		if delimiter != "" {
+			if i := strings.Index(key[len(prefix):], delimiter); i >= 0 {
+				entry = key[:len(prefix)+i+len(delimiter)]
+			}
+		}
+		if entry <= after || entry == last {
+			continue
+		}
+		if res.KeyCount == maxKeys {
+			res.IsTruncated = true
+			res.NextContinuationToken = last
+			break
+		}
+		last = entry
+		res.KeyCount++
+		if entry != key {
+			res.CommonPrefixes = append(res.CommonPrefixes, commonPrefix{entry})
+			continue
+		}
+		obj := bucket[key]
+		res.Contents = append(res.Contents, content{
+			Key:          key,
+			LastModified: obj.modified.UTC().Format(time.RFC3339Nano),
+			ETag:         obj.etag(),
+			Size:         int64(len(obj.data)),
+			StorageClass: "STANDARD",
+		})
+	}
+	writeXML(w, res)
+}
+
+func writeXML(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(v)
+}
+
+// writeS3Error writes the error the way S3 does, responses to HEAD requests have no body
+func writeS3Error(w http.ResponseWriter, r *http.Request, status int, code string) {
+	if r.Method == http.MethodHead {
+		w.WriteHeader(status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	xml.NewEncoder(w).Encode(struct {
+		XMLName  xml.Name `xml:"Error"`
+		Code     string
+		Message  string
+		Resource string
+	}{Code: code, Message: code, Resource: r.URL.Path})
+}
+
+// objects returns the sorted keys of the bucket
+func (f *fakeS3) objects(bucketName string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var res []string
+	for key := range f.buckets[bucketName] {
+		res = append(res, key)
+	}
+	sort.Strings(res)
+	return res
+}
@@ -0,0 +1,232 @@
+package storagesvc
+
+import (
+	"context"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"remote-storage/server/common"
+	"remote-storage/server/db"
+	fs "remote-storage/server/storagesvc/repository/filesystem"
+)
+
+const (
+	defaultSearchLimit = 100
+	maxSearchLimit     = 1000
+	// maxIndexedContent is the size of the beginning of text files searched by content
+	maxIndexedContent = 64 << 10
+)
+
+// SearchOptions describes the search of the files in the directory and in the nested directories
+type SearchOptions struct {
+	// DirPath is the path to the searched directory, the root directory by default
+	DirPath string `json:"dir_path,omitempty"`
+	// Glob filters files by their names, see path.Match for the syntax
+	Glob string `json:"glob,omitempty"`
+	// Ext filters files by the extension of their names, case insensitive, with or without the dot
+	Ext string `json:"ext,omitempty"`
+	// MinSize and MaxSize limit the size of files in bytes, 0 means no limit
+	MinSize int64 `json:"min_size,omitempty"`
+	MaxSize int64 `json:"max_size,omitempty"`
+	// ModifiedAfter and ModifiedBefore limit the modification time of files, both are inclusive
+	ModifiedAfter  time.Time `json:"modified_after,omitempty"`
+	ModifiedBefore time.Time `json:"modified_before,omitempty"`
+	// Content is the case insensitive text the beginning of text files must contain
+	Content string `json:"content,omitempty"`
+	// Type filters files by their type
+	Type ListType `json:"type,omitempty"`
+	// Limit is the maximal amount of found files
+	Limit int `json:"limit,omitempty"`
+}
+
+// SearchResult is the list of files found in the searched directory ordered by path
+type SearchResult struct {
+	// Entries have paths relative to the searched directory
+	Entries []ListEntry `json:"entries"`
+	// Truncated is set if more files than the limit are found
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// validateSearchOptions checks the options and fills in the defaults
+func validateSearchOptions(options SearchOptions) (SearchOptions, error) {
+	switch options.Type {
+	case ListTypeAll, ListTypeFiles, ListTypeDirs:
+	default:
+		return options, ErrInvalidArgument
+	}
+	if options.Glob != "" {
+		if _, err := path.Match(options.Glob, ""); err != nil {
+			return options, ErrInvalidArgument
+		}
+	}
+	if options.Ext != "" && !strings.HasPrefix(options.Ext, ".") {
+		options.Ext = "." + options.Ext
+	}
+	options.Ext = strings.ToLower(options.Ext)
+	options.Content = strings.ToLower(options.Content)
+	if options.MinSize < 0 || options.MaxSize < 0 || options.MaxSize > 0 && options.MinSize > options.MaxSize {
+		return options, ErrInvalidArgument
+	}
+	if !options.ModifiedBefore.IsZero() && options.ModifiedAfter.After(options.ModifiedBefore) {
+		return options, ErrInvalidArgument
+	}
+	switch {
+	case options.Limit < 0:
+		return options, ErrInvalidArgument
+	case options.Limit == 0:
+		options.Limit = defaultSearchLimit
+	case options.Limit > maxSearchLimit:
+		options.Limit = maxSearchLimit
+	}
+	return options, nil
+}
+
+// Search returns the files of the directory and of the nested directories matching the options.
+// Files are found in the search index kept by the methods changing files, so files changed
+// bypassing the service are found after the index is rebuilt.
+func (svc *service) Search(ctx context.Context, options SearchOptions) (SearchResult, error) {
+	res := SearchResult{Entries: []ListEntry{}}
+	options, err := validateSearchOptions(options)
+	if err != nil {
+		return res, err
+	}
+	dirPath, dir, err := svc.resolveDir(ctx, options.DirPath)
+	if err != nil {
+		return res, err
+	}
+	info, err := svc.backend.Stat(dirPath)
+	if err != nil {
+		return res, getErrorType(err)
+	}
+	if !info.IsDir {
+		return res, ErrInvalidArgument
+	}
+	found, err := svc.database.SearchIndex(db.IndexQuery{
+		User:           getUserInfFromCtx(ctx).Name,
+		PathPrefix:     dir,
+		Ext:            options.Ext,
+		MinSize:        options.MinSize,
+		MaxSize:        options.MaxSize,
+		ModifiedAfter:  options.ModifiedAfter,
+		ModifiedBefore: options.ModifiedBefore,
+		Content:        options.Content,
+	})
+	if err != nil {
+		return res, err
+	}
+	filter := ListOptions{Type: options.Type, Glob: options.Glob}
+	for _, indexed := range found {
+		entry := ListEntry{
+			Path: strings.TrimPrefix(strings.TrimPrefix(indexed.Path, dir), "/"),
+			FileInfo: fs.FileInfo{
+				Name:     indexed.Name,
+				IsDir:    indexed.IsDir,
+				Size:     indexed.Size,
+				Modified: indexed.Modified,
+			},
+		}
+		if !filter.matches(entry) {
+			continue
+		}
+		if len(res.Entries) == options.Limit {
+			res.Truncated = true
+			break
+		}
+		res.Entries = append(res.Entries, entry)
+	}
+	return res, nil
+}
+
+// RebuildIndex replaces the search index of the user with the files of the root directory
+// of the user and returns the amount of indexed files
+func (svc *service) RebuildIndex(ctx context.Context) (int, error) {
+	userInf := getUserInfFromCtx(ctx)
+	tree, err := svc.backend.TraverseDirectory(strings.TrimRight(userInf.RootDir, "/"))
+	if err != nil {
+		return 0, getErrorType(err)
+	}
+	if err := svc.database.DeleteIndexEntries(userInf.Name, ""); err != nil {
+		return 0, err
+	}
+	var entries []db.IndexEntry
+	for _, child := range tree.Children {
+		svc.collectIndexEntries(userInf, joinPath(userInf.RootDir, child.Name), child, &entries)
+	}
+	if err := svc.database.PutIndexEntries(entries); err != nil {
+		return 0, err
+	}
+	return len(entries), nil
+}
+
+// RebuildIndexes rebuilds the search indexes of the users, it is used
+// for indexing the files stored before the index is introduced
+func RebuildIndexes(ctx context.Context, s Service, users []common.UserInf) (int, error) {
+	total := 0
+	for _, userInf := range users {
+		n, err := s.RebuildIndex(putUserInfInCtx(ctx, userInf))
+		if err != nil {
+			return total, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// collectIndexEntries appends the entries of the file at filePath and of the nested files
+func (svc *service) collectIndexEntries(userInf common.UserInf, filePath string, info fs.FileInfo, res *[]db.IndexEntry) {
+	entry := db.IndexEntry{
+		User:     userInf.Name,
+		Path:     relativePath(userInf.RootDir, filePath),
+		Name:     info.Name,
+		Ext:      strings.ToLower(path.Ext(info.Name)),
+		IsDir:    info.IsDir,
+		Size:     info.Size,
+		Modified: info.Modified,
+	}
+	if !info.IsDir {
+		entry.Content = svc.indexedContent(filePath)
+	}
+	*res = append(*res, entry)
+	for _, child := range info.Children {
+		svc.collectIndexEntries(userInf, joinPath(filePath, child.Name), child, res)
+	}
+}
+
+// indexedContent returns the beginning of the text file in lower case, empty for other files
+func (svc *service) indexedContent(filePath string) string {
+	f, err := svc.backend.OpenFile(filePath)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, maxIndexedContent))
+	if err != nil || !isText(data) {
+		return ""
+	}
+	content := strings.ToValidUTF8(string(data), "")
+	return strings.ToLower(strings.ReplaceAll(content, "\x00", ""))
+}
+
+// indexFile replaces the entries of the file at filePath and of the nested files in the search index.
+// Failing to update the index doesn't fail the change which is already done, RebuildIndex repairs it.
+func (svc *service) indexFile(ctx context.Context, filePath string) {
+	userInf := getUserInfFromCtx(ctx)
+	info, err := svc.backend.Stat(filePath)
+	if err != nil {
+		return
+	}
+	if info.IsDir {
+		info, err = svc.backend.TraverseDirectory(filePath)
+		if err != nil {
+			return
+		}
+	}
+	var entries []db.IndexEntry
+	svc.collectIndexEntries(userInf, filePath, info, &entries)
+	if err := svc.database.DeleteIndexEntries(userInf.Name, relativePath(userInf.RootDir, filePath)); err != nil {
+		return
+	}
+	svc.database.PutIndexEntries(entries)
+}
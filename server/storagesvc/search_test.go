@@ -0,0 +1,45 @@
+package storagesvc
+
+import "testing"
+
+// searchPaths returns the paths of the files found by the search
+func searchPaths(t *testing.T, svc *service, options SearchOptions) []string {
+	t.Helper()
+	res, err := svc.Search(userContext("alice"), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, entry := range res.Entries {
+		paths = append(paths, entry.Path)
+	}
+	return paths
+}
+
+func TestSearchFindsRenamedFilesByNewExtension(t *testing.T) {
+	svc := newTestService(t)
+	ctx := userContext("alice")
+	if _, err := svc.MkDir(ctx, "", "docs", ConflictFail); err != nil {
+		t.Fatal(err)
+	}
+	upload(t, svc, "alice", "docs", "notes.txt", "notes")
+	if _, err := svc.Rename(ctx, "docs", "notes.txt", "notes.md", ConflictFail); err != nil {
+		t.Fatal(err)
+	}
+	if paths := searchPaths(t, svc, SearchOptions{Ext: "md"}); len(paths) != 1 || paths[0] != "docs/notes.md" {
+		t.Fatalf("found by the new extension %v", paths)
+	}
+	if paths := searchPaths(t, svc, SearchOptions{Ext: "txt"}); len(paths) != 0 {
+		t.Fatalf("found by the old extension %v", paths)
+	}
+
+	if _, err := svc.Rename(ctx, "", "docs", "archive.old", ConflictFail); err != nil {
+		t.Fatal(err)
+	}
+	if paths := searchPaths(t, svc, SearchOptions{Ext: "old"}); len(paths) != 1 || paths[0] != "archive.old" {
+		t.Fatalf("found the moved directory %v", paths)
+	}
+	if paths := searchPaths(t, svc, SearchOptions{Ext: "md"}); len(paths) != 1 || paths[0] != "archive.old/notes.md" {
+		t.Fatalf("found the nested file %v", paths)
+	}
+}
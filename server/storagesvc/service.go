@@ -6,21 +6,69 @@ import (
 	"github.com/go-kit/kit/log"
 	"io"
 	"os"
+	"path"
 	"remote-storage/server/authsvc"
 	"remote-storage/server/authsvc/client"
+	"remote-storage/server/db"
 	fs "remote-storage/server/storagesvc/repository/filesystem"
+	"strings"
+	"time"
 )
 
 // Service interface contains methods for managing local file system
 type Service interface {
 	GetState(ctx context.Context) (fs.FileInfo, error)
-	MkDir(ctx context.Context, dir, path string) (string, error)
-	Rename(ctx context.Context, dirPath, oldName, newName string) (string, error)
-	Move(ctx context.Context, srcDirPath, fileName, destDirPath string) (string, error)
+	List(ctx context.Context, options ListOptions) (ListPage, error)
+	MkDir(ctx context.Context, dir, path string, conflict ConflictPolicy) (Result, error)
+	Rename(ctx context.Context, dirPath, oldName, newName string, conflict ConflictPolicy) (Result, error)
+	Move(ctx context.Context, srcDirPath, fileName, destDirPath string, conflict ConflictPolicy) (Result, error)
 	Delete(ctx context.Context, dirPath, fileName string) (string, error)
-	Copy(ctx context.Context, srcDirPath, fileName, destDirPath string) (string, error)
-	Download(ctx context.Context, dirPath, fileName string) (io.ReadCloser, error)
-	Upload(ctx context.Context, dirPath, fileName string, contents io.ReadCloser) error
+	Copy(ctx context.Context, srcDirPath, fileName, destDirPath string, conflict ConflictPolicy) (Result, error)
+	Batch(ctx context.Context, operations []BatchOperation, stopOnError bool) ([]BatchResult, error)
+	Extract(ctx context.Context, dirPath, fileName, destDirPath string, conflict ConflictPolicy) ([]Result, error)
+	Download(ctx context.Context, dirPath, fileName string) (io.ReadCloser, fs.FileInfo, error)
+	DownloadArchive(ctx context.Context, dirPath string, fileNames []string, format ArchiveFormat) (io.ReadCloser, fs.FileInfo, error)
+	Upload(ctx context.Context, dirPath, fileName string, contents io.ReadCloser, checksum Checksum, conflict ConflictPolicy) (Result, error)
+	CreateUploadSession(ctx context.Context, dirPath, fileName string, size int64, checksum Checksum, conflict ConflictPolicy) (UploadSession, error)
+	GetUploadSession(ctx context.Context, id string) (UploadSession, error)
+	UploadChunk(ctx context.Context, id string, offset int64, contents io.ReadCloser) (UploadSession, error)
+	FinalizeUploadSession(ctx context.Context, id string) (Result, error)
+	ListVersions(ctx context.Context, dirPath, fileName string) ([]FileVersion, error)
+	DownloadVersion(ctx context.Context, dirPath, fileName, versionID string) (io.ReadCloser, fs.FileInfo, error)
+	RestoreVersion(ctx context.Context, dirPath, fileName, versionID string) (string, error)
+	PruneVersions(ctx context.Context, keep int, maxAge time.Duration) (int, error)
+	ListTrash(ctx context.Context) ([]TrashItem, error)
+	RestoreFromTrash(ctx context.Context, id string, conflict ConflictPolicy) (Result, error)
+	EmptyTrash(ctx context.Context) (int, error)
+	GetUsage(ctx context.Context) (Usage, error)
+	SetQuota(ctx context.Context, user string, quota int64) error
+	GetChanges(ctx context.Context, since string) (Changes, error)
+	Watch(ctx context.Context, since string) (<-chan Changes, error)
+	CreateShareLink(ctx context.Context, options ShareLinkOptions) (ShareLink, error)
+	ListShareLinks(ctx context.Context) ([]ShareLink, error)
+	DeleteShareLink(ctx context.Context, token string) error
+	// GetShared, DownloadShared and UploadShared are used by holders of share links without authentication
+	GetShared(ctx context.Context, token, password string, options ListOptions) (SharedItem, error)
+	DownloadShared(ctx context.Context, token, password, filePath string, format ArchiveFormat) (io.ReadCloser, fs.FileInfo, error)
+	UploadShared(ctx context.Context, token, password, dirPath, fileName string, contents io.ReadCloser) (Result, error)
+	GrantAccess(ctx context.Context, options GrantOptions) (Grant, error)
+	ListGrants(ctx context.Context) ([]Grant, error)
+	RevokeAccess(ctx context.Context, id int64) error
+	ListACL(ctx context.Context) ([]ACLEntry, error)
+	AddACLEntry(ctx context.Context, entry ACLEntry) (ACLEntry, error)
+	DeleteACLEntry(ctx context.Context, id int64) error
+	ListGroupMembers(ctx context.Context) ([]GroupMember, error)
+	AddGroupMember(ctx context.Context, member GroupMember) error
+	RemoveGroupMember(ctx context.Context, member GroupMember) error
+	ListUploadTypeRules(ctx context.Context) ([]UploadTypeRule, error)
+	AddUploadTypeRule(ctx context.Context, rule UploadTypeRule) (UploadTypeRule, error)
+	DeleteUploadTypeRule(ctx context.Context, id int64) error
+	Search(ctx context.Context, options SearchOptions) (SearchResult, error)
+	RebuildIndex(ctx context.Context) (int, error)
+	GetMetadata(ctx context.Context, dirPath, fileName string) (Metadata, error)
+	SetMetadata(ctx context.Context, dirPath, fileName string, metadata Metadata, replace bool) (Metadata, error)
+	DeleteMetadata(ctx context.Context, dirPath, fileName string, keys, tags []string) (Metadata, error)
+	Preview(ctx context.Context, dirPath, fileName string, size int) (io.ReadCloser, fs.FileInfo, error)
 	getAuthSvc() authsvc.Service
 }
 
@@ -29,15 +77,66 @@ var (
 	ErrAlreadyExists = errors.New("already exists")
 	ErrNotFound      = errors.New("not found")
 	ErrAuthFailed    = errors.New("authentication failed")
+
+	ErrInvalidArgument  = errors.New("invalid argument")
+	ErrOffsetMismatch   = errors.New("offset mismatch")
+	ErrUploadIncomplete = errors.New("upload incomplete")
+	ErrQuotaExceeded    = errors.New("quota exceeded")
+	ErrPathEscape       = errors.New("path escapes the root directory")
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+	ErrUploadInProgress = errors.New("upload in progress")
+	ErrShareExpired     = errors.New("share link expired")
+	ErrForbidden        = errors.New("forbidden")
+	ErrTypeNotAllowed   = errors.New("file type not allowed")
+	ErrTooManyUploads   = errors.New("too many upload sessions")
+	ErrTooManyEntries   = errors.New("too many entries to list")
 )
 
 type Config struct {
+	// RootDir is used for creating local file system backend
+	// if Backend is not specified
 	RootDir             string
+	Backend             fs.Backend
 	ConsulServerAddress string
+	// UploadSessionDir is the local directory keeping resumable upload sessions
+	UploadSessionDir string
+	// UploadSessionTTL is the time after which an unused upload session expires
+	UploadSessionTTL time.Duration
+	// StagingDir is the directory of the backend keeping uploads until they are complete
+	StagingDir string
+	// ConcurrentUploads is the policy applied to uploads to the path another upload is in progress to,
+	// UploadLastWriterWins by default
+	ConcurrentUploads UploadPolicy
+	// AttributesDir is the directory of the backend keeping attributes of files such as checksums
+	AttributesDir string
+	// VersionsDir is the directory of the backend keeping previous versions of overwritten files
+	VersionsDir string
+	// PreviewsDir is the directory of the backend keeping cached previews of files
+	PreviewsDir string
+	// TrashDir is the directory of the backend keeping deleted files
+	TrashDir string
+	// TrashRetention is the time after which deleted files are removed permanently
+	TrashRetention time.Duration
+	// Database keeps the change journal, share links and grants, they are kept in memory if Database is not specified
+	Database db.StorageDatabase
+	// ChangesRetention is the time after which recorded changes are removed from the journal
+	ChangesRetention time.Duration
+	// Admins are the users allowed to manage access control lists and upload type rules
+	Admins []string
 }
 
 type service struct {
-	authSvc authsvc.Service
+	authSvc  authsvc.Service
+	backend  fs.Backend
+	uploads  *uploadSessionStore
+	versions *versionStore
+	previews *previewStore
+	trash    *trashStore
+	usage    *usageTracker
+	changes  *changeJournal
+	staging  *stagingArea
+	database db.StorageDatabase
+	admins   map[string]bool
 }
 
 func NewFileSystemService(logger log.Logger, config Config) Service {
@@ -46,126 +145,360 @@ func NewFileSystemService(logger log.Logger, config Config) Service {
 	if err != nil {
 		logger.Log("Error:", "cannot create authentication service client")
 	}
-	fs.InitializeFileSystem(fs.ConfigFileSystem{
-		RootDir: config.RootDir,
+	backend := config.Backend
+	if backend == nil {
+		backend = fs.NewLocalBackend(fs.ConfigFileSystem{
+			RootDir: config.RootDir,
+		})
+	}
+	backend = fs.NewAttributeBackend(backend, fs.ConfigAttributes{
+		Dir: config.AttributesDir,
 	})
-	return &service{
-		authSvc: authSvc,
+	uploads, err := newUploadSessionStore(config.UploadSessionDir, config.UploadSessionTTL)
+	if err != nil {
+		logger.Log("Error:", "cannot create upload sessions directory", "err", err)
+	}
+	trash := newTrashStore(backend, config.TrashDir, config.TrashRetention)
+	go trash.runJanitor(context.Background())
+	database := config.Database
+	if database == nil {
+		logger.Log("Warning:", "no database specified, the change journal, share links, grants and the search index are kept in memory")
+		database = db.NewStorageDatabaseMemory()
+	}
+	changes := newChangeJournal(database, logger, config.ChangesRetention)
+	go changes.runJanitor(context.Background())
+	policy, err := parseUploadPolicy(string(config.ConcurrentUploads))
+	if err != nil {
+		logger.Log("Warning:", "unknown concurrent uploads policy, last-writer-wins is used", "policy", config.ConcurrentUploads)
+		policy = UploadLastWriterWins
 	}
+	staging := newStagingArea(backend, config.StagingDir, policy)
+	go staging.runJanitor(context.Background())
+	admins := make(map[string]bool)
+	for _, name := range config.Admins {
+		admins[name] = true
+	}
+	versions := newVersionStore(backend, config.VersionsDir)
+	svc := &service{
+		authSvc:  authSvc,
+		backend:  backend,
+		uploads:  uploads,
+		versions: versions,
+		previews: newPreviewStore(backend, config.PreviewsDir),
+		trash:    trash,
+		usage:    newUsageTracker(backend, trash, uploads, versions),
+		changes:  changes,
+		staging:  staging,
+		database: database,
+		admins:   admins,
+	}
+	uploads.expired = func(rec uploadSessionRecord) {
+		svc.usage.add(rec.UserRootDir, -rec.Size)
+	}
+	go uploads.runJanitor(context.Background())
+	return SharingMiddleware(database, backend)(svc)
 }
 
 func (svc *service) getAuthSvc() authsvc.Service {
 	return svc.authSvc
 }
 func (svc *service) GetState(ctx context.Context) (fs.FileInfo, error) {
-	userRootDir := ctx.Value(ctxUserInfKey{}).(string)
-	res, err := fs.TraverseDirectory(userRootDir)
+	userRootDir := getUserInfFromCtx(ctx).RootDir
+	res, err := svc.backend.TraverseDirectory(userRootDir)
 	if err != nil {
 		err = getErrorType(err)
 	}
 	return res, err
 }
 
-func (svc *service) MkDir(ctx context.Context, path string, dir string) (string, error) {
-	var err error
-	var newDirPath string
-	userRootDir := ctx.Value(ctxUserInfKey{}).(string)
-	newDirPath = userRootDir + path + dir
+// MkDir creates the directory, conflict defines what happens if something exists at its path,
+// ConflictSkip keeps the existing directory
+func (svc *service) MkDir(ctx context.Context, path string, dir string, conflict ConflictPolicy) (Result, error) {
+	var res Result
+	conflict, err := parseConflictPolicy(string(conflict))
+	if err != nil {
+		return res, err
+	}
+	newDirPath, err := svc.resolvePath(ctx, path, dir)
+	if err != nil {
+		return res, err
+	}
 
-	err = fs.Mkdir(newDirPath, 0644)
+	res.Path, res.Action, err = svc.resolveConflict(ctx, "", newDirPath, true, conflict)
 	if err != nil {
-		err = getErrorType(err)
+		return res, err
+	}
+	if res.Action == ActionSkipped || res.Action == ActionMerged {
+		// there is nothing to merge into the existing directory
+		res.Action = ActionSkipped
+		return res, nil
 	}
+	err = svc.backend.Mkdir(res.Path, 0644)
+	if err != nil {
+		return res, getErrorType(err)
+	}
+	svc.recordChange(ctx, ChangeCreated, res.Path, "")
 
-	return newDirPath, err
+	return res, nil
 }
 
-func (svc *service) Rename(ctx context.Context, dirPath, oldName, newName string) (string, error) {
-	var err error
-	userRootDir := ctx.Value(ctxUserInfKey{}).(string)
-	var oldFilePath = userRootDir + dirPath + oldName
-	var newFilePath = userRootDir + dirPath + newName
-
-	err = fs.Rename(oldFilePath, newFilePath)
+// Rename renames the file in its directory, conflict defines what happens if the new name is taken
+func (svc *service) Rename(ctx context.Context, dirPath, oldName, newName string, conflict ConflictPolicy) (Result, error) {
+	oldFilePath, err := svc.resolvePath(ctx, dirPath, oldName)
 	if err != nil {
-		err = getErrorType(err)
+		return Result{}, err
 	}
-
-	return newFilePath, err
+	newFilePath, err := svc.resolvePath(ctx, dirPath, newName)
+	if err != nil {
+		return Result{}, err
+	}
+	return svc.move(ctx, oldFilePath, newFilePath, conflict)
 }
 
-func (svc *service) Move(ctx context.Context, srcDirPath, fileName, destDirPath string) (string, error) {
-	var err error
-	userRootDir := ctx.Value(ctxUserInfKey{}).(string)
-	var oldFilePath = userRootDir + srcDirPath + fileName
-	var newFilePath = userRootDir + destDirPath + fileName
+// Move moves the file into another directory, conflict defines what happens
+// if the destination directory has the file with the same name
+func (svc *service) Move(ctx context.Context, srcDirPath, fileName, destDirPath string, conflict ConflictPolicy) (Result, error) {
+	oldFilePath, err := svc.resolvePath(ctx, srcDirPath, fileName)
+	if err != nil {
+		return Result{}, err
+	}
+	newFilePath, err := svc.resolvePath(ctx, destDirPath, fileName)
+	if err != nil {
+		return Result{}, err
+	}
+	return svc.move(ctx, oldFilePath, newFilePath, conflict)
+}
 
-	err = fs.Move(oldFilePath, newFilePath)
+// move implements Rename and Move
+func (svc *service) move(ctx context.Context, oldFilePath, newFilePath string, conflict ConflictPolicy) (Result, error) {
+	res := Result{Path: newFilePath}
+	conflict, err := parseConflictPolicy(string(conflict))
 	if err != nil {
-		err = getErrorType(err)
+		return res, err
+	}
+	if isNested(oldFilePath, newFilePath) {
+		return res, ErrInvalidArgument
+	}
+	src, err := svc.backend.Stat(oldFilePath)
+	if err != nil {
+		return res, getErrorType(err)
+	}
+	if oldFilePath == newFilePath {
+		res.Action = ActionSkipped
+		return res, nil
 	}
 
-	return newFilePath, err
+	res.Path, res.Action, err = svc.resolveConflict(ctx, oldFilePath, newFilePath, src.IsDir, conflict)
+	if err != nil || res.Action == ActionSkipped {
+		return res, err
+	}
+	if res.Action == ActionMerged {
+		res.Skipped, err = svc.merge(ctx, oldFilePath, res.Path, true)
+	} else {
+		err = svc.backend.Rename(oldFilePath, res.Path)
+		if err == nil {
+			svc.recordChange(ctx, ChangeMoved, res.Path, oldFilePath)
+			svc.moveGrants(ctx, oldFilePath, res.Path)
+			svc.moveVersions(oldFilePath, res.Path)
+		}
+	}
+	// the replaced files are kept as versions or in the trash, so the usage doesn't change
+	if err != nil {
+		return res, getErrorType(err)
+	}
+	return res, nil
 }
 
+// Delete moves the file into the trash of the user, see RestoreFromTrash
 func (svc *service) Delete(ctx context.Context, dirPath, fileName string) (string, error) {
 	var err error
-	userRootDir := ctx.Value(ctxUserInfKey{}).(string)
-	var filePath = userRootDir + dirPath + fileName
+	userRootDir := getUserInfFromCtx(ctx).RootDir
+	filePath, err := svc.resolvePath(ctx, dirPath, fileName)
+	if err != nil {
+		return "", err
+	}
+	dir, err := cleanDirPath(dirPath)
+	if err != nil {
+		return "", err
+	}
 
-	err = fs.RemoveAll(filePath)
+	item, err := svc.trash.put(userRootDir, dir, fileName)
 	if err != nil {
-		err = getErrorType(err)
+		return filePath, getErrorType(err)
 	}
+	svc.recordDeletion(ctx, filePath, item.IsDir)
 
-	return filePath, err
+	return filePath, nil
 }
 
-func (svc *service) Copy(ctx context.Context, srcDirPath, fileName, destDirPath string) (string, error) {
-	var err error
-	userRootDir := ctx.Value(ctxUserInfKey{}).(string)
-	var oldFilePath = userRootDir + srcDirPath + fileName
-	var newFilePath = userRootDir + destDirPath + fileName
-
-	err = fs.Copy(oldFilePath, newFilePath)
+// Copy fails with ErrQuotaExceeded if the copied files don't fit the quota of the user,
+// conflict defines what happens if the destination directory has the file with the same name
+func (svc *service) Copy(ctx context.Context, srcDirPath, fileName, destDirPath string, conflict ConflictPolicy) (Result, error) {
+	var res Result
+	userInf := getUserInfFromCtx(ctx)
+	userRootDir := userInf.RootDir
+	conflict, err := parseConflictPolicy(string(conflict))
 	if err != nil {
-		err = getErrorType(err)
+		return res, err
+	}
+	oldFilePath, err := svc.resolvePath(ctx, srcDirPath, fileName)
+	if err != nil {
+		return res, err
+	}
+	newFilePath, err := svc.resolvePath(ctx, destDirPath, fileName)
+	if err != nil {
+		return res, err
+	}
+	res.Path = newFilePath
+	if isNested(oldFilePath, newFilePath) {
+		return res, ErrInvalidArgument
 	}
 
-	return newFilePath, err
+	src, err := svc.backend.Stat(oldFilePath)
+	if err != nil {
+		return res, getErrorType(err)
+	}
+	size, err := svc.sizeOf(oldFilePath)
+	if err != nil {
+		return res, getErrorType(err)
+	}
+	quota, err := svc.quotaOf(ctx)
+	if err != nil {
+		return res, err
+	}
+	err = svc.usage.check(userRootDir, quota, size)
+	if err != nil {
+		return res, getErrorType(err)
+	}
+	res.Path, res.Action, err = svc.resolveConflict(ctx, oldFilePath, newFilePath, src.IsDir, conflict)
+	if err != nil || res.Action == ActionSkipped {
+		return res, err
+	}
+	existed, err := exists(svc.backend, res.Path)
+	if err != nil {
+		return res, getErrorType(err)
+	}
+	// the replaced files are kept as versions or in the trash, so all copied files are added to the usage,
+	// merging adds the files missing in the destination
+	var before int64
+	if res.Action == ActionMerged {
+		if before, err = svc.sizeOf(res.Path); err != nil {
+			return res, getErrorType(err)
+		}
+		res.Skipped, err = svc.merge(ctx, oldFilePath, res.Path, false)
+	} else {
+		err = svc.backend.Copy(oldFilePath, res.Path)
+		if err == nil && existed {
+			svc.recordChange(ctx, ChangeModified, res.Path, "")
+		} else if err == nil {
+			svc.recordChange(ctx, ChangeCreated, res.Path, "")
+		}
+	}
+	if after, sizeErr := svc.sizeOf(res.Path); sizeErr == nil {
+		svc.usage.add(userRootDir, after-before)
+	}
+	if err != nil {
+		return res, getErrorType(err)
+	}
+	return res, nil
 }
 
-func (svc *service) Download(ctx context.Context, dirPath, fileName string) (io.ReadCloser, error) {
-	var err error
-	userRootDir := ctx.Value(ctxUserInfKey{}).(string)
-	var filePath = userRootDir + dirPath + fileName
+// Download opens the file for reading, the returned reader is also an io.Seeker,
+// so the transport is able to serve byte ranges of the file
+func (svc *service) Download(ctx context.Context, dirPath, fileName string) (io.ReadCloser, fs.FileInfo, error) {
+	filePath, err := svc.resolvePath(ctx, dirPath, fileName)
+	if err != nil {
+		return nil, fs.FileInfo{}, err
+	}
 
-	file, err := fs.OpenFile(filePath)
+	info, err := svc.backend.Stat(filePath)
 	if err != nil {
-		err = getErrorType(err)
+		return nil, info, getErrorType(err)
+	}
+	if info.IsDir {
+		return nil, info, ErrInvalidArgument
+	}
+	file, err := svc.backend.OpenFile(filePath)
+	if err != nil {
+		return nil, info, getErrorType(err)
 	}
 
-	return file, err
+	return file, info, nil
 }
 
-func (svc *service) Upload(ctx context.Context, dirPath, fileName string, contents io.ReadCloser) error {
+// Upload writes contents into the file and reports where the file is stored.
+// Contents are written into the staging area first, the quota of the user and the checksum
+// are checked there, and the complete file is renamed into place, so the partially written
+// file is never visible. Conflict defines what happens if the file exists, the file is
+// overwritten by default. The path differs from the requested one if the upload is renamed
+// because of the existing file or another upload to the same path.
+func (svc *service) Upload(ctx context.Context, dirPath, fileName string, contents io.ReadCloser, checksum Checksum, conflict ConflictPolicy) (Result, error) {
+	defer contents.Close()
+	var res Result
+	if conflict == "" {
+		conflict = ConflictOverwrite
+	}
+	conflict, err := parseConflictPolicy(string(conflict))
+	if err != nil {
+		return res, err
+	}
+	filePath, err := svc.resolvePath(ctx, dirPath, fileName)
+	if err != nil {
+		return res, err
+	}
+	if err := checksum.validate(); err != nil {
+		return res, err
+	}
+	return svc.store(ctx, filePath, contents, checksum, conflict)
+}
+
+// store writes contents into the file filePath through the staging area,
+// conflict defines what happens if the file exists
+func (svc *service) store(ctx context.Context, filePath string, contents io.Reader, checksum Checksum, conflict ConflictPolicy) (Result, error) {
+	var res Result
 	var err error
-	userRootDir := ctx.Value(ctxUserInfKey{}).(string)
-	var filePath = userRootDir + dirPath + fileName
+	if conflict == ConflictFail || conflict == ConflictSkip {
+		// contents are not read if they are not going to be stored anyway
+		res.Path, res.Action, err = svc.resolveConflict(ctx, "", filePath, false, conflict)
+		if err != nil || res.Action == ActionSkipped {
+			return res, err
+		}
+	}
 
-	file, err := fs.Create(filePath)
+	stagePath, end, err := svc.staging.begin(filePath)
 	if err != nil {
-		return getErrorType(err)
+		return res, err
 	}
-	_, err = io.Copy(file, contents)
+	defer end()
+	stagedPath, w, err := svc.stage(ctx, path.Base(filePath), contents, checksum)
 	if err != nil {
-		return getErrorType(err)
+		if err == ErrChecksumMismatch {
+			return res, err
+		}
+		return res, getErrorType(err)
+	}
+	res, err = svc.commit(ctx, stagedPath, stagePath, conflict, w)
+	if err == nil && stagePath != filePath && res.Action == ActionCreated {
+		res.Action = ActionRenamed
 	}
-	return nil
+	return res, err
+}
+
+// isNested reports whether the path is nested into the directory dirPath
+func isNested(dirPath, filePath string) bool {
+	return strings.HasPrefix(filePath, dirPath+"/")
 }
 
 func getErrorType(err error) error {
 	switch {
+	case errors.Is(err, ErrQuotaExceeded):
+		err = ErrQuotaExceeded
+	case errors.Is(err, ErrTypeNotAllowed):
+		err = ErrTypeNotAllowed
+	case errors.Is(err, ErrTooManyEntries):
+		err = ErrTooManyEntries
+	case errors.Is(err, fs.ErrOutsideRoot):
+		err = ErrPathEscape
 	case os.IsNotExist(err):
 		err = ErrNotFound
 	case os.IsExist(err):
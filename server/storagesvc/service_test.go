@@ -0,0 +1,69 @@
+package storagesvc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+
+	"remote-storage/server/common"
+	"remote-storage/server/db"
+	fs "remote-storage/server/storagesvc/repository/filesystem"
+)
+
+// newTestService returns the service keeping files in memory with the users alice and bob,
+// the authentication service is not used
+func newTestService(t *testing.T) *service {
+	t.Helper()
+	return newTestServiceOn(t, fs.NewMemoryBackend())
+}
+
+// newTestServiceOn returns the service keeping files in the backend with the users alice and bob
+func newTestServiceOn(t *testing.T, backend fs.Backend) *service {
+	t.Helper()
+	backend = fs.NewAttributeBackend(backend, fs.ConfigAttributes{})
+	database := db.NewStorageDatabaseMemory()
+	for _, name := range []string{"alice", "bob"} {
+		if err := backend.Mkdir(name, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := database.CreateUser(name, "password", name+"/"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	uploads, err := newUploadSessionStore(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trash := newTrashStore(backend, "", 0)
+	versions := newVersionStore(backend, "")
+	svc := &service{
+		backend:  backend,
+		uploads:  uploads,
+		versions: versions,
+		previews: newPreviewStore(backend, ""),
+		trash:    trash,
+		usage:    newUsageTracker(backend, trash, uploads, versions),
+		changes:  newChangeJournal(database, log.NewNopLogger(), 0),
+		staging:  newStagingArea(backend, "", UploadLastWriterWins),
+		database: database,
+		admins:   map[string]bool{},
+	}
+	uploads.expired = func(rec uploadSessionRecord) {
+		svc.usage.add(rec.UserRootDir, -rec.Size)
+	}
+	return svc
+}
+
+// userContext returns the context of the request made by the user
+func userContext(name string) context.Context {
+	return putUserInfInCtx(context.Background(), common.UserInf{Name: name, RootDir: name + "/"})
+}
+
+// setQuota sets the quota of the user in the database of the service
+func setQuota(t *testing.T, svc *service, name string, quota int64) {
+	t.Helper()
+	if err := svc.database.SetQuota(name, quota); err != nil {
+		t.Fatal(err)
+	}
+}
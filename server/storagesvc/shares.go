@@ -0,0 +1,320 @@
+package storagesvc
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"remote-storage/server/common"
+	"remote-storage/server/db"
+	fs "remote-storage/server/storagesvc/repository/filesystem"
+)
+
+// ShareMode defines what the holder of the share link is allowed to do
+type ShareMode string
+
+const (
+	// ShareRead allows listing and downloading the shared file or directory
+	ShareRead ShareMode = "read"
+	// ShareUpload allows uploading files into the shared directory without seeing its contents
+	ShareUpload ShareMode = "upload"
+)
+
+// ShareLinkOptions describe the share link being created
+type ShareLinkOptions struct {
+	// DirPath and FileName are the path to the shared file or directory
+	DirPath  string `json:"dir_path"`
+	FileName string `json:"file_name"`
+	// Mode is read by default, only directories are shared for upload
+	Mode ShareMode `json:"mode,omitempty"`
+	// Password is required to use the link if it is not empty
+	Password string `json:"password,omitempty"`
+	// ExpiresInSec is the lifetime of the link, 0 means the link never expires
+	ExpiresInSec int64 `json:"expires_in_sec,omitempty"`
+	// MaxDownloads is the amount of downloads allowed through the link, 0 means unlimited
+	MaxDownloads int `json:"max_downloads,omitempty"`
+}
+
+// ShareLink gives access to the file or the directory of the user through /s/{token}
+// without authentication
+type ShareLink struct {
+	Token string `json:"token"`
+	// URL is the path of the link on the server
+	URL string `json:"url"`
+	// Path to the shared file relative to the root directory of the user
+	Path         string     `json:"path"`
+	IsDir        bool       `json:"is_dir"`
+	Mode         ShareMode  `json:"mode"`
+	HasPassword  bool       `json:"has_password,omitempty"`
+	Expires      *time.Time `json:"expires,omitempty"`
+	MaxDownloads int        `json:"max_downloads,omitempty"`
+	Downloads    int        `json:"downloads"`
+	Created      time.Time  `json:"created"`
+}
+
+// SharedItem describes the shared file or directory to the holder of the link
+type SharedItem struct {
+	// Name is the name of the shared file or directory
+	Name    string     `json:"name"`
+	IsDir   bool       `json:"is_dir"`
+	Mode    ShareMode  `json:"mode"`
+	Expires *time.Time `json:"expires,omitempty"`
+	// Size is the size of the shared file
+	Size int64 `json:"size,omitempty"`
+	// Listing is the page of the listed directory of the directory shared for reading
+	Listing *ListPage `json:"listing,omitempty"`
+}
+
+func shareLinkFrom(link db.ShareLink) ShareLink {
+	res := ShareLink{
+		Token:        link.Token,
+		URL:          "/s/" + link.Token,
+		Path:         link.Path,
+		IsDir:        link.IsDir,
+		Mode:         ShareMode(link.Mode),
+		HasPassword:  link.HashedPassword != "",
+		MaxDownloads: link.MaxDownloads,
+		Downloads:    link.Downloads,
+		Created:      link.Created,
+	}
+	if !link.Expires.IsZero() {
+		expires := link.Expires
+		res.Expires = &expires
+	}
+	return res
+}
+
+// hashSharePassword hashes the password of the link the way passwords of users are hashed,
+// salted with the token
+func hashSharePassword(token, password string) string {
+	return common.SHA256hashing(token + password)
+}
+
+// CreateShareLink shares the file or the directory of the user
+func (svc *service) CreateShareLink(ctx context.Context, options ShareLinkOptions) (ShareLink, error) {
+	if options.Mode == "" {
+		options.Mode = ShareRead
+	}
+	if options.Mode != ShareRead && options.Mode != ShareUpload {
+		return ShareLink{}, ErrInvalidArgument
+	}
+	if options.ExpiresInSec < 0 || options.MaxDownloads < 0 {
+		return ShareLink{}, ErrInvalidArgument
+	}
+	filePath, err := svc.resolvePath(ctx, options.DirPath, options.FileName)
+	if err != nil {
+		return ShareLink{}, err
+	}
+	info, err := svc.backend.Stat(filePath)
+	if err != nil {
+		return ShareLink{}, getErrorType(err)
+	}
+	if options.Mode == ShareUpload && !info.IsDir {
+		return ShareLink{}, ErrInvalidArgument
+	}
+	token, err := newRandomID()
+	if err != nil {
+		return ShareLink{}, err
+	}
+	userInf := getUserInfFromCtx(ctx)
+	link := db.ShareLink{
+		Token:        token,
+		User:         userInf.Name,
+		Path:         relativePath(userInf.RootDir, filePath),
+		IsDir:        info.IsDir,
+		Mode:         string(options.Mode),
+		MaxDownloads: options.MaxDownloads,
+		Created:      time.Now(),
+	}
+	if options.Password != "" {
+		link.HashedPassword = hashSharePassword(token, options.Password)
+	}
+	if options.ExpiresInSec > 0 {
+		link.Expires = link.Created.Add(time.Duration(options.ExpiresInSec) * time.Second)
+	}
+	if err := svc.database.CreateShareLink(link); err != nil {
+		return ShareLink{}, err
+	}
+	return shareLinkFrom(link), nil
+}
+
+// ListShareLinks returns the share links of the user, expired links are included
+func (svc *service) ListShareLinks(ctx context.Context) ([]ShareLink, error) {
+	links, err := svc.database.GetShareLinks(getUserInfFromCtx(ctx).Name)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]ShareLink, 0, len(links))
+	for _, link := range links {
+		res = append(res, shareLinkFrom(link))
+	}
+	return res, nil
+}
+
+// DeleteShareLink revokes the share link of the user
+func (svc *service) DeleteShareLink(ctx context.Context, token string) error {
+	err := svc.database.DeleteShareLink(getUserInfFromCtx(ctx).Name, token)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	return err
+}
+
+// openShareLink checks the link and the password and returns the link together with
+// the context of its owner, so the shared files are accessed as by the owner
+func (svc *service) openShareLink(ctx context.Context, token, password string) (db.ShareLink, context.Context, error) {
+	link, err := svc.database.GetShareLink(token)
+	if err == sql.ErrNoRows {
+		return link, ctx, ErrNotFound
+	}
+	if err != nil {
+		return link, ctx, err
+	}
+	if !link.Expires.IsZero() && time.Now().After(link.Expires) {
+		return link, ctx, ErrShareExpired
+	}
+	if link.HashedPassword != "" {
+		hashed := hashSharePassword(token, password)
+		if subtle.ConstantTimeCompare([]byte(hashed), []byte(link.HashedPassword)) != 1 {
+			return link, ctx, ErrAuthFailed
+		}
+	}
+	owner, err := svc.database.GetUser(link.User)
+	if err == sql.ErrNoRows {
+		return link, ctx, ErrNotFound
+	}
+	if err != nil {
+		return link, ctx, err
+	}
+	return link, putUserInfInCtx(ctx, owner), nil
+}
+
+// sharedPath splits the path of the file inside the shared directory into the directory
+// and the name relative to the root directory of the owner, the empty path is the shared file itself
+func sharedPath(link db.ShareLink, filePath string) (string, string, error) {
+	rel, err := cleanDirPath(filePath)
+	if err != nil {
+		return "", "", err
+	}
+	if rel != "" && !link.IsDir {
+		return "", "", ErrNotFound
+	}
+	dir, name := path.Split(path.Join(link.Path, rel))
+	return strings.TrimSuffix(dir, "/"), name, nil
+}
+
+// GetShared describes the item shared by the link, directories shared for reading
+// are listed, options.DirPath is relative to the shared directory
+func (svc *service) GetShared(ctx context.Context, token, password string, options ListOptions) (SharedItem, error) {
+	link, ctx, err := svc.openShareLink(ctx, token, password)
+	if err != nil {
+		return SharedItem{}, err
+	}
+	dir, name, err := sharedPath(link, "")
+	if err != nil {
+		return SharedItem{}, err
+	}
+	filePath, err := svc.resolvePath(ctx, dir, name)
+	if err != nil {
+		return SharedItem{}, err
+	}
+	info, err := svc.backend.Stat(filePath)
+	if err != nil {
+		return SharedItem{}, getErrorType(err)
+	}
+	res := SharedItem{
+		Name:    info.Name,
+		IsDir:   info.IsDir,
+		Mode:    ShareMode(link.Mode),
+		Expires: shareLinkFrom(link).Expires,
+	}
+	if !info.IsDir {
+		res.Size = info.Size
+		return res, nil
+	}
+	if res.Mode != ShareRead {
+		return res, nil
+	}
+	dir, name, err = sharedPath(link, options.DirPath)
+	if err != nil {
+		return SharedItem{}, err
+	}
+	options.DirPath = path.Join(dir, name)
+	page, err := svc.List(ctx, options)
+	if err != nil {
+		return SharedItem{}, err
+	}
+	res.Listing = &page
+	return res, nil
+}
+
+// DownloadShared downloads the file filePath of the directory shared for reading,
+// the empty filePath downloads the shared item. Directories are downloaded as archives
+// of the format. Every download is counted against the maximal amount of downloads
+// once the file is opened.
+func (svc *service) DownloadShared(ctx context.Context, token, password, filePath string, format ArchiveFormat) (io.ReadCloser, fs.FileInfo, error) {
+	link, ctx, err := svc.openShareLink(ctx, token, password)
+	if err != nil {
+		return nil, fs.FileInfo{}, err
+	}
+	if ShareMode(link.Mode) != ShareRead {
+		return nil, fs.FileInfo{}, ErrForbidden
+	}
+	dir, name, err := sharedPath(link, filePath)
+	if err != nil {
+		return nil, fs.FileInfo{}, err
+	}
+	fullPath, err := svc.resolvePath(ctx, dir, name)
+	if err != nil {
+		return nil, fs.FileInfo{}, err
+	}
+	info, err := svc.backend.Stat(fullPath)
+	if err != nil {
+		return nil, fs.FileInfo{}, getErrorType(err)
+	}
+	var file io.ReadCloser
+	if info.IsDir {
+		file, info, err = svc.DownloadArchive(ctx, path.Join(dir, name), nil, format)
+	} else {
+		file, info, err = svc.Download(ctx, dir, name)
+	}
+	if err != nil {
+		return nil, fs.FileInfo{}, err
+	}
+	// only the downloads which are started are counted
+	allowed, err := svc.database.CountShareLinkDownload(token)
+	if err == nil && !allowed {
+		err = ErrShareExpired
+	}
+	if err != nil {
+		file.Close()
+		return nil, fs.FileInfo{}, err
+	}
+	return file, info, nil
+}
+
+// UploadShared uploads the file into the directory dirPath of the directory shared for upload.
+// Existing files are never overwritten, the upload is renamed instead. The returned path
+// is relative to the shared directory, so the owner's tree is not revealed.
+func (svc *service) UploadShared(ctx context.Context, token, password, dirPath, fileName string, contents io.ReadCloser) (Result, error) {
+	defer contents.Close()
+	link, ctx, err := svc.openShareLink(ctx, token, password)
+	if err != nil {
+		return Result{}, err
+	}
+	if ShareMode(link.Mode) != ShareUpload {
+		return Result{}, ErrForbidden
+	}
+	dir, name, err := sharedPath(link, dirPath)
+	if err != nil {
+		return Result{}, err
+	}
+	res, err := svc.Upload(ctx, path.Join(dir, name), fileName, contents, Checksum{}, ConflictRename)
+	sharedRoot := joinPath(getUserInfFromCtx(ctx).RootDir, link.Path)
+	res.Path = strings.TrimPrefix(strings.TrimPrefix(res.Path, sharedRoot), "/")
+	return res, err
+}
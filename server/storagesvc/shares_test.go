@@ -0,0 +1,85 @@
+package storagesvc
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestDownloadSharedCountsOpenedDownloads(t *testing.T) {
+	svc := newTestService(t)
+	ctx := userContext("alice")
+	if _, err := svc.MkDir(ctx, "", "docs", ConflictFail); err != nil {
+		t.Fatal(err)
+	}
+	upload(t, svc, "alice", "docs", "a.txt", "a")
+	link, err := svc.CreateShareLink(ctx, ShareLinkOptions{FileName: "docs", MaxDownloads: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// downloads which fail to open the archive are not counted
+	for i := 0; i < 3; i++ {
+		if _, _, err := svc.DownloadShared(ctx, link.Token, "", "", "rar"); err != ErrInvalidArgument {
+			t.Fatalf("DownloadShared of the unknown format = %v, want ErrInvalidArgument", err)
+		}
+	}
+	file, _, err := svc.DownloadShared(ctx, link.Token, "", "a.txt", "")
+	if err != nil {
+		t.Fatalf("download is used up by failed downloads: %v", err)
+	}
+	data, err := io.ReadAll(file)
+	file.Close()
+	if err != nil || string(data) != "a" {
+		t.Fatalf("a.txt = %q, %v", data, err)
+	}
+	if _, _, err := svc.DownloadShared(ctx, link.Token, "", "a.txt", ""); err != ErrShareExpired {
+		t.Fatalf("DownloadShared over the limit = %v, want ErrShareExpired", err)
+	}
+}
+
+func TestSharePasswordIsNotTakenFromQuery(t *testing.T) {
+	svc := newTestService(t)
+	ctx := userContext("alice")
+	upload(t, svc, "alice", "", "a.txt", "a")
+	link, err := svc.CreateShareLink(ctx, ShareLinkOptions{FileName: "a.txt", Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(MakeHttpHandler(svc))
+	defer ts.Close()
+	download := ts.URL + "/s/" + link.Token + "/download"
+
+	resp, err := http.Get(download + "?password=secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		t.Fatal("password is taken from the query")
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, download, nil)
+	req.Header.Set("X-Share-Password", "secret")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("download with the header = %s", resp.Status)
+	}
+
+	resp, err = http.PostForm(download, url.Values{"password": {"secret"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(data), "a") {
+		t.Fatalf("download with the posted form = %s %q", resp.Status, data)
+	}
+}
@@ -0,0 +1,160 @@
+package storagesvc
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"remote-storage/server/db"
+)
+
+// Permission is the access level granted to another user or the group
+type Permission string
+
+const (
+	// PermissionRead allows listing and downloading files of the shared directory
+	PermissionRead Permission = "read"
+	// PermissionWrite additionally allows creating, changing and removing files of the shared directory
+	PermissionWrite Permission = "write"
+	// PermissionManage additionally allows granting access to the shared directory,
+	// creating share links to it and renaming, moving or removing the shared directory itself
+	PermissionManage Permission = "manage"
+)
+
+var permissionLevels = map[Permission]int{
+	PermissionRead:   1,
+	PermissionWrite:  2,
+	PermissionManage: 3,
+}
+
+// allows reports whether the permission includes the required one
+func (p Permission) allows(required Permission) bool {
+	return permissionLevels[p] >= permissionLevels[required]
+}
+
+// GranteeType is the kind of the grantee
+type GranteeType string
+
+const (
+	GranteeUser  GranteeType = "user"
+	GranteeGroup GranteeType = "group"
+)
+
+// GrantOptions describe the access being granted
+type GrantOptions struct {
+	// DirPath and FileName are the path to the shared directory
+	DirPath  string `json:"dir_path"`
+	FileName string `json:"file_name"`
+	// Grantee is the name of the user or the group
+	Grantee     string      `json:"grantee"`
+	GranteeType GranteeType `json:"grantee_type,omitempty"`
+	Permission  Permission  `json:"permission"`
+}
+
+// Grant gives another user or the group access to the directory of the owner,
+// the directory appears to them in the "Shared with me" directory
+type Grant struct {
+	ID    int64  `json:"id"`
+	Owner string `json:"owner"`
+	// Path to the shared directory relative to the root directory of the owner
+	Path        string      `json:"path"`
+	Grantee     string      `json:"grantee"`
+	GranteeType GranteeType `json:"grantee_type"`
+	Permission  Permission  `json:"permission"`
+	Created     time.Time   `json:"created"`
+}
+
+func grantFrom(grant db.Grant) Grant {
+	return Grant{
+		ID:          grant.ID,
+		Owner:       grant.Owner,
+		Path:        grant.Path,
+		Grantee:     grant.Grantee,
+		GranteeType: GranteeType(grant.GranteeType),
+		Permission:  Permission(grant.Permission),
+		Created:     grant.Created,
+	}
+}
+
+// GrantAccess gives another user or the group access to the directory of the user,
+// the permission of the existing grant to the same grantee is replaced
+func (svc *service) GrantAccess(ctx context.Context, options GrantOptions) (Grant, error) {
+	if options.GranteeType == "" {
+		options.GranteeType = GranteeUser
+	}
+	if options.GranteeType != GranteeUser && options.GranteeType != GranteeGroup {
+		return Grant{}, ErrInvalidArgument
+	}
+	if _, ok := permissionLevels[options.Permission]; !ok || options.Grantee == "" {
+		return Grant{}, ErrInvalidArgument
+	}
+	userInf := getUserInfFromCtx(ctx)
+	if options.GranteeType == GranteeUser {
+		if options.Grantee == userInf.Name {
+			return Grant{}, ErrInvalidArgument
+		}
+		if _, err := svc.database.GetUser(options.Grantee); err == sql.ErrNoRows {
+			return Grant{}, ErrNotFound
+		} else if err != nil {
+			return Grant{}, err
+		}
+	}
+	dirPath, err := svc.resolvePath(ctx, options.DirPath, options.FileName)
+	if err != nil {
+		return Grant{}, err
+	}
+	info, err := svc.backend.Stat(dirPath)
+	if err != nil {
+		return Grant{}, getErrorType(err)
+	}
+	if !info.IsDir {
+		return Grant{}, ErrInvalidArgument
+	}
+	grant := db.Grant{
+		Owner:       userInf.Name,
+		Path:        relativePath(userInf.RootDir, dirPath),
+		Grantee:     options.Grantee,
+		GranteeType: string(options.GranteeType),
+		Permission:  string(options.Permission),
+		Created:     time.Now(),
+	}
+	grant.ID, err = svc.database.CreateGrant(grant)
+	if err != nil {
+		return Grant{}, err
+	}
+	return grantFrom(grant), nil
+}
+
+// ListGrants returns the grants of the directories of the user
+func (svc *service) ListGrants(ctx context.Context) ([]Grant, error) {
+	grants, err := svc.database.GetGrantsByOwner(getUserInfFromCtx(ctx).Name)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]Grant, 0, len(grants))
+	for _, grant := range grants {
+		res = append(res, grantFrom(grant))
+	}
+	return res, nil
+}
+
+// RevokeAccess removes the grant of the directory of the user
+func (svc *service) RevokeAccess(ctx context.Context, id int64) error {
+	grant, err := svc.database.GetGrant(id)
+	if err == sql.ErrNoRows || err == nil && grant.Owner != getUserInfFromCtx(ctx).Name {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return svc.database.DeleteGrant(id)
+}
+
+// moveGrants makes the grants follow the moved directory. Failing to update the grants
+// doesn't fail the move which is already done, the grants are left pointing to the old path.
+func (svc *service) moveGrants(ctx context.Context, oldFilePath, newFilePath string) {
+	userInf := getUserInfFromCtx(ctx)
+	oldPath := relativePath(userInf.RootDir, oldFilePath)
+	newPath := relativePath(userInf.RootDir, newFilePath)
+	svc.database.MoveGrants(userInf.Name, oldPath, newPath)
+}
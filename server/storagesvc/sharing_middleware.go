@@ -0,0 +1,824 @@
+package storagesvc
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"remote-storage/server/authsvc"
+	"remote-storage/server/db"
+	fs "remote-storage/server/storagesvc/repository/filesystem"
+)
+
+// sharedWithMeDir is the virtual directory in the root directory of the user
+// containing the directories shared with the user as "Shared with me/<owner>/<name>"
+const sharedWithMeDir = "Shared with me"
+
+// SharingMiddleware gives users access to the directories shared with them through sharedWithMeDir.
+// Calls with paths inside sharedWithMeDir are checked against the permission of the grant
+// and executed on behalf of the owner, so the quota, the trash and the change journal
+// of the owner are used. Other calls are passed through unchanged.
+func SharingMiddleware(database db.StorageDatabase, backend fs.Backend) Middleware {
+	return func(next Service) Service {
+		return &sharingMiddleware{
+			next:     next,
+			database: database,
+			backend:  backend,
+		}
+	}
+}
+
+type sharingMiddleware struct {
+	next     Service
+	database db.StorageDatabase
+	backend  fs.Backend
+}
+
+// mount is the directory shared with the user
+type mount struct {
+	owner string
+	// name is the name of the directory in the directory of the owner in sharedWithMeDir
+	name string
+	// path is relative to the root directory of the owner
+	path       string
+	permission Permission
+}
+
+// contains reports whether the path relative to the root directory of the owner is inside the mount
+func (m mount) contains(rel string) bool {
+	return rel == m.path || strings.HasPrefix(rel, m.path+"/")
+}
+
+// virtual returns the path relative to the root directory of the user
+// of the file of the mount at the path relative to the root directory of the owner
+func (m mount) virtual(rel string) string {
+	return joinPath(sharedWithMeDir, m.owner, m.name) + strings.TrimPrefix(rel, m.path)
+}
+
+// mounts returns the directories shared with the user, the grants of the same directory
+// to the user and to the groups of the user are merged keeping the highest permission
+func (mw *sharingMiddleware) mounts(ctx context.Context) ([]mount, error) {
+	user := getUserInfFromCtx(ctx).Name
+	grants, err := mw.database.GetGrantsFor(user)
+	if err != nil {
+		return nil, err
+	}
+	var res []mount
+	index := map[[2]string]int{}
+	taken := map[string]map[string]bool{}
+	for _, grant := range grants {
+		if grant.Owner == user {
+			continue
+		}
+		permission := Permission(grant.Permission)
+		key := [2]string{grant.Owner, grant.Path}
+		if i, ok := index[key]; ok {
+			if !res[i].permission.allows(permission) {
+				res[i].permission = permission
+			}
+			continue
+		}
+		if taken[grant.Owner] == nil {
+			taken[grant.Owner] = map[string]bool{}
+		}
+		name := path.Base(grant.Path)
+		if taken[grant.Owner][name] {
+			name, _ = freeNameFunc(name, func(candidate string) (bool, error) {
+				return taken[grant.Owner][candidate], nil
+			})
+		}
+		taken[grant.Owner][name] = true
+		index[key] = len(res)
+		res = append(res, mount{
+			owner:      grant.Owner,
+			name:       name,
+			path:       grant.Path,
+			permission: permission,
+		})
+	}
+	return res, nil
+}
+
+// ownerContext returns the context of the call on behalf of the owner,
+// the caller is kept in the context
+func (mw *sharingMiddleware) ownerContext(ctx context.Context, owner string) (context.Context, error) {
+	userInf, err := mw.database.GetUser(owner)
+	if err == sql.ErrNoRows {
+		return ctx, ErrNotFound
+	}
+	if err != nil {
+		return ctx, err
+	}
+	return putUserInfInCtx(putCallerInCtx(ctx, getCallerFromCtx(ctx)), userInf), nil
+}
+
+// target is the file of the call after resolving sharedWithMeDir
+type target struct {
+	// ctx is the context of the owner of the shared file or the original context
+	ctx context.Context
+	// dir and name are relative to the root directory of the owner of the shared file,
+	// they are the original arguments for other files
+	dir  string
+	name string
+	// mount is nil for files outside of sharedWithMeDir
+	mount  *mount
+	mounts []mount
+}
+
+// shared reports whether the cleaned path is inside sharedWithMeDir
+func shared(p string) bool {
+	return p == sharedWithMeDir || strings.HasPrefix(p, sharedWithMeDir+"/")
+}
+
+// resolvePath checks the permission to the path relative to the root directory of the user
+// and returns the target with the path relative to the root directory of the owner in dir.
+// Only the mounts are accessible, levels of sharedWithMeDir above them are read-only.
+func (mw *sharingMiddleware) resolvePath(ctx context.Context, p string, required Permission) (target, error) {
+	t := target{ctx: ctx, dir: p}
+	clean, err := cleanDirPath(p)
+	if err != nil || !shared(clean) {
+		// the error is reported by the service
+		return t, nil
+	}
+	elems := strings.SplitN(clean, "/", 4)
+	if len(elems) < 3 {
+		return t, ErrForbidden
+	}
+	t.mounts, err = mw.mounts(ctx)
+	if err != nil {
+		return t, err
+	}
+	for i, m := range t.mounts {
+		if m.owner == elems[1] && m.name == elems[2] {
+			t.mount = &t.mounts[i]
+			break
+		}
+	}
+	if t.mount == nil {
+		return t, ErrNotFound
+	}
+	if !t.mount.permission.allows(required) {
+		return t, ErrForbidden
+	}
+	t.ctx, err = mw.ownerContext(ctx, t.mount.owner)
+	if err != nil {
+		return t, err
+	}
+	t.dir = t.mount.path
+	if len(elems) == 4 {
+		t.dir = joinPath(t.dir, elems[3])
+	}
+	return t, nil
+}
+
+// resolveFile resolves the file fileName of the directory dirPath like resolvePath.
+// Changing the shared directory itself requires PermissionManage.
+func (mw *sharingMiddleware) resolveFile(ctx context.Context, dirPath, fileName string, required Permission) (target, error) {
+	clean, err := cleanDirPath(dirPath)
+	if err != nil || !shared(joinPath(clean, fileName)) {
+		return target{ctx: ctx, dir: dirPath, name: fileName}, nil
+	}
+	if err := validateName(fileName); err != nil {
+		return target{ctx: ctx}, err
+	}
+	t, err := mw.resolvePath(ctx, joinPath(clean, fileName), required)
+	if err != nil {
+		return t, err
+	}
+	if t.dir == t.mount.path && required == PermissionWrite && !t.mount.permission.allows(PermissionManage) {
+		return t, ErrForbidden
+	}
+	dir, name := path.Split(t.dir)
+	t.dir, t.name = strings.TrimSuffix(dir, "/"), name
+	return t, nil
+}
+
+// sameOwner checks that both targets of the call are files of the same user
+func sameOwner(src, dest target) error {
+	switch {
+	case src.mount == nil && dest.mount == nil:
+		return nil
+	case src.mount == nil || dest.mount == nil || src.mount.owner != dest.mount.owner:
+		return ErrInvalidArgument
+	default:
+		return nil
+	}
+}
+
+// virtualRel returns the path relative to the root directory of the user of the file
+// of the owner at the path relative to the root directory of the owner, empty if the file
+// is not shared with the user
+func (t target) virtualRel(rel string) string {
+	var found *mount
+	for i, m := range t.mounts {
+		if m.owner == t.mount.owner && m.contains(rel) && (found == nil || len(m.path) > len(found.path)) {
+			found = &t.mounts[i]
+		}
+	}
+	if found == nil {
+		return ""
+	}
+	return found.virtual(rel)
+}
+
+// virtualPath translates the path in the backend of the shared file
+// into the path the user sees, paths of own files are returned unchanged
+func (t target) virtualPath(ctx context.Context, filePath string) string {
+	if t.mount == nil || filePath == "" {
+		return filePath
+	}
+	rel := t.virtualRel(relativePath(getUserInfFromCtx(t.ctx).RootDir, filePath))
+	if rel == "" {
+		return ""
+	}
+	return joinPath(getUserInfFromCtx(ctx).RootDir, rel)
+}
+
+func (t target) virtualResult(ctx context.Context, res Result) Result {
+	if t.mount == nil {
+		return res
+	}
+	res.Path = t.virtualPath(ctx, res.Path)
+	for i, p := range res.Skipped {
+		res.Skipped[i] = t.virtualPath(ctx, p)
+	}
+	return res
+}
+
+func (mw *sharingMiddleware) getAuthSvc() authsvc.Service {
+	return mw.next.getAuthSvc()
+}
+
+// GetState appends the trees of the directories shared with the user in sharedWithMeDir
+func (mw *sharingMiddleware) GetState(ctx context.Context) (fs.FileInfo, error) {
+	res, err := mw.next.GetState(ctx)
+	if err != nil {
+		return res, err
+	}
+	mounts, err := mw.mounts(ctx)
+	if err != nil || len(mounts) == 0 {
+		return res, err
+	}
+	virtual := fs.FileInfo{Name: sharedWithMeDir, IsDir: true}
+	owners := map[string]int{}
+	for _, m := range mounts {
+		ownerCtx, err := mw.ownerContext(ctx, m.owner)
+		if err != nil {
+			continue
+		}
+		tree, err := mw.backend.TraverseDirectory(joinPath(getUserInfFromCtx(ownerCtx).RootDir, m.path))
+		if err != nil {
+			// the shared directory is removed
+			continue
+		}
+		tree.Name = m.name
+		i, ok := owners[m.owner]
+		if !ok {
+			i = len(virtual.Children)
+			owners[m.owner] = i
+			virtual.Children = append(virtual.Children, fs.FileInfo{Name: m.owner, IsDir: true})
+		}
+		virtual.Children[i].Children = append(virtual.Children[i].Children, tree)
+	}
+	res.Children = append(res.Children, virtual)
+	return res, nil
+}
+
+// List lists the directories shared with the user. The levels of sharedWithMeDir
+// above the shared directories are listed in full on the single page.
+func (mw *sharingMiddleware) List(ctx context.Context, options ListOptions) (ListPage, error) {
+	clean, err := cleanDirPath(options.DirPath)
+	if err != nil {
+		return mw.next.List(ctx, options)
+	}
+	if clean == "" {
+		mounts, err := mw.mounts(ctx)
+		if err != nil {
+			return ListPage{}, err
+		}
+		if len(mounts) > 0 {
+			ctx = withVirtualEntries(ctx, ListEntry{
+				Path:     sharedWithMeDir,
+				FileInfo: fs.FileInfo{Name: sharedWithMeDir, IsDir: true},
+			})
+		}
+		return mw.next.List(ctx, options)
+	}
+	if !shared(clean) {
+		return mw.next.List(ctx, options)
+	}
+	if strings.Count(clean, "/") >= 2 {
+		t, err := mw.resolvePath(ctx, options.DirPath, PermissionRead)
+		if err != nil {
+			return ListPage{}, err
+		}
+		options.DirPath = t.dir
+		return mw.next.List(t.ctx, options)
+	}
+	return mw.listVirtual(ctx, clean, options)
+}
+
+// listVirtual lists the owners in sharedWithMeDir or the directories shared by the owner
+func (mw *sharingMiddleware) listVirtual(ctx context.Context, dir string, options ListOptions) (ListPage, error) {
+	res := ListPage{Entries: []ListEntry{}}
+	options, err := validateListOptions(options)
+	if err != nil {
+		return res, err
+	}
+	mounts, err := mw.mounts(ctx)
+	if err != nil {
+		return res, err
+	}
+	owner := strings.TrimPrefix(strings.TrimPrefix(dir, sharedWithMeDir), "/")
+	found := owner == ""
+	var entries []ListEntry
+	seen := map[string]bool{}
+	for _, m := range mounts {
+		var info fs.FileInfo
+		switch {
+		case owner == "" && !seen[m.owner]:
+			seen[m.owner] = true
+			info = fs.FileInfo{Name: m.owner, IsDir: true}
+		case owner != "" && m.owner == owner:
+			found = true
+			ownerCtx, err := mw.ownerContext(ctx, m.owner)
+			if err != nil {
+				continue
+			}
+			info, err = mw.backend.Stat(joinPath(getUserInfFromCtx(ownerCtx).RootDir, m.path))
+			if err != nil {
+				// the shared directory is removed
+				continue
+			}
+			info.Name = m.name
+		default:
+			continue
+		}
+		entry := ListEntry{Path: info.Name, FileInfo: info}
+		if options.matches(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	if !found {
+		return res, ErrNotFound
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if options.Desc {
+			return compareEntries(options.Sort, entries[i], entries[j]) > 0
+		}
+		return compareEntries(options.Sort, entries[i], entries[j]) < 0
+	})
+	res.Entries = append(res.Entries, entries...)
+	return res, nil
+}
+
+func (mw *sharingMiddleware) MkDir(ctx context.Context, dirPath, dirName string, conflict ConflictPolicy) (Result, error) {
+	t, err := mw.resolveFile(ctx, dirPath, dirName, PermissionWrite)
+	if err != nil {
+		return Result{}, err
+	}
+	res, err := mw.next.MkDir(t.ctx, t.dir, t.name, conflict)
+	return t.virtualResult(ctx, res), err
+}
+
+// Rename renames the file in its directory, renaming the shared directory itself
+// requires PermissionManage and the directory keeps being shared
+func (mw *sharingMiddleware) Rename(ctx context.Context, dirPath, oldName, newName string, conflict ConflictPolicy) (Result, error) {
+	t, err := mw.resolveFile(ctx, dirPath, oldName, PermissionWrite)
+	if err != nil {
+		return Result{}, err
+	}
+	if t.mount == nil {
+		// sharedWithMeDir can't be taken by the own file
+		if _, err := mw.resolveFile(ctx, dirPath, newName, PermissionWrite); err != nil {
+			return Result{}, err
+		}
+	}
+	res, err := mw.next.Rename(t.ctx, t.dir, t.name, newName, conflict)
+	if err == nil && t.mount != nil && joinPath(t.dir, t.name) == t.mount.path {
+		// the grants followed the renamed directory
+		if mounts, err := mw.mounts(ctx); err == nil {
+			t.mounts = mounts
+		}
+	}
+	return t.virtualResult(ctx, res), err
+}
+
+func (mw *sharingMiddleware) Move(ctx context.Context, srcDirPath, fileName, destDirPath string, conflict ConflictPolicy) (Result, error) {
+	src, err := mw.resolveFile(ctx, srcDirPath, fileName, PermissionWrite)
+	if err != nil {
+		return Result{}, err
+	}
+	dest, err := mw.resolveFile(ctx, destDirPath, fileName, PermissionWrite)
+	if err != nil {
+		return Result{}, err
+	}
+	if err := sameOwner(src, dest); err != nil {
+		return Result{}, err
+	}
+	res, err := mw.next.Move(src.ctx, src.dir, src.name, dest.dir, conflict)
+	return dest.virtualResult(ctx, res), err
+}
+
+func (mw *sharingMiddleware) Delete(ctx context.Context, dirPath, fileName string) (string, error) {
+	t, err := mw.resolveFile(ctx, dirPath, fileName, PermissionWrite)
+	if err != nil {
+		return "", err
+	}
+	res, err := mw.next.Delete(t.ctx, t.dir, t.name)
+	return t.virtualPath(ctx, res), err
+}
+
+func (mw *sharingMiddleware) Copy(ctx context.Context, srcDirPath, fileName, destDirPath string, conflict ConflictPolicy) (Result, error) {
+	src, err := mw.resolveFile(ctx, srcDirPath, fileName, PermissionRead)
+	if err != nil {
+		return Result{}, err
+	}
+	dest, err := mw.resolveFile(ctx, destDirPath, fileName, PermissionWrite)
+	if err != nil {
+		return Result{}, err
+	}
+	if err := sameOwner(src, dest); err != nil {
+		return Result{}, err
+	}
+	res, err := mw.next.Copy(src.ctx, src.dir, src.name, dest.dir, conflict)
+	return dest.virtualResult(ctx, res), err
+}
+
+func (mw *sharingMiddleware) Batch(ctx context.Context, operations []BatchOperation, stopOnError bool) ([]BatchResult, error) {
+	return runBatch(ctx, mw, operations, stopOnError)
+}
+
+func (mw *sharingMiddleware) Extract(ctx context.Context, dirPath, fileName, destDirPath string, conflict ConflictPolicy) ([]Result, error) {
+	src, err := mw.resolveFile(ctx, dirPath, fileName, PermissionRead)
+	if err != nil {
+		return nil, err
+	}
+	dest, err := mw.resolvePath(ctx, destDirPath, PermissionWrite)
+	if err != nil {
+		return nil, err
+	}
+	if err := sameOwner(src, dest); err != nil {
+		return nil, err
+	}
+	results, err := mw.next.Extract(src.ctx, src.dir, src.name, dest.dir, conflict)
+	for i := range results {
+		results[i] = dest.virtualResult(ctx, results[i])
+	}
+	return results, err
+}
+
+func (mw *sharingMiddleware) Download(ctx context.Context, dirPath, fileName string) (io.ReadCloser, fs.FileInfo, error) {
+	t, err := mw.resolveFile(ctx, dirPath, fileName, PermissionRead)
+	if err != nil {
+		return nil, fs.FileInfo{}, err
+	}
+	return mw.next.Download(t.ctx, t.dir, t.name)
+}
+
+func (mw *sharingMiddleware) DownloadArchive(ctx context.Context, dirPath string, fileNames []string, format ArchiveFormat) (io.ReadCloser, fs.FileInfo, error) {
+	t, err := mw.resolvePath(ctx, dirPath, PermissionRead)
+	if err != nil {
+		return nil, fs.FileInfo{}, err
+	}
+	return mw.next.DownloadArchive(t.ctx, t.dir, fileNames, format)
+}
+
+func (mw *sharingMiddleware) Upload(ctx context.Context, dirPath, fileName string, contents io.ReadCloser, checksum Checksum, conflict ConflictPolicy) (Result, error) {
+	t, err := mw.resolveFile(ctx, dirPath, fileName, PermissionWrite)
+	if err != nil {
+		contents.Close()
+		return Result{}, err
+	}
+	res, err := mw.next.Upload(t.ctx, t.dir, t.name, contents, checksum, conflict)
+	return t.virtualResult(ctx, res), err
+}
+
+// sharedSessionSep separates the owner from the id of the upload session in the shared directory
+const sharedSessionSep = "."
+
+// CreateUploadSession prefixes the id of the session in the shared directory with the owner,
+// so the following calls find the session of the owner
+func (mw *sharingMiddleware) CreateUploadSession(ctx context.Context, dirPath, fileName string, size int64, checksum Checksum, conflict ConflictPolicy) (UploadSession, error) {
+	t, err := mw.resolveFile(ctx, dirPath, fileName, PermissionWrite)
+	if err != nil {
+		return UploadSession{}, err
+	}
+	session, err := mw.next.CreateUploadSession(t.ctx, t.dir, t.name, size, checksum, conflict)
+	if err != nil || t.mount == nil {
+		return session, err
+	}
+	return mw.virtualSession(t, session), nil
+}
+
+func (mw *sharingMiddleware) virtualSession(t target, session UploadSession) UploadSession {
+	session.ID = base64.RawURLEncoding.EncodeToString([]byte(t.mount.owner)) + sharedSessionSep + session.ID
+	session.DirPath = t.virtualRel(session.DirPath)
+	return session
+}
+
+// resolveSession returns the target of the upload session, the access to the shared directory
+// is checked again as the grant could be revoked since the session was created
+func (mw *sharingMiddleware) resolveSession(ctx context.Context, id string) (target, string, error) {
+	t := target{ctx: ctx}
+	i := strings.Index(id, sharedSessionSep)
+	if i < 0 {
+		return t, id, nil
+	}
+	owner, err := base64.RawURLEncoding.DecodeString(id[:i])
+	if err != nil {
+		return t, id, ErrNotFound
+	}
+	id = id[i+len(sharedSessionSep):]
+	ownerCtx, err := mw.ownerContext(ctx, string(owner))
+	if err != nil {
+		return t, id, err
+	}
+	session, err := mw.next.GetUploadSession(ownerCtx, id)
+	if err != nil {
+		return t, id, err
+	}
+	t, err = mw.authorize(ctx, string(owner), joinPath(session.DirPath, session.FileName), PermissionWrite)
+	if err != nil {
+		return t, id, err
+	}
+	t.ctx = ownerCtx
+	return t, id, nil
+}
+
+// authorize checks the permission to the file of the owner at the path relative
+// to the root directory of the owner
+func (mw *sharingMiddleware) authorize(ctx context.Context, owner, rel string, required Permission) (target, error) {
+	t := target{ctx: ctx}
+	var err error
+	t.mounts, err = mw.mounts(ctx)
+	if err != nil {
+		return t, err
+	}
+	for i, m := range t.mounts {
+		if m.owner != owner || !m.contains(rel) {
+			continue
+		}
+		if t.mount == nil || !t.mount.permission.allows(m.permission) {
+			t.mount = &t.mounts[i]
+		}
+	}
+	if t.mount == nil {
+		return t, ErrNotFound
+	}
+	if !t.mount.permission.allows(required) {
+		return t, ErrForbidden
+	}
+	return t, nil
+}
+
+func (mw *sharingMiddleware) GetUploadSession(ctx context.Context, id string) (UploadSession, error) {
+	t, id, err := mw.resolveSession(ctx, id)
+	if err != nil {
+		return UploadSession{}, err
+	}
+	session, err := mw.next.GetUploadSession(t.ctx, id)
+	if err != nil || t.mount == nil {
+		return session, err
+	}
+	return mw.virtualSession(t, session), nil
+}
+
+func (mw *sharingMiddleware) UploadChunk(ctx context.Context, id string, offset int64, contents io.ReadCloser) (UploadSession, error) {
+	t, id, err := mw.resolveSession(ctx, id)
+	if err != nil {
+		contents.Close()
+		return UploadSession{}, err
+	}
+	session, err := mw.next.UploadChunk(t.ctx, id, offset, contents)
+	if t.mount == nil {
+		return session, err
+	}
+	return mw.virtualSession(t, session), err
+}
+
+func (mw *sharingMiddleware) FinalizeUploadSession(ctx context.Context, id string) (Result, error) {
+	t, id, err := mw.resolveSession(ctx, id)
+	if err != nil {
+		return Result{}, err
+	}
+	res, err := mw.next.FinalizeUploadSession(t.ctx, id)
+	return t.virtualResult(ctx, res), err
+}
+
+func (mw *sharingMiddleware) ListVersions(ctx context.Context, dirPath, fileName string) ([]FileVersion, error) {
+	t, err := mw.resolveFile(ctx, dirPath, fileName, PermissionRead)
+	if err != nil {
+		return nil, err
+	}
+	return mw.next.ListVersions(t.ctx, t.dir, t.name)
+}
+
+func (mw *sharingMiddleware) DownloadVersion(ctx context.Context, dirPath, fileName, versionID string) (io.ReadCloser, fs.FileInfo, error) {
+	t, err := mw.resolveFile(ctx, dirPath, fileName, PermissionRead)
+	if err != nil {
+		return nil, fs.FileInfo{}, err
+	}
+	return mw.next.DownloadVersion(t.ctx, t.dir, t.name, versionID)
+}
+
+func (mw *sharingMiddleware) RestoreVersion(ctx context.Context, dirPath, fileName, versionID string) (string, error) {
+	t, err := mw.resolveFile(ctx, dirPath, fileName, PermissionWrite)
+	if err != nil {
+		return "", err
+	}
+	res, err := mw.next.RestoreVersion(t.ctx, t.dir, t.name, versionID)
+	return t.virtualPath(ctx, res), err
+}
+
+func (mw *sharingMiddleware) PruneVersions(ctx context.Context, keep int, maxAge time.Duration) (int, error) {
+	return mw.next.PruneVersions(ctx, keep, maxAge)
+}
+
+func (mw *sharingMiddleware) ListTrash(ctx context.Context) ([]TrashItem, error) {
+	return mw.next.ListTrash(ctx)
+}
+
+func (mw *sharingMiddleware) RestoreFromTrash(ctx context.Context, id string, conflict ConflictPolicy) (Result, error) {
+	return mw.next.RestoreFromTrash(ctx, id, conflict)
+}
+
+func (mw *sharingMiddleware) EmptyTrash(ctx context.Context) (int, error) {
+	return mw.next.EmptyTrash(ctx)
+}
+
+func (mw *sharingMiddleware) GetUsage(ctx context.Context) (Usage, error) {
+	return mw.next.GetUsage(ctx)
+}
+
+func (mw *sharingMiddleware) SetQuota(ctx context.Context, user string, quota int64) error {
+	return mw.next.SetQuota(ctx, user, quota)
+}
+
+func (mw *sharingMiddleware) GetChanges(ctx context.Context, since string) (Changes, error) {
+	return mw.next.GetChanges(ctx, since)
+}
+
+func (mw *sharingMiddleware) Watch(ctx context.Context, since string) (<-chan Changes, error) {
+	return mw.next.Watch(ctx, since)
+}
+
+// CreateShareLink shares the file of the shared directory on behalf of the owner,
+// the link belongs to the owner
+func (mw *sharingMiddleware) CreateShareLink(ctx context.Context, options ShareLinkOptions) (ShareLink, error) {
+	t, err := mw.resolveFile(ctx, options.DirPath, options.FileName, PermissionManage)
+	if err != nil {
+		return ShareLink{}, err
+	}
+	options.DirPath, options.FileName = t.dir, t.name
+	link, err := mw.next.CreateShareLink(t.ctx, options)
+	if err == nil && t.mount != nil {
+		link.Path = t.virtualRel(link.Path)
+	}
+	return link, err
+}
+
+func (mw *sharingMiddleware) ListShareLinks(ctx context.Context) ([]ShareLink, error) {
+	return mw.next.ListShareLinks(ctx)
+}
+
+func (mw *sharingMiddleware) DeleteShareLink(ctx context.Context, token string) error {
+	return mw.next.DeleteShareLink(ctx, token)
+}
+
+func (mw *sharingMiddleware) GetShared(ctx context.Context, token, password string, options ListOptions) (SharedItem, error) {
+	return mw.next.GetShared(ctx, token, password, options)
+}
+
+func (mw *sharingMiddleware) DownloadShared(ctx context.Context, token, password, filePath string, format ArchiveFormat) (io.ReadCloser, fs.FileInfo, error) {
+	return mw.next.DownloadShared(ctx, token, password, filePath, format)
+}
+
+func (mw *sharingMiddleware) UploadShared(ctx context.Context, token, password, dirPath, fileName string, contents io.ReadCloser) (Result, error) {
+	return mw.next.UploadShared(ctx, token, password, dirPath, fileName, contents)
+}
+
+// GrantAccess shares the directory of the shared directory on behalf of the owner
+func (mw *sharingMiddleware) GrantAccess(ctx context.Context, options GrantOptions) (Grant, error) {
+	t, err := mw.resolveFile(ctx, options.DirPath, options.FileName, PermissionManage)
+	if err != nil {
+		return Grant{}, err
+	}
+	options.DirPath, options.FileName = t.dir, t.name
+	grant, err := mw.next.GrantAccess(t.ctx, options)
+	if err == nil && t.mount != nil {
+		grant.Path = t.virtualRel(grant.Path)
+	}
+	return grant, err
+}
+
+func (mw *sharingMiddleware) ListGrants(ctx context.Context) ([]Grant, error) {
+	return mw.next.ListGrants(ctx)
+}
+
+func (mw *sharingMiddleware) ListACL(ctx context.Context) ([]ACLEntry, error) {
+	return mw.next.ListACL(ctx)
+}
+
+func (mw *sharingMiddleware) AddACLEntry(ctx context.Context, entry ACLEntry) (ACLEntry, error) {
+	return mw.next.AddACLEntry(ctx, entry)
+}
+
+func (mw *sharingMiddleware) DeleteACLEntry(ctx context.Context, id int64) error {
+	return mw.next.DeleteACLEntry(ctx, id)
+}
+
+func (mw *sharingMiddleware) ListGroupMembers(ctx context.Context) ([]GroupMember, error) {
+	return mw.next.ListGroupMembers(ctx)
+}
+
+func (mw *sharingMiddleware) AddGroupMember(ctx context.Context, member GroupMember) error {
+	return mw.next.AddGroupMember(ctx, member)
+}
+
+func (mw *sharingMiddleware) RemoveGroupMember(ctx context.Context, member GroupMember) error {
+	return mw.next.RemoveGroupMember(ctx, member)
+}
+
+func (mw *sharingMiddleware) ListUploadTypeRules(ctx context.Context) ([]UploadTypeRule, error) {
+	return mw.next.ListUploadTypeRules(ctx)
+}
+
+func (mw *sharingMiddleware) AddUploadTypeRule(ctx context.Context, rule UploadTypeRule) (UploadTypeRule, error) {
+	return mw.next.AddUploadTypeRule(ctx, rule)
+}
+
+func (mw *sharingMiddleware) DeleteUploadTypeRule(ctx context.Context, id int64) error {
+	return mw.next.DeleteUploadTypeRule(ctx, id)
+}
+
+// Search searches the shared directory on behalf of the owner, the paths of the entries
+// are relative to the searched directory, so they need no translation
+func (mw *sharingMiddleware) Search(ctx context.Context, options SearchOptions) (SearchResult, error) {
+	t, err := mw.resolvePath(ctx, options.DirPath, PermissionRead)
+	if err != nil {
+		return SearchResult{}, err
+	}
+	options.DirPath = t.dir
+	return mw.next.Search(t.ctx, options)
+}
+
+func (mw *sharingMiddleware) RebuildIndex(ctx context.Context) (int, error) {
+	return mw.next.RebuildIndex(ctx)
+}
+
+func (mw *sharingMiddleware) GetMetadata(ctx context.Context, dirPath, fileName string) (Metadata, error) {
+	t, err := mw.resolveFile(ctx, dirPath, fileName, PermissionRead)
+	if err != nil {
+		return Metadata{}, err
+	}
+	return mw.next.GetMetadata(t.ctx, t.dir, t.name)
+}
+
+func (mw *sharingMiddleware) SetMetadata(ctx context.Context, dirPath, fileName string, metadata Metadata, replace bool) (Metadata, error) {
+	t, err := mw.resolveFile(ctx, dirPath, fileName, PermissionWrite)
+	if err != nil {
+		return Metadata{}, err
+	}
+	return mw.next.SetMetadata(t.ctx, t.dir, t.name, metadata, replace)
+}
+
+func (mw *sharingMiddleware) DeleteMetadata(ctx context.Context, dirPath, fileName string, keys, tags []string) (Metadata, error) {
+	t, err := mw.resolveFile(ctx, dirPath, fileName, PermissionWrite)
+	if err != nil {
+		return Metadata{}, err
+	}
+	return mw.next.DeleteMetadata(t.ctx, t.dir, t.name, keys, tags)
+}
+
+func (mw *sharingMiddleware) Preview(ctx context.Context, dirPath, fileName string, size int) (io.ReadCloser, fs.FileInfo, error) {
+	t, err := mw.resolveFile(ctx, dirPath, fileName, PermissionRead)
+	if err != nil {
+		return nil, fs.FileInfo{}, err
+	}
+	return mw.next.Preview(t.ctx, t.dir, t.name, size)
+}
+
+// RevokeAccess also removes grants of the directories shared with the user with PermissionManage
+func (mw *sharingMiddleware) RevokeAccess(ctx context.Context, id int64) error {
+	grant, err := mw.database.GetGrant(id)
+	if err != nil || grant.Owner == getUserInfFromCtx(ctx).Name {
+		return mw.next.RevokeAccess(ctx, id)
+	}
+	if _, err := mw.authorize(ctx, grant.Owner, grant.Path, PermissionManage); err != nil {
+		if err == ErrForbidden {
+			return err
+		}
+		return ErrNotFound
+	}
+	ownerCtx, err := mw.ownerContext(ctx, grant.Owner)
+	if err != nil {
+		return err
+	}
+	return mw.next.RevokeAccess(ownerCtx, id)
+}
@@ -0,0 +1,246 @@
+package storagesvc
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	fs "remote-storage/server/storagesvc/repository/filesystem"
+)
+
+const (
+	defaultStagingDir    = ".staging"
+	stagingTTL           = 24 * time.Hour
+	stagingPurgeInterval = time.Hour
+)
+
+// UploadPolicy defines what happens when the file is uploaded while another upload
+// to the same path is in progress
+type UploadPolicy string
+
+const (
+	// UploadLastWriterWins lets both uploads complete, the file is the one completed last
+	UploadLastWriterWins UploadPolicy = "last-writer-wins"
+	// UploadReject makes the later upload fail with ErrUploadInProgress
+	UploadReject UploadPolicy = "reject"
+	// UploadRename stores the later upload under a free name, "file.txt" becomes "file (1).txt"
+	UploadRename UploadPolicy = "rename"
+)
+
+// parseUploadPolicy returns the policy named by s, empty s means UploadLastWriterWins
+func parseUploadPolicy(s string) (UploadPolicy, error) {
+	switch p := UploadPolicy(s); p {
+	case "":
+		return UploadLastWriterWins, nil
+	case UploadLastWriterWins, UploadReject, UploadRename:
+		return p, nil
+	default:
+		return "", ErrInvalidArgument
+	}
+}
+
+// stagingArea keeps uploaded files until they are complete and verified,
+// then they are renamed into place, so readers never see partially written files.
+// Every user has own directory in the area.
+type stagingArea struct {
+	backend fs.Backend
+	rootDir string
+	policy  UploadPolicy
+
+	mu sync.Mutex
+	// uploading counts uploads in progress to every path
+	uploading map[string]int
+}
+
+func newStagingArea(backend fs.Backend, rootDir string, policy UploadPolicy) *stagingArea {
+	if rootDir == "" {
+		rootDir = defaultStagingDir
+	}
+	return &stagingArea{
+		backend:   backend,
+		rootDir:   rootDir,
+		policy:    policy,
+		uploading: make(map[string]int),
+	}
+}
+
+// userDir returns the staging directory of the user,
+// the root directory of the user is escaped into a single path element
+func (s *stagingArea) userDir(userRootDir string) string {
+	return path.Join(s.rootDir, "user-"+url.PathEscape(userRootDir))
+}
+
+// create opens the new staged file of the user for writing
+func (s *stagingArea) create(userRootDir string) (string, io.WriteCloser, error) {
+	dir := s.userDir(userRootDir)
+	if err := fs.MkdirAll(s.backend, dir, 0755); err != nil {
+		return "", nil, err
+	}
+	id, err := newRandomID()
+	if err != nil {
+		return "", nil, err
+	}
+	stagedPath := path.Join(dir, id)
+	file, err := s.backend.Create(stagedPath)
+	if err != nil {
+		return "", nil, err
+	}
+	return stagedPath, file, nil
+}
+
+// begin registers the upload to filePath following the policy and returns the path
+// the upload must be stored at, end must be called when the upload is over
+func (s *stagingArea) begin(filePath string) (string, func(), error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.uploading[filePath] > 0 {
+		switch s.policy {
+		case UploadReject:
+			return "", nil, ErrUploadInProgress
+		case UploadRename:
+			dirPath := path.Dir(filePath)
+			name, err := freeNameFunc(path.Base(filePath), func(candidate string) (bool, error) {
+				candidatePath := path.Join(dirPath, candidate)
+				if s.uploading[candidatePath] > 0 {
+					return true, nil
+				}
+				return exists(s.backend, candidatePath)
+			})
+			if err != nil {
+				return "", nil, err
+			}
+			filePath = path.Join(dirPath, name)
+		}
+	}
+	s.uploading[filePath]++
+	return filePath, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.uploading[filePath]--; s.uploading[filePath] == 0 {
+			delete(s.uploading, filePath)
+		}
+	}, nil
+}
+
+// purgeExpired removes staged files abandoned by crashed uploads
+func (s *stagingArea) purgeExpired() {
+	tree, err := s.backend.TraverseDirectory(s.rootDir)
+	if err != nil {
+		return
+	}
+	for _, dir := range tree.Children {
+		for _, file := range dir.Children {
+			if time.Since(file.Modified) > stagingTTL {
+				s.backend.RemoveAll(path.Join(s.rootDir, dir.Name, file.Name))
+			}
+		}
+	}
+}
+
+// runJanitor periodically purges abandoned staged files until ctx is done
+func (s *stagingArea) runJanitor(ctx context.Context) {
+	ticker := time.NewTicker(stagingPurgeInterval)
+	defer ticker.Stop()
+	for {
+		s.purgeExpired()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// syncFile flushes the written data to the storage if the file supports it
+func syncFile(file io.WriteCloser) error {
+	if s, ok := file.(interface{ Sync() error }); ok {
+		return s.Sync()
+	}
+	return nil
+}
+
+// stage writes contents of the file with the name into the new staged file of the user,
+// verifying the type allowed to the user, the checksum and the quota.
+// The staged file is removed if anything fails.
+func (svc *service) stage(ctx context.Context, fileName string, contents io.Reader, checksum Checksum) (string, *quotaWriter, error) {
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(contents, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", nil, err
+	}
+	head = head[:n]
+	contentType := detectContentType(fileName, head)
+	if err := svc.checkUploadType(ctx, contentType); err != nil {
+		return "", nil, err
+	}
+	quota, err := svc.quotaOf(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+	userRootDir := getUserInfFromCtx(ctx).RootDir
+	stagedPath, file, err := svc.staging.create(userRootDir)
+	if err != nil {
+		return "", nil, err
+	}
+	w := svc.newQuotaWriter(ctx, file, quota)
+	digest := newDigester()
+	_, err = io.Copy(io.MultiWriter(w, digest), io.MultiReader(bytes.NewReader(head), contents))
+	if err == nil {
+		err = checksum.verify(digest.sum())
+	}
+	if err == nil {
+		err = syncFile(file)
+	}
+	if err != nil {
+		// the incomplete file is never stored by backends able to discard it
+		fs.Abort(file)
+	} else {
+		err = file.Close()
+	}
+	if err == nil {
+		err = svc.storeAttributes(stagedPath, digest.sum(), contentType)
+	}
+	if err != nil {
+		svc.backend.RemoveAll(stagedPath)
+		w.release()
+		return "", nil, err
+	}
+	return stagedPath, w, nil
+}
+
+// commit renames the staged file into place, conflict defines what happens if the file exists.
+// The staged file is removed if it is not used.
+func (svc *service) commit(ctx context.Context, stagedPath, filePath string, conflict ConflictPolicy, w *quotaWriter) (Result, error) {
+	var res Result
+	replaced, err := svc.backend.Stat(filePath)
+	replacedFile := err == nil && !replaced.IsDir
+	if err != nil && !os.IsNotExist(err) {
+		err = getErrorType(err)
+	} else {
+		res.Path, res.Action, err = svc.resolveConflict(ctx, "", filePath, false, conflict)
+	}
+	if err == nil && res.Action != ActionSkipped {
+		if err = svc.backend.Rename(stagedPath, res.Path); err != nil {
+			err = getErrorType(err)
+		}
+	}
+	if err != nil || res.Action == ActionSkipped {
+		svc.backend.RemoveAll(stagedPath)
+		w.release()
+		return res, err
+	}
+	w.settle()
+	if res.Action == ActionOverwritten && replacedFile {
+		svc.keepMetadata(res.Path, replaced.Attributes)
+		svc.invalidatePreviews(replaced)
+		svc.recordChange(ctx, ChangeModified, res.Path, "")
+	} else {
+		svc.recordChange(ctx, ChangeCreated, res.Path, "")
+	}
+	return res, nil
+}
@@ -0,0 +1,149 @@
+package storagesvc
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// pendingUpload is the upload whose contents are written by the test
+type pendingUpload struct {
+	w    *io.PipeWriter
+	done chan error
+	res  Result
+}
+
+// startUpload starts uploading the file of alice and waits until the upload is in progress
+func startUpload(t *testing.T, svc *service, fileName string) *pendingUpload {
+	t.Helper()
+	r, w := io.Pipe()
+	u := &pendingUpload{w: w, done: make(chan error, 1)}
+	go func() {
+		var err error
+		u.res, err = svc.Upload(userContext("alice"), "", fileName, r, Checksum{}, ConflictOverwrite)
+		u.done <- err
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		svc.staging.mu.Lock()
+		n := svc.staging.uploading["alice/"+fileName]
+		svc.staging.mu.Unlock()
+		if n > 0 {
+			return u
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("upload is not started")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// finish writes the contents and waits for the upload to complete
+func (u *pendingUpload) finish(contents string) (Result, error) {
+	io.WriteString(u.w, contents)
+	u.w.Close()
+	err := <-u.done
+	return u.res, err
+}
+
+func uploadAs(svc *service, fileName, contents string) (Result, error) {
+	return svc.Upload(userContext("alice"), "", fileName, io.NopCloser(strings.NewReader(contents)), Checksum{}, ConflictOverwrite)
+}
+
+func TestUploadPolicyReject(t *testing.T) {
+	svc := newTestService(t)
+	svc.staging.policy = UploadReject
+	first := startUpload(t, svc, "a.txt")
+	if _, err := uploadAs(svc, "a.txt", "second"); err != ErrUploadInProgress {
+		t.Fatalf("concurrent upload = %v, want ErrUploadInProgress", err)
+	}
+	if _, err := first.finish("first"); err != nil {
+		t.Fatal(err)
+	}
+	if got := download(t, svc, "alice", "", "a.txt"); got != "first" {
+		t.Fatalf("a.txt = %q, want first", got)
+	}
+	// the path is free again when the upload is over
+	if _, err := uploadAs(svc, "a.txt", "third"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUploadPolicyRename(t *testing.T) {
+	svc := newTestService(t)
+	svc.staging.policy = UploadRename
+	first := startUpload(t, svc, "a.txt")
+	res, err := uploadAs(svc, "a.txt", "second")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Path != "alice/a (1).txt" || res.Action != ActionRenamed {
+		t.Fatalf("concurrent upload = %+v, want renamed to a (1).txt", res)
+	}
+	if res, err := first.finish("first"); err != nil || res.Path != "alice/a.txt" {
+		t.Fatalf("first upload = %+v, %v", res, err)
+	}
+	if got := download(t, svc, "alice", "", "a.txt"); got != "first" {
+		t.Fatalf("a.txt = %q, want first", got)
+	}
+	if got := download(t, svc, "alice", "", "a (1).txt"); got != "second" {
+		t.Fatalf("a (1).txt = %q, want second", got)
+	}
+}
+
+func TestUploadPolicyLastWriterWins(t *testing.T) {
+	svc := newTestService(t)
+	first := startUpload(t, svc, "a.txt")
+	if res, err := uploadAs(svc, "a.txt", "second"); err != nil || res.Path != "alice/a.txt" {
+		t.Fatalf("concurrent upload = %+v, %v", res, err)
+	}
+	if got := download(t, svc, "alice", "", "a.txt"); got != "second" {
+		t.Fatalf("a.txt = %q, want second", got)
+	}
+	if _, err := first.finish("first"); err != nil {
+		t.Fatal(err)
+	}
+	if got := download(t, svc, "alice", "", "a.txt"); got != "first" {
+		t.Fatalf("a.txt = %q, want first completed last", got)
+	}
+	if staged := stagedFiles(t, svc); len(staged) != 0 {
+		t.Fatalf("staged files are left: %v", staged)
+	}
+}
+
+func TestFailedUploadLeavesNothing(t *testing.T) {
+	svc := newTestService(t)
+	setQuota(t, svc, "alice", 10)
+
+	// the client disconnects in the middle of the upload
+	aborted := startUpload(t, svc, "a.txt")
+	io.WriteString(aborted.w, "partial")
+	aborted.w.CloseWithError(errors.New("connection reset"))
+	if err := <-aborted.done; err == nil {
+		t.Fatal("aborted upload succeeded")
+	}
+	// the contents don't fit the quota
+	if _, err := uploadAs(svc, "b.txt", strings.Repeat("x", 11)); err != ErrQuotaExceeded {
+		t.Fatalf("upload over the quota = %v, want ErrQuotaExceeded", err)
+	}
+	// the contents don't match the checksum
+	contents := io.NopCloser(strings.NewReader("c"))
+	if _, err := svc.Upload(userContext("alice"), "", "c.txt", contents, Checksum{SHA256: sha256Of("other")}, ConflictFail); err != ErrChecksumMismatch {
+		t.Fatalf("upload with the wrong checksum = %v, want ErrChecksumMismatch", err)
+	}
+
+	for _, p := range []string{"alice/a.txt", "alice/b.txt", "alice/c.txt"} {
+		if _, err := svc.backend.Stat(p); !os.IsNotExist(err) {
+			t.Fatalf("Stat(%q) = %v, want not exist", p, err)
+		}
+	}
+	if staged := stagedFiles(t, svc); len(staged) != 0 {
+		t.Fatalf("staged files are left: %v", staged)
+	}
+	if usage, err := svc.GetUsage(userContext("alice")); err != nil || usage.Used != 0 {
+		t.Fatalf("usage = %+v, %v, want nothing used", usage, err)
+	}
+}
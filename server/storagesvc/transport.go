@@ -1,19 +1,32 @@
 package storagesvc
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"github.com/go-kit/kit/endpoint"
 	kithttp "github.com/go-kit/kit/transport/http"
 	"github.com/gorilla/mux"
 	"io"
+	"mime"
 	"net/http"
+	"net/url"
+	"path"
 	"reflect"
 	"remote-storage/server/authsvc"
+	fs "remote-storage/server/storagesvc/repository/filesystem"
+	"strconv"
+	"strings"
+	"time"
 )
 
-const chunkSize = 64 * 1
+const chunkSize = 32 * 1024
+
+// eventsKeepAlive is the interval of comments sent to the idle stream of events,
+// so proxies don't close the connection
+const eventsKeepAlive = 30 * time.Second
 
 type ctxRequestKey struct{}
 
@@ -33,6 +46,16 @@ type readCloserContainer interface {
 	ReadCloser() io.ReadCloser
 }
 
+// fileInfoContainer is implemented by responses describing the file they contain
+type fileInfoContainer interface {
+	FileInfo() fs.FileInfo
+}
+
+// inlineContainer is implemented by responses displayed by the client rather than saved
+type inlineContainer interface {
+	Inline() bool
+}
+
 func ApplyAuthMiddleware(endpoints *Endpoints, mw TransportAuthMiddleware, svc authsvc.Service) Endpoints {
 	v := reflect.ValueOf(endpoints).Elem()
 	for i := 0; i < v.NumField(); i++ {
@@ -63,12 +86,54 @@ func MakeHttpHandler(s Service) http.Handler {
 		encodeResponse,
 		options...,
 	))
-	r.Methods("POST").Path("/filesystem/download").Handler(kithttp.NewServer(
+	r.Methods("GET", "POST").Path("/filesystem/list").Handler(kithttp.NewServer(
+		e.ListEndpoint,
+		decodeListRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("GET", "POST").Path("/filesystem/search").Handler(kithttp.NewServer(
+		e.SearchEndpoint,
+		decodeSearchRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("POST").Path("/filesystem/search/rebuild").Handler(kithttp.NewServer(
+		e.RebuildIndexEndpoint,
+		decodeRebuildIndexRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("GET", "POST").Path("/filesystem/metadata").Handler(kithttp.NewServer(
+		e.GetMetadataEndpoint,
+		decodeGetMetadataRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("POST").Path("/filesystem/metadata/set").Handler(kithttp.NewServer(
+		e.SetMetadataEndpoint,
+		decodeSetMetadataRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("POST", "DELETE").Path("/filesystem/metadata/delete").Handler(kithttp.NewServer(
+		e.DeleteMetadataEndpoint,
+		decodeDeleteMetadataRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("GET", "HEAD", "POST").Path("/filesystem/download").Handler(kithttp.NewServer(
 		e.DownloadEndpoint,
 		decodeDownloadRequest,
 		encodeChunkedResponse,
 		options...,
 	))
+	r.Methods("GET", "HEAD", "POST").Path("/filesystem/preview").Handler(kithttp.NewServer(
+		e.PreviewEndpoint,
+		decodePreviewRequest,
+		encodeChunkedResponse,
+		options...,
+	))
 	r.Methods("POST").Path("/filesystem/upload").Handler(kithttp.NewServer(
 		e.UploadEndpoint,
 		decodeUploadRequest,
@@ -99,12 +164,231 @@ func MakeHttpHandler(s Service) http.Handler {
 		encodeResponse,
 		options...,
 	))
-	r.Methods("DELETE").Path("filesystem/delete").Handler(kithttp.NewServer(
+	r.Methods("POST").Path("/filesystem/upload/session").Handler(kithttp.NewServer(
+		e.CreateUploadSessionEndpoint,
+		decodeCreateUploadSessionRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("GET").Path("/filesystem/upload/session/{id}").Handler(kithttp.NewServer(
+		e.GetUploadSessionEndpoint,
+		decodeGetUploadSessionRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("PUT").Path("/filesystem/upload/session/{id}").Handler(kithttp.NewServer(
+		e.UploadChunkEndpoint,
+		decodeUploadChunkRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("POST").Path("/filesystem/upload/session/{id}/finalize").Handler(kithttp.NewServer(
+		e.FinalizeUploadSessionEndpoint,
+		decodeFinalizeUploadSessionRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("POST").Path("/filesystem/versions").Handler(kithttp.NewServer(
+		e.ListVersionsEndpoint,
+		decodeListVersionsRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("GET", "POST").Path("/filesystem/download/archive").Handler(kithttp.NewServer(
+		e.DownloadArchiveEndpoint,
+		decodeDownloadArchiveRequest,
+		encodeChunkedResponse,
+		options...,
+	))
+	r.Methods("GET", "HEAD", "POST").Path("/filesystem/versions/download").Handler(kithttp.NewServer(
+		e.DownloadVersionEndpoint,
+		decodeVersionRequest,
+		encodeChunkedResponse,
+		options...,
+	))
+	r.Methods("POST").Path("/filesystem/versions/restore").Handler(kithttp.NewServer(
+		e.RestoreVersionEndpoint,
+		decodeVersionRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("POST").Path("/filesystem/versions/prune").Handler(kithttp.NewServer(
+		e.PruneVersionsEndpoint,
+		decodePruneVersionsRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("POST", "DELETE").Path("/filesystem/delete").Handler(kithttp.NewServer(
 		e.DeleteEndpoint,
 		decodeDeleteRequest,
 		encodeResponse,
 		options...,
 	))
+	r.Methods("POST").Path("/filesystem/batch").Handler(kithttp.NewServer(
+		e.BatchEndpoint,
+		decodeBatchRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("POST").Path("/filesystem/extract").Handler(kithttp.NewServer(
+		e.ExtractEndpoint,
+		decodeExtractRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("GET", "POST").Path("/filesystem/trash").Handler(kithttp.NewServer(
+		e.ListTrashEndpoint,
+		decodeListTrashRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("POST").Path("/filesystem/trash/restore").Handler(kithttp.NewServer(
+		e.RestoreFromTrashEndpoint,
+		decodeRestoreFromTrashRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("POST").Path("/filesystem/trash/empty").Handler(kithttp.NewServer(
+		e.EmptyTrashEndpoint,
+		decodeEmptyTrashRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("GET").Path("/filesystem/usage").Handler(kithttp.NewServer(
+		e.GetUsageEndpoint,
+		decodeGetUsageRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("POST").Path("/users/quota").Handler(kithttp.NewServer(
+		e.SetQuotaEndpoint,
+		decodeSetQuotaRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("GET", "POST").Path("/filesystem/changes").Handler(kithttp.NewServer(
+		e.GetChangesEndpoint,
+		decodeGetChangesRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("GET").Path("/filesystem/events").Handler(kithttp.NewServer(
+		e.WatchEndpoint,
+		decodeWatchRequest,
+		encodeEventsResponse,
+		options...,
+	))
+	r.Methods("GET").Path("/shares").Handler(kithttp.NewServer(
+		e.ListShareLinksEndpoint,
+		decodeListShareLinksRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("POST").Path("/shares/create").Handler(kithttp.NewServer(
+		e.CreateShareLinkEndpoint,
+		decodeCreateShareLinkRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("POST", "DELETE").Path("/shares/delete").Handler(kithttp.NewServer(
+		e.DeleteShareLinkEndpoint,
+		decodeDeleteShareLinkRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("GET").Path("/grants").Handler(kithttp.NewServer(
+		e.ListGrantsEndpoint,
+		decodeListGrantsRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("POST").Path("/grants/create").Handler(kithttp.NewServer(
+		e.GrantAccessEndpoint,
+		decodeGrantAccessRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("POST", "DELETE").Path("/grants/delete").Handler(kithttp.NewServer(
+		e.RevokeAccessEndpoint,
+		decodeRevokeAccessRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("GET").Path("/acl").Handler(kithttp.NewServer(
+		e.ListACLEndpoint,
+		decodeListACLRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("POST").Path("/acl/create").Handler(kithttp.NewServer(
+		e.AddACLEntryEndpoint,
+		decodeAddACLEntryRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("POST", "DELETE").Path("/acl/delete").Handler(kithttp.NewServer(
+		e.DeleteACLEntryEndpoint,
+		decodeDeleteACLEntryRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("GET").Path("/groups").Handler(kithttp.NewServer(
+		e.ListGroupMembersEndpoint,
+		decodeListGroupMembersRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("POST").Path("/groups/add").Handler(kithttp.NewServer(
+		e.AddGroupMemberEndpoint,
+		decodeAddGroupMemberRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("POST", "DELETE").Path("/groups/remove").Handler(kithttp.NewServer(
+		e.RemoveGroupMemberEndpoint,
+		decodeRemoveGroupMemberRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("GET").Path("/upload-types").Handler(kithttp.NewServer(
+		e.ListUploadTypeRulesEndpoint,
+		decodeListUploadTypeRulesRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("POST").Path("/upload-types/create").Handler(kithttp.NewServer(
+		e.AddUploadTypeRuleEndpoint,
+		decodeAddUploadTypeRuleRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("POST", "DELETE").Path("/upload-types/delete").Handler(kithttp.NewServer(
+		e.DeleteUploadTypeRuleEndpoint,
+		decodeDeleteUploadTypeRuleRequest,
+		encodeResponse,
+		options...,
+	))
+
+	// share links are served without authentication
+	// passwords are sent in the X-Share-Password header or in the form POSTed by browsers
+	r.Methods("GET", "POST").Path("/s/{token}").Handler(kithttp.NewServer(
+		e.GetSharedEndpoint,
+		decodeGetSharedRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("GET", "POST").Path("/s/{token}/download").Handler(kithttp.NewServer(
+		e.DownloadSharedEndpoint,
+		decodeDownloadSharedRequest,
+		encodeChunkedResponse,
+		options...,
+	))
+	r.Methods("POST").Path("/s/{token}/upload").Handler(kithttp.NewServer(
+		e.UploadSharedEndpoint,
+		decodeUploadSharedRequest,
+		encodeResponse,
+		options...,
+	))
 
 	return r
 }
@@ -117,6 +401,134 @@ func decodeGetStateRequest(_ context.Context, r *http.Request) (interface{}, err
 	return request, nil
 }
 
+// decodeListRequest takes the options from the query of GET requests
+// and from the JSON body of POST requests
+func decodeListRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request listRequest
+	if r.Method != http.MethodGet {
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			return nil, err
+		}
+		return request, nil
+	}
+	return decodeListQuery(r.URL.Query())
+}
+
+// decodeListQuery takes the listing options from the query of the GET request
+func decodeListQuery(query url.Values) (listRequest, error) {
+	var request listRequest
+	var err error
+	if depth := query.Get("depth"); depth != "" {
+		if request.Depth, err = strconv.Atoi(depth); err != nil {
+			return request, ErrInvalidArgument
+		}
+	}
+	if limit := query.Get("limit"); limit != "" {
+		if request.Limit, err = strconv.Atoi(limit); err != nil {
+			return request, ErrInvalidArgument
+		}
+	}
+	if desc := query.Get("desc"); desc != "" {
+		if request.Desc, err = strconv.ParseBool(desc); err != nil {
+			return request, ErrInvalidArgument
+		}
+	}
+	request.DirPath = query.Get("dir_path")
+	request.Sort = ListSort(query.Get("sort"))
+	request.Type = ListType(query.Get("type"))
+	request.Glob = query.Get("glob")
+	request.Cursor = query.Get("cursor")
+	request.Tags = query["tag"]
+	for _, meta := range query["meta"] {
+		if request.Metadata == nil {
+			request.Metadata = make(map[string]string)
+		}
+		// meta=key=value or meta=key for any value
+		k, v, _ := strings.Cut(meta, "=")
+		request.Metadata[k] = v
+	}
+	return request, nil
+}
+
+func decodeSearchRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request searchRequest
+	if r.Method != http.MethodGet {
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			return nil, err
+		}
+		return request, nil
+	}
+	query := r.URL.Query()
+	var err error
+	if limit := query.Get("limit"); limit != "" {
+		if request.Limit, err = strconv.Atoi(limit); err != nil {
+			return nil, ErrInvalidArgument
+		}
+	}
+	if size := query.Get("min_size"); size != "" {
+		if request.MinSize, err = strconv.ParseInt(size, 10, 64); err != nil {
+			return nil, ErrInvalidArgument
+		}
+	}
+	if size := query.Get("max_size"); size != "" {
+		if request.MaxSize, err = strconv.ParseInt(size, 10, 64); err != nil {
+			return nil, ErrInvalidArgument
+		}
+	}
+	if t := query.Get("modified_after"); t != "" {
+		if request.ModifiedAfter, err = time.Parse(time.RFC3339, t); err != nil {
+			return nil, ErrInvalidArgument
+		}
+	}
+	if t := query.Get("modified_before"); t != "" {
+		if request.ModifiedBefore, err = time.Parse(time.RFC3339, t); err != nil {
+			return nil, ErrInvalidArgument
+		}
+	}
+	request.DirPath = query.Get("dir_path")
+	request.Glob = query.Get("glob")
+	request.Ext = query.Get("ext")
+	request.Content = query.Get("content")
+	request.Type = ListType(query.Get("type"))
+	return request, nil
+}
+
+func decodeRebuildIndexRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	return rebuildIndexRequest{}, nil
+}
+
+// decodeGetMetadataRequest takes the path to the file from the query of GET requests
+// and from the JSON body of POST requests
+func decodeGetMetadataRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request getMetadataRequest
+	if r.Method == http.MethodGet {
+		query := r.URL.Query()
+		request.DirPath = query.Get("dir_path")
+		request.FileName = query.Get("file_name")
+		return request, nil
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+func decodeSetMetadataRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request setMetadataRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+func decodeDeleteMetadataRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request deleteMetadataRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
 func decodeMkDirRequest(_ context.Context, r *http.Request) (interface{}, error) {
 	var request mkDirRequest
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
@@ -149,6 +561,22 @@ func decodeMoveRequest(_ context.Context, r *http.Request) (interface{}, error)
 	return request, nil
 }
 
+func decodeBatchRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request batchRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+func decodeExtractRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request extractRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
 func decodeDeleteRequest(_ context.Context, r *http.Request) (interface{}, error) {
 	var request deleteRequest
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
@@ -157,94 +585,518 @@ func decodeDeleteRequest(_ context.Context, r *http.Request) (interface{}, error
 	return request, nil
 }
 
+// decodeDownloadRequest takes the file from the query of GET and HEAD requests,
+// which are cacheable, and from the JSON body of POST requests
 func decodeDownloadRequest(_ context.Context, r *http.Request) (interface{}, error) {
 	var request downloadRequest
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		query := r.URL.Query()
+		request.DirPath = query.Get("dir_path")
+		request.FileName = query.Get("file_name")
+		return request, nil
+	}
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 		return nil, err
 	}
 	return request, nil
 }
 
-func decodeUploadRequest(_ context.Context, r *http.Request) (interface{}, error) {
-	var request uploadRequest
+// decodePreviewRequest takes the file and the size from the query of GET and HEAD requests
+// and from the JSON body of POST requests
+func decodePreviewRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request previewRequest
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		query := r.URL.Query()
+		request.DirPath = query.Get("dir_path")
+		request.FileName = query.Get("file_name")
+		if size := query.Get("size"); size != "" {
+			var err error
+			if request.Size, err = strconv.Atoi(size); err != nil {
+				return nil, ErrInvalidArgument
+			}
+		}
+		return request, nil
+	}
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 		return nil, err
 	}
 	return request, nil
 }
 
-func encodeResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
-	e, ok := response.(errorer)
-	if !ok && e.error() != nil {
-		// Not a Go kit transport error, but a business-logic error.
-		encodeError(ctx, e.error(), w)
-		return nil
+// decodeDownloadArchiveRequest takes the files from the query of GET requests,
+// where file_name is repeated for every file, and from the JSON body of POST requests
+func decodeDownloadArchiveRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request downloadArchiveRequest
+	if r.Method == http.MethodGet {
+		query := r.URL.Query()
+		request.DirPath = query.Get("dir_path")
+		request.FileNames = query["file_name"]
+		request.Format = ArchiveFormat(query.Get("format"))
+		return request, nil
 	}
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	return json.NewEncoder(w).Encode(response)
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, err
+	}
+	return request, nil
 }
 
-func encodeChunkedResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
-	e, ok := response.(errorer)
-	if !ok && e.error() != nil {
-		// Not a Go kit transport error, but a business-logic error.
-		encodeError(ctx, e.error(), w)
-		return nil
-	}
-	r, ok := response.(readCloserContainer)
-	if !ok {
-		encodeError(ctx, ErrUnknownError, w)
-		return nil
+// decodeUploadRequest takes the path to the file and the conflict policy from the query,
+// the body of the request is streamed into the file
+func decodeUploadRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	query := r.URL.Query()
+	checksum, err := parseDigestHeader(requestDigest(r))
+	if err != nil {
+		return nil, err
 	}
-	srcBuffer := r.ReadCloser()
-	buffer := make([]byte, chunkSize)
-	for {
-		// Read the next chunk from the file
-		n, err := srcBuffer.Read(buffer)
-		if err == io.EOF {
-			// Reached the end of the file, break the loop
-			break
-		}
-		if err != nil {
-			// Error reading the file, handle it
-			encodeError(ctx, ErrUnknownError, w)
-			return nil
-		}
+	return uploadRequest{
+		DirPath:  query.Get("dir_path"),
+		FileName: query.Get("file_name"),
+		Contents: r.Body,
+		Checksum: checksum,
+		Conflict: ConflictPolicy(query.Get("conflict")),
+	}, nil
+}
 
-		// Send the current chunk to the response writer
-		_, err = w.Write(buffer[:n])
-		if err != nil {
-			// Error sending the chunk, handle it
-			encodeError(ctx, ErrUnknownError, w)
-			return nil
-		}
+// requestDigest returns the expected digest of the uploaded contents,
+// the contents are the whole file, so Repr-Digest is accepted too
+func requestDigest(r *http.Request) string {
+	if digest := r.Header.Get("Content-Digest"); digest != "" {
+		return digest
+	}
+	return r.Header.Get("Repr-Digest")
+}
 
-		// Flush the response writer to ensure the chunk is sent immediately
-		if flusher, ok := w.(http.Flusher); ok {
-			flusher.Flush()
-		}
+func decodeCreateUploadSessionRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request createUploadSessionRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, err
 	}
-	return nil
+	return request, nil
 }
 
-// encodeRequest likewise JSON-encodes the request to the HTTP request body.
-// Don't use it directly as a transport/http.Client EncodeRequestFunc:
-// storagesvc endpoints require mutating the HTTP method and request path.
-func encodeRequest(ctx context.Context, req *http.Request, reqBody interface{}) error {
-	var buf bytes.Buffer
-	err := json.NewEncoder(&buf).Encode(reqBody)
+func decodeGetUploadSessionRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	return getUploadSessionRequest{
+		ID: mux.Vars(r)["id"],
+	}, nil
+}
+
+// decodeUploadChunkRequest takes the offset from the query
+// and leaves the request body as the contents of the chunk
+func decodeUploadChunkRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	offset, err := strconv.ParseInt(r.URL.Query().Get("offset"), 10, 64)
 	if err != nil {
-		return err
-	}
-	req.Body = io.NopCloser(&buf)
-	cookies := ctx.Value(contextKeyRequestCookie).(Cookies)
-	for _, cookie := range cookies {
-		req.AddCookie(cookie)
+		return nil, ErrInvalidArgument
 	}
-	return nil
+	return uploadChunkRequest{
+		ID:       mux.Vars(r)["id"],
+		Offset:   offset,
+		Contents: r.Body,
+	}, nil
 }
 
-func encodeGetStateRequest(ctx context.Context, req *http.Request, reqBody interface{}) error {
+func decodeFinalizeUploadSessionRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	return finalizeUploadSessionRequest{
+		ID: mux.Vars(r)["id"],
+	}, nil
+}
+
+func decodeListVersionsRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request listVersionsRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+// decodeVersionRequest takes the version from the query of GET and HEAD requests
+// and from the JSON body of POST requests
+func decodeVersionRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request versionRequest
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		query := r.URL.Query()
+		request.DirPath = query.Get("dir_path")
+		request.FileName = query.Get("file_name")
+		request.VersionID = query.Get("version_id")
+		return request, nil
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+func decodePruneVersionsRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request pruneVersionsRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+func decodeListTrashRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	return listTrashRequest{}, nil
+}
+
+func decodeRestoreFromTrashRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request restoreFromTrashRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+func decodeEmptyTrashRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	return emptyTrashRequest{}, nil
+}
+
+func decodeGetUsageRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	return getUsageRequest{}, nil
+}
+
+func decodeSetQuotaRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request setQuotaRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+func decodeGetChangesRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request getChangesRequest
+	if r.Method != http.MethodGet {
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			return nil, err
+		}
+		return request, nil
+	}
+	request.Since = r.URL.Query().Get("since")
+	return request, nil
+}
+
+func decodeListShareLinksRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	return listShareLinksRequest{}, nil
+}
+
+func decodeCreateShareLinkRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request createShareLinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+func decodeDeleteShareLinkRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request deleteShareLinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+func decodeListGrantsRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	return listGrantsRequest{}, nil
+}
+
+func decodeGrantAccessRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request grantAccessRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+func decodeRevokeAccessRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request revokeAccessRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+func decodeListACLRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	return listACLRequest{}, nil
+}
+
+func decodeAddACLEntryRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request addACLEntryRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+func decodeDeleteACLEntryRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request deleteACLEntryRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+func decodeListGroupMembersRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	return listGroupMembersRequest{}, nil
+}
+
+func decodeAddGroupMemberRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request addGroupMemberRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+func decodeRemoveGroupMemberRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request removeGroupMemberRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+func decodeListUploadTypeRulesRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	return listUploadTypeRulesRequest{}, nil
+}
+
+func decodeAddUploadTypeRuleRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request addUploadTypeRuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+func decodeDeleteUploadTypeRuleRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request deleteUploadTypeRuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+// sharePassword takes the password of the share link from the X-Share-Password header,
+// browsers opening the link send it in the password field of the POSTed form.
+// The password is never taken from the query, so it doesn't end up in logs and histories.
+func sharePassword(r *http.Request) string {
+	if password := r.Header.Get("X-Share-Password"); password != "" {
+		return password
+	}
+	if r.Method == http.MethodPost {
+		return r.PostFormValue("password")
+	}
+	return ""
+}
+
+// decodeGetSharedRequest takes the listing options from the query like decodeListRequest
+// does for GET requests
+func decodeGetSharedRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	request, err := decodeListQuery(r.URL.Query())
+	if err != nil {
+		return nil, err
+	}
+	return getSharedRequest{
+		Token:       mux.Vars(r)["token"],
+		Password:    sharePassword(r),
+		ListOptions: request.ListOptions,
+	}, nil
+}
+
+func decodeDownloadSharedRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	query := r.URL.Query()
+	return downloadSharedRequest{
+		Token:    mux.Vars(r)["token"],
+		Password: sharePassword(r),
+		Path:     query.Get("path"),
+		Format:   ArchiveFormat(query.Get("format")),
+	}, nil
+}
+
+// decodeUploadSharedRequest takes the path to the file from the query and the password
+// from the X-Share-Password header, the body of the request is streamed into the file
+func decodeUploadSharedRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	query := r.URL.Query()
+	return uploadSharedRequest{
+		Token:    mux.Vars(r)["token"],
+		Password: r.Header.Get("X-Share-Password"),
+		DirPath:  query.Get("dir_path"),
+		FileName: query.Get("file_name"),
+		Contents: r.Body,
+	}, nil
+}
+
+// decodeWatchRequest takes the token from the query, the Last-Event-ID header
+// sent by reconnecting EventSource clients takes precedence
+func decodeWatchRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	request := watchRequest{Since: r.URL.Query().Get("since")}
+	if id := r.Header.Get("Last-Event-ID"); id != "" {
+		request.Since = id
+	}
+	return request, nil
+}
+
+func encodeResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	if e, ok := response.(errorer); ok && e.error() != nil {
+		// Not a Go kit transport error, but a business-logic error.
+		encodeError(ctx, e.error(), w)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	return json.NewEncoder(w).Encode(response)
+}
+
+// encodeEventsResponse streams the changes as server-sent events until the stream is closed.
+// Every event carries the token of the change page as its id, so reconnecting clients
+// continue from the last received event.
+func encodeEventsResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	if e, ok := response.(errorer); ok && e.error() != nil {
+		// Not a Go kit transport error, but a business-logic error.
+		encodeError(ctx, e.error(), w)
+		return nil
+	}
+	resp, ok := response.(watchResponse)
+	flusher, canFlush := w.(http.Flusher)
+	if !ok || resp.Changes == nil || !canFlush {
+		encodeError(ctx, ErrUnknownError, w)
+		return nil
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventsKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case changes, ok := <-resp.Changes:
+			if !ok {
+				return nil
+			}
+			data, err := json.Marshal(changes)
+			if err != nil {
+				return err
+			}
+			if _, err := fmt.Fprintf(w, "id: %s\nevent: changes\ndata: %s\n\n", changes.Token, data); err != nil {
+				return err
+			}
+		case <-keepAlive.C:
+			if _, err := io.WriteString(w, ": keep-alive\n\n"); err != nil {
+				return err
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+// encodeChunkedResponse writes the contents of the downloaded file.
+// Seekable contents are served with http.ServeContent, which handles Range,
+// If-Range, If-None-Match and If-Modified-Since headers and sets Content-Type
+// and Content-Length. Other contents, such as generated archives, are streamed in chunks.
+func encodeChunkedResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	if e, ok := response.(errorer); ok && e.error() != nil {
+		// Not a Go kit transport error, but a business-logic error.
+		encodeError(ctx, e.error(), w)
+		return nil
+	}
+	r, ok := response.(readCloserContainer)
+	if !ok || r.ReadCloser() == nil {
+		encodeError(ctx, ErrUnknownError, w)
+		return nil
+	}
+	srcBuffer := r.ReadCloser()
+	defer srcBuffer.Close()
+
+	var info fs.FileInfo
+	if c, ok := response.(fileInfoContainer); ok {
+		info = c.FileInfo()
+	}
+	disposition := "attachment"
+	if c, ok := response.(inlineContainer); ok && c.Inline() {
+		disposition = "inline"
+	}
+	if info.Name != "" {
+		w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{
+			"filename": info.Name,
+		}))
+	}
+	// the type detected when the file is uploaded, otherwise it is guessed from the name
+	if info.ContentType != "" {
+		w.Header().Set("Content-Type", info.ContentType)
+	}
+	// the digest of the whole file, even if only a range of it is sent
+	if digest := formatDigestHeader(checksumOf(info)); digest != "" {
+		w.Header().Set("Repr-Digest", digest)
+	}
+
+	req, _ := ctx.Value(ctxRequestKey{}).(*http.Request)
+	if seeker, ok := srcBuffer.(io.ReadSeeker); ok && req != nil {
+		w.Header().Set("ETag", fileETag(info))
+		http.ServeContent(w, req, info.Name, info.Modified, seeker)
+		return nil
+	}
+
+	if contentType := mime.TypeByExtension(path.Ext(info.Name)); contentType != "" && info.ContentType == "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+	writeChunked(w, srcBuffer)
+	return nil
+}
+
+// fileETag returns the strong entity tag of the file,
+// which changes whenever the file is modified
+func fileETag(info fs.FileInfo) string {
+	return fmt.Sprintf(`"%x-%x"`, info.Modified.UnixNano(), info.Size)
+}
+
+// writeChunked streams src into w flushing every chunk,
+// so the client starts receiving the contents before the whole stream is read
+func writeChunked(w http.ResponseWriter, src io.Reader) error {
+	buffer := make([]byte, chunkSize)
+	for {
+		// Read the next chunk from the source
+		n, err := src.Read(buffer)
+		if n > 0 {
+			// Send the current chunk to the response writer
+			if _, err := w.Write(buffer[:n]); err != nil {
+				return err
+			}
+			// Flush the response writer to ensure the chunk is sent immediately
+			if flusher, ok := w.(http.Flusher); ok {
+				flusher.Flush()
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// encodeRequest likewise JSON-encodes the request to the HTTP request body.
+// Don't use it directly as a transport/http.Client EncodeRequestFunc:
+// storagesvc endpoints require mutating the HTTP method and request path.
+func encodeRequest(ctx context.Context, req *http.Request, reqBody interface{}) error {
+	var buf bytes.Buffer
+	err := json.NewEncoder(&buf).Encode(reqBody)
+	if err != nil {
+		return err
+	}
+	req.Body = io.NopCloser(&buf)
+	addRequestCookies(ctx, req)
+	return nil
+}
+
+// addRequestCookies adds the cookies set by Endpoints to the request
+func addRequestCookies(ctx context.Context, req *http.Request) {
+	cookies, _ := ctx.Value(contextKeyRequestCookie).(Cookies)
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+}
+
+func encodeGetStateRequest(ctx context.Context, req *http.Request, reqBody interface{}) error {
 	// r.Methods("GET").Path("/filesystem/state")
 	req.URL.Path = "/filesystem/state"
 	return encodeRequest(ctx, req, reqBody)
@@ -256,6 +1108,78 @@ func decodeGetStateResponse(ctx context.Context, resp *http.Response) (interface
 	return response, err
 }
 
+func encodeListRequest(ctx context.Context, req *http.Request, reqBody interface{}) error {
+	// r.Methods("POST").Path("/filesystem/list")
+	req.URL.Path = "/filesystem/list"
+	return encodeRequest(ctx, req, reqBody)
+}
+
+func decodeListResponse(ctx context.Context, resp *http.Response) (interface{}, error) {
+	var response listResponse
+	err := json.NewDecoder(resp.Body).Decode(&response)
+	return response, err
+}
+
+func encodeSearchRequest(ctx context.Context, req *http.Request, reqBody interface{}) error {
+	// r.Methods("POST").Path("/filesystem/search")
+	req.URL.Path = "/filesystem/search"
+	return encodeRequest(ctx, req, reqBody)
+}
+
+func decodeSearchResponse(ctx context.Context, resp *http.Response) (interface{}, error) {
+	var response searchResponse
+	err := json.NewDecoder(resp.Body).Decode(&response)
+	return response, err
+}
+
+func encodeRebuildIndexRequest(ctx context.Context, req *http.Request, reqBody interface{}) error {
+	// r.Methods("POST").Path("/filesystem/search/rebuild")
+	req.URL.Path = "/filesystem/search/rebuild"
+	return encodeRequest(ctx, req, reqBody)
+}
+
+func decodeRebuildIndexResponse(ctx context.Context, resp *http.Response) (interface{}, error) {
+	var response rebuildIndexResponse
+	err := json.NewDecoder(resp.Body).Decode(&response)
+	return response, err
+}
+
+func encodeGetMetadataRequest(ctx context.Context, req *http.Request, reqBody interface{}) error {
+	// r.Methods("POST").Path("/filesystem/metadata")
+	req.URL.Path = "/filesystem/metadata"
+	return encodeRequest(ctx, req, reqBody)
+}
+
+func decodeGetMetadataResponse(ctx context.Context, resp *http.Response) (interface{}, error) {
+	var response metadataResponse
+	err := json.NewDecoder(resp.Body).Decode(&response)
+	return response, err
+}
+
+func encodeSetMetadataRequest(ctx context.Context, req *http.Request, reqBody interface{}) error {
+	// r.Methods("POST").Path("/filesystem/metadata/set")
+	req.URL.Path = "/filesystem/metadata/set"
+	return encodeRequest(ctx, req, reqBody)
+}
+
+func decodeSetMetadataResponse(ctx context.Context, resp *http.Response) (interface{}, error) {
+	var response metadataResponse
+	err := json.NewDecoder(resp.Body).Decode(&response)
+	return response, err
+}
+
+func encodeDeleteMetadataRequest(ctx context.Context, req *http.Request, reqBody interface{}) error {
+	// r.Methods("POST", "DELETE").Path("/filesystem/metadata/delete")
+	req.URL.Path = "/filesystem/metadata/delete"
+	return encodeRequest(ctx, req, reqBody)
+}
+
+func decodeDeleteMetadataResponse(ctx context.Context, resp *http.Response) (interface{}, error) {
+	var response metadataResponse
+	err := json.NewDecoder(resp.Body).Decode(&response)
+	return response, err
+}
+
 func encodeMkDirRequest(ctx context.Context, req *http.Request, reqBody interface{}) error {
 	// r.Methods("POST").Path("/filesystem/mkdir")
 	req.URL.Path = "/filesystem/mkdir"
@@ -299,7 +1223,7 @@ func encodeCopyRequest(ctx context.Context, req *http.Request, reqBody interface
 }
 
 func decodeCopyResponse(ctx context.Context, resp *http.Response) (interface{}, error) {
-	var response moveResponse
+	var response copyResponse
 	err := json.NewDecoder(resp.Body).Decode(&response)
 	return response, err
 }
@@ -311,7 +1235,31 @@ func encodeDeleteRequest(ctx context.Context, req *http.Request, reqBody interfa
 }
 
 func decodeDeleteResponse(ctx context.Context, resp *http.Response) (interface{}, error) {
-	var response moveResponse
+	var response deleteResponse
+	err := json.NewDecoder(resp.Body).Decode(&response)
+	return response, err
+}
+
+func encodeBatchRequest(ctx context.Context, req *http.Request, reqBody interface{}) error {
+	// r.Methods("POST").Path("/filesystem/batch")
+	req.URL.Path = "/filesystem/batch"
+	return encodeRequest(ctx, req, reqBody)
+}
+
+func decodeBatchResponse(ctx context.Context, resp *http.Response) (interface{}, error) {
+	var response batchResponse
+	err := json.NewDecoder(resp.Body).Decode(&response)
+	return response, err
+}
+
+func encodeExtractRequest(ctx context.Context, req *http.Request, reqBody interface{}) error {
+	// r.Methods("POST").Path("/filesystem/extract")
+	req.URL.Path = "/filesystem/extract"
+	return encodeRequest(ctx, req, reqBody)
+}
+
+func decodeExtractResponse(ctx context.Context, resp *http.Response) (interface{}, error) {
+	var response extractResponse
 	err := json.NewDecoder(resp.Body).Decode(&response)
 	return response, err
 }
@@ -319,27 +1267,286 @@ func decodeDeleteResponse(ctx context.Context, resp *http.Response) (interface{}
 func encodeDownloadRequest(ctx context.Context, req *http.Request, reqBody interface{}) error {
 	// r.Methods("POST").Path("/filesystem/download")
 	req.URL.Path = "/filesystem/download"
+	if rng, ok := ctx.Value(ctxDownloadRangeKey{}).(downloadRange); ok {
+		req.Header.Set("Range", rng.header())
+	}
 	return encodeRequest(ctx, req, reqBody)
 }
 
+// decodeDownloadResponse leaves the response body open as the contents of the file,
+// the client endpoint must be created with the BufferedStream option
 func decodeDownloadResponse(ctx context.Context, resp *http.Response) (interface{}, error) {
-	var response moveResponse
-	err := json.NewDecoder(resp.Body).Decode(&response)
-	return response, err
+	var response downloadResponse
+	if resp.StatusCode >= http.StatusBadRequest {
+		defer resp.Body.Close()
+		err := json.NewDecoder(resp.Body).Decode(&response)
+		return response, err
+	}
+	response.Buffer = resp.Body
+	response.Info.Size = resp.ContentLength
+	if modified, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		response.Info.Modified = modified
+	}
+	if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil {
+		response.Info.Name = params["filename"]
+	}
+	if checksum, err := parseDigestHeader(resp.Header.Get("Repr-Digest")); err == nil {
+		response.Info.SHA256 = checksum.SHA256
+		response.Info.CRC32C = checksum.CRC32C
+	}
+	response.Info.ContentType = resp.Header.Get("Content-Type")
+	return response, nil
+}
+
+func encodePreviewRequest(ctx context.Context, req *http.Request, reqBody interface{}) error {
+	// r.Methods("POST").Path("/filesystem/preview")
+	req.URL.Path = "/filesystem/preview"
+	return encodeRequest(ctx, req, reqBody)
+}
+
+// decodePreviewResponse leaves the response body open as the contents of the preview,
+// the client endpoint must be created with the BufferedStream option
+func decodePreviewResponse(ctx context.Context, resp *http.Response) (interface{}, error) {
+	response, err := decodeDownloadResponse(ctx, resp)
+	r := response.(downloadResponse)
+	return previewResponse{r.Buffer, r.Info, r.Error}, err
+}
+
+func encodeDownloadArchiveRequest(ctx context.Context, req *http.Request, reqBody interface{}) error {
+	// r.Methods("POST").Path("/filesystem/download/archive")
+	req.URL.Path = "/filesystem/download/archive"
+	return encodeRequest(ctx, req, reqBody)
 }
 
 func encodeUploadRequest(ctx context.Context, req *http.Request, reqBody interface{}) error {
 	// r.Methods("POST").Path("/filesystem/upload")
+	r := reqBody.(uploadRequest)
 	req.URL.Path = "/filesystem/upload"
-	return encodeRequest(ctx, req, reqBody)
+	query := url.Values{"dir_path": {r.DirPath}, "file_name": {r.FileName}}
+	if r.Conflict != "" {
+		query.Set("conflict", string(r.Conflict))
+	}
+	req.URL.RawQuery = query.Encode()
+	req.Body = r.Contents
+	if digest := formatDigestHeader(r.Checksum); digest != "" {
+		req.Header.Set("Content-Digest", digest)
+	}
+	addRequestCookies(ctx, req)
+	return nil
 }
 
 func decodeUdploadResponse(ctx context.Context, resp *http.Response) (interface{}, error) {
-	var response moveResponse
+	var response uploadResponse
+	err := json.NewDecoder(resp.Body).Decode(&response)
+	return response, err
+}
+
+func encodeCreateUploadSessionRequest(ctx context.Context, req *http.Request, reqBody interface{}) error {
+	// r.Methods("POST").Path("/filesystem/upload/session")
+	req.URL.Path = "/filesystem/upload/session"
+	return encodeRequest(ctx, req, reqBody)
+}
+
+func encodeGetUploadSessionRequest(ctx context.Context, req *http.Request, reqBody interface{}) error {
+	// r.Methods("GET").Path("/filesystem/upload/session/{id}")
+	r := reqBody.(getUploadSessionRequest)
+	req.URL.Path = "/filesystem/upload/session/" + url.PathEscape(r.ID)
+	addRequestCookies(ctx, req)
+	return nil
+}
+
+func encodeUploadChunkRequest(ctx context.Context, req *http.Request, reqBody interface{}) error {
+	// r.Methods("PUT").Path("/filesystem/upload/session/{id}")
+	r := reqBody.(uploadChunkRequest)
+	req.URL.Path = "/filesystem/upload/session/" + url.PathEscape(r.ID)
+	req.URL.RawQuery = url.Values{"offset": {strconv.FormatInt(r.Offset, 10)}}.Encode()
+	req.Body = r.Contents
+	addRequestCookies(ctx, req)
+	return nil
+}
+
+func decodeUploadSessionResponse(ctx context.Context, resp *http.Response) (interface{}, error) {
+	var response uploadSessionResponse
+	err := json.NewDecoder(resp.Body).Decode(&response)
+	return response, err
+}
+
+func encodeFinalizeUploadSessionRequest(ctx context.Context, req *http.Request, reqBody interface{}) error {
+	// r.Methods("POST").Path("/filesystem/upload/session/{id}/finalize")
+	r := reqBody.(finalizeUploadSessionRequest)
+	req.URL.Path = "/filesystem/upload/session/" + url.PathEscape(r.ID) + "/finalize"
+	addRequestCookies(ctx, req)
+	return nil
+}
+
+func decodeFinalizeUploadSessionResponse(ctx context.Context, resp *http.Response) (interface{}, error) {
+	var response finalizeUploadSessionResponse
+	err := json.NewDecoder(resp.Body).Decode(&response)
+	return response, err
+}
+
+func encodeListVersionsRequest(ctx context.Context, req *http.Request, reqBody interface{}) error {
+	// r.Methods("POST").Path("/filesystem/versions")
+	req.URL.Path = "/filesystem/versions"
+	return encodeRequest(ctx, req, reqBody)
+}
+
+func decodeListVersionsResponse(ctx context.Context, resp *http.Response) (interface{}, error) {
+	var response listVersionsResponse
+	err := json.NewDecoder(resp.Body).Decode(&response)
+	return response, err
+}
+
+func encodeDownloadVersionRequest(ctx context.Context, req *http.Request, reqBody interface{}) error {
+	// r.Methods("POST").Path("/filesystem/versions/download")
+	req.URL.Path = "/filesystem/versions/download"
+	if rng, ok := ctx.Value(ctxDownloadRangeKey{}).(downloadRange); ok {
+		req.Header.Set("Range", rng.header())
+	}
+	return encodeRequest(ctx, req, reqBody)
+}
+
+func encodeRestoreVersionRequest(ctx context.Context, req *http.Request, reqBody interface{}) error {
+	// r.Methods("POST").Path("/filesystem/versions/restore")
+	req.URL.Path = "/filesystem/versions/restore"
+	return encodeRequest(ctx, req, reqBody)
+}
+
+func decodeRestoreVersionResponse(ctx context.Context, resp *http.Response) (interface{}, error) {
+	var response restoreVersionResponse
+	err := json.NewDecoder(resp.Body).Decode(&response)
+	return response, err
+}
+
+func encodePruneVersionsRequest(ctx context.Context, req *http.Request, reqBody interface{}) error {
+	// r.Methods("POST").Path("/filesystem/versions/prune")
+	req.URL.Path = "/filesystem/versions/prune"
+	return encodeRequest(ctx, req, reqBody)
+}
+
+func decodePruneVersionsResponse(ctx context.Context, resp *http.Response) (interface{}, error) {
+	var response pruneVersionsResponse
+	err := json.NewDecoder(resp.Body).Decode(&response)
+	return response, err
+}
+
+func encodeListTrashRequest(ctx context.Context, req *http.Request, reqBody interface{}) error {
+	// r.Methods("GET", "POST").Path("/filesystem/trash")
+	req.URL.Path = "/filesystem/trash"
+	return encodeRequest(ctx, req, reqBody)
+}
+
+func decodeListTrashResponse(ctx context.Context, resp *http.Response) (interface{}, error) {
+	var response listTrashResponse
+	err := json.NewDecoder(resp.Body).Decode(&response)
+	return response, err
+}
+
+func encodeRestoreFromTrashRequest(ctx context.Context, req *http.Request, reqBody interface{}) error {
+	// r.Methods("POST").Path("/filesystem/trash/restore")
+	req.URL.Path = "/filesystem/trash/restore"
+	return encodeRequest(ctx, req, reqBody)
+}
+
+func decodeRestoreFromTrashResponse(ctx context.Context, resp *http.Response) (interface{}, error) {
+	var response restoreFromTrashResponse
+	err := json.NewDecoder(resp.Body).Decode(&response)
+	return response, err
+}
+
+func encodeEmptyTrashRequest(ctx context.Context, req *http.Request, reqBody interface{}) error {
+	// r.Methods("POST").Path("/filesystem/trash/empty")
+	req.URL.Path = "/filesystem/trash/empty"
+	return encodeRequest(ctx, req, reqBody)
+}
+
+func decodeEmptyTrashResponse(ctx context.Context, resp *http.Response) (interface{}, error) {
+	var response emptyTrashResponse
+	err := json.NewDecoder(resp.Body).Decode(&response)
+	return response, err
+}
+
+func encodeGetUsageRequest(ctx context.Context, req *http.Request, reqBody interface{}) error {
+	// r.Methods("GET").Path("/filesystem/usage")
+	req.URL.Path = "/filesystem/usage"
+	return encodeRequest(ctx, req, reqBody)
+}
+
+func decodeGetUsageResponse(ctx context.Context, resp *http.Response) (interface{}, error) {
+	var response getUsageResponse
+	err := json.NewDecoder(resp.Body).Decode(&response)
+	return response, err
+}
+
+func encodeSetQuotaRequest(ctx context.Context, req *http.Request, reqBody interface{}) error {
+	// r.Methods("POST").Path("/users/quota")
+	req.URL.Path = "/users/quota"
+	return encodeRequest(ctx, req, reqBody)
+}
+
+func decodeSetQuotaResponse(ctx context.Context, resp *http.Response) (interface{}, error) {
+	var response setQuotaResponse
+	err := json.NewDecoder(resp.Body).Decode(&response)
+	return response, err
+}
+
+func encodeGetChangesRequest(ctx context.Context, req *http.Request, reqBody interface{}) error {
+	// r.Methods("GET", "POST").Path("/filesystem/changes")
+	req.URL.Path = "/filesystem/changes"
+	req.URL.RawQuery = url.Values{"since": {reqBody.(getChangesRequest).Since}}.Encode()
+	addRequestCookies(ctx, req)
+	return nil
+}
+
+func decodeGetChangesResponse(ctx context.Context, resp *http.Response) (interface{}, error) {
+	var response getChangesResponse
 	err := json.NewDecoder(resp.Body).Decode(&response)
 	return response, err
 }
 
+func encodeWatchRequest(ctx context.Context, req *http.Request, reqBody interface{}) error {
+	// r.Methods("GET").Path("/filesystem/events")
+	req.URL.Path = "/filesystem/events"
+	req.URL.RawQuery = url.Values{"since": {reqBody.(watchRequest).Since}}.Encode()
+	req.Header.Set("Accept", "text/event-stream")
+	addRequestCookies(ctx, req)
+	return nil
+}
+
+// decodeWatchResponse reads the server-sent events in the background,
+// the response body is closed when the stream ends
+func decodeWatchResponse(ctx context.Context, resp *http.Response) (interface{}, error) {
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		var response watchResponse
+		err := json.NewDecoder(resp.Body).Decode(&response)
+		return response, err
+	}
+	changes := make(chan Changes)
+	go func() {
+		defer resp.Body.Close()
+		defer close(changes)
+		scanner := bufio.NewScanner(resp.Body)
+		scanner.Buffer(make([]byte, chunkSize), 16*1024*1024)
+		for scanner.Scan() {
+			data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+			if !ok {
+				continue
+			}
+			var page Changes
+			if err := json.Unmarshal([]byte(data), &page); err != nil {
+				return
+			}
+			select {
+			case changes <- page:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return watchResponse{Changes: changes}, nil
+}
+
 func encodeError(_ context.Context, err error, w http.ResponseWriter) {
 	if err == nil {
 		panic("encodeError with nil error")
@@ -359,7 +1566,265 @@ func codeFrom(err error) int {
 		return http.StatusBadRequest
 	case ErrAuthFailed.Error():
 		return http.StatusUnauthorized
+	case ErrInvalidArgument.Error(), ErrChecksumMismatch.Error(), ErrTooManyEntries.Error():
+		return http.StatusBadRequest
+	case ErrOffsetMismatch.Error(), ErrUploadIncomplete.Error(), ErrUploadInProgress.Error():
+		return http.StatusConflict
+	case ErrQuotaExceeded.Error():
+		return http.StatusInsufficientStorage
+	case ErrPathEscape.Error(), ErrForbidden.Error():
+		return http.StatusForbidden
+	case ErrShareExpired.Error():
+		return http.StatusGone
+	case ErrTypeNotAllowed.Error():
+		return http.StatusUnsupportedMediaType
+	case ErrTooManyUploads.Error():
+		return http.StatusTooManyRequests
 	default:
 		return http.StatusInternalServerError
 	}
 }
+
+func encodeCreateShareLinkRequest(ctx context.Context, req *http.Request, reqBody interface{}) error {
+	// r.Methods("POST").Path("/shares/create")
+	req.URL.Path = "/shares/create"
+	return encodeRequest(ctx, req, reqBody)
+}
+
+func decodeCreateShareLinkResponse(ctx context.Context, resp *http.Response) (interface{}, error) {
+	var response createShareLinkResponse
+	err := json.NewDecoder(resp.Body).Decode(&response)
+	return response, err
+}
+
+func encodeListShareLinksRequest(ctx context.Context, req *http.Request, reqBody interface{}) error {
+	// r.Methods("GET").Path("/shares")
+	req.URL.Path = "/shares"
+	addRequestCookies(ctx, req)
+	return nil
+}
+
+func decodeListShareLinksResponse(ctx context.Context, resp *http.Response) (interface{}, error) {
+	var response listShareLinksResponse
+	err := json.NewDecoder(resp.Body).Decode(&response)
+	return response, err
+}
+
+func encodeDeleteShareLinkRequest(ctx context.Context, req *http.Request, reqBody interface{}) error {
+	// r.Methods("POST", "DELETE").Path("/shares/delete")
+	req.URL.Path = "/shares/delete"
+	return encodeRequest(ctx, req, reqBody)
+}
+
+func decodeDeleteShareLinkResponse(ctx context.Context, resp *http.Response) (interface{}, error) {
+	var response deleteShareLinkResponse
+	err := json.NewDecoder(resp.Body).Decode(&response)
+	return response, err
+}
+
+func encodeGrantAccessRequest(ctx context.Context, req *http.Request, reqBody interface{}) error {
+	// r.Methods("POST").Path("/grants/create")
+	req.URL.Path = "/grants/create"
+	return encodeRequest(ctx, req, reqBody)
+}
+
+func decodeGrantAccessResponse(ctx context.Context, resp *http.Response) (interface{}, error) {
+	var response grantAccessResponse
+	err := json.NewDecoder(resp.Body).Decode(&response)
+	return response, err
+}
+
+func encodeListGrantsRequest(ctx context.Context, req *http.Request, reqBody interface{}) error {
+	// r.Methods("GET").Path("/grants")
+	req.URL.Path = "/grants"
+	addRequestCookies(ctx, req)
+	return nil
+}
+
+func decodeListGrantsResponse(ctx context.Context, resp *http.Response) (interface{}, error) {
+	var response listGrantsResponse
+	err := json.NewDecoder(resp.Body).Decode(&response)
+	return response, err
+}
+
+func encodeRevokeAccessRequest(ctx context.Context, req *http.Request, reqBody interface{}) error {
+	// r.Methods("POST", "DELETE").Path("/grants/delete")
+	req.URL.Path = "/grants/delete"
+	return encodeRequest(ctx, req, reqBody)
+}
+
+func decodeRevokeAccessResponse(ctx context.Context, resp *http.Response) (interface{}, error) {
+	var response revokeAccessResponse
+	err := json.NewDecoder(resp.Body).Decode(&response)
+	return response, err
+}
+
+func encodeListACLRequest(ctx context.Context, req *http.Request, reqBody interface{}) error {
+	// r.Methods("GET").Path("/acl")
+	req.URL.Path = "/acl"
+	addRequestCookies(ctx, req)
+	return nil
+}
+
+func decodeListACLResponse(ctx context.Context, resp *http.Response) (interface{}, error) {
+	var response listACLResponse
+	err := json.NewDecoder(resp.Body).Decode(&response)
+	return response, err
+}
+
+func encodeAddACLEntryRequest(ctx context.Context, req *http.Request, reqBody interface{}) error {
+	// r.Methods("POST").Path("/acl/create")
+	req.URL.Path = "/acl/create"
+	return encodeRequest(ctx, req, reqBody)
+}
+
+func decodeAddACLEntryResponse(ctx context.Context, resp *http.Response) (interface{}, error) {
+	var response addACLEntryResponse
+	err := json.NewDecoder(resp.Body).Decode(&response)
+	return response, err
+}
+
+func encodeDeleteACLEntryRequest(ctx context.Context, req *http.Request, reqBody interface{}) error {
+	// r.Methods("POST", "DELETE").Path("/acl/delete")
+	req.URL.Path = "/acl/delete"
+	return encodeRequest(ctx, req, reqBody)
+}
+
+func decodeDeleteACLEntryResponse(ctx context.Context, resp *http.Response) (interface{}, error) {
+	var response deleteACLEntryResponse
+	err := json.NewDecoder(resp.Body).Decode(&response)
+	return response, err
+}
+
+func encodeListGroupMembersRequest(ctx context.Context, req *http.Request, reqBody interface{}) error {
+	// r.Methods("GET").Path("/groups")
+	req.URL.Path = "/groups"
+	addRequestCookies(ctx, req)
+	return nil
+}
+
+func decodeListGroupMembersResponse(ctx context.Context, resp *http.Response) (interface{}, error) {
+	var response listGroupMembersResponse
+	err := json.NewDecoder(resp.Body).Decode(&response)
+	return response, err
+}
+
+func encodeAddGroupMemberRequest(ctx context.Context, req *http.Request, reqBody interface{}) error {
+	// r.Methods("POST").Path("/groups/add")
+	req.URL.Path = "/groups/add"
+	return encodeRequest(ctx, req, reqBody)
+}
+
+func decodeAddGroupMemberResponse(ctx context.Context, resp *http.Response) (interface{}, error) {
+	var response addGroupMemberResponse
+	err := json.NewDecoder(resp.Body).Decode(&response)
+	return response, err
+}
+
+func encodeRemoveGroupMemberRequest(ctx context.Context, req *http.Request, reqBody interface{}) error {
+	// r.Methods("POST", "DELETE").Path("/groups/remove")
+	req.URL.Path = "/groups/remove"
+	return encodeRequest(ctx, req, reqBody)
+}
+
+func decodeRemoveGroupMemberResponse(ctx context.Context, resp *http.Response) (interface{}, error) {
+	var response removeGroupMemberResponse
+	err := json.NewDecoder(resp.Body).Decode(&response)
+	return response, err
+}
+
+func encodeListUploadTypeRulesRequest(ctx context.Context, req *http.Request, reqBody interface{}) error {
+	// r.Methods("GET").Path("/upload-types")
+	req.URL.Path = "/upload-types"
+	addRequestCookies(ctx, req)
+	return nil
+}
+
+func decodeListUploadTypeRulesResponse(ctx context.Context, resp *http.Response) (interface{}, error) {
+	var response listUploadTypeRulesResponse
+	err := json.NewDecoder(resp.Body).Decode(&response)
+	return response, err
+}
+
+func encodeAddUploadTypeRuleRequest(ctx context.Context, req *http.Request, reqBody interface{}) error {
+	// r.Methods("POST").Path("/upload-types/create")
+	req.URL.Path = "/upload-types/create"
+	return encodeRequest(ctx, req, reqBody)
+}
+
+func decodeAddUploadTypeRuleResponse(ctx context.Context, resp *http.Response) (interface{}, error) {
+	var response addUploadTypeRuleResponse
+	err := json.NewDecoder(resp.Body).Decode(&response)
+	return response, err
+}
+
+func encodeDeleteUploadTypeRuleRequest(ctx context.Context, req *http.Request, reqBody interface{}) error {
+	// r.Methods("POST", "DELETE").Path("/upload-types/delete")
+	req.URL.Path = "/upload-types/delete"
+	return encodeRequest(ctx, req, reqBody)
+}
+
+func decodeDeleteUploadTypeRuleResponse(ctx context.Context, resp *http.Response) (interface{}, error) {
+	var response deleteUploadTypeRuleResponse
+	err := json.NewDecoder(resp.Body).Decode(&response)
+	return response, err
+}
+
+func encodeGetSharedRequest(ctx context.Context, req *http.Request, reqBody interface{}) error {
+	// r.Methods("GET").Path("/s/{token}")
+	r := reqBody.(getSharedRequest)
+	req.URL.Path = "/s/" + url.PathEscape(r.Token)
+	query := url.Values{"dir_path": {r.DirPath}}
+	if r.Depth != 0 {
+		query.Set("depth", strconv.Itoa(r.Depth))
+	}
+	if r.Limit != 0 {
+		query.Set("limit", strconv.Itoa(r.Limit))
+	}
+	if r.Desc {
+		query.Set("desc", "true")
+	}
+	for key, value := range map[string]string{"sort": string(r.Sort), "type": string(r.Type), "glob": r.Glob, "cursor": r.Cursor} {
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
+	req.URL.RawQuery = query.Encode()
+	if r.Password != "" {
+		req.Header.Set("X-Share-Password", r.Password)
+	}
+	return nil
+}
+
+func decodeGetSharedResponse(ctx context.Context, resp *http.Response) (interface{}, error) {
+	var response getSharedResponse
+	err := json.NewDecoder(resp.Body).Decode(&response)
+	return response, err
+}
+
+func encodeDownloadSharedRequest(ctx context.Context, req *http.Request, reqBody interface{}) error {
+	// r.Methods("GET").Path("/s/{token}/download")
+	r := reqBody.(downloadSharedRequest)
+	req.URL.Path = "/s/" + url.PathEscape(r.Token) + "/download"
+	query := url.Values{"path": {r.Path}}
+	if r.Format != "" {
+		query.Set("format", string(r.Format))
+	}
+	req.URL.RawQuery = query.Encode()
+	if r.Password != "" {
+		req.Header.Set("X-Share-Password", r.Password)
+	}
+	return nil
+}
+
+func encodeUploadSharedRequest(ctx context.Context, req *http.Request, reqBody interface{}) error {
+	// r.Methods("POST").Path("/s/{token}/upload")
+	r := reqBody.(uploadSharedRequest)
+	req.URL.Path = "/s/" + url.PathEscape(r.Token) + "/upload"
+	req.URL.RawQuery = url.Values{"dir_path": {r.DirPath}, "file_name": {r.FileName}}.Encode()
+	req.Body = r.Contents
+	if r.Password != "" {
+		req.Header.Set("X-Share-Password", r.Password)
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package storagesvc
+
+import (
+	"context"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"remote-storage/server/authsvc"
+	"remote-storage/server/common"
+)
+
+// fakeAuthService accepts the name of the user as the token
+type fakeAuthService struct{}
+
+func (fakeAuthService) Login(ctx context.Context, login string, password string) (authsvc.AuthCookie, error) {
+	return authsvc.AuthCookie{}, authsvc.ErrWrongCredentials
+}
+
+func (fakeAuthService) RefreshToken(ctx context.Context, tokenStr string) (authsvc.AuthCookie, error) {
+	return authsvc.AuthCookie{}, authsvc.ErrTokenExpired
+}
+
+func (fakeAuthService) ValidateToken(ctx context.Context, tokenStr string) (common.UserInf, error) {
+	return common.UserInf{Name: tokenStr, RootDir: tokenStr + "/"}, nil
+}
+
+// newTestServer serves the test service over HTTP, requests are authenticated
+// with the token cookie holding the name of the user
+func newTestServer(t *testing.T) (*service, *httptest.Server) {
+	t.Helper()
+	svc := newTestService(t)
+	svc.authSvc = fakeAuthService{}
+	ts := httptest.NewServer(MakeHttpHandler(svc))
+	t.Cleanup(ts.Close)
+	return svc, ts
+}
+
+// getAs makes the GET request of the user with the headers given as name and value pairs
+func getAs(t *testing.T, user, url string, headers ...string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.AddCookie(&http.Cookie{Name: "token", Value: user})
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func readBody(t *testing.T, resp *http.Response) string {
+	t.Helper()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestDownloadRange(t *testing.T) {
+	svc, ts := newTestServer(t)
+	upload(t, svc, "alice", "", "a.txt", "0123456789")
+	download := ts.URL + "/filesystem/download?dir_path=&file_name=a.txt"
+
+	resp := getAs(t, "alice", download, "Range", "bytes=2-4")
+	if resp.StatusCode != http.StatusPartialContent {
+		t.Fatalf("single range: %s", resp.Status)
+	}
+	if got := resp.Header.Get("Content-Range"); got != "bytes 2-4/10" {
+		t.Fatalf("Content-Range = %q", got)
+	}
+	if got := readBody(t, resp); got != "234" {
+		t.Fatalf("single range = %q, want 234", got)
+	}
+
+	resp = getAs(t, "alice", download, "Range", "bytes=0-1,7-")
+	if resp.StatusCode != http.StatusPartialContent {
+		t.Fatalf("multiple ranges: %s", resp.Status)
+	}
+	mediaType, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/byteranges" {
+		t.Fatalf("Content-Type = %q, %v", resp.Header.Get("Content-Type"), err)
+	}
+	parts := multipart.NewReader(resp.Body, params["boundary"])
+	for _, want := range []struct{ contentRange, data string }{
+		{"bytes 0-1/10", "01"},
+		{"bytes 7-9/10", "789"},
+	} {
+		part, err := parts.NextPart()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := part.Header.Get("Content-Range"); got != want.contentRange || string(data) != want.data {
+			t.Fatalf("part %q = %q, want %q = %q", got, data, want.contentRange, want.data)
+		}
+	}
+	if _, err := parts.NextPart(); err != io.EOF {
+		t.Fatalf("more parts than ranges: %v", err)
+	}
+
+	resp = getAs(t, "alice", download, "Range", "bytes=20-")
+	if resp.StatusCode != http.StatusRequestedRangeNotSatisfiable {
+		t.Fatalf("range past the end: %s", resp.Status)
+	}
+}
+
+func TestDownloadConditional(t *testing.T) {
+	svc, ts := newTestServer(t)
+	upload(t, svc, "alice", "", "a.txt", "contents")
+	download := ts.URL + "/filesystem/download?dir_path=&file_name=a.txt"
+
+	resp := getAs(t, "alice", download)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("download: %s", resp.Status)
+	}
+	etag, modified := resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+	if etag == "" || modified == "" {
+		t.Fatalf("ETag = %q, Last-Modified = %q", etag, modified)
+	}
+
+	for _, header := range [][]string{
+		{"If-None-Match", etag},
+		{"If-Modified-Since", modified},
+	} {
+		resp := getAs(t, "alice", download, header...)
+		if resp.StatusCode != http.StatusNotModified {
+			t.Fatalf("%s: %s, want 304", header[0], resp.Status)
+		}
+		if got := readBody(t, resp); got != "" {
+			t.Fatalf("%s: body %q", header[0], got)
+		}
+	}
+
+	// the changed file has another ETag
+	upload(t, svc, "alice", "", "a.txt", "changed contents")
+	resp = getAs(t, "alice", download, "If-None-Match", etag)
+	if resp.StatusCode != http.StatusOK || readBody(t, resp) != "changed contents" {
+		t.Fatalf("changed file: %s", resp.Status)
+	}
+}
+
+func TestClientDownloadRange(t *testing.T) {
+	svc, ts := newTestServer(t)
+	upload(t, svc, "alice", "", "a.txt", "0123456789")
+	e, err := MakeClientEndpoints(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.cookies = make(map[string]*http.Cookie)
+	e.AddCookie(&http.Cookie{Name: "token", Value: "alice"})
+
+	for _, tc := range []struct {
+		offset, length int64
+		want           string
+	}{
+		{3, 4, "3456"},
+		{6, 0, "6789"},
+		{0, 100, "0123456789"},
+	} {
+		file, info, err := e.DownloadRange(context.Background(), "", "a.txt", tc.offset, tc.length)
+		if err != nil {
+			t.Fatalf("DownloadRange(%d, %d): %v", tc.offset, tc.length, err)
+		}
+		data, err := io.ReadAll(file)
+		file.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != tc.want || info.Size != int64(len(tc.want)) || info.Name != "a.txt" {
+			t.Fatalf("DownloadRange(%d, %d) = %q, %+v, want %q", tc.offset, tc.length, data, info, tc.want)
+		}
+	}
+}
@@ -0,0 +1,324 @@
+package storagesvc
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	fs "remote-storage/server/storagesvc/repository/filesystem"
+)
+
+const (
+	defaultTrashDir       = ".trash"
+	defaultTrashRetention = 30 * 24 * time.Hour
+	trashRecordExt        = ".json"
+	trashPurgeInterval    = time.Hour
+)
+
+// TrashItem is a deleted file or directory which can be restored to its original location
+type TrashItem struct {
+	ID string `json:"id"`
+	// DirPath is the original path to the directory of the item
+	DirPath string `json:"dir_path"`
+	// FileName is the original name of the item
+	FileName string    `json:"file_name"`
+	IsDir    bool      `json:"is_dir"`
+	Size     int64     `json:"size"`
+	Deleted  time.Time `json:"deleted"`
+}
+
+// trashStore keeps deleted items in the directory of the backend.
+// Every user has own directory where each item is stored next to its JSON record.
+type trashStore struct {
+	backend   fs.Backend
+	rootDir   string
+	retention time.Duration
+}
+
+func newTrashStore(backend fs.Backend, rootDir string, retention time.Duration) *trashStore {
+	if rootDir == "" {
+		rootDir = defaultTrashDir
+	}
+	if retention <= 0 {
+		retention = defaultTrashRetention
+	}
+	return &trashStore{
+		backend:   backend,
+		rootDir:   rootDir,
+		retention: retention,
+	}
+}
+
+// userDir returns the directory keeping the trash of the user,
+// the root directory of the user is escaped into a single path element
+func (t *trashStore) userDir(userRootDir string) string {
+	return path.Join(t.rootDir, "user-"+url.PathEscape(userRootDir))
+}
+
+func isTrashItemID(id string) bool {
+	return id != "" && !strings.ContainsAny(id, `/\.`)
+}
+
+func writeJSONFile(backend fs.Backend, filePath string, v interface{}) error {
+	file, err := backend.Create(filePath)
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(file).Encode(v); err != nil {
+		fs.Abort(file)
+		return err
+	}
+	return file.Close()
+}
+
+func readJSONFile(backend fs.Backend, filePath string, v interface{}) error {
+	file, err := backend.OpenFile(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return json.NewDecoder(file).Decode(v)
+}
+
+// treeSize returns the total size of the files in the tree
+func treeSize(info fs.FileInfo) int64 {
+	if !info.IsDir {
+		return info.Size
+	}
+	var size int64
+	for _, child := range info.Children {
+		size += treeSize(child)
+	}
+	return size
+}
+
+// put moves the file into the trash of the user, dirPath must be cleaned
+func (t *trashStore) put(userRootDir, dirPath, fileName string) (TrashItem, error) {
+	var filePath = joinPath(userRootDir, dirPath, fileName)
+	info, err := t.backend.Stat(filePath)
+	if err != nil {
+		return TrashItem{}, err
+	}
+	if info.IsDir {
+		tree, err := t.backend.TraverseDirectory(filePath)
+		if err != nil {
+			return TrashItem{}, err
+		}
+		info.Size = treeSize(tree)
+	}
+	suffix, err := newRandomID()
+	if err != nil {
+		return TrashItem{}, err
+	}
+	now := time.Now()
+	item := TrashItem{
+		ID:       strconv.FormatInt(now.UnixNano(), 10) + "-" + suffix[:8],
+		DirPath:  dirPath,
+		FileName: fileName,
+		IsDir:    info.IsDir,
+		Size:     info.Size,
+		Deleted:  now.UTC(),
+	}
+	dir := t.userDir(userRootDir)
+	if err := fs.MkdirAll(t.backend, dir, 0755); err != nil {
+		return item, err
+	}
+	// the record is written first, so there are no items without records
+	recordPath := path.Join(dir, item.ID+trashRecordExt)
+	if err := writeJSONFile(t.backend, recordPath, item); err != nil {
+		t.backend.RemoveAll(recordPath)
+		return item, err
+	}
+	if err := t.backend.Rename(filePath, path.Join(dir, item.ID)); err != nil {
+		t.backend.RemoveAll(recordPath)
+		return item, err
+	}
+	return item, nil
+}
+
+// list returns the items in the trash of the user, the most recently deleted first
+func (t *trashStore) list(userRootDir string) ([]TrashItem, error) {
+	res := []TrashItem{}
+	dir := t.userDir(userRootDir)
+	tree, err := t.backend.TraverseDirectory(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return res, nil
+		}
+		return res, err
+	}
+	for _, child := range tree.Children {
+		if child.IsDir || !strings.HasSuffix(child.Name, trashRecordExt) {
+			continue
+		}
+		var item TrashItem
+		if err := readJSONFile(t.backend, path.Join(dir, child.Name), &item); err != nil {
+			continue
+		}
+		res = append(res, item)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Deleted.After(res[j].Deleted)
+	})
+	return res, nil
+}
+
+func (t *trashStore) get(userRootDir, id string) (TrashItem, error) {
+	var item TrashItem
+	if !isTrashItemID(id) {
+		return item, ErrNotFound
+	}
+	err := readJSONFile(t.backend, path.Join(t.userDir(userRootDir), id+trashRecordExt), &item)
+	if err != nil {
+		return item, ErrNotFound
+	}
+	return item, nil
+}
+
+// itemPath returns the path to the deleted item in the trash
+func (t *trashStore) itemPath(userRootDir, id string) string {
+	return path.Join(t.userDir(userRootDir), id)
+}
+
+// remove permanently removes the item and its record
+func (t *trashStore) remove(userRootDir, id string) error {
+	if err := t.backend.RemoveAll(t.itemPath(userRootDir, id)); err != nil {
+		return err
+	}
+	return t.backend.RemoveAll(path.Join(t.userDir(userRootDir), id+trashRecordExt))
+}
+
+// purgeExpired permanently removes items of all users deleted earlier than the retention period
+func (t *trashStore) purgeExpired() error {
+	tree, err := t.backend.TraverseDirectory(t.rootDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, userDir := range tree.Children {
+		escaped, ok := strings.CutPrefix(userDir.Name, "user-")
+		if !userDir.IsDir || !ok {
+			continue
+		}
+		userRootDir, err := url.PathUnescape(escaped)
+		if err != nil {
+			continue
+		}
+		items, err := t.list(userRootDir)
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			if time.Since(item.Deleted) < t.retention {
+				continue
+			}
+			if err := t.remove(userRootDir, item.ID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// runJanitor periodically purges expired items until ctx is done
+func (t *trashStore) runJanitor(ctx context.Context) {
+	ticker := time.NewTicker(trashPurgeInterval)
+	defer ticker.Stop()
+	for {
+		t.purgeExpired()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (svc *service) ListTrash(ctx context.Context) ([]TrashItem, error) {
+	userRootDir := getUserInfFromCtx(ctx).RootDir
+	res, err := svc.trash.list(userRootDir)
+	if err != nil {
+		return res, getErrorType(err)
+	}
+	return res, nil
+}
+
+// RestoreFromTrash moves the item back to its original location,
+// the missing parent directories are created again.
+// If the location is taken, conflict defines whether the restoring fails,
+// the item gets a free name or replaces the existing file. ConflictSkip leaves
+// the item in the trash, directories are not merged.
+func (svc *service) RestoreFromTrash(ctx context.Context, id string, conflict ConflictPolicy) (Result, error) {
+	var res Result
+	userRootDir := getUserInfFromCtx(ctx).RootDir
+	conflict, err := parseConflictPolicy(string(conflict))
+	if err != nil {
+		return res, err
+	}
+	item, err := svc.trash.get(userRootDir, id)
+	if err != nil {
+		return res, err
+	}
+	dirPath, dir, err := svc.resolveDir(ctx, item.DirPath)
+	if err != nil {
+		return res, err
+	}
+	if err := fs.MkdirAll(svc.backend, dirPath, 0755); err != nil {
+		return res, getErrorType(err)
+	}
+
+	filePath, err := svc.resolvePath(ctx, dir, item.FileName)
+	if err != nil {
+		return res, err
+	}
+	res.Path, res.Action, err = svc.resolveConflict(ctx, "", filePath, item.IsDir, conflict)
+	if err != nil {
+		return res, err
+	}
+	if res.Action == ActionSkipped || res.Action == ActionMerged {
+		res.Action = ActionSkipped
+		return res, nil
+	}
+	replaced, err := exists(svc.backend, res.Path)
+	if err != nil {
+		return res, getErrorType(err)
+	}
+	if err := svc.backend.Rename(svc.trash.itemPath(userRootDir, item.ID), res.Path); err != nil {
+		return res, getErrorType(err)
+	}
+	if replaced {
+		svc.recordChange(ctx, ChangeModified, res.Path, "")
+	} else {
+		svc.recordChange(ctx, ChangeCreated, res.Path, "")
+	}
+	if err := svc.trash.remove(userRootDir, item.ID); err != nil {
+		return res, getErrorType(err)
+	}
+	return res, nil
+}
+
+// EmptyTrash permanently removes all items in the trash of the user
+func (svc *service) EmptyTrash(ctx context.Context) (int, error) {
+	userRootDir := getUserInfFromCtx(ctx).RootDir
+	items, err := svc.trash.list(userRootDir)
+	if err != nil {
+		return 0, getErrorType(err)
+	}
+	var removed int
+	for _, item := range items {
+		if err := svc.trash.remove(userRootDir, item.ID); err != nil {
+			return removed, getErrorType(err)
+		}
+		removed++
+		svc.usage.add(userRootDir, -item.Size)
+	}
+	return removed, nil
+}
@@ -0,0 +1,223 @@
+package storagesvc
+
+import (
+	"io"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+// download returns the contents of the file of the user
+func download(t *testing.T, svc *service, name, dirPath, fileName string) string {
+	t.Helper()
+	file, _, err := svc.Download(userContext(name), dirPath, fileName)
+	if err != nil {
+		t.Fatalf("Download(%q, %q): %v", dirPath, fileName, err)
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// trashItems returns the items in the trash of alice
+func trashItems(t *testing.T, svc *service) []TrashItem {
+	t.Helper()
+	items, err := svc.ListTrash(userContext("alice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return items
+}
+
+func TestDeleteMovesToTrash(t *testing.T) {
+	svc := newTestService(t)
+	ctx := userContext("alice")
+	if _, err := svc.MkDir(ctx, "", "docs", ConflictFail); err != nil {
+		t.Fatal(err)
+	}
+	upload(t, svc, "alice", "docs", "a.txt", "contents")
+	if _, err := svc.Delete(ctx, "docs", "a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.backend.Stat("alice/docs/a.txt"); !os.IsNotExist(err) {
+		t.Fatalf("Stat of the deleted file = %v, want not exist", err)
+	}
+	items := trashItems(t, svc)
+	if len(items) != 1 {
+		t.Fatalf("trash = %+v, want 1 item", items)
+	}
+	item := items[0]
+	if item.DirPath != "docs" || item.FileName != "a.txt" || item.IsDir || item.Size != 8 {
+		t.Fatalf("item = %+v", item)
+	}
+	if items, err := svc.ListTrash(userContext("bob")); err != nil || len(items) != 0 {
+		t.Fatalf("trash of bob = %+v, %v", items, err)
+	}
+
+	// the deleted parent directory is created again
+	if _, err := svc.Delete(ctx, "", "docs"); err != nil {
+		t.Fatal(err)
+	}
+	res, err := svc.RestoreFromTrash(ctx, item.ID, ConflictFail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Path != "alice/docs/a.txt" || res.Action != ActionCreated {
+		t.Fatalf("RestoreFromTrash = %+v", res)
+	}
+	if got := download(t, svc, "alice", "docs", "a.txt"); got != "contents" {
+		t.Fatalf("restored file = %q", got)
+	}
+	if _, err := svc.RestoreFromTrash(ctx, item.ID, ConflictFail); err != ErrNotFound {
+		t.Fatalf("second RestoreFromTrash = %v, want ErrNotFound", err)
+	}
+	if items := trashItems(t, svc); len(items) != 1 || items[0].FileName != "docs" || !items[0].IsDir {
+		t.Fatalf("trash = %+v, want the docs directory", items)
+	}
+}
+
+func TestRestoreFromTrashConflict(t *testing.T) {
+	tests := []struct {
+		conflict  ConflictPolicy
+		err       error
+		action    Action
+		path      string
+		contents  string
+		trashLeft int
+	}{
+		{ConflictFail, ErrAlreadyExists, "", "", "new", 1},
+		{ConflictSkip, nil, ActionSkipped, "alice/a.txt", "new", 1},
+		{ConflictRename, nil, ActionRenamed, "alice/a (1).txt", "new", 0},
+		{ConflictOverwrite, nil, ActionOverwritten, "alice/a.txt", "old", 0},
+	}
+	for _, tc := range tests {
+		t.Run(string(tc.conflict), func(t *testing.T) {
+			svc := newTestService(t)
+			ctx := userContext("alice")
+			upload(t, svc, "alice", "", "a.txt", "old")
+			if _, err := svc.Delete(ctx, "", "a.txt"); err != nil {
+				t.Fatal(err)
+			}
+			upload(t, svc, "alice", "", "a.txt", "new")
+			id := trashItems(t, svc)[0].ID
+
+			res, err := svc.RestoreFromTrash(ctx, id, tc.conflict)
+			if err != tc.err {
+				t.Fatalf("RestoreFromTrash = %v, want %v", err, tc.err)
+			}
+			if err == nil && (res.Action != tc.action || res.Path != tc.path) {
+				t.Fatalf("RestoreFromTrash = %+v, want %s to %s", res, tc.action, tc.path)
+			}
+			if got := download(t, svc, "alice", "", "a.txt"); got != tc.contents {
+				t.Fatalf("a.txt = %q, want %q", got, tc.contents)
+			}
+			if tc.action == ActionRenamed {
+				if got := download(t, svc, "alice", "", path.Base(tc.path)); got != "old" {
+					t.Fatalf("restored file = %q, want old", got)
+				}
+			}
+			if items := trashItems(t, svc); len(items) != tc.trashLeft {
+				t.Fatalf("trash = %+v, want %d items", items, tc.trashLeft)
+			}
+		})
+	}
+}
+
+func TestEmptyTrash(t *testing.T) {
+	svc := newTestService(t)
+	ctx := userContext("alice")
+	if _, err := svc.MkDir(ctx, "", "docs", ConflictFail); err != nil {
+		t.Fatal(err)
+	}
+	upload(t, svc, "alice", "docs", "a.txt", "a")
+	upload(t, svc, "alice", "", "b.txt", "b")
+	upload(t, svc, "bob", "", "c.txt", "c")
+	for _, p := range [][2]string{{"", "docs"}, {"", "b.txt"}} {
+		if _, err := svc.Delete(ctx, p[0], p[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := svc.Delete(userContext("bob"), "", "c.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err := svc.EmptyTrash(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 2 {
+		t.Fatalf("removed = %d, want 2", removed)
+	}
+	if items := trashItems(t, svc); len(items) != 0 {
+		t.Fatalf("trash = %+v, want empty", items)
+	}
+	tree, err := svc.backend.TraverseDirectory(svc.trash.userDir("alice/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tree.Children) != 0 {
+		t.Fatalf("trash directory keeps %+v", tree.Children)
+	}
+	if items, err := svc.ListTrash(userContext("bob")); err != nil || len(items) != 1 {
+		t.Fatalf("trash of bob = %+v, %v", items, err)
+	}
+}
+
+func TestPurgeExpiredTrash(t *testing.T) {
+	svc := newTestService(t)
+	svc.trash = newTrashStore(svc.backend, "", time.Hour)
+	ctx := userContext("alice")
+	upload(t, svc, "alice", "", "old.txt", "old")
+	upload(t, svc, "alice", "", "new.txt", "new")
+	upload(t, svc, "bob", "", "old.txt", "old")
+	for _, user := range []string{"alice", "bob"} {
+		if _, err := svc.Delete(userContext(user), "", "old.txt"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := svc.Delete(ctx, "", "new.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the old files were deleted before the retention period
+	var expired []string
+	for _, userRootDir := range []string{"alice/", "bob/"} {
+		items, err := svc.trash.list(userRootDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, item := range items {
+			if item.FileName != "old.txt" {
+				continue
+			}
+			item.Deleted = item.Deleted.Add(-2 * time.Hour)
+			record := path.Join(svc.trash.userDir(userRootDir), item.ID+trashRecordExt)
+			if err := writeJSONFile(svc.backend, record, item); err != nil {
+				t.Fatal(err)
+			}
+			expired = append(expired, svc.trash.itemPath(userRootDir, item.ID))
+		}
+	}
+
+	if len(expired) != 2 {
+		t.Fatalf("expired items = %v, want 2", expired)
+	}
+	if err := svc.trash.purgeExpired(); err != nil {
+		t.Fatal(err)
+	}
+	if items := trashItems(t, svc); len(items) != 1 || items[0].FileName != "new.txt" {
+		t.Fatalf("trash = %+v, want new.txt", items)
+	}
+	if items, err := svc.ListTrash(userContext("bob")); err != nil || len(items) != 0 {
+		t.Fatalf("trash of bob = %+v, %v", items, err)
+	}
+	for _, p := range expired {
+		if _, err := svc.backend.Stat(p); !os.IsNotExist(err) {
+			t.Fatalf("Stat of the purged item %s = %v, want not exist", p, err)
+		}
+	}
+}
@@ -0,0 +1,467 @@
+package storagesvc
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultUploadSessionTTL = 24 * time.Hour
+	uploadSessionExt        = ".json"
+	uploadSessionDataExt    = ".data"
+	// maxUploadSessions is the amount of sessions every user is allowed to keep open
+	maxUploadSessions = 32
+)
+
+// UploadSession describes the state of a resumable upload.
+// Chunks are accepted only at Offset, which is the amount of bytes committed so far.
+type UploadSession struct {
+	ID       string    `json:"id"`
+	DirPath  string    `json:"dir_path"`
+	FileName string    `json:"file_name"`
+	Size     int64     `json:"size"`
+	Offset   int64     `json:"offset"`
+	Expires  time.Time `json:"expires"`
+	// Conflict is applied when the session is finalized if the file exists
+	Conflict ConflictPolicy `json:"conflict,omitempty"`
+	// Checksum is the expected checksum of the whole file verified when the session is finalized
+	Checksum Checksum `json:"checksum"`
+}
+
+// uploadSessionRecord is the UploadSession persisted on disk
+type uploadSessionRecord struct {
+	UploadSession
+	UserRootDir string `json:"user_root_dir"`
+}
+
+// uploadSessionStore keeps upload sessions in the local directory,
+// every session is stored as a JSON description and a file with the committed data,
+// so sessions survive the restart of the service.
+// The declared size of every open session is counted in the usage of its user.
+type uploadSessionStore struct {
+	dir string
+	ttl time.Duration
+	// expired is called for every session removed by the janitor
+	expired func(rec uploadSessionRecord)
+
+	mu    sync.Mutex
+	locks map[string]*sessionLock
+	// creating serializes counting and creating sessions
+	creating sync.Mutex
+}
+
+// sessionLock is the lock of the session kept while anybody holds or waits for it
+type sessionLock struct {
+	sync.Mutex
+	refs int
+}
+
+func newUploadSessionStore(dir string, ttl time.Duration) (*uploadSessionStore, error) {
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), "storagesvc-uploads")
+	}
+	if ttl <= 0 {
+		ttl = defaultUploadSessionTTL
+	}
+	err := os.MkdirAll(dir, 0700)
+	return &uploadSessionStore{
+		dir:   dir,
+		ttl:   ttl,
+		locks: make(map[string]*sessionLock),
+	}, err
+}
+
+// lock locks the session with the taken id and returns the function unlocking it,
+// the lock is dropped when it is released by everybody, so unknown ids leave nothing behind
+func (s *uploadSessionStore) lock(id string) func() {
+	s.mu.Lock()
+	l, ok := s.locks[id]
+	if !ok {
+		l = &sessionLock{}
+		s.locks[id] = l
+	}
+	l.refs++
+	s.mu.Unlock()
+	l.Lock()
+	return func() {
+		l.Unlock()
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		l.refs--
+		if l.refs == 0 {
+			delete(s.locks, id)
+		}
+	}
+}
+
+func (s *uploadSessionStore) recordPath(id string) string {
+	return filepath.Join(s.dir, id+uploadSessionExt)
+}
+
+func (s *uploadSessionStore) dataPath(id string) string {
+	return filepath.Join(s.dir, id+uploadSessionDataExt)
+}
+
+func newRandomID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// readRecord returns the description of the session, expired sessions are returned too
+func (s *uploadSessionStore) readRecord(id string) (uploadSessionRecord, error) {
+	var rec uploadSessionRecord
+	f, err := os.Open(s.recordPath(id))
+	if err != nil {
+		return rec, err
+	}
+	defer f.Close()
+	err = json.NewDecoder(f).Decode(&rec)
+	return rec, err
+}
+
+// list returns the sessions of the user kept in the store,
+// expired sessions are returned until the janitor removes them
+func (s *uploadSessionStore) list(userRootDir string) ([]uploadSessionRecord, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var res []uploadSessionRecord
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), uploadSessionExt)
+		if !ok {
+			continue
+		}
+		rec, err := s.readRecord(id)
+		if err != nil || rec.UserRootDir != userRootDir {
+			continue
+		}
+		res = append(res, rec)
+	}
+	return res, nil
+}
+
+// create stores the new session, nothing is left behind if it fails
+func (s *uploadSessionStore) create(userRootDir, dirPath, fileName string, size int64, checksum Checksum, conflict ConflictPolicy) (uploadSessionRecord, error) {
+	id, err := newRandomID()
+	if err != nil {
+		return uploadSessionRecord{}, err
+	}
+	rec := uploadSessionRecord{
+		UploadSession: UploadSession{
+			ID:       id,
+			DirPath:  dirPath,
+			FileName: fileName,
+			Size:     size,
+			Expires:  time.Now().Add(s.ttl),
+			Conflict: conflict,
+			Checksum: checksum,
+		},
+		UserRootDir: userRootDir,
+	}
+	data, err := os.Create(s.dataPath(id))
+	if err == nil {
+		err = data.Close()
+	}
+	if err == nil {
+		err = s.save(rec)
+	}
+	if err != nil {
+		s.remove(id)
+	}
+	return rec, err
+}
+
+// save atomically replaces the description of the session
+func (s *uploadSessionStore) save(rec uploadSessionRecord) error {
+	tmp, err := os.CreateTemp(s.dir, rec.ID+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := json.NewEncoder(tmp).Encode(rec); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.recordPath(rec.ID))
+}
+
+// get returns the session belonging to the user, expired sessions are not found
+func (s *uploadSessionStore) get(userRootDir, id string) (uploadSessionRecord, error) {
+	var rec uploadSessionRecord
+	if id == "" || strings.ContainsAny(id, `/\.`) {
+		return rec, ErrNotFound
+	}
+	rec, err := s.readRecord(id)
+	if os.IsNotExist(err) {
+		return rec, ErrNotFound
+	}
+	if err != nil {
+		return rec, ErrUnknownError
+	}
+	if rec.UserRootDir != userRootDir || time.Now().After(rec.Expires) {
+		return rec, ErrNotFound
+	}
+	return rec, nil
+}
+
+// writeChunk appends contents to the committed data of the session.
+// Whatever was written is committed even if reading contents fails,
+// so the client is able to resume from the new offset.
+func (s *uploadSessionStore) writeChunk(rec uploadSessionRecord, offset int64, contents io.Reader) (uploadSessionRecord, error) {
+	if offset != rec.Offset {
+		return rec, ErrOffsetMismatch
+	}
+	data, err := os.OpenFile(s.dataPath(rec.ID), os.O_WRONLY, 0600)
+	if err != nil {
+		return rec, err
+	}
+	defer data.Close()
+	// drop the data left by an interrupted write that wasn't committed
+	if err := data.Truncate(offset); err != nil {
+		return rec, err
+	}
+	if _, err := data.Seek(offset, io.SeekStart); err != nil {
+		return rec, err
+	}
+	// read one byte over the limit to find out if the chunk is too large
+	n, copyErr := io.Copy(data, io.LimitReader(contents, rec.Size-offset+1))
+	if n > rec.Size-offset {
+		n = rec.Size - offset
+		copyErr = ErrInvalidArgument
+	}
+	if err := data.Truncate(offset + n); err != nil {
+		return rec, err
+	}
+	if err := data.Sync(); err != nil {
+		return rec, err
+	}
+	rec.Offset = offset + n
+	rec.Expires = time.Now().Add(s.ttl)
+	if err := s.save(rec); err != nil {
+		return rec, err
+	}
+	return rec, copyErr
+}
+
+func (s *uploadSessionStore) remove(id string) {
+	os.Remove(s.recordPath(id))
+	os.Remove(s.dataPath(id))
+}
+
+// purgeExpired removes the sessions which were not used during the ttl
+func (s *uploadSessionStore) purgeExpired() {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), uploadSessionExt)
+		if !ok {
+			continue
+		}
+		unlock := s.lock(id)
+		rec, err := s.readRecord(id)
+		if err != nil || time.Now().After(rec.Expires) {
+			s.remove(id)
+			if err == nil && s.expired != nil {
+				s.expired(rec)
+			}
+		}
+		unlock()
+	}
+}
+
+// runJanitor periodically purges expired sessions until ctx is done
+func (s *uploadSessionStore) runJanitor(ctx context.Context) {
+	interval := s.ttl / 2
+	if interval > time.Hour {
+		interval = time.Hour
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		s.purgeExpired()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// CreateUploadSession fails with ErrQuotaExceeded at once if the file of the size doesn't fit the quota,
+// the size is counted in the usage of the user until the session is finalized or expires.
+// ErrTooManyUploads is returned if the user has too many open sessions.
+// The checksum of the whole file is kept in the session and verified when it is finalized.
+func (svc *service) CreateUploadSession(ctx context.Context, dirPath, fileName string, size int64, checksum Checksum, conflict ConflictPolicy) (UploadSession, error) {
+	userInf := getUserInfFromCtx(ctx)
+	userRootDir := userInf.RootDir
+	if size < 0 {
+		return UploadSession{}, ErrInvalidArgument
+	}
+	if err := checksum.validate(); err != nil {
+		return UploadSession{}, err
+	}
+	if conflict == "" {
+		conflict = ConflictOverwrite
+	}
+	conflict, err := parseConflictPolicy(string(conflict))
+	if err != nil {
+		return UploadSession{}, err
+	}
+	filePath, err := svc.resolvePath(ctx, dirPath, fileName)
+	if err != nil {
+		return UploadSession{}, err
+	}
+	if conflict == ConflictFail {
+		// the session is not going to be finalized anyway
+		if _, _, err := svc.resolveConflict(ctx, "", filePath, false, conflict); err != nil {
+			return UploadSession{}, err
+		}
+	}
+	dirFullPath, dirPath, err := svc.resolveDir(ctx, dirPath)
+	if err != nil {
+		return UploadSession{}, err
+	}
+	dir, err := svc.backend.Stat(dirFullPath)
+	if err != nil {
+		return UploadSession{}, getErrorType(err)
+	}
+	if !dir.IsDir {
+		return UploadSession{}, ErrNotFound
+	}
+	svc.uploads.creating.Lock()
+	defer svc.uploads.creating.Unlock()
+	sessions, err := svc.uploads.list(userRootDir)
+	if err != nil {
+		return UploadSession{}, ErrUnknownError
+	}
+	var open int
+	for _, rec := range sessions {
+		if time.Now().Before(rec.Expires) {
+			open++
+		}
+	}
+	if open >= maxUploadSessions {
+		return UploadSession{}, ErrTooManyUploads
+	}
+	quota, err := svc.quotaOf(ctx)
+	if err != nil {
+		return UploadSession{}, err
+	}
+	if err := svc.usage.reserve(userRootDir, quota, size); err != nil {
+		return UploadSession{}, getErrorType(err)
+	}
+	rec, err := svc.uploads.create(userRootDir, dirPath, fileName, size, checksum, conflict)
+	if err != nil {
+		svc.usage.unreserve(userRootDir, size)
+		return UploadSession{}, ErrUnknownError
+	}
+	svc.usage.settle(userRootDir, size)
+	return rec.UploadSession, nil
+}
+
+func (svc *service) GetUploadSession(ctx context.Context, id string) (UploadSession, error) {
+	userRootDir := getUserInfFromCtx(ctx).RootDir
+	unlock := svc.uploads.lock(id)
+	defer unlock()
+	rec, err := svc.uploads.get(userRootDir, id)
+	if err != nil {
+		return UploadSession{}, err
+	}
+	return rec.UploadSession, nil
+}
+
+func (svc *service) UploadChunk(ctx context.Context, id string, offset int64, contents io.ReadCloser) (UploadSession, error) {
+	defer contents.Close()
+	userRootDir := getUserInfFromCtx(ctx).RootDir
+	unlock := svc.uploads.lock(id)
+	defer unlock()
+	rec, err := svc.uploads.get(userRootDir, id)
+	if err != nil {
+		return UploadSession{}, err
+	}
+	rec, err = svc.uploads.writeChunk(rec, offset, contents)
+	if err != nil {
+		if err != ErrOffsetMismatch && err != ErrInvalidArgument {
+			err = ErrUnknownError
+		}
+		return rec.UploadSession, err
+	}
+	return rec.UploadSession, nil
+}
+
+// FinalizeUploadSession moves the completely uploaded data of the session into place.
+// The data is written into the staging area and then renamed into place,
+// so readers never see a partially written file. ErrChecksumMismatch is returned
+// if the data differs from the checksum given when the session was created.
+func (svc *service) FinalizeUploadSession(ctx context.Context, id string) (Result, error) {
+	userRootDir := getUserInfFromCtx(ctx).RootDir
+	unlock := svc.uploads.lock(id)
+	defer unlock()
+	rec, err := svc.uploads.get(userRootDir, id)
+	if err != nil {
+		return Result{}, err
+	}
+	if rec.Offset != rec.Size {
+		return Result{}, ErrUploadIncomplete
+	}
+	filePath, err := svc.resolvePath(ctx, rec.DirPath, rec.FileName)
+	if err != nil {
+		return Result{}, err
+	}
+	stagePath, end, err := svc.staging.begin(filePath)
+	if err != nil {
+		return Result{}, err
+	}
+	defer end()
+	data, err := os.Open(svc.uploads.dataPath(rec.ID))
+	if err != nil {
+		return Result{}, ErrUnknownError
+	}
+	defer data.Close()
+	// the data is counted as the staged file instead of the session from now on
+	svc.usage.add(userRootDir, -rec.Size)
+	stagedPath, w, err := svc.stage(ctx, rec.FileName, data, rec.Checksum)
+	if err != nil {
+		svc.usage.add(userRootDir, rec.Size)
+		if err == ErrChecksumMismatch {
+			return Result{}, err
+		}
+		return Result{}, getErrorType(err)
+	}
+	conflict := rec.Conflict
+	if conflict == "" {
+		// sessions created before the policy was kept overwrite the file
+		conflict = ConflictOverwrite
+	}
+	res, err := svc.commit(ctx, stagedPath, stagePath, conflict, w)
+	if err != nil {
+		svc.usage.add(userRootDir, rec.Size)
+		return res, err
+	}
+	if stagePath != filePath && res.Action == ActionCreated {
+		res.Action = ActionRenamed
+	}
+	svc.uploads.remove(rec.ID)
+	return res, nil
+}
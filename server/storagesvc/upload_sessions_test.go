@@ -0,0 +1,178 @@
+package storagesvc
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	fs "remote-storage/server/storagesvc/repository/filesystem"
+)
+
+// stagedFiles returns the paths of the files left in the staging area
+func stagedFiles(t *testing.T, svc *service) []string {
+	t.Helper()
+	tree, err := svc.backend.TraverseDirectory(svc.staging.rootDir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	var res []string
+	var walk func(dir string, info fs.FileInfo)
+	walk = func(dir string, info fs.FileInfo) {
+		for _, child := range info.Children {
+			if child.IsDir {
+				walk(path.Join(dir, child.Name), child)
+			} else {
+				res = append(res, path.Join(dir, child.Name))
+			}
+		}
+	}
+	walk(svc.staging.rootDir, tree)
+	return res
+}
+
+func sha256Of(contents string) string {
+	sum := sha256.Sum256([]byte(contents))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestUploadSessionsCountTowardsUsage(t *testing.T) {
+	svc := newTestService(t)
+	setQuota(t, svc, "alice", 100)
+	ctx := userContext("alice")
+
+	first, err := svc.CreateUploadSession(ctx, "", "a.txt", 60, Checksum{}, ConflictFail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.CreateUploadSession(ctx, "", "b.txt", 60, Checksum{}, ConflictFail); err != ErrQuotaExceeded {
+		t.Fatalf("second session: got %v, want %v", err, ErrQuotaExceeded)
+	}
+	// the usage computed again still counts the open session
+	if used, err := svc.usage.compute("alice/"); err != nil || used != 60 {
+		t.Fatalf("computed usage %d, %v, want 60", used, err)
+	}
+
+	if _, err := svc.UploadChunk(ctx, first.ID, 0, io.NopCloser(strings.NewReader(strings.Repeat("x", 60)))); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.FinalizeUploadSession(ctx, first.ID); err != nil {
+		t.Fatal(err)
+	}
+	usage, err := svc.GetUsage(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.Used != 60 {
+		t.Fatalf("used %d after finalizing, want 60", usage.Used)
+	}
+}
+
+func TestExpiredUploadSessionReleasesUsage(t *testing.T) {
+	svc := newTestService(t)
+	svc.uploads.ttl = time.Millisecond
+	setQuota(t, svc, "alice", 100)
+	ctx := userContext("alice")
+
+	if _, err := svc.CreateUploadSession(ctx, "", "a.txt", 60, Checksum{}, ConflictFail); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	svc.uploads.purgeExpired()
+	if _, err := svc.CreateUploadSession(ctx, "", "b.txt", 60, Checksum{}, ConflictFail); err != nil {
+		t.Fatalf("after the session expired: %v", err)
+	}
+}
+
+func TestUploadSessionsAreLimited(t *testing.T) {
+	svc := newTestService(t)
+	ctx := userContext("alice")
+
+	for i := 0; i < maxUploadSessions; i++ {
+		if _, err := svc.CreateUploadSession(ctx, "", "a.txt", 1, Checksum{}, ConflictOverwrite); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := svc.CreateUploadSession(ctx, "", "a.txt", 1, Checksum{}, ConflictOverwrite); err != ErrTooManyUploads {
+		t.Fatalf("got %v, want %v", err, ErrTooManyUploads)
+	}
+	// the limit is kept for every user
+	if _, err := svc.CreateUploadSession(userContext("bob"), "", "a.txt", 1, Checksum{}, ConflictOverwrite); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUploadSessionLocksAreDropped(t *testing.T) {
+	svc := newTestService(t)
+	ctx := userContext("alice")
+
+	for i := 0; i < 10; i++ {
+		if _, err := svc.GetUploadSession(ctx, "unknown"+strings.Repeat("x", i)); err != ErrNotFound {
+			t.Fatalf("got %v, want %v", err, ErrNotFound)
+		}
+	}
+	session, err := svc.CreateUploadSession(ctx, "", "a.txt", 1, Checksum{}, ConflictFail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.UploadChunk(ctx, session.ID, 0, io.NopCloser(strings.NewReader("x"))); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.FinalizeUploadSession(ctx, session.ID); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(svc.uploads.locks); n != 0 {
+		t.Fatalf("%d locks are kept", n)
+	}
+}
+
+func TestFinalizeUploadSessionVerifiesChecksum(t *testing.T) {
+	svc := newTestService(t)
+	ctx := userContext("alice")
+	if _, err := svc.CreateUploadSession(ctx, "", "a.txt", 8, Checksum{SHA256: "xyz"}, ConflictFail); err != ErrInvalidArgument {
+		t.Fatalf("CreateUploadSession with the malformed checksum = %v, want ErrInvalidArgument", err)
+	}
+
+	checksum := Checksum{SHA256: sha256Of("contents")}
+	session, err := svc.CreateUploadSession(ctx, "", "a.txt", 8, checksum, ConflictFail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the checksum is kept in the persisted session
+	if session, err := svc.GetUploadSession(ctx, session.ID); err != nil || session.Checksum != checksum {
+		t.Fatalf("GetUploadSession = %+v, %v", session, err)
+	}
+	if _, err := svc.UploadChunk(ctx, session.ID, 0, io.NopCloser(strings.NewReader("CONTENTS"))); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.FinalizeUploadSession(ctx, session.ID); err != ErrChecksumMismatch {
+		t.Fatalf("FinalizeUploadSession = %v, want ErrChecksumMismatch", err)
+	}
+	if _, err := svc.backend.Stat("alice/a.txt"); !os.IsNotExist(err) {
+		t.Fatalf("Stat of the rejected file = %v, want not exist", err)
+	}
+	if staged := stagedFiles(t, svc); len(staged) != 0 {
+		t.Fatalf("staged files are left: %v", staged)
+	}
+
+	session, err = svc.CreateUploadSession(ctx, "", "a.txt", 8, checksum, ConflictFail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.UploadChunk(ctx, session.ID, 0, io.NopCloser(strings.NewReader("contents"))); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.FinalizeUploadSession(ctx, session.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got := download(t, svc, "alice", "", "a.txt"); got != "contents" {
+		t.Fatalf("a.txt = %q", got)
+	}
+}
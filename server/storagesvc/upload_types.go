@@ -0,0 +1,221 @@
+package storagesvc
+
+import (
+	"context"
+	"database/sql"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"remote-storage/server/db"
+)
+
+// sniffLen is the size of the beginning of the contents the MIME type is detected from
+const sniffLen = 512
+
+// signatureTypes are the MIME types http.DetectContentType recognizes by magic bytes,
+// the extension claiming them is not trusted if the magic bytes don't match
+var signatureTypes = map[string]bool{
+	"application/pdf":    true,
+	"application/zip":    true,
+	"application/x-gzip": true,
+	"application/gzip":   true,
+	"image/png":          true,
+	"image/jpeg":         true,
+	"image/gif":          true,
+	"image/webp":         true,
+	"image/bmp":          true,
+}
+
+// genericTypes are the MIME types detected by magic bytes which the extension refines,
+// such as the office documents which are zip archives
+var genericTypes = map[string]bool{
+	"application/octet-stream": true,
+	"application/zip":          true,
+	"text/plain":               true,
+	"text/xml":                 true,
+}
+
+// mediaType returns the MIME type without parameters in lower case
+func mediaType(contentType string) string {
+	if t, _, err := mime.ParseMediaType(contentType); err == nil {
+		return t
+	}
+	return strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+}
+
+// detectContentType returns the MIME type of the file with the name beginning with head.
+// The magic bytes decide if they identify the type, otherwise the extension does
+// unless it claims the type the magic bytes would have identified.
+func detectContentType(name string, head []byte) string {
+	sniffed := http.DetectContentType(head)
+	byExt := mime.TypeByExtension(strings.ToLower(path.Ext(name)))
+	if byExt == "" || !genericTypes[mediaType(sniffed)] {
+		return sniffed
+	}
+	if signatureTypes[mediaType(byExt)] && mediaType(byExt) != mediaType(sniffed) {
+		return sniffed
+	}
+	return byExt
+}
+
+// UploadTypeRule restricts the MIME types of the files the user or the group uploads.
+// Users without rules upload files of any type. The file is rejected if its type matches
+// any Deny pattern of the rules of the user, or if the rules have Allow patterns
+// and the type matches none of them. Patterns are "type/subtype", "type/*" or "*/*".
+type UploadTypeRule struct {
+	ID            int64       `json:"id"`
+	Principal     string      `json:"principal"`
+	PrincipalType GranteeType `json:"principal_type,omitempty"`
+	Allow         []string    `json:"allow"`
+	Deny          []string    `json:"deny"`
+	Created       time.Time   `json:"created"`
+}
+
+func uploadTypeRuleFrom(rule db.UploadTypeRule) UploadTypeRule {
+	return UploadTypeRule{
+		ID:            rule.ID,
+		Principal:     rule.Principal,
+		PrincipalType: GranteeType(rule.PrincipalType),
+		Allow:         append([]string{}, rule.Allow...),
+		Deny:          append([]string{}, rule.Deny...),
+		Created:       rule.Created,
+	}
+}
+
+// parseTypePattern returns the pattern in lower case, ErrInvalidArgument if it is malformed
+func parseTypePattern(s string) (string, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	typ, subtype, _ := strings.Cut(s, "/")
+	valid := func(part string) bool {
+		return part != "" && (part == "*" || !strings.ContainsAny(part, "*/ ,;"))
+	}
+	if !valid(typ) || !valid(subtype) || typ == "*" && subtype != "*" {
+		return "", ErrInvalidArgument
+	}
+	return s, nil
+}
+
+// matchesType reports whether the MIME type without parameters matches any of the patterns
+func matchesType(patterns []string, typ string) bool {
+	for _, pattern := range patterns {
+		prefix, subtype, _ := strings.Cut(pattern, "/")
+		switch {
+		case pattern == "*/*", pattern == typ:
+			return true
+		case subtype == "*" && strings.HasPrefix(typ, prefix+"/"):
+			return true
+		}
+	}
+	return false
+}
+
+// checkUploadType returns ErrTypeNotAllowed if the rules of the caller don't allow uploading the type,
+// uploads into directories shared with the caller are checked against the rules of the caller
+// rather than of the owner, uploads through share links are checked against the rules of the owner
+func (svc *service) checkUploadType(ctx context.Context, contentType string) error {
+	rules, err := svc.database.GetUploadTypeRulesFor(getCallerFromCtx(ctx))
+	if err != nil {
+		return err
+	}
+	typ := mediaType(contentType)
+	restricted, allowed := false, false
+	for _, rule := range rules {
+		if matchesType(rule.Deny, typ) {
+			return ErrTypeNotAllowed
+		}
+		if len(rule.Allow) > 0 {
+			restricted = true
+			allowed = allowed || matchesType(rule.Allow, typ)
+		}
+	}
+	if restricted && !allowed {
+		return ErrTypeNotAllowed
+	}
+	return nil
+}
+
+// ListUploadTypeRules returns all upload type rules, only admins are allowed to list them
+func (svc *service) ListUploadTypeRules(ctx context.Context) ([]UploadTypeRule, error) {
+	if err := svc.checkAdmin(ctx); err != nil {
+		return nil, err
+	}
+	rules, err := svc.database.GetUploadTypeRules()
+	if err != nil {
+		return nil, err
+	}
+	res := make([]UploadTypeRule, 0, len(rules))
+	for _, rule := range rules {
+		res = append(res, uploadTypeRuleFrom(rule))
+	}
+	return res, nil
+}
+
+// AddUploadTypeRule stores the upload type rule, only admins are allowed to add rules
+func (svc *service) AddUploadTypeRule(ctx context.Context, rule UploadTypeRule) (UploadTypeRule, error) {
+	if err := svc.checkAdmin(ctx); err != nil {
+		return UploadTypeRule{}, err
+	}
+	if rule.PrincipalType == "" {
+		rule.PrincipalType = GranteeUser
+	}
+	if rule.PrincipalType != GranteeUser && rule.PrincipalType != GranteeGroup || rule.Principal == "" {
+		return UploadTypeRule{}, ErrInvalidArgument
+	}
+	if len(rule.Allow) == 0 && len(rule.Deny) == 0 {
+		return UploadTypeRule{}, ErrInvalidArgument
+	}
+	if rule.PrincipalType == GranteeUser {
+		if _, err := svc.database.GetUser(rule.Principal); err == sql.ErrNoRows {
+			return UploadTypeRule{}, ErrNotFound
+		} else if err != nil {
+			return UploadTypeRule{}, err
+		}
+	}
+	record := db.UploadTypeRule{
+		Principal:     rule.Principal,
+		PrincipalType: string(rule.PrincipalType),
+		Created:       time.Now(),
+	}
+	var err error
+	if record.Allow, err = parseTypePatterns(rule.Allow); err != nil {
+		return UploadTypeRule{}, err
+	}
+	if record.Deny, err = parseTypePatterns(rule.Deny); err != nil {
+		return UploadTypeRule{}, err
+	}
+	record.ID, err = svc.database.CreateUploadTypeRule(record)
+	if err != nil {
+		return UploadTypeRule{}, err
+	}
+	return uploadTypeRuleFrom(record), nil
+}
+
+// parseTypePatterns returns the patterns in lower case without duplicates
+func parseTypePatterns(patterns []string) ([]string, error) {
+	res := []string{}
+	for _, s := range patterns {
+		pattern, err := parseTypePattern(s)
+		if err != nil {
+			return nil, err
+		}
+		if !hasTag(res, pattern) {
+			res = append(res, pattern)
+		}
+	}
+	return res, nil
+}
+
+// DeleteUploadTypeRule removes the upload type rule, only admins are allowed to remove rules
+func (svc *service) DeleteUploadTypeRule(ctx context.Context, id int64) error {
+	if err := svc.checkAdmin(ctx); err != nil {
+		return err
+	}
+	err := svc.database.DeleteUploadTypeRule(id)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	return err
+}
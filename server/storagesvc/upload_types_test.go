@@ -0,0 +1,39 @@
+package storagesvc
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestUploadTypeOfSharedDirectoryFollowsCaller(t *testing.T) {
+	svc := newTestService(t)
+	svc.admins["alice"] = true
+	alice, bob := userContext("alice"), userContext("bob")
+	if _, err := svc.MkDir(alice, "", "inbox", ConflictFail); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.GrantAccess(alice, GrantOptions{FileName: "inbox", Grantee: "bob", Permission: PermissionWrite}); err != nil {
+		t.Fatal(err)
+	}
+	for user, deny := range map[string]string{"alice": "image/*", "bob": "text/*"} {
+		if _, err := svc.AddUploadTypeRule(alice, UploadTypeRule{Principal: user, Deny: []string{deny}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	shared := SharingMiddleware(svc.database, svc.backend)(svc)
+	uploadAs := func(ctx context.Context, fileName, contents string) error {
+		_, err := shared.Upload(ctx, "Shared with me/alice/inbox", fileName, io.NopCloser(strings.NewReader(contents)), Checksum{}, ConflictFail)
+		return err
+	}
+	if err := uploadAs(bob, "a.txt", "text"); err != ErrTypeNotAllowed {
+		t.Fatalf("upload denied to the caller = %v, want ErrTypeNotAllowed", err)
+	}
+	// the rules of the owner don't restrict the caller
+	if err := uploadAs(bob, "b.png", "\x89PNG\r\n\x1a\n"); err != nil {
+		t.Fatalf("upload allowed to the caller = %v", err)
+	}
+	// the rules of the caller don't restrict the owner
+	upload(t, svc, "alice", "inbox", "c.txt", "text")
+}
@@ -0,0 +1,327 @@
+package storagesvc
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	fs "remote-storage/server/storagesvc/repository/filesystem"
+)
+
+// usageRefreshInterval is the time after which the usage of the user is computed again,
+// so changes made by other instances of the service are taken into account
+const usageRefreshInterval = time.Minute
+
+// Usage describes the amount of bytes stored by the user
+type Usage struct {
+	// Used is the size of the files of the user including their versions, the trash and the open upload sessions
+	Used int64 `json:"used"`
+	// Available is the amount of bytes the user is still able to store, -1 means unlimited
+	Available int64 `json:"available"`
+	// Quota is the amount of bytes the user is allowed to store, 0 means unlimited
+	Quota int64 `json:"quota"`
+}
+
+type usageEntry struct {
+	// stored is the size of the data kept for the user, it is replaced when the usage is computed again
+	stored int64
+	// reserved is the size of the data being written, computing the usage doesn't change it
+	reserved int64
+	known    bool
+	computed time.Time
+	// scan is closed when the running computation is done, nil if nothing is computed
+	scan chan struct{}
+	// delta are the changes of stored made while the usage is computed
+	delta int64
+	err   error
+}
+
+// usageTracker keeps the amount of bytes used by every user.
+// Usage is computed from the backend the first time it is needed,
+// then it is kept up to date by the writes of the service.
+// The usage is periodically computed again in the background,
+// the last known usage is used meanwhile.
+type usageTracker struct {
+	backend  fs.Backend
+	trash    *trashStore
+	uploads  *uploadSessionStore
+	versions *versionStore
+
+	mu      sync.Mutex
+	entries map[string]*usageEntry
+}
+
+func newUsageTracker(backend fs.Backend, trash *trashStore, uploads *uploadSessionStore, versions *versionStore) *usageTracker {
+	return &usageTracker{
+		backend:  backend,
+		trash:    trash,
+		uploads:  uploads,
+		versions: versions,
+		entries:  make(map[string]*usageEntry),
+	}
+}
+
+// compute returns the size of the files of the user, their versions, the items in the trash
+// and the declared sizes of the open upload sessions
+func (u *usageTracker) compute(userRootDir string) (int64, error) {
+	tree, err := u.backend.TraverseDirectory(userRootDir)
+	if err != nil {
+		return 0, err
+	}
+	used := treeSize(tree)
+	versions, err := u.backend.TraverseDirectory(u.versions.dirOf(userRootDir))
+	if err != nil && !os.IsNotExist(err) {
+		return 0, err
+	}
+	used += treeSize(versions)
+	items, err := u.trash.list(userRootDir)
+	if err != nil {
+		return 0, err
+	}
+	for _, item := range items {
+		used += item.Size
+	}
+	sessions, err := u.uploads.list(userRootDir)
+	if err != nil {
+		return 0, err
+	}
+	for _, rec := range sessions {
+		used += rec.Size
+	}
+	return used, nil
+}
+
+// entry returns the usage of the user, u.mu must be held.
+// If the usage is not known yet, u.mu is released while it is computed.
+// The outdated usage is computed again in the background.
+func (u *usageTracker) entry(userRootDir string) (*usageEntry, error) {
+	e, ok := u.entries[userRootDir]
+	if !ok {
+		e = &usageEntry{}
+		u.entries[userRootDir] = e
+	}
+	if e.scan == nil && (!e.known || time.Since(e.computed) >= usageRefreshInterval) {
+		e.scan = make(chan struct{})
+		e.delta = 0
+		go u.scan(userRootDir, e)
+	}
+	if !e.known {
+		scan := e.scan
+		u.mu.Unlock()
+		<-scan
+		u.mu.Lock()
+		if !e.known {
+			return nil, e.err
+		}
+	}
+	return e, nil
+}
+
+// scan computes the usage of the user, the changes made meanwhile are added to the result
+func (u *usageTracker) scan(userRootDir string, e *usageEntry) {
+	stored, err := u.compute(userRootDir)
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if err == nil {
+		e.stored = stored + e.delta
+		e.known = true
+		e.computed = time.Now()
+	}
+	e.err = err
+	close(e.scan)
+	e.scan = nil
+}
+
+func (u *usageTracker) used(userRootDir string) (int64, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	e, err := u.entry(userRootDir)
+	if err != nil {
+		return 0, err
+	}
+	return e.stored + e.reserved, nil
+}
+
+// check returns ErrQuotaExceeded if n more bytes don't fit the quota of the user,
+// non-positive quota means unlimited
+func (u *usageTracker) check(userRootDir string, quota, n int64) error {
+	if quota <= 0 || n <= 0 {
+		return nil
+	}
+	used, err := u.used(userRootDir)
+	if err != nil {
+		return err
+	}
+	if used+n > quota {
+		return ErrQuotaExceeded
+	}
+	return nil
+}
+
+// reserve reserves n bytes being written by the user if they fit the quota,
+// the reservation is either stored by settle or dropped by unreserve
+func (u *usageTracker) reserve(userRootDir string, quota, n int64) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	e, err := u.entry(userRootDir)
+	if err != nil {
+		return err
+	}
+	if quota > 0 && n > 0 && e.stored+e.reserved+n > quota {
+		return ErrQuotaExceeded
+	}
+	e.reserved += n
+	return nil
+}
+
+// unreserve drops the reservation of n bytes which were not stored
+func (u *usageTracker) unreserve(userRootDir string, n int64) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if e, ok := u.entries[userRootDir]; ok {
+		e.reserved -= n
+	}
+}
+
+// settle turns the reservation of n bytes into the stored data
+func (u *usageTracker) settle(userRootDir string, n int64) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if e, ok := u.entries[userRootDir]; ok {
+		e.reserved -= n
+		e.addStored(n)
+	}
+}
+
+// add changes the size of the data stored by the user by delta bytes
+func (u *usageTracker) add(userRootDir string, delta int64) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if e, ok := u.entries[userRootDir]; ok {
+		e.addStored(delta)
+	}
+}
+
+func (e *usageEntry) addStored(delta int64) {
+	e.stored += delta
+	if e.scan != nil {
+		e.delta += delta
+	}
+}
+
+// quotaWriter reserves the space for every write in the usage of the user,
+// so writing fails with ErrQuotaExceeded as soon as the quota is reached
+type quotaWriter struct {
+	w           io.Writer
+	usage       *usageTracker
+	userRootDir string
+	quota       int64
+	written     int64
+}
+
+func (q *quotaWriter) Write(p []byte) (int, error) {
+	if err := q.usage.reserve(q.userRootDir, q.quota, int64(len(p))); err != nil {
+		return 0, err
+	}
+	n, err := q.w.Write(p)
+	q.written += int64(n)
+	if n < len(p) {
+		q.usage.unreserve(q.userRootDir, int64(len(p)-n))
+	}
+	return n, err
+}
+
+// release drops the space reserved by the written data which is not stored
+func (q *quotaWriter) release() {
+	q.usage.unreserve(q.userRootDir, q.written)
+}
+
+// settle counts the written data as stored
+func (q *quotaWriter) settle() {
+	q.usage.settle(q.userRootDir, q.written)
+}
+
+// newQuotaWriter returns the writer limited by the quota of the user of the context, see quotaOf
+func (svc *service) newQuotaWriter(ctx context.Context, w io.Writer, quota int64) *quotaWriter {
+	return &quotaWriter{
+		w:           w,
+		usage:       svc.usage,
+		userRootDir: getUserInfFromCtx(ctx).RootDir,
+		quota:       quota,
+	}
+}
+
+// quotaOf returns the quota of the user of the context. It is read from the database
+// every time it is enforced, so the changed quota applies to the tokens issued before.
+func (svc *service) quotaOf(ctx context.Context) (int64, error) {
+	user, err := svc.database.GetUser(getUserInfFromCtx(ctx).Name)
+	if err == sql.ErrNoRows {
+		return 0, ErrAuthFailed
+	}
+	if err != nil {
+		return 0, ErrUnknownError
+	}
+	return user.Quota, nil
+}
+
+// sizeOf returns the total size of the files at filePath, 0 if nothing exists there
+func (svc *service) sizeOf(filePath string) (int64, error) {
+	info, err := svc.backend.Stat(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	if !info.IsDir {
+		return info.Size, nil
+	}
+	tree, err := svc.backend.TraverseDirectory(filePath)
+	if err != nil {
+		return 0, err
+	}
+	return treeSize(tree), nil
+}
+
+// SetQuota sets the amount of bytes the user is allowed to store, 0 means unlimited.
+// Only admins are allowed to set quotas, the quota applies to the next write of the user.
+func (svc *service) SetQuota(ctx context.Context, user string, quota int64) error {
+	if err := svc.checkAdmin(ctx); err != nil {
+		return err
+	}
+	if user == "" || quota < 0 {
+		return ErrInvalidArgument
+	}
+	if _, err := svc.database.GetUser(user); err == sql.ErrNoRows {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+	return svc.database.SetQuota(user, quota)
+}
+
+func (svc *service) GetUsage(ctx context.Context) (Usage, error) {
+	quota, err := svc.quotaOf(ctx)
+	if err != nil {
+		return Usage{}, err
+	}
+	used, err := svc.usage.used(getUserInfFromCtx(ctx).RootDir)
+	if err != nil {
+		return Usage{}, getErrorType(err)
+	}
+	res := Usage{
+		Used:      used,
+		Available: -1,
+		Quota:     quota,
+	}
+	if quota > 0 {
+		res.Available = quota - used
+		if res.Available < 0 {
+			res.Available = 0
+		}
+	}
+	return res, nil
+}
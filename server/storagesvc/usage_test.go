@@ -0,0 +1,143 @@
+package storagesvc
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOverwritesCountVersions(t *testing.T) {
+	svc := newTestService(t)
+	setQuota(t, svc, "alice", 25)
+	ctx := userContext("alice")
+	write := func() error {
+		contents := io.NopCloser(strings.NewReader("0123456789"))
+		_, err := svc.Upload(ctx, "", "a.txt", contents, Checksum{}, ConflictOverwrite)
+		return err
+	}
+	for i := 0; i < 2; i++ {
+		if err := write(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the file and its version are 20 bytes
+	if err := write(); err != ErrQuotaExceeded {
+		t.Fatalf("got %v, want %v", err, ErrQuotaExceeded)
+	}
+	if used, err := svc.usage.compute("alice/"); err != nil || used != 20 {
+		t.Fatalf("computed usage %d, %v, want 20", used, err)
+	}
+	if _, err := svc.PruneVersions(ctx, 0, time.Nanosecond); err != nil {
+		t.Fatal(err)
+	}
+	if usage, _ := svc.GetUsage(ctx); usage.Used != 10 {
+		t.Fatalf("used %d after pruning, want 10", usage.Used)
+	}
+	if err := write(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReservationsSurviveRecompute(t *testing.T) {
+	svc := newTestService(t)
+	upload(t, svc, "alice", "", "a.txt", "0123456789")
+
+	if err := svc.usage.reserve("alice/", 100, 50); err != nil {
+		t.Fatal(err)
+	}
+	svc.usage.mu.Lock()
+	svc.usage.entries["alice/"].computed = time.Time{}
+	svc.usage.mu.Unlock()
+	// the outdated usage starts computing again, the reservation is kept
+	svc.usage.used("alice/")
+	waitUsageScan(t, svc.usage, "alice/")
+	if used, err := svc.usage.used("alice/"); err != nil || used != 60 {
+		t.Fatalf("used %d, %v, want 60", used, err)
+	}
+	svc.usage.settle("alice/", 50)
+	if used, _ := svc.usage.used("alice/"); used != 60 {
+		t.Fatalf("used %d after settling, want 60", used)
+	}
+}
+
+func TestMoveKeepsUsage(t *testing.T) {
+	svc := newTestService(t)
+	upload(t, svc, "alice", "", "a.txt", "0123456789")
+	upload(t, svc, "alice", "", "b.txt", "01234")
+	ctx := userContext("alice")
+	before, err := svc.GetUsage(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := svc.Rename(ctx, "", "a.txt", "b.txt", ConflictOverwrite); err != nil {
+		t.Fatal(err)
+	}
+	after, err := svc.GetUsage(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.Used != before.Used {
+		t.Fatalf("used %d after moving, want %d", after.Used, before.Used)
+	}
+	if used, _ := svc.usage.compute("alice/"); used != after.Used {
+		t.Fatalf("computed usage %d, tracked %d", used, after.Used)
+	}
+}
+
+func waitUsageScan(t *testing.T, u *usageTracker, userRootDir string) {
+	t.Helper()
+	u.mu.Lock()
+	scan := u.entries[userRootDir].scan
+	u.mu.Unlock()
+	if scan != nil {
+		<-scan
+	}
+}
+
+func TestSetQuotaAppliesToNextWrite(t *testing.T) {
+	svc := newTestService(t)
+	svc.admins["alice"] = true
+	admin, ctx := userContext("alice"), userContext("bob")
+	upload(t, svc, "bob", "", "a.txt", "0123456789")
+
+	if err := svc.SetQuota(ctx, "bob", 15); err != ErrForbidden {
+		t.Fatalf("SetQuota of the user = %v, want ErrForbidden", err)
+	}
+	if err := svc.SetQuota(admin, "carol", 15); err != ErrNotFound {
+		t.Fatalf("SetQuota of the unknown user = %v, want ErrNotFound", err)
+	}
+	if err := svc.SetQuota(admin, "bob", 15); err != nil {
+		t.Fatal(err)
+	}
+	// the context of the request made before the change gets the new quota
+	usage, err := svc.GetUsage(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.Quota != 15 || usage.Available != 5 {
+		t.Fatalf("usage = %+v, want 5 of 15 available", usage)
+	}
+	contents := io.NopCloser(strings.NewReader("0123456789"))
+	if _, err := svc.Upload(ctx, "", "b.txt", contents, Checksum{}, ConflictFail); err != ErrQuotaExceeded {
+		t.Fatalf("Upload over the quota = %v, want ErrQuotaExceeded", err)
+	}
+	if _, err := svc.Copy(ctx, "", "a.txt", "", ConflictRename); err != ErrQuotaExceeded {
+		t.Fatalf("Copy over the quota = %v, want ErrQuotaExceeded", err)
+	}
+	if _, err := svc.CreateUploadSession(ctx, "", "b.txt", 10, Checksum{}, ConflictFail); err != ErrQuotaExceeded {
+		t.Fatalf("CreateUploadSession over the quota = %v, want ErrQuotaExceeded", err)
+	}
+
+	if err := svc.SetQuota(admin, "bob", 0); err != nil {
+		t.Fatal(err)
+	}
+	if usage, _ := svc.GetUsage(ctx); usage.Quota != 0 || usage.Available != -1 {
+		t.Fatalf("usage = %+v, want unlimited", usage)
+	}
+	contents = io.NopCloser(strings.NewReader("0123456789"))
+	if _, err := svc.Upload(ctx, "", "b.txt", contents, Checksum{}, ConflictFail); err != nil {
+		t.Fatalf("Upload without the quota: %v", err)
+	}
+}
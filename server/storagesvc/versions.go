@@ -0,0 +1,309 @@
+package storagesvc
+
+import (
+	"context"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	fs "remote-storage/server/storagesvc/repository/filesystem"
+)
+
+const defaultVersionsDir = ".versions"
+
+// FileVersion is the previous content of a file kept when the file was overwritten
+type FileVersion struct {
+	ID string `json:"id"`
+	// Size of the content
+	Size int64 `json:"size"`
+	// Created is the time the content was overwritten
+	Created time.Time `json:"created"`
+}
+
+// versionStore keeps previous versions of files in the directory of the backend.
+// Versions of the file are stored in the directory with the same path as the file,
+// named by the time they were created.
+type versionStore struct {
+	backend fs.Backend
+	rootDir string
+}
+
+func newVersionStore(backend fs.Backend, rootDir string) *versionStore {
+	if rootDir == "" {
+		rootDir = defaultVersionsDir
+	}
+	return &versionStore{
+		backend: backend,
+		rootDir: rootDir,
+	}
+}
+
+// dirOf returns the directory keeping versions of the file
+func (v *versionStore) dirOf(filePath string) string {
+	return path.Join(v.rootDir, filePath)
+}
+
+func isVersionID(id string) bool {
+	_, err := strconv.ParseUint(id, 10, 64)
+	return err == nil
+}
+
+// keep saves the current content of the file as a new version,
+// nothing is done if the file does not exist or it is a directory
+func (v *versionStore) keep(filePath string) error {
+	info, err := v.backend.Stat(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if info.IsDir {
+		return nil
+	}
+	dir := v.dirOf(filePath)
+	if err := fs.MkdirAll(v.backend, dir, 0755); err != nil {
+		return err
+	}
+	id := strconv.FormatInt(time.Now().UnixNano(), 10)
+	return v.backend.Copy(filePath, path.Join(dir, id))
+}
+
+// move makes the versions of the file or all files in the directory follow it to newPath,
+// they are merged with the versions kept at newPath
+func (v *versionStore) move(oldPath, newPath string) error {
+	src, dest := v.dirOf(oldPath), v.dirOf(newPath)
+	if src == dest {
+		return nil
+	}
+	if ok, err := exists(v.backend, src); err != nil || !ok {
+		return err
+	}
+	return v.mergeDir(src, dest)
+}
+
+// mergeDir moves the directory src to dest, the contents are merged if dest exists
+func (v *versionStore) mergeDir(src, dest string) error {
+	info, err := v.backend.Stat(dest)
+	if os.IsNotExist(err) {
+		if err := fs.MkdirAll(v.backend, path.Dir(dest), 0755); err != nil {
+			return err
+		}
+		return v.backend.Rename(src, dest)
+	}
+	if err != nil {
+		return err
+	}
+	if !info.IsDir {
+		return v.backend.Rename(src, dest)
+	}
+	children, err := fs.ReadDir(v.backend, src)
+	if err != nil {
+		return err
+	}
+	for _, child := range children {
+		childSrc, childDest := path.Join(src, child.Name), path.Join(dest, child.Name)
+		if child.IsDir {
+			err = v.mergeDir(childSrc, childDest)
+		} else {
+			err = v.backend.Rename(childSrc, childDest)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return v.backend.RemoveAll(src)
+}
+
+// list returns versions of the file, the newest first
+func (v *versionStore) list(filePath string) ([]FileVersion, error) {
+	res := []FileVersion{}
+	dir, err := v.backend.TraverseDirectory(v.dirOf(filePath))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return res, nil
+		}
+		return res, err
+	}
+	for _, child := range dir.Children {
+		if child.IsDir || !isVersionID(child.Name) {
+			continue
+		}
+		nanos, _ := strconv.ParseInt(child.Name, 10, 64)
+		res = append(res, FileVersion{
+			ID:      child.Name,
+			Size:    child.Size,
+			Created: time.Unix(0, nanos).UTC(),
+		})
+	}
+	sortVersions(res)
+	return res, nil
+}
+
+func sortVersions(versions []FileVersion) {
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].Created.After(versions[j].Created)
+	})
+}
+
+// pathOf returns the path of the version of the file
+func (v *versionStore) pathOf(filePath, id string) (string, error) {
+	if !isVersionID(id) {
+		return "", ErrNotFound
+	}
+	p := path.Join(v.dirOf(filePath), id)
+	info, err := v.backend.Stat(p)
+	if err != nil || info.IsDir {
+		return "", ErrNotFound
+	}
+	return p, nil
+}
+
+// prune removes versions of all files in dirPath,
+// keeping at most keep newest versions of every file and removing versions older than maxAge.
+// Non-positive keep or maxAge disables the corresponding limit.
+// It returns the number of removed versions and their total size.
+func (v *versionStore) prune(dirPath string, keep int, maxAge time.Duration) (int, int64, error) {
+	tree, err := v.backend.TraverseDirectory(v.dirOf(dirPath))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, 0, nil
+		}
+		return 0, 0, err
+	}
+	return v.pruneTree(v.dirOf(dirPath), tree, keep, maxAge)
+}
+
+func (v *versionStore) pruneTree(dir string, tree fs.FileInfo, keep int, maxAge time.Duration) (int, int64, error) {
+	var pruned int
+	var freed int64
+	var versions []FileVersion
+	for _, child := range tree.Children {
+		if child.IsDir {
+			n, size, err := v.pruneTree(path.Join(dir, child.Name), child, keep, maxAge)
+			pruned += n
+			freed += size
+			if err != nil {
+				return pruned, freed, err
+			}
+			continue
+		}
+		if nanos, err := strconv.ParseInt(child.Name, 10, 64); err == nil {
+			versions = append(versions, FileVersion{ID: child.Name, Size: child.Size, Created: time.Unix(0, nanos)})
+		}
+	}
+	sortVersions(versions)
+	for i, version := range versions {
+		tooMany := keep > 0 && i >= keep
+		tooOld := maxAge > 0 && time.Since(version.Created) > maxAge
+		if !tooMany && !tooOld {
+			continue
+		}
+		if err := v.backend.RemoveAll(path.Join(dir, version.ID)); err != nil {
+			return pruned, freed, err
+		}
+		pruned++
+		freed += version.Size
+	}
+	return pruned, freed, nil
+}
+
+func (svc *service) ListVersions(ctx context.Context, dirPath, fileName string) ([]FileVersion, error) {
+	filePath, err := svc.resolvePath(ctx, dirPath, fileName)
+	if err != nil {
+		return []FileVersion{}, err
+	}
+
+	res, err := svc.versions.list(filePath)
+	if err != nil {
+		return res, getErrorType(err)
+	}
+	return res, nil
+}
+
+func (svc *service) DownloadVersion(ctx context.Context, dirPath, fileName, versionID string) (io.ReadCloser, fs.FileInfo, error) {
+	filePath, err := svc.resolvePath(ctx, dirPath, fileName)
+	if err != nil {
+		return nil, fs.FileInfo{}, err
+	}
+
+	versionPath, err := svc.versions.pathOf(filePath, versionID)
+	if err != nil {
+		return nil, fs.FileInfo{}, err
+	}
+	info, err := svc.backend.Stat(versionPath)
+	if err != nil {
+		return nil, info, getErrorType(err)
+	}
+	file, err := svc.backend.OpenFile(versionPath)
+	if err != nil {
+		return nil, info, getErrorType(err)
+	}
+	info.Name = fileName
+	return file, info, nil
+}
+
+// RestoreVersion replaces the content of the file with the version,
+// the replaced content is kept as a new version
+func (svc *service) RestoreVersion(ctx context.Context, dirPath, fileName, versionID string) (string, error) {
+	userInf := getUserInfFromCtx(ctx)
+	userRootDir := userInf.RootDir
+	filePath, err := svc.resolvePath(ctx, dirPath, fileName)
+	if err != nil {
+		return "", err
+	}
+
+	versionPath, err := svc.versions.pathOf(filePath, versionID)
+	if err != nil {
+		return "", err
+	}
+	versionSize, err := svc.sizeOf(versionPath)
+	if err != nil {
+		return "", getErrorType(err)
+	}
+	// the current content is kept as a version, so the restored content is added to the usage
+	quota, err := svc.quotaOf(ctx)
+	if err != nil {
+		return "", err
+	}
+	if err := svc.usage.check(userRootDir, quota, versionSize); err != nil {
+		return "", getErrorType(err)
+	}
+	if err := svc.versions.keep(filePath); err != nil {
+		return "", getErrorType(err)
+	}
+	if err := svc.backend.Copy(versionPath, filePath); err != nil {
+		return "", getErrorType(err)
+	}
+	svc.usage.add(userRootDir, versionSize)
+	svc.recordChange(ctx, ChangeModified, filePath, "")
+	return filePath, nil
+}
+
+// moveVersions makes the versions follow the moved file. Failing to move the versions
+// doesn't fail the move which is already done, the versions are left at the old path.
+func (svc *service) moveVersions(oldFilePath, newFilePath string) {
+	svc.versions.move(oldFilePath, newFilePath)
+}
+
+// PruneVersions removes old versions of all files of the user
+func (svc *service) PruneVersions(ctx context.Context, keep int, maxAge time.Duration) (int, error) {
+	userRootDir := getUserInfFromCtx(ctx).RootDir
+	if keep <= 0 && maxAge <= 0 {
+		return 0, ErrInvalidArgument
+	}
+	if strings.Trim(userRootDir, "/") == "" {
+		return 0, ErrInvalidArgument
+	}
+
+	pruned, freed, err := svc.versions.prune(userRootDir, keep, maxAge)
+	svc.usage.add(userRootDir, -freed)
+	if err != nil {
+		return pruned, getErrorType(err)
+	}
+	return pruned, nil
+}
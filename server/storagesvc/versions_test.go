@@ -0,0 +1,76 @@
+package storagesvc
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+// upload writes the file of the user replacing the existing one
+func upload(t *testing.T, svc *service, name, dirPath, fileName, contents string) {
+	t.Helper()
+	ctx := userContext(name)
+	_, err := svc.Upload(ctx, dirPath, fileName, io.NopCloser(strings.NewReader(contents)), Checksum{}, ConflictOverwrite)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func versionCount(t *testing.T, svc *service, dirPath, fileName string) int {
+	t.Helper()
+	versions, err := svc.ListVersions(userContext("alice"), dirPath, fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(versions)
+}
+
+func TestVersionsFollowRenamedFile(t *testing.T) {
+	svc := newTestService(t)
+	upload(t, svc, "alice", "", "a.txt", "one")
+	upload(t, svc, "alice", "", "a.txt", "two")
+
+	if _, err := svc.Rename(userContext("alice"), "", "a.txt", "b.txt", ConflictFail); err != nil {
+		t.Fatal(err)
+	}
+	if n := versionCount(t, svc, "", "b.txt"); n != 1 {
+		t.Fatalf("renamed file has %d versions, want 1", n)
+	}
+	if n := versionCount(t, svc, "", "a.txt"); n != 0 {
+		t.Fatalf("old path has %d versions, want 0", n)
+	}
+}
+
+func TestVersionsFollowMovedDirectory(t *testing.T) {
+	svc := newTestService(t)
+	ctx := userContext("alice")
+	for _, dir := range []string{"src", "dest"} {
+		if _, err := svc.MkDir(ctx, "", dir, ConflictFail); err != nil {
+			t.Fatal(err)
+		}
+	}
+	upload(t, svc, "alice", "src", "a.txt", "one")
+	upload(t, svc, "alice", "src", "a.txt", "two")
+
+	if _, err := svc.Move(ctx, "", "src", "dest", ConflictFail); err != nil {
+		t.Fatal(err)
+	}
+	if n := versionCount(t, svc, "dest/src", "a.txt"); n != 1 {
+		t.Fatalf("moved file has %d versions, want 1", n)
+	}
+}
+
+func TestVersionsAreMergedOnOverwrite(t *testing.T) {
+	svc := newTestService(t)
+	upload(t, svc, "alice", "", "a.txt", "one")
+	upload(t, svc, "alice", "", "a.txt", "two")
+	upload(t, svc, "alice", "", "b.txt", "three")
+
+	if _, err := svc.Rename(userContext("alice"), "", "a.txt", "b.txt", ConflictOverwrite); err != nil {
+		t.Fatal(err)
+	}
+	// the version of a.txt and the replaced content of b.txt
+	if n := versionCount(t, svc, "", "b.txt"); n != 2 {
+		t.Fatalf("file has %d versions, want 2", n)
+	}
+}
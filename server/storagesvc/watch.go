@@ -0,0 +1,57 @@
+package storagesvc
+
+import (
+	"context"
+	"time"
+)
+
+// watchPollInterval is the interval the journal is checked for the changes
+// made through other instances of the service, changes made through
+// this instance are sent right away
+const watchPollInterval = 2 * time.Second
+
+// Watch streams the changes made by the user after the token since until ctx is done.
+// The first page is sent right away and carries the token of the current state,
+// later pages are only sent when the user changes files.
+func (svc *service) Watch(ctx context.Context, since string) (<-chan Changes, error) {
+	userName := getUserInfFromCtx(ctx).Name
+	wake := svc.changes.waiter(userName)
+	changes, err := svc.GetChanges(ctx, since)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make(chan Changes)
+	go func() {
+		defer close(res)
+		ticker := time.NewTicker(watchPollInterval)
+		defer ticker.Stop()
+		first := true
+		for {
+			if first || len(changes.Changes) > 0 || changes.ResyncRequired {
+				select {
+				case res <- changes:
+				case <-ctx.Done():
+					return
+				}
+				first = false
+			}
+			if !changes.HasMore {
+				select {
+				case <-ctx.Done():
+					return
+				case <-wake:
+				case <-ticker.C:
+				}
+			}
+			wake = svc.changes.waiter(userName)
+			next, err := svc.GetChanges(ctx, changes.Token)
+			if err != nil {
+				svc.changes.logger.Log("Error:", "cannot get changes", "user", userName, "err", err)
+				next = Changes{Token: changes.Token}
+			}
+			changes = next
+		}
+	}()
+	return res, nil
+}